@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+var dryRun bool
+var minAge time.Duration
+
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Delete leftover resources from previous gathers",
+	Long: `Delete leftover resources from previous gathers.
+
+Gathering creates temporary resources such as agent pods in the gathered
+clusters. These resources are deleted when gathering completes, but if
+gathering crashed or was killed they may be left behind. This command finds
+these resources by label and deletes them.
+
+Resources created less than --min-age ago are skipped, since they may be
+used by a gather that is still running.`,
+	Example: `  # Delete leftover resources in clusters "dr1" and "dr2"
+  kubectl gather cleanup --contexts dr1,dr2
+
+  # Show leftover resources without deleting them
+  kubectl gather cleanup --contexts dr1,dr2 --dry-run
+
+  # Delete also resources created in the last hour, when no gather is running
+  kubectl gather cleanup --contexts dr1,dr2 --min-age 0`,
+	Args: cobra.NoArgs,
+	Run:  runCleanup,
+}
+
+func init() {
+	cleanupCmd.Flags().StringVar(&kubeconfig, "kubeconfig", "",
+		"the kubeconfig file to use, or a directory with a kubeconfig file per cluster")
+	cleanupCmd.Flags().StringSliceVar(&contexts, "contexts", nil,
+		"comma separated list of contexts to clean up")
+	cleanupCmd.Flags().BoolVar(&dryRun, "dry-run", false,
+		"show leftover resources without deleting them")
+	cleanupCmd.Flags().DurationVar(&minAge, "min-age", time.Hour,
+		"skip resources created less than this duration ago, which may be used by a running gather")
+	cleanupCmd.Flags().BoolVarP(&verbose, "verbose", "v", false,
+		"be more verbose")
+	cleanupCmd.Flags().StringVar(&logFormat, "log-format", "text",
+		"Set the logging format [text, json]")
+
+	rootCmd.AddCommand(cleanupCmd)
+}
+
+func runCleanup(cmd *cobra.Command, args []string) {
+	log = createConsoleLogger(verbose, logFormat)
+	defer func() {
+		_ = log.Sync()
+	}()
+
+	clusters, err := loadClusterConfigs(contexts, kubeconfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	wg := sync.WaitGroup{}
+	results := make(chan result, len(clusters))
+
+	for i := range clusters {
+		cluster := clusters[i]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			count, err := gather.Cleanup(cluster.Config, dryRun, minAge, log.Named(cluster.Context))
+			results <- result{Count: count, Err: err}
+		}()
+	}
+
+	wg.Wait()
+	close(results)
+
+	count := 0
+
+	for r := range results {
+		if r.Err != nil {
+			log.Fatal(r.Err)
+		}
+		count += r.Count
+	}
+
+	if dryRun {
+		log.Infof("Found %d leftover resources in %d clusters", count, len(clusters))
+	} else {
+		log.Infof("Deleted %d leftover resources in %d clusters", count, len(clusters))
+	}
+}
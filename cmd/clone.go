@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+var cloneNamespace string
+var cloneCluster string
+var cloneContext string
+var cloneStorageClasses map[string]string
+
+var cloneCmd = &cobra.Command{
+	Use:   "clone",
+	Short: "Clone a gathered namespace to another cluster",
+	Long: `Clone a gathered namespace to another cluster.
+
+Reconstructs a failing environment from a gather, for example in a lab
+cluster. The namespace resources are exported as manifests (see "export
+manifests") and applied in dependency order: the custom resource
+definitions of the custom resources in the namespace, the namespace,
+configuration (e.g. config maps, secrets, claims, roles, services), and
+the workloads. Storage classes of persistent volume claims and stateful
+sets can be mapped to the storage classes of the target cluster. Volumes
+data is not cloned.`,
+	Example: `  # Clone namespace "myapp" in gather.local/ to the cluster in context "lab"
+  kubectl gather clone -d gather.local -n myapp --to-context lab
+
+  # Clone mapping storage class "ocs-storagecluster-ceph-rbd" to "standard"
+  kubectl gather clone -d gather.local -n myapp --to-context lab \
+      --storage-class-map ocs-storagecluster-ceph-rbd=standard`,
+	Args: cobra.NoArgs,
+	Run:  runClone,
+}
+
+func init() {
+	cloneCmd.Flags().StringVarP(&directory, "directory", "d", "",
+		"gather directory")
+	cloneCmd.Flags().StringVarP(&cloneNamespace, "namespace", "n", "",
+		"namespace to clone")
+	cloneCmd.Flags().StringVar(&cloneCluster, "cluster", "",
+		"cluster directory name (required if the namespace was gathered in multiple clusters)")
+	cloneCmd.Flags().StringVar(&cloneContext, "to-context", "",
+		"kubeconfig context of the target cluster")
+	cloneCmd.Flags().StringVar(&kubeconfig, "kubeconfig", "",
+		"the kubeconfig file to use")
+	cloneCmd.Flags().StringToStringVar(&cloneStorageClasses, "storage-class-map", nil,
+		"map gathered storage classes to target cluster storage classes (e.g. old=new)")
+	cloneCmd.Flags().BoolVarP(&verbose, "verbose", "v", false,
+		"be more verbose")
+	cloneCmd.Flags().StringVar(&logFormat, "log-format", "text",
+		"Set the logging format [text, json]")
+
+	_ = cloneCmd.MarkFlagRequired("directory")
+	_ = cloneCmd.MarkFlagRequired("namespace")
+	_ = cloneCmd.MarkFlagRequired("to-context")
+
+	rootCmd.AddCommand(cloneCmd)
+}
+
+func runClone(cmd *cobra.Command, args []string) {
+	log = createConsoleLogger(verbose, logFormat)
+	defer func() {
+		_ = log.Sync()
+	}()
+
+	start := time.Now()
+
+	configs, err := loadClusterConfigs([]string{cloneContext}, kubeconfig)
+	if err != nil {
+		log.Fatalf("Cannot load context %q: %s", cloneContext, err)
+	}
+
+	opts := &gather.CloneOptions{
+		Cluster:        cloneCluster,
+		Namespace:      cloneNamespace,
+		StorageClasses: cloneStorageClasses,
+		Log:            log,
+	}
+
+	result, err := gather.Clone(directory, configs[0].Config, opts)
+	if result == nil {
+		log.Fatalf("Cannot clone namespace %q: %s", cloneNamespace, err)
+	}
+
+	log.Infof("Applied %d customresourcedefinitions (%d existing) and %d resources to context %q in %.3f seconds",
+		result.CRDs, result.ExistingCRDs, result.Resources, cloneContext, time.Since(start).Seconds())
+
+	if err != nil {
+		log.Fatalf("Namespace %q cloned partly: %s", cloneNamespace, err)
+	}
+}
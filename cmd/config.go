@@ -4,20 +4,123 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
 )
 
+// Timeout for checking if a cluster is reachable.
+const clusterCheckTimeout = 10 * time.Second
+
 type clusterConfig struct {
 	Config  *rest.Config
 	Context string
+
+	// Kubeconfig file and context name for running kubectl and oc commands.
+	// When using a kubeconfig directory, these are the file containing the
+	// cluster config and its current context.
+	Kubeconfig        string
+	KubeconfigContext string
+
+	// Namespaces and addons overriding the --namespaces and --addons flags
+	// for this cluster, if not nil.
+	Namespaces []string
+	Addons     []string
+}
+
+// Namespaces to gather in specific clusters, from --namespaces entries like
+// "hub=openshift-operators", keyed by cluster name.
+var clusterNamespaces map[string][]string
+
+// GatherNamespaces returns the namespaces to gather in this cluster.
+func (c *clusterConfig) GatherNamespaces() []string {
+	if c.Namespaces != nil {
+		return c.Namespaces
+	}
+	if scoped, ok := clusterNamespaces[c.Name()]; ok {
+		return append(slices.Clone(namespaces), scoped...)
+	}
+	return namespaces
+}
+
+// parseNamespaces splits --namespaces entries to namespaces gathered in all
+// clusters, and namespaces gathered in specific clusters ("cluster=namespace").
+func parseNamespaces(values []string) ([]string, map[string][]string, error) {
+	var global []string
+	var scoped map[string][]string
+
+	for _, value := range values {
+		cluster, namespace, found := strings.Cut(value, "=")
+		if !found {
+			global = append(global, value)
+			continue
+		}
+		if cluster == "" || namespace == "" {
+			return nil, nil, fmt.Errorf("invalid namespace %q: expected \"namespace\" or \"cluster=namespace\"", value)
+		}
+		if scoped == nil {
+			scoped = map[string][]string{}
+		}
+		scoped[cluster] = append(scoped[cluster], namespace)
+	}
+
+	return global, scoped, nil
+}
+
+// checkClusterNamespaces returns an error if --namespaces specifies namespaces
+// for unknown clusters, since the intended cluster would gather the wrong
+// namespaces.
+func checkClusterNamespaces(clusters []*clusterConfig) error {
+	var errs []error
+
+	for _, name := range slices.Sorted(maps.Keys(clusterNamespaces)) {
+		if !slices.ContainsFunc(clusters, func(c *clusterConfig) bool { return c.Name() == name }) {
+			errs = append(errs, fmt.Errorf("unknown cluster %q in --namespaces", name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// GatherAddons returns the addons to enable in this cluster.
+func (c *clusterConfig) GatherAddons() []string {
+	if c.Addons != nil {
+		return c.Addons
+	}
+	return addons
+}
+
+// kubeconfigFile is a cluster config in a kubeconfig directory.
+type kubeconfigFile struct {
+	Path    string
+	Context string
+	Config  *api.Config
+}
+
+// Name returns the cluster name for messages.
+func (c *clusterConfig) Name() string {
+	if c.Context == "" {
+		return "in-cluster"
+	}
+	return c.Context
 }
 
 func loadClusterConfigs(contexts []string, kubeconfig string) ([]*clusterConfig, error) {
+	if isDirectory(kubeconfig) {
+		return loadKubeconfigDirConfigs(contexts, kubeconfig)
+	}
+
 	if len(contexts) == 0 {
 		restConfig, err := rest.InClusterConfig()
 		if err != rest.ErrNotInCluster {
@@ -55,12 +158,126 @@ func loadClusterConfigs(contexts []string, kubeconfig string) ([]*clusterConfig,
 			return nil, err
 		}
 
-		configs = append(configs, &clusterConfig{Config: restConfig, Context: context})
+		configs = append(configs, &clusterConfig{
+			Config:            restConfig,
+			Context:           context,
+			Kubeconfig:        kubeconfig,
+			KubeconfigContext: context,
+		})
+	}
+
+	return configs, nil
+}
+
+// loadKubeconfigDirConfigs loads the cluster configs from a kubeconfig
+// directory. If contexts is empty, all clusters in the directory are used.
+func loadKubeconfigDirConfigs(contexts []string, dir string) ([]*clusterConfig, error) {
+	files, err := loadKubeconfigDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(contexts) == 0 {
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no kubeconfig found in %q", dir)
+		}
+
+		contexts = slices.Sorted(maps.Keys(files))
+		log.Infof("Using %d contexts from kubeconfig directory %q", len(contexts), dir)
+	} else {
+		log.Infof("Using kubeconfig directory %q", dir)
+	}
+
+	var configs []*clusterConfig
+
+	for _, context := range contexts {
+		file, ok := files[context]
+		if !ok {
+			return nil, fmt.Errorf("context %q not found in kubeconfig directory %q", context, dir)
+		}
+
+		restConfig, err := clientcmd.NewNonInteractiveClientConfig(
+			*file.Config, file.Context, nil, nil).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file.Path, err)
+		}
+
+		configs = append(configs, &clusterConfig{
+			Config:            restConfig,
+			Context:           context,
+			Kubeconfig:        file.Path,
+			KubeconfigContext: file.Context,
+		})
 	}
 
 	return configs, nil
 }
 
+// loadKubeconfigDir loads the kubeconfig files in dir, where every file
+// contains the config of one cluster. The cluster context name is the file
+// name without the extension (e.g. "dr1" for "dr1.yaml"). The file current
+// context is used, or the only context in the file if the current context is
+// not set. Hidden files and sub directories are ignored.
+func loadKubeconfigDir(dir string) (map[string]*kubeconfigFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]*kubeconfigFile{}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+
+		config, err := clientcmd.LoadFromFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		context, err := kubeconfigContext(config, path)
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if other, ok := files[name]; ok {
+			return nil, fmt.Errorf("context %q found in both %q and %q", name, other.Path, path)
+		}
+
+		files[name] = &kubeconfigFile{Path: path, Context: context, Config: config}
+	}
+
+	return files, nil
+}
+
+// kubeconfigContext returns the current context in a kubeconfig, or the only
+// context if the current context is not set.
+func kubeconfigContext(config *api.Config, path string) (string, error) {
+	if config.CurrentContext != "" {
+		return config.CurrentContext, nil
+	}
+	if len(config.Contexts) == 1 {
+		for name := range config.Contexts {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("%s: current context not set and %d contexts found",
+		path, len(config.Contexts))
+}
+
+// isDirectory returns true if path is an existing directory.
+func isDirectory(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
 func loadKubeconfig(kubeconfig string) (*api.Config, error) {
 	if kubeconfig == "" {
 		kubeconfig = defaultKubeconfig()
@@ -80,3 +297,66 @@ func defaultKubeconfig() string {
 	}
 	return clientcmd.RecommendedHomeFile
 }
+
+// checkClusters checks that all clusters are reachable before gathering, so
+// we fail fast with a clear error instead of timing out slowly during the
+// gather. If skipUnreachable is true, unreachable clusters are skipped and
+// the reachable clusters are returned. Fails if no cluster is reachable.
+func checkClusters(clusters []*clusterConfig, skipUnreachable bool) ([]*clusterConfig, error) {
+	wg := sync.WaitGroup{}
+	errs := make([]error, len(clusters))
+
+	for i := range clusters {
+		cluster := clusters[i]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			config := rest.CopyConfig(cluster.Config)
+			config.Timeout = clusterCheckTimeout
+
+			client, err := discovery.NewDiscoveryClientForConfig(config)
+			if err == nil {
+				_, err = client.ServerVersion()
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %s", cluster.Name(), err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	var reachable []*clusterConfig
+	var unreachable []error
+
+	for i, err := range errs {
+		if err != nil {
+			unreachable = append(unreachable, err)
+		} else {
+			reachable = append(reachable, clusters[i])
+		}
+	}
+
+	if len(unreachable) == 0 {
+		return clusters, nil
+	}
+
+	summary := errors.Join(unreachable...)
+
+	if len(reachable) == 0 {
+		return nil, fmt.Errorf("no cluster is reachable:\n%s", summary)
+	}
+
+	if !skipUnreachable {
+		return nil, fmt.Errorf("cannot reach %d of %d clusters (use --skip-unreachable to gather the reachable clusters):\n%s",
+			len(unreachable), len(clusters), summary)
+	}
+
+	for _, err := range unreachable {
+		log.Warnf("Skipping unreachable cluster %s", err)
+	}
+
+	return reachable, nil
+}
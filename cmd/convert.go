@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+var convertFrom string
+var convertCluster string
+
+var convertCmd = &cobra.Command{
+	Use:   "convert SRC",
+	Short: "Convert data gathered by other tools to the gather directory layout",
+	Long: `Convert data gathered by other tools to the gather directory layout.
+
+Converting existing archives allows using the commands working with gather
+directories (e.g. report, graph, export) on data gathered by other tools.
+Supported formats:
+
+  must-gather   a directory created by "oc adm must-gather". Resources and
+                container logs are converted, other files are ignored.`,
+	Example: `  # Convert must-gather.local.123/ to cluster "dr1" in gather.converted/
+  kubectl gather convert --from must-gather must-gather.local.123 -d gather.converted --cluster dr1`,
+	Args: cobra.ExactArgs(1),
+	Run:  runConvert,
+}
+
+func init() {
+	convertCmd.Flags().StringVar(&convertFrom, "from", "",
+		"format of the source directory [must-gather]")
+	convertCmd.Flags().StringVarP(&directory, "directory", "d", "",
+		"gather directory (default \"gather.{timestamp}\")")
+	convertCmd.Flags().StringVar(&convertCluster, "cluster", "",
+		"cluster directory name (default source directory name)")
+	convertCmd.Flags().BoolVarP(&verbose, "verbose", "v", false,
+		"be more verbose")
+	convertCmd.Flags().StringVar(&logFormat, "log-format", "text",
+		"Set the logging format [text, json]")
+
+	_ = convertCmd.MarkFlagRequired("from")
+
+	rootCmd.AddCommand(convertCmd)
+}
+
+func runConvert(cmd *cobra.Command, args []string) {
+	if convertFrom != "must-gather" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported format %q (supported formats: must-gather)\n", convertFrom)
+		os.Exit(1)
+	}
+
+	log = createConsoleLogger(verbose, logFormat)
+	defer func() {
+		_ = log.Sync()
+	}()
+
+	src := args[0]
+	start := time.Now()
+
+	if directory == "" {
+		directory = defaultGatherDirectory()
+	}
+
+	if convertCluster == "" {
+		convertCluster = filepath.Base(filepath.Clean(src))
+	}
+
+	dst := filepath.Join(directory, convertCluster)
+
+	// Converting to an existing cluster directory would mix unrelated data.
+	if _, err := os.Stat(dst); err == nil {
+		log.Fatalf("Cluster directory %q already exists", dst)
+	}
+
+	count, err := gather.ConvertMustGather(src, dst, log)
+	if err != nil {
+		log.Fatalf("Cannot convert %q: %s", src, err)
+	}
+
+	log.Infof("Converted %d resources from %q to %q in %.3f seconds",
+		count, src, dst, time.Since(start).Seconds())
+}
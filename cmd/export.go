@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+var exportOutput string
+var exportNamespace string
+var exportCluster string
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export a gather directory to other formats",
+}
+
+var exportSQLiteCmd = &cobra.Command{
+	Use:   "sqlite",
+	Short: "Export a gather directory to a SQLite database",
+	Long: `Export a gather directory to a SQLite database.
+
+The database includes a "resources" table with the gathered resources as
+JSON text and extracted columns (cluster, resource, kind, namespace, name,
+path, creation_timestamp, labels), and an "events" table. Use SQLite JSON
+functions to query the resources. Requires the "sqlite3" command.`,
+	Example: `  # Export gather.local/ to gather.db
+  kubectl gather export sqlite -d gather.local -o gather.db
+
+  # List all pods
+  sqlite3 gather.db "SELECT namespace, name FROM resources WHERE kind = 'Pod'"`,
+	Args: cobra.NoArgs,
+	Run:  runExportSQLite,
+}
+
+var exportManifestsCmd = &cobra.Command{
+	Use:   "manifests",
+	Short: "Export a gathered namespace as manifests",
+	Long: `Export a gathered namespace as manifests.
+
+The namespace and the resources in the namespace are exported as multi
+document YAML, suitable for "kubectl apply" on another cluster, for example
+to reproduce an issue in a lab. The status and fields assigned by the
+cluster (e.g. uid, resourceVersion, service cluster IP) are removed.
+Resources created by controllers (e.g. pods owned by a replica set) or by
+the cluster (e.g. events, endpoints) are not exported.`,
+	Example: `  # Export namespace "myapp" in gather.local/ to myapp.yaml
+  kubectl gather export manifests -d gather.local -n myapp -o myapp.yaml
+
+  # Apply the manifests of namespace "myapp" gathered in cluster "dr1"
+  kubectl gather export manifests -d gather.local -n myapp --cluster dr1 | kubectl apply -f -`,
+	Args: cobra.NoArgs,
+	Run:  runExportManifests,
+}
+
+func init() {
+	exportSQLiteCmd.Flags().StringVarP(&directory, "directory", "d", "",
+		"gather directory")
+	exportSQLiteCmd.Flags().StringVarP(&exportOutput, "output", "o", "",
+		"database file (must not exist)")
+	exportSQLiteCmd.Flags().BoolVarP(&verbose, "verbose", "v", false,
+		"be more verbose")
+	exportSQLiteCmd.Flags().StringVar(&logFormat, "log-format", "text",
+		"Set the logging format [text, json]")
+
+	_ = exportSQLiteCmd.MarkFlagRequired("directory")
+	_ = exportSQLiteCmd.MarkFlagRequired("output")
+
+	exportManifestsCmd.Flags().StringVarP(&directory, "directory", "d", "",
+		"gather directory")
+	exportManifestsCmd.Flags().StringVarP(&exportNamespace, "namespace", "n", "",
+		"namespace to export")
+	exportManifestsCmd.Flags().StringVar(&exportCluster, "cluster", "",
+		"cluster directory name (required if the namespace was gathered in multiple clusters)")
+	exportManifestsCmd.Flags().StringVarP(&exportOutput, "output", "o", "",
+		"manifests file (default stdout)")
+	exportManifestsCmd.Flags().BoolVarP(&verbose, "verbose", "v", false,
+		"be more verbose")
+	exportManifestsCmd.Flags().StringVar(&logFormat, "log-format", "text",
+		"Set the logging format [text, json]")
+
+	_ = exportManifestsCmd.MarkFlagRequired("directory")
+	_ = exportManifestsCmd.MarkFlagRequired("namespace")
+
+	exportCmd.AddCommand(exportSQLiteCmd)
+	exportCmd.AddCommand(exportManifestsCmd)
+	rootCmd.AddCommand(exportCmd)
+}
+
+func runExportSQLite(cmd *cobra.Command, args []string) {
+	log = createConsoleLogger(verbose, logFormat)
+	defer func() {
+		_ = log.Sync()
+	}()
+
+	start := time.Now()
+
+	// Adding to an existing database would mix unrelated gathers.
+	if _, err := os.Stat(exportOutput); err == nil {
+		log.Fatalf("Database %q already exists", exportOutput)
+	}
+
+	// Fail before reading the gather directory if we cannot load the data.
+	sqlite3, err := exec.LookPath("sqlite3")
+	if err != nil {
+		log.Fatal("Cannot export to sqlite: sqlite3 not found in PATH, please install sqlite3")
+	}
+
+	var stderr bytes.Buffer
+
+	sqlite := exec.Command(sqlite3, "-bail", exportOutput)
+	sqlite.Stderr = &stderr
+
+	stdin, err := sqlite.StdinPipe()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Debugf("Running command: %s", sqlite)
+	if err := sqlite.Start(); err != nil {
+		log.Fatalf("Cannot start sqlite3: %s", err)
+	}
+
+	count, exportErr := gather.ExportSQL(directory, stdin)
+	stdin.Close()
+
+	if err := sqlite.Wait(); err != nil {
+		os.Remove(exportOutput)
+		log.Fatalf("sqlite3 error: %s: %s", err, stderr.String())
+	}
+
+	if exportErr != nil {
+		os.Remove(exportOutput)
+		log.Fatalf("Cannot export %q: %s", directory, exportErr)
+	}
+
+	log.Infof("Exported %d resources to %q in %.3f seconds",
+		count, exportOutput, time.Since(start).Seconds())
+}
+
+func runExportManifests(cmd *cobra.Command, args []string) {
+	log = createConsoleLogger(verbose, logFormat)
+	defer func() {
+		_ = log.Sync()
+	}()
+
+	start := time.Now()
+
+	w := os.Stdout
+	if exportOutput != "" {
+		f, err := os.Create(exportOutput)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	count, err := gather.ExportManifests(directory, exportCluster, exportNamespace, w)
+	if err != nil {
+		if exportOutput != "" {
+			os.Remove(exportOutput)
+		}
+		log.Fatalf("Cannot export namespace %q: %s", exportNamespace, err)
+	}
+
+	log.Infof("Exported %d resources in namespace %q in %.3f seconds",
+		count, exportNamespace, time.Since(start).Seconds())
+}
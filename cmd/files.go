@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+var filesConfig string
+
+// filesConfigFile is a YAML file describing the files to copy from pods by the
+// files addon.
+type filesConfigFile struct {
+	Files []gather.FilesRule `json:"files"`
+}
+
+// readFilesConfig reads the files rules from the files config file.
+func readFilesConfig(path string) ([]gather.FilesRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &filesConfigFile{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("invalid files config %q: %s", path, err)
+	}
+
+	if len(config.Files) == 0 {
+		return nil, fmt.Errorf("invalid files config %q: no files rule", path)
+	}
+
+	return config.Files, nil
+}
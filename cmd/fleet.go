@@ -0,0 +1,349 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// Default key of the kubeconfig in a kubeconfig secret.
+const defaultSecretKey = "kubeconfig"
+
+var clustersFile string
+var clusterSelector string
+
+// Temporary directory for kubeconfigs read from secrets. kubectl commands run
+// by addons need a kubeconfig file.
+var secretKubeconfigsDir string
+
+// fleetInventory is a clusters.yaml file describing the clusters in a fleet.
+type fleetInventory struct {
+	Clusters []fleetCluster `json:"clusters"`
+}
+
+// fleetCluster describes a cluster in the fleet inventory.
+type fleetCluster struct {
+	// Name of the cluster, used for the cluster directory.
+	Name string `json:"name"`
+
+	// Kubeconfig file for accessing the cluster. Relative paths are relative
+	// to the inventory file. If both kubeconfig and secret are not set, the
+	// --kubeconfig or default kubeconfig is used.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+
+	// Secret containing the kubeconfig for accessing the cluster, in the
+	// cluster accessed by --kubeconfig (e.g. the hub cluster).
+	Secret *fleetSecret `json:"secret,omitempty"`
+
+	// Context in the kubeconfig. If not set, the kubeconfig current context is
+	// used, or the cluster name if using the --kubeconfig or default
+	// kubeconfig.
+	Context string `json:"context,omitempty"`
+
+	// Labels for selecting clusters with --cluster-selector.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Namespaces overriding --namespaces for this cluster.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Addons overriding --addons for this cluster. An empty list disables all
+	// addons.
+	Addons []string `json:"addons,omitempty"`
+}
+
+// fleetSecret is a reference to a kubeconfig secret.
+type fleetSecret struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Key       string `json:"key,omitempty"`
+}
+
+// readFleetInventory reads and validates the fleet inventory file.
+func readFleetInventory(path string) (*fleetInventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := &fleetInventory{}
+	if err := yaml.UnmarshalStrict(data, inventory); err != nil {
+		return nil, fmt.Errorf("invalid clusters file %q: %s", path, err)
+	}
+
+	if err := inventory.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid clusters file %q: %w", path, err)
+	}
+
+	// Make kubeconfig paths relative to the current directory.
+	base := filepath.Dir(path)
+	for i := range inventory.Clusters {
+		c := &inventory.Clusters[i]
+		if c.Kubeconfig != "" && !filepath.IsAbs(c.Kubeconfig) {
+			c.Kubeconfig = filepath.Join(base, c.Kubeconfig)
+		}
+	}
+
+	return inventory, nil
+}
+
+// Validate returns an error if the inventory is invalid.
+func (f *fleetInventory) Validate() error {
+	var errs []error
+
+	if len(f.Clusters) == 0 {
+		errs = append(errs, errors.New("no cluster found"))
+	}
+
+	seen := map[string]bool{}
+
+	for i, c := range f.Clusters {
+		switch {
+		case c.Name == "":
+			errs = append(errs, fmt.Errorf("cluster %d: name is required", i))
+		case c.Name == "." || c.Name == ".." || strings.ContainsAny(c.Name, `/\`):
+			errs = append(errs, fmt.Errorf("cluster %q: invalid name", c.Name))
+		case seen[c.Name]:
+			errs = append(errs, fmt.Errorf("cluster %q: duplicate name", c.Name))
+		}
+		seen[c.Name] = true
+
+		if c.Kubeconfig != "" && c.Secret != nil {
+			errs = append(errs, fmt.Errorf("cluster %q: kubeconfig and secret cannot be used together", c.Name))
+		}
+
+		if c.Secret != nil && (c.Secret.Namespace == "" || c.Secret.Name == "") {
+			errs = append(errs, fmt.Errorf("cluster %q: secret namespace and name are required", c.Name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Select returns the clusters matching names and selector. If names is empty,
+// all clusters matching the selector are returned.
+func (f *fleetInventory) Select(names []string, selector string) ([]fleetCluster, error) {
+	s, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster selector %q: %s", selector, err)
+	}
+
+	for _, name := range names {
+		if !slices.ContainsFunc(f.Clusters, func(c fleetCluster) bool { return c.Name == name }) {
+			return nil, fmt.Errorf("cluster %q not found", name)
+		}
+	}
+
+	var selected []fleetCluster
+
+	for _, c := range f.Clusters {
+		if len(names) > 0 && !slices.Contains(names, c.Name) {
+			continue
+		}
+		if !s.Matches(labels.Set(c.Labels)) {
+			continue
+		}
+		selected = append(selected, c)
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no cluster matches selector %q", selector)
+	}
+
+	return selected, nil
+}
+
+// loadFleetConfigs loads the configs of the clusters in the fleet inventory
+// matching names and selector.
+func loadFleetConfigs(path string, names []string, selector string) ([]*clusterConfig, error) {
+	inventory, err := readFleetInventory(path)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := inventory.Select(names, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Using %d of %d clusters from %q", len(selected), len(inventory.Clusters), path)
+
+	var configs []*clusterConfig
+
+	for _, c := range selected {
+		config, err := loadFleetCluster(c)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %q: %s", c.Name, err)
+		}
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+func loadFleetCluster(c fleetCluster) (*clusterConfig, error) {
+	path := c.Kubeconfig
+	context := c.Context
+
+	switch {
+	case c.Secret != nil:
+		var err error
+		path, err = writeSecretKubeconfig(c.Name, c.Secret)
+		if err != nil {
+			return nil, err
+		}
+	case path == "":
+		path = kubeconfig
+		if path == "" {
+			path = defaultKubeconfig()
+		}
+		if context == "" {
+			context = c.Name
+		}
+	}
+
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if context == "" {
+		context, err = kubeconfigContext(config, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	restConfig, err := clientcmd.NewNonInteractiveClientConfig(
+		*config, context, nil, nil).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &clusterConfig{
+		Config:            restConfig,
+		Context:           c.Name,
+		Kubeconfig:        path,
+		KubeconfigContext: context,
+		Namespaces:        c.Namespaces,
+		Addons:            c.Addons,
+	}, nil
+}
+
+// writeSecretKubeconfig reads a kubeconfig secret from the cluster accessed by
+// --kubeconfig, and writes it to a temporary file readable only by the user.
+func writeSecretKubeconfig(name string, secret *fleetSecret) (string, error) {
+	config, err := hubClientConfig().ClientConfig()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := readSecretKey(config, secret)
+	if err != nil {
+		return "", err
+	}
+
+	if secretKubeconfigsDir == "" {
+		dir, err := os.MkdirTemp("", "kubectl-gather-kubeconfigs-")
+		if err != nil {
+			return "", err
+		}
+		secretKubeconfigsDir = dir
+	}
+
+	path := filepath.Join(secretKubeconfigsDir, name+".yaml")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+func readSecretKey(config *rest.Config, ref *fleetSecret) ([]byte, error) {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := client.CoreV1().Secrets(ref.Namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	key := ref.Key
+	if key == "" {
+		key = defaultSecretKey
+	}
+
+	data, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("key %q not found in secret \"%s/%s\"", key, ref.Namespace, ref.Name)
+	}
+
+	return data, nil
+}
+
+// removeSecretKubeconfigs removes the kubeconfigs read from secrets.
+func removeSecretKubeconfigs() {
+	if secretKubeconfigsDir == "" {
+		return
+	}
+	if err := os.RemoveAll(secretKubeconfigsDir); err != nil {
+		log.Warnf("Cannot remove %q: %s", secretKubeconfigsDir, err)
+	}
+	secretKubeconfigsDir = ""
+}
+
+// validateFleetFlags validates the clusters file, and the gather options of
+// the selected clusters.
+func validateFleetFlags() error {
+	inventory, err := readFleetInventory(clustersFile)
+	if err != nil {
+		return err
+	}
+
+	selected, err := inventory.Select(contexts, clusterSelector)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, c := range selected {
+		if c.Namespaces == nil && c.Addons == nil {
+			continue
+		}
+
+		options, err := gatherOptions(kubeconfig, "")
+		if err != nil {
+			// Reported by validateGatherFlags.
+			return nil
+		}
+
+		if c.Namespaces != nil {
+			options.Namespaces = c.Namespaces
+		}
+		if c.Addons != nil {
+			options.Addons = c.Addons
+		}
+
+		if err := options.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("cluster %q: %w", c.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Generate dependency graphs for gathered namespaces",
+	Long: `Generate dependency graphs for gathered namespaces.
+
+The graph connects objects by owner references, persistent volume claims to
+persistent volumes and storage classes, pods to the config maps, secrets,
+service accounts and claims they use, and services to endpoints and pods.
+The graph is written to graph.json and graph.dot (graphviz) in every
+namespace directory.`,
+	Example: `  # Generate graphs for all clusters in gather.local/
+  kubectl gather graph -d gather.local
+
+  # Render the graph of namespace "my-ns" in cluster "dr1"
+  dot -Tsvg gather.local/dr1/namespaces/my-ns/graph.dot -o my-ns.svg`,
+	Args: cobra.NoArgs,
+	Run:  runGraph,
+}
+
+func init() {
+	graphCmd.Flags().StringVarP(&directory, "directory", "d", "",
+		"gather directory")
+	graphCmd.Flags().BoolVarP(&verbose, "verbose", "v", false,
+		"be more verbose")
+	graphCmd.Flags().StringVar(&logFormat, "log-format", "text",
+		"Set the logging format [text, json]")
+
+	_ = graphCmd.MarkFlagRequired("directory")
+
+	rootCmd.AddCommand(graphCmd)
+}
+
+func runGraph(cmd *cobra.Command, args []string) {
+	log = createConsoleLogger(verbose, logFormat)
+	defer func() {
+		_ = log.Sync()
+	}()
+
+	clusterDirs, err := gather.FindClusterDirs(directory)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(clusterDirs) == 0 {
+		log.Fatalf("No cluster directory found in %q", directory)
+	}
+
+	for _, clusterDir := range clusterDirs {
+		count, err := gather.WriteGraphs(clusterDir)
+		if err != nil {
+			log.Fatalf("Cannot generate graphs for %q: %s", clusterDir, err)
+		}
+		log.Infof("Generated %d graphs in %q", count, clusterDir)
+	}
+}
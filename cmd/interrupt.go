@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+// Time to wait for in-flight work after the gather was interrupted.
+const interruptGracePeriod = 30 * time.Second
+
+// interrupts keeps the functions to call when the gather is interrupted.
+var interrupts = struct {
+	mutex       sync.Mutex
+	once        sync.Once
+	interrupted bool
+	funcs       []func()
+}{}
+
+// handleInterrupts starts handling SIGINT and SIGTERM. On the first signal we
+// stop queuing new work, delete the agent pods, and wait for in-flight work up
+// to interruptGracePeriod. If the grace period expires or we get another
+// signal, we flush the logs and exit.
+func handleInterrupts() {
+	interrupts.once.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+		go func() {
+			sig := <-signals
+			log.Warnf("Received %s, stopping gather (waiting up to %s for in-flight work)",
+				sig, interruptGracePeriod)
+
+			interrupts.mutex.Lock()
+			interrupts.interrupted = true
+			funcs := interrupts.funcs
+			interrupts.mutex.Unlock()
+
+			for _, fn := range funcs {
+				fn()
+			}
+
+			gather.DeleteAgentPods()
+
+			select {
+			case sig := <-signals:
+				log.Warnf("Received %s, exiting", sig)
+			case <-time.After(interruptGracePeriod):
+				log.Warnf("Timeout waiting for in-flight work, exiting")
+			}
+
+			exitGather(1)
+		}()
+	})
+}
+
+// onInterrupt registers fn to be called when the gather is interrupted. If the
+// gather was already interrupted, fn is called immediately.
+func onInterrupt(fn func()) {
+	interrupts.mutex.Lock()
+	if !interrupts.interrupted {
+		interrupts.funcs = append(interrupts.funcs, fn)
+		interrupts.mutex.Unlock()
+		return
+	}
+	interrupts.mutex.Unlock()
+
+	fn()
+}
+
+// interrupted returns true if the gather was interrupted.
+func interrupted() bool {
+	interrupts.mutex.Lock()
+	defer interrupts.mutex.Unlock()
+	return interrupts.interrupted
+}
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+const lastRunName = "last.yaml"
+
+var again bool
+
+// Flags that can be used with --again. Other flags are taken from the last
+// run.
+var againFlags = []string{"again", "directory", "verbose", "log-format", "force"}
+
+// lastRun records the parameters of the last successful gather, so the user
+// can gather again with the same configuration.
+type lastRun struct {
+	// Time when the gather completed.
+	Time time.Time `json:"time"`
+
+	// Directory of the gather. Gathering again uses a new directory.
+	Directory string `json:"directory"`
+
+	// Flags specified by the user, excluding the directory.
+	Args []string `json:"args"`
+}
+
+// lastRunPath returns the path of the last run file.
+func lastRunPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "kubectl-gather", lastRunName), nil
+}
+
+// gatherArgs returns the flags specified by the user, excluding flags that
+// can be used with --again.
+func gatherArgs(flags *pflag.FlagSet) []string {
+	return changedFlagArgs(flags, againFlags)
+}
+
+// changedFlagArgs returns the flags specified by the user as arguments,
+// excluding flags in exclude.
+func changedFlagArgs(flags *pflag.FlagSet, exclude []string) []string {
+	var args []string
+	flags.Visit(func(f *pflag.Flag) {
+		if slices.Contains(exclude, f.Name) {
+			return
+		}
+		value := f.Value.String()
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			value = strings.Join(slice.GetSlice(), ",")
+		}
+		args = append(args, "--"+f.Name+"="+value)
+	})
+	return args
+}
+
+// loadLastRun sets the flags from the last successful gather. Only flags in
+// againFlags can be specified with --again.
+func loadLastRun(cmd *cobra.Command) error {
+	flags := cmd.Flags()
+
+	var extra []string
+	flags.Visit(func(f *pflag.Flag) {
+		if !slices.Contains(againFlags, f.Name) {
+			extra = append(extra, "--"+f.Name)
+		}
+	})
+	if len(extra) > 0 {
+		return fmt.Errorf("--again cannot be used with %s", strings.Join(extra, ", "))
+	}
+
+	path, err := lastRunPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return errors.New("no previous gather to repeat")
+		}
+		return err
+	}
+
+	var last lastRun
+	if err := yaml.Unmarshal(data, &last); err != nil {
+		return fmt.Errorf("invalid last run file %q: %s", path, err)
+	}
+
+	if err := flags.Parse(last.Args); err != nil {
+		return fmt.Errorf("invalid last run file %q: %s", path, err)
+	}
+
+	return nil
+}
+
+// saveLastRun records the flags of a successful gather. Failures are logged,
+// since the gather succeeded.
+func saveLastRun(args []string) {
+	path, err := lastRunPath()
+	if err != nil {
+		log.Debugf("Cannot record last run: %s", err)
+		return
+	}
+
+	last := lastRun{Time: time.Now(), Directory: directory, Args: args}
+	data, err := yaml.Marshal(&last)
+	if err != nil {
+		log.Debugf("Cannot record last run: %s", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		log.Debugf("Cannot record last run: %s", err)
+		return
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		log.Debugf("Cannot record last run: %s", err)
+	}
+}
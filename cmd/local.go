@@ -4,13 +4,19 @@
 package cmd
 
 import (
+	"cmp"
+	"maps"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/nirs/kubectl-gather/pkg/gather"
 )
 
+// Number of slowest resources logged when using --verbose.
+const slowestResources = 5
+
 type result struct {
 	Count int
 	Err   error
@@ -19,6 +25,8 @@ type result struct {
 func localGather(clusters []*clusterConfig) {
 	start := time.Now()
 
+	cacheDir := discoveryCacheDir()
+
 	wg := sync.WaitGroup{}
 	results := make(chan result, len(clusters))
 
@@ -34,14 +42,16 @@ func localGather(clusters []*clusterConfig) {
 
 		directory := filepath.Join(directory, cluster.Context)
 
-		options := gather.Options{
-			Kubeconfig: kubeconfig,
-			Context:    cluster.Context,
-			Namespaces: namespaces,
-			Addons:     addons,
-			Log:        log.Named(cluster.Context),
+		options, err := gatherOptions(cluster.Kubeconfig, cluster.KubeconfigContext)
+		if err != nil {
+			log.Fatal(err)
 		}
 
+		options.Namespaces = cluster.GatherNamespaces()
+		options.Addons = cluster.GatherAddons()
+		options.DiscoveryCacheDir = cacheDir
+		options.Log = log.Named(cluster.Context)
+
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -52,20 +62,25 @@ func localGather(clusters []*clusterConfig) {
 				return
 			}
 
+			onInterrupt(g.Interrupt)
+
 			err = g.Gather()
-			results <- result{Count: g.Count(), Err: err}
-			if err != nil {
+			stats := g.Stats()
+			results <- result{Count: stats.Resources, Err: err}
+			if err != nil || g.Interrupted() {
 				return
 			}
 
 			elapsed := time.Since(start).Seconds()
 			if cluster.Context != "" {
-				log.Infof("Gathered %d resources from cluster %q in %.3f seconds",
-					g.Count(), cluster.Context, elapsed)
+				log.Infof("Gathered %d resources (%s) from cluster %q in %.3f seconds",
+					stats.Resources, formatBytes(stats.Bytes), cluster.Context, elapsed)
 			} else {
-				log.Infof("Gathered %d resources on cluster in %.3f seconds",
-					g.Count(), elapsed)
+				log.Infof("Gathered %d resources (%s) on cluster in %.3f seconds",
+					stats.Resources, formatBytes(stats.Bytes), elapsed)
 			}
+
+			logStats(stats, options)
 		}()
 	}
 
@@ -74,6 +89,15 @@ func localGather(clusters []*clusterConfig) {
 
 	count := 0
 
+	if interrupted() {
+		for r := range results {
+			count += r.Count
+		}
+		log.Warnf("Gather interrupted, gathered %d resources from %d clusters in %.3f seconds",
+			count, len(clusters), time.Since(start).Seconds())
+		exitGather(1)
+	}
+
 	for r := range results {
 		if r.Err != nil {
 			log.Fatal(r.Err)
@@ -81,11 +105,124 @@ func localGather(clusters []*clusterConfig) {
 		count += r.Count
 	}
 
-	if len(namespaces) != 0 && count == 0 {
+	if count == 0 {
 		// Likely a user error like a wrong namespace.
-		log.Warnf("No resource gathered from namespaces %v", namespaces)
+		if len(namespaces) != 0 {
+			log.Warnf("No resource gathered from namespaces %v", namespaces)
+		} else if len(clusterNamespaces) != 0 {
+			log.Warnf("No resource gathered from namespaces %v", clusterNamespaces)
+		}
 	}
 
 	log.Infof("Gathered %d resources from %d clusters in %.3f seconds",
 		count, len(clusters), time.Since(start).Seconds())
 }
+
+// logStats logs problems and the slowest resources in a cluster gather.
+func logStats(stats gather.Stats, options gather.Options) {
+	if stats.Errors > 0 {
+		options.Log.Warnf("Recorded %d errors in %q", stats.Errors, "errors.yaml")
+		for _, kind := range slices.Sorted(maps.Keys(stats.ErrorKinds)) {
+			options.Log.Infof("Recorded %d %q errors", stats.ErrorKinds[kind], kind)
+		}
+	}
+	if stats.Warnings > 0 {
+		options.Log.Infof("Recorded %d API warnings in %q", stats.Warnings, "deprecations.txt")
+	}
+
+	names := slices.SortedFunc(maps.Keys(stats.ResourceTiming), func(a, b string) int {
+		return cmp.Compare(stats.ResourceTiming[b], stats.ResourceTiming[a])
+	})
+	for _, name := range names[:min(len(names), slowestResources)] {
+		options.Log.Debugf("Gathered %q in %.3f seconds", name, stats.ResourceTiming[name])
+	}
+
+	q := stats.Queue
+	options.Log.Debugf("Work queue: %d workers, %d completed, %d dropped, max %d pending",
+		q.Workers, q.Completed, q.Dropped, q.MaxPending)
+}
+
+// gatherOptions returns the gather options for context in kubeconfig.
+func gatherOptions(kubeconfig string, context string) (gather.Options, error) {
+	maxBytes, err := parseBytes("max-in-flight-bytes", maxInFlightBytes)
+	if err != nil {
+		return gather.Options{}, err
+	}
+
+	bandwidth, err := parseBytes("copy-bandwidth", copyBandwidth)
+	if err != nil {
+		return gather.Options{}, err
+	}
+
+	logBandwidth, err := parseBytes("log-bandwidth-limit", logBandwidthLimit)
+	if err != nil {
+		return gather.Options{}, err
+	}
+
+	maxObject, err := parseBytes("max-object-size", maxObjectSize)
+	if err != nil {
+		return gather.Options{}, err
+	}
+
+	binaryThreshold, err := parseBytes("binary-fields-threshold", binaryFieldsThreshold)
+	if err != nil {
+		return gather.Options{}, err
+	}
+
+	sinceTime, err := parseTime("since", since)
+	if err != nil {
+		return gather.Options{}, err
+	}
+
+	untilTime, err := parseTime("until", until)
+	if err != nil {
+		return gather.Options{}, err
+	}
+
+	var files []gather.FilesRule
+	if filesConfig != "" {
+		files, err = readFilesConfig(filesConfig)
+		if err != nil {
+			return gather.Options{}, err
+		}
+	}
+
+	return gather.Options{
+		Kubeconfig:            kubeconfig,
+		Context:               context,
+		Namespaces:            namespaces,
+		Addons:                addons,
+		MaxInFlightBytes:      maxBytes,
+		Protobuf:              protobuf,
+		DiscoveryCacheTTL:     discoveryCacheTTL,
+		SkipEmpty:             skipEmpty,
+		InventoryOnly:         inventoryOnly,
+		ClusterResources:      clusterResources,
+		MaxPerResource:        maxPerResource,
+		MaxObjectSize:         maxObject,
+		BinaryFields:          binaryFields,
+		BinaryFieldsThreshold: binaryThreshold,
+		AllVersions:           allVersions,
+		ShowAPIWarnings:       showAPIWarnings,
+		Resources:             resources,
+		Name:                  resourceName,
+		RookLogsSince:         rookLogsSince,
+		AddonTimeout:          addonTimeout,
+		Deterministic:         deterministic,
+		Append:                appendGather,
+		RequestLog:            requestLog,
+		DebugAPIDump:          debugAPIDump,
+		ReadOnly:              readOnly,
+		AllowAgents:           allowAgents,
+		CopyBandwidth:         bandwidth,
+		LogBandwidth:          logBandwidth,
+		LogsPerNode:           logsPerNode,
+		PartialMarkers:        partialMarkers,
+		RetryFailed:           retryFailed,
+		RawEndpoints:          rawEndpoints,
+		Files:                 files,
+		ByKind:                byKind,
+		Since:                 sinceTime,
+		Until:                 untilTime,
+	}, nil
+}
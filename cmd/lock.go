@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const lockName = ".gather.lock"
+
+// Lock on the gather directory, held until the gather completes.
+var gatherLock *directoryLock
+
+// lockOwner describes the process holding the gather directory lock.
+type lockOwner struct {
+	PID  int    `json:"pid"`
+	Host string `json:"host"`
+}
+
+// directoryLock is an advisory lock preventing concurrent gathers writing to
+// the same gather directory. The lock is a file created exclusively in the
+// gather directory, recording the process holding the lock. If the program
+// terminates without releasing the lock, the next gather on the same host
+// detects that the owner is not running and removes the stale lock. A lock
+// held by a process on another host cannot be checked, and is removed only if
+// force is set.
+type directoryLock struct {
+	path string
+}
+
+// lockDirectory creates directory if needed and locks it. Fails if another
+// gather holds the lock, unless force is set and the owner is on another host.
+func lockDirectory(directory string, force bool) (*directoryLock, error) {
+	if err := os.MkdirAll(directory, 0750); err != nil {
+		return nil, err
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &directoryLock{path: filepath.Join(directory, lockName)}
+	self := lockOwner{PID: os.Getpid(), Host: host}
+
+	for {
+		err := l.create(self)
+		if err == nil {
+			return l, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		owner, err := l.owner()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// Released after we tried to create it.
+				continue
+			}
+			return nil, fmt.Errorf("directory %q is locked by another gather (remove %q if no other gather is running): %s",
+				directory, l.path, err)
+		}
+
+		switch {
+		case owner.Host == host && processRunning(owner.PID):
+			return nil, fmt.Errorf("directory %q is used by another gather (pid %d on host %q), use another --directory",
+				directory, owner.PID, owner.Host)
+		case owner.Host == host:
+			log.Warnf("Removing stale lock %q (pid %d is not running)", l.path, owner.PID)
+		case !force:
+			return nil, fmt.Errorf("directory %q is used by another gather (pid %d on host %q), use another --directory, or --force if that gather is not running",
+				directory, owner.PID, owner.Host)
+		default:
+			log.Warnf("Removing lock %q (pid %d on host %q)", l.path, owner.PID, owner.Host)
+		}
+
+		if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+}
+
+// Release removes the lock. Does nothing if l is nil.
+func (l *directoryLock) Release() {
+	if l == nil {
+		return
+	}
+	if err := os.Remove(l.path); err != nil {
+		log.Warnf("Cannot remove lock %q: %s", l.path, err)
+	}
+}
+
+func (l *directoryLock) create(owner lockOwner) error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(f).Encode(owner); err != nil {
+		f.Close()
+		os.Remove(l.path)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(l.path)
+		return err
+	}
+
+	return nil
+}
+
+func (l *directoryLock) owner() (*lockOwner, error) {
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := &lockOwner{}
+	if err := json.Unmarshal(data, owner); err != nil {
+		return nil, err
+	}
+
+	return owner, nil
+}
+
+// processRunning returns true if process pid is running on this host. On
+// Windows finding the process fails if it is not running.
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return !errors.Is(err, os.ErrProcessDone)
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// logFile keeps logs in memory until the log file is created. This allows
+// logging before we know that we can gather anything, without creating an
+// empty gather directory when we fail.
+type logFile struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+	file   *os.File
+	closed bool
+}
+
+// Create creates the log file in directory, writing the logs kept in memory.
+// If append is true, logs are appended to an existing log file.
+func (l *logFile) Create(directory string, append bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err := os.MkdirAll(directory, 0750); err != nil {
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+
+	file, err := os.OpenFile(filepath.Join(directory, "gather.log"), flags, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err := l.buffer.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file = file
+	return nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return len(p), nil
+	}
+	if l.file == nil {
+		return l.buffer.Write(p)
+	}
+	return l.file.Write(p)
+}
+
+func (l *logFile) Sync() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Sync()
+}
+
+// Close closes the log file. Logs written after closing are logged only to the
+// console.
+func (l *logFile) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.closed = true
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
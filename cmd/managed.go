@@ -0,0 +1,234 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// The managed cluster representing the hub itself.
+const localClusterName = "local-cluster"
+
+// Secret created by the hub when importing a cluster.
+const autoImportSecretName = "auto-import-secret"
+
+var managedKubeconfigs bool
+var assumeYes bool
+
+var managedClustersResource = schema.GroupVersionResource{
+	Group:    "cluster.open-cluster-management.io",
+	Version:  "v1",
+	Resource: "managedclusters",
+}
+
+var clusterDeploymentsResource = schema.GroupVersionResource{
+	Group:    "hive.openshift.io",
+	Version:  "v1",
+	Resource: "clusterdeployments",
+}
+
+// hubClientConfig returns the client config for the cluster accessed by
+// --kubeconfig, using the current context or in-cluster config.
+func hubClientConfig() clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{})
+}
+
+// loadManagedConfigs loads the configs of the clusters managed by the hub
+// matching names and selector, using the managed clusters admin kubeconfigs
+// stored in secrets on the hub. The hub is included if it is managed as
+// "local-cluster".
+func loadManagedConfigs(names []string, selector string) ([]*clusterConfig, error) {
+	hubConfig := hubClientConfig()
+
+	hub, err := hubConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	inventory, err := managedInventory(hub)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := inventory.Select(names, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var managed []fleetCluster
+	var local *fleetCluster
+
+	for i := range selected {
+		c := &selected[i]
+		switch {
+		case c.Name == localClusterName:
+			local = c
+		case c.Secret == nil:
+			log.Warnf("Skipping managed cluster %q: admin kubeconfig secret not found", c.Name)
+		default:
+			managed = append(managed, *c)
+		}
+	}
+
+	if err := confirmManagedKubeconfigs(managed); err != nil {
+		return nil, err
+	}
+
+	var configs []*clusterConfig
+
+	if local != nil {
+		raw, err := hubConfig.RawConfig()
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, &clusterConfig{
+			Config:            hub,
+			Context:           localClusterName,
+			Kubeconfig:        kubeconfig,
+			KubeconfigContext: raw.CurrentContext,
+		})
+	}
+
+	for _, c := range managed {
+		config, err := loadFleetCluster(c)
+		if err != nil {
+			return nil, fmt.Errorf("managed cluster %q: %s", c.Name, err)
+		}
+		configs = append(configs, config)
+	}
+
+	if len(configs) == 0 {
+		return nil, errors.New("no managed cluster kubeconfig found")
+	}
+
+	log.Infof("Using %d managed clusters", len(configs))
+
+	return configs, nil
+}
+
+// managedInventory returns a fleet inventory describing the managed clusters,
+// with references to the managed clusters admin kubeconfig secrets. Clusters
+// without a known admin kubeconfig secret have no secret.
+func managedInventory(hub *rest.Config) (*fleetInventory, error) {
+	dynamicClient, err := dynamic.NewForConfig(hub)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubernetes.NewForConfig(hub)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := dynamicClient.Resource(managedClustersResource).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, errors.New("managed clusters not found, is this a hub cluster?")
+		}
+		return nil, err
+	}
+
+	inventory := &fleetInventory{}
+
+	for i := range list.Items {
+		name := list.Items[i].GetName()
+		c := fleetCluster{Name: name, Labels: list.Items[i].GetLabels()}
+
+		if name != localClusterName {
+			c.Secret, err = findAdminKubeconfig(dynamicClient, client, name)
+			if err != nil {
+				return nil, fmt.Errorf("managed cluster %q: %s", name, err)
+			}
+		}
+
+		inventory.Clusters = append(inventory.Clusters, c)
+	}
+
+	if len(inventory.Clusters) == 0 {
+		return nil, errors.New("no managed cluster found")
+	}
+
+	return inventory, nil
+}
+
+// findAdminKubeconfig looks up the admin kubeconfig secret of a managed
+// cluster in the managed cluster namespace. Clusters provisioned by the hub
+// have a cluster deployment referencing the admin kubeconfig secret. Imported
+// clusters may keep the kubeconfig used for importing the cluster in the auto
+// import secret. Returns nil if no secret was found.
+func findAdminKubeconfig(dynamicClient dynamic.Interface, client kubernetes.Interface, name string) (*fleetSecret, error) {
+	cd, err := dynamicClient.Resource(clusterDeploymentsResource).Namespace(name).
+		Get(context.TODO(), name, metav1.GetOptions{})
+	if err == nil {
+		secretName, _, _ := unstructured.NestedString(cd.Object,
+			"spec", "clusterMetadata", "adminKubeconfigSecretRef", "name")
+		if secretName != "" {
+			return &fleetSecret{Namespace: name, Name: secretName, Key: defaultSecretKey}, nil
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	secret, err := client.CoreV1().Secrets(name).Get(context.TODO(), autoImportSecretName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// The auto import secret may contain a token and server instead.
+	if _, ok := secret.Data[defaultSecretKey]; !ok {
+		return nil, nil
+	}
+
+	return &fleetSecret{Namespace: name, Name: autoImportSecretName, Key: defaultSecretKey}, nil
+}
+
+// confirmManagedKubeconfigs asks the user to confirm reading the managed
+// clusters admin kubeconfigs. The admin kubeconfigs grant full access to the
+// managed clusters, so we never read them without explicit confirmation.
+func confirmManagedKubeconfigs(clusters []fleetCluster) error {
+	if len(clusters) == 0 || assumeYes {
+		return nil
+	}
+
+	if !isTerminal(os.Stdin) {
+		return errors.New("reading managed clusters admin kubeconfigs requires confirmation, use --yes to confirm")
+	}
+
+	fmt.Fprintf(os.Stderr, "Reading admin kubeconfigs of %d managed clusters from the hub:\n", len(clusters))
+	for _, c := range clusters {
+		fmt.Fprintf(os.Stderr, "  %s: secret \"%s/%s\"\n", c.Name, c.Secret.Namespace, c.Secret.Name)
+	}
+	fmt.Fprint(os.Stderr, "Continue? [y/N] ")
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	default:
+		return errors.New("reading managed clusters admin kubeconfigs not confirmed")
+	}
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/rest"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+	"github.com/nirs/kubectl-gather/pkg/operator"
+)
+
+var operatorImage string
+var operatorServiceAccount string
+var operatorNamespace string
+
+var operatorCmd = &cobra.Command{
+	Use:   "operator",
+	Short: "Run the gather operator in the cluster",
+	Long: `Run the gather operator in the cluster.
+
+The operator reconciles Gather resources by running a gather job for every
+Gather resource, storing the gathered data in the destination specified in the
+Gather spec. Install the CRD and operator deployment from config/operator.yaml.`,
+	Args: cobra.NoArgs,
+	Run:  runOperator,
+}
+
+func init() {
+	operatorCmd.Flags().StringVar(&operatorImage, "image", gather.Image,
+		"image used to run gather jobs")
+	operatorCmd.Flags().StringVar(&operatorServiceAccount, "service-account", "kubectl-gather",
+		"service account used to run gather jobs")
+	operatorCmd.Flags().StringVar(&operatorNamespace, "watch-namespace", "",
+		"if specified, watch only Gather resources in this namespace")
+	operatorCmd.Flags().BoolVarP(&verbose, "verbose", "v", false,
+		"be more verbose")
+	operatorCmd.Flags().StringVar(&logFormat, "log-format", "text",
+		"Set the logging format [text, json]")
+
+	rootCmd.AddCommand(operatorCmd)
+}
+
+func runOperator(cmd *cobra.Command, args []string) {
+	log = createConsoleLogger(verbose, logFormat)
+	defer func() {
+		_ = log.Sync()
+	}()
+
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		log.Fatalf("Cannot get in cluster config: %s", err)
+	}
+
+	op, err := operator.New(config, operator.Options{
+		Image:          operatorImage,
+		ServiceAccount: operatorServiceAccount,
+		Namespace:      operatorNamespace,
+		Log:            log.Named("operator"),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := op.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+// Write the gather archive to stdout.
+const stdoutOutput = "-"
+
+var output string
+
+// Temporary directory holding the gather until it is written to the output
+// archive.
+var outputTempDir string
+
+// prepareOutput moves the gather directory to a new temporary directory when
+// writing the gather to an archive. The archive top directory is named like
+// the gather directory, so extracting the archive creates the same directory
+// as a normal gather.
+func prepareOutput() error {
+	if output == "" {
+		return nil
+	}
+
+	tmp, err := os.MkdirTemp("", "kubectl-gather-")
+	if err != nil {
+		return err
+	}
+
+	outputTempDir = tmp
+	directory = filepath.Join(tmp, filepath.Base(directory))
+	return nil
+}
+
+// writeOutput writes the gather directory to the output archive and removes
+// the temporary directory. If writing the archive fails the temporary
+// directory is kept, so the gathered data is not lost.
+func writeOutput() {
+	if outputTempDir == "" {
+		return
+	}
+
+	start := time.Now()
+
+	// The archive must not include logs written while archiving.
+	if err := gatherLogFile.Close(); err != nil {
+		log.Warnf("Cannot close log file: %s", err)
+	}
+
+	if err := writeArchive(); err != nil {
+		log.Errorf("Cannot write archive: %s (gathered data kept in %q)", err, directory)
+		_ = log.Sync()
+		os.Exit(1)
+	}
+
+	if err := os.RemoveAll(outputTempDir); err != nil {
+		log.Warnf("Cannot remove temporary directory %q: %s", outputTempDir, err)
+	}
+
+	if output == stdoutOutput {
+		log.Infof("Wrote archive to stdout in %.3f seconds", time.Since(start).Seconds())
+	} else {
+		log.Infof("Wrote archive %q in %.3f seconds", output, time.Since(start).Seconds())
+	}
+}
+
+func writeArchive() error {
+	var dst io.WriteCloser = os.Stdout
+
+	if output != stdoutOutput {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		dst = f
+	}
+
+	if err := gather.WriteArchive(directory, filepath.Base(directory), dst); err != nil {
+		if dst != os.Stdout {
+			dst.Close()
+			os.Remove(output)
+		}
+		return err
+	}
+
+	if dst != os.Stdout {
+		return dst.Close()
+	}
+
+	return nil
+}
+
+// isTerminal returns true if f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
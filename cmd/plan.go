@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+var planFormat string
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show what a gather will do",
+	Long: `Show what a gather will do.
+
+Resolve the clusters, namespaces, resource types and addons for the gather
+flags, and estimate the number of items of every resource type, without
+gathering anything. The plan is written to stdout, so other tools can
+validate and record a gather before running it.`,
+	Example: `  # Show the plan for gathering namespace "my-app" in clusters "dr1" and "dr2"
+  kubectl gather plan --contexts dr1,dr2 -n my-app
+
+  # Show the plan in YAML format
+  kubectl gather plan --contexts dr1,dr2 -n my-app -o yaml`,
+	Args: cobra.NoArgs,
+	Run:  runPlan,
+}
+
+// gatherPlan describes the gather of all clusters.
+type gatherPlan struct {
+	Remote   bool          `json:"remote"`
+	Clusters []clusterPlan `json:"clusters"`
+}
+
+// clusterPlan describes the gather of a single cluster.
+type clusterPlan struct {
+	Name string `json:"name"`
+	*gather.Plan
+}
+
+func init() {
+	// The --output flag selects the plan format instead of the archive.
+	flags := pflag.NewFlagSet("gather", pflag.ContinueOnError)
+	addGatherFlags(flags)
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Name != "output" {
+			planCmd.Flags().AddFlag(f)
+		}
+	})
+
+	planCmd.Flags().StringVarP(&planFormat, "output", "o", "json",
+		"plan format [json, yaml]")
+
+	rootCmd.AddCommand(planCmd)
+}
+
+func runPlan(cmd *cobra.Command, args []string) {
+	if planFormat != "json" && planFormat != "yaml" {
+		fmt.Fprintf(os.Stderr, "Error: invalid output format %q (expected \"json\" or \"yaml\")\n", planFormat)
+		os.Exit(1)
+	}
+
+	if err := validateGatherFlags(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	log = createConsoleLogger(verbose, logFormat)
+	defer func() {
+		removeSecretKubeconfigs()
+		_ = log.Sync()
+	}()
+
+	clusters, err := loadClusters()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	clusters, err = checkClusters(clusters, skipUnreachable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	plan := gatherPlan{Remote: remote}
+
+	for _, cluster := range clusters {
+		options, err := gatherOptions(cluster.Kubeconfig, cluster.KubeconfigContext)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		options.Namespaces = cluster.GatherNamespaces()
+		options.Addons = cluster.GatherAddons()
+		options.Log = log.Named(cluster.Name())
+
+		// Planning must not write anything.
+		options.RequestLog = false
+		options.Append = false
+
+		g, err := gather.New(cluster.Config, "", options)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		clusterPlan := clusterPlan{Name: cluster.Name()}
+		clusterPlan.Plan, err = g.Plan()
+		if err != nil {
+			log.Fatalf("Cannot plan cluster %q: %s", cluster.Name(), err)
+		}
+
+		plan.Clusters = append(plan.Clusters, clusterPlan)
+	}
+
+	var data []byte
+	if planFormat == "yaml" {
+		data, err = yaml.Marshal(&plan)
+	} else {
+		data, err = json.MarshalIndent(&plan, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err := os.Stdout.Write(data); err != nil {
+		log.Fatal(err)
+	}
+}
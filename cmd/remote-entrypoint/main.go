@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+// The remote-entrypoint command is the entrypoint of the gather image, invoked
+// by "oc adm must-gather". It runs kubectl-gather in the same process with
+// the same arguments, storing the data in the must-gather directory, so remote
+// gathering supports exactly the same flags as local gathering.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nirs/kubectl-gather/cmd"
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+// The directory copied by must-gather to the local directory.
+const base = "/must-gather"
+
+func main() {
+	if err := os.MkdirAll(base, 0750); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot create %q: %s\n", base, err)
+		os.Exit(1)
+	}
+
+	// Used by must-gather to report the image version.
+	version := fmt.Sprintf("gather\n%s\n", gather.Version)
+	if err := os.WriteFile(filepath.Join(base, "version"), []byte(version), 0640); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot write version: %s\n", err)
+		os.Exit(1)
+	}
+
+	// Flags may be specified after a sub command (e.g. "resource pods"), so
+	// we must add the directory last.
+	args := append(os.Args[1:], "--directory="+base)
+	cmd.ExecuteArgs(args)
+}
@@ -9,15 +9,19 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/spf13/pflag"
+
 	"github.com/nirs/kubectl-gather/pkg/gather"
 )
 
-func remoteGather(clusters []*clusterConfig) {
+func remoteGather(clusters []*clusterConfig, flags *pflag.FlagSet) {
 	start := time.Now()
+	flagArgs := remoteFlagArgs(flags)
 
 	wg := sync.WaitGroup{}
 	errors := make(chan error, len(clusters))
@@ -29,7 +33,7 @@ func remoteGather(clusters []*clusterConfig) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := runMustGather(cluster.Context, directory); err != nil {
+			if err := runMustGather(cluster, directory, flagArgs); err != nil {
 				errors <- err
 			}
 		}()
@@ -46,7 +50,8 @@ func remoteGather(clusters []*clusterConfig) {
 		len(clusters), time.Since(start).Seconds())
 }
 
-func runMustGather(context string, directory string) error {
+func runMustGather(cluster *clusterConfig, directory string, flagArgs []string) error {
+	context := cluster.Context
 	log.Infof("Gathering on remote cluster %q", context)
 	start := time.Now()
 
@@ -59,12 +64,24 @@ func runMustGather(context string, directory string) error {
 
 	var stderr bytes.Buffer
 
-	cmd := mustGatherCommand(context, directory)
+	cmd := mustGatherCommand(cluster, directory, flagArgs)
 	cmd.Stdout = logfile
 	cmd.Stderr = &stderr
 
 	log.Debugf("Running command: %s", cmd)
-	if err := cmd.Run(); err != nil {
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("cannot start oc adm must-gather: %s", err)
+	}
+
+	// Let must-gather clean up the remote cluster when interrupted.
+	onInterrupt(func() {
+		_ = cmd.Process.Signal(os.Interrupt)
+	})
+
+	if err := cmd.Wait(); err != nil {
+		if interrupted() {
+			return fmt.Errorf("gather on remote cluster %q interrupted", context)
+		}
 		return fmt.Errorf("oc adm must-gather error: %s: %s", err, stderr.String())
 	}
 
@@ -83,28 +100,82 @@ func createMustGatherLog(directory string) (*os.File, error) {
 	return os.Create(filepath.Join(directory, "must-gather.log"))
 }
 
-func mustGatherCommand(context string, directory string) *exec.Cmd {
+// Flags not forwarded to the remote gather. The flags select the clusters and
+// the local gather directory, are handled by the local command, or are
+// converted for every cluster by mustGatherCommand.
+var localFlags = []string{
+	// Local gather.
+	"remote",
+	"directory",
+	"kubeconfig",
+	"output",
+	"again",
+	"force",
+	"yes",
+
+	// Clusters selection.
+	"contexts",
+	"clusters",
+	"cluster-selector",
+	"managed-kubeconfig-from-secrets",
+	"skip-unreachable",
+
+	// Trigger command.
+	"on-event",
+	"on-pod-phase",
+
+	// Converted for every cluster.
+	"namespaces",
+	"addons",
+	"since",
+	"until",
+}
+
+// remoteFlagArgs returns the flags specified by the user forwarded to the
+// remote gather.
+func remoteFlagArgs(flags *pflag.FlagSet) []string {
+	return changedFlagArgs(flags, localFlags)
+}
+
+func mustGatherCommand(cluster *clusterConfig, directory string, flagArgs []string) *exec.Cmd {
 	args := []string{
 		"adm",
 		"must-gather",
 		"--image=" + gather.Image,
-		"--context=" + context,
+		"--context=" + cluster.KubeconfigContext,
 		"--dest-dir=" + directory,
 	}
-	if kubeconfig != "" {
-		args = append(args, "--kubeconfig="+kubeconfig)
+	if cluster.Kubeconfig != "" {
+		args = append(args, "--kubeconfig="+cluster.Kubeconfig)
 	}
 
-	var remoteArgs []string
+	remoteArgs := slices.Clone(flagArgs)
 
-	if len(namespaces) > 0 {
+	if namespaces := cluster.GatherNamespaces(); len(namespaces) > 0 {
 		remoteArgs = append(remoteArgs, "--namespaces="+strings.Join(namespaces, ","))
 	}
 
-	if addons != nil {
+	if addons := cluster.GatherAddons(); addons != nil {
 		remoteArgs = append(remoteArgs, "--addons="+strings.Join(addons, ","))
 	}
 
+	// Pass absolute times so all clusters use the same time window.
+	if t, err := parseTime("since", since); err == nil && !t.IsZero() {
+		remoteArgs = append(remoteArgs, "--since="+t.Format(time.RFC3339))
+	}
+
+	if t, err := parseTime("until", until); err == nil && !t.IsZero() {
+		remoteArgs = append(remoteArgs, "--until="+t.Format(time.RFC3339))
+	}
+
+	if len(resources) > 0 {
+		arg := resources[0]
+		if resourceName != "" {
+			arg += "/" + resourceName
+		}
+		remoteArgs = append([]string{"resource", arg}, remoteArgs...)
+	}
+
 	if len(remoteArgs) > 0 {
 		args = append(args, "--", "/usr/bin/gather")
 		args = append(args, remoteArgs...)
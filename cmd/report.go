@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+var reportOutput string
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Generate an HTML report for a gather directory",
+	Long: `Generate an HTML report for a gather directory.
+
+The report is a static HTML page including a summary of the gathered
+clusters, findings from the gather reports, workloads per namespace, and
+an events timeline. The report can be attached to tickets and viewed in
+any browser.`,
+	Example: `  # Generate gather.local/report.html
+  kubectl gather report -d gather.local
+
+  # Generate the report in another location
+  kubectl gather report -d gather.local -o /tmp/report.html`,
+	Args: cobra.NoArgs,
+	Run:  runReport,
+}
+
+func init() {
+	reportCmd.Flags().StringVarP(&directory, "directory", "d", "",
+		"gather directory")
+	reportCmd.Flags().StringVarP(&reportOutput, "output", "o", "",
+		"report file (default \"{directory}/report.html\")")
+	reportCmd.Flags().BoolVarP(&verbose, "verbose", "v", false,
+		"be more verbose")
+	reportCmd.Flags().StringVar(&logFormat, "log-format", "text",
+		"Set the logging format [text, json]")
+
+	_ = reportCmd.MarkFlagRequired("directory")
+
+	rootCmd.AddCommand(reportCmd)
+}
+
+func runReport(cmd *cobra.Command, args []string) {
+	log = createConsoleLogger(verbose, logFormat)
+	defer func() {
+		_ = log.Sync()
+	}()
+
+	if reportOutput == "" {
+		reportOutput = filepath.Join(directory, "report.html")
+	}
+
+	report, err := gather.NewReport(directory)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dst, err := os.Create(reportOutput)
+	if err != nil {
+		log.Fatalf("Cannot create report: %s", err)
+	}
+
+	defer dst.Close()
+
+	writer := bufio.NewWriter(dst)
+	if err := report.WriteHTML(writer); err != nil {
+		log.Fatalf("Cannot write report: %s", err)
+	}
+
+	if err := writer.Flush(); err != nil {
+		log.Fatalf("Cannot write report: %s", err)
+	}
+
+	log.Infof("Report written to %q", reportOutput)
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var resources []string
+var resourceName string
+
+var resourceCmd = &cobra.Command{
+	Use:   "resource KIND[/NAME]",
+	Short: "Gather a single resource or kind",
+	Long: `Gather a single resource or kind.
+
+Gather only resources of the specified kind, or a single resource, and the
+related data gathered by the addons (e.g. logs for pods, persistent volumes
+for persistent volume claims). This is much faster than gathering entire
+namespaces when you know what you are looking for.
+
+The kind can be a resource name (e.g. "pods"), singular name ("pod"), short
+name ("po"), kind ("Pod"), or full name ("storage.k8s.io/storageclasses").`,
+	Example: `  # Gather all pods in namespace "my-app" and their logs
+  kubectl gather resource pods -n my-app
+
+  # Gather persistent volume claim "data" and its persistent volume
+  kubectl gather resource pvc/data -n my-app
+
+  # Gather a cluster scoped resource
+  kubectl gather resource nodes`,
+	Args: cobra.ExactArgs(1),
+	Run:  runResource,
+}
+
+func init() {
+	addGatherFlags(resourceCmd.Flags())
+	rootCmd.AddCommand(resourceCmd)
+}
+
+func runResource(cmd *cobra.Command, args []string) {
+	kind, name := parseResourceArg(args[0])
+	resources = []string{kind}
+	resourceName = name
+
+	clusters := prepareGather(cmd)
+	defer finishGather()
+
+	if resourceName != "" {
+		log.Infof("Gathering %q %q", kind, resourceName)
+	} else {
+		log.Infof("Gathering %q", kind)
+	}
+
+	gatherClusters(cmd, clusters)
+}
+
+// parseResourceArg parses KIND[/NAME], where KIND may be a full name including
+// the group (e.g. "storage.k8s.io/storageclasses/standard"). Groups without a
+// dot (e.g. "apps") cannot be distinguished from a kind, so the resource name
+// must be used instead (e.g. "deployments/name").
+func parseResourceArg(arg string) (string, string) {
+	parts := strings.SplitN(arg, "/", 3)
+	switch {
+	case len(parts) == 3:
+		return parts[0] + "/" + parts[1], parts[2]
+	case len(parts) == 2 && strings.Contains(parts[0], "."):
+		return arg, ""
+	case len(parts) == 2:
+		return parts[0], parts[1]
+	default:
+		return arg, ""
+	}
+}
@@ -6,6 +6,7 @@ package cmd
 import (
 	"fmt"
 	stdlog "log"
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
@@ -13,8 +14,10 @@ import (
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/api/resource"
 
 	"github.com/nirs/kubectl-gather/pkg/gather"
 )
@@ -27,8 +30,46 @@ var addons []string
 var remote bool
 var verbose bool
 var logFormat string
+var maxInFlightBytes string
+var copyBandwidth string
+var logBandwidthLimit string
+var logsPerNode int
+var partialMarkers bool
+var retryFailed bool
+var protobuf bool
+var discoveryCacheTTL time.Duration
+var skipEmpty bool
+var inventoryOnly []string
+var clusterResources []string
+var maxPerResource int
+var maxObjectSize string
+var binaryFields string
+var binaryFieldsThreshold string
+var allVersions bool
+var showAPIWarnings bool
+var rookLogsSince time.Duration
+var addonTimeout time.Duration
+var deterministic bool
+var appendGather bool
+var skipUnreachable bool
+var requestLog bool
+var debugAPIDump bool
+var readOnly bool
+var allowAgents bool
+var rawEndpoints []string
+var byKind bool
+var force bool
+var since string
+var until string
 var log *zap.SugaredLogger
 
+// Log file in the gather directory, closed when the gather completes.
+var gatherLogFile *logFile
+
+// Time when the program started, used to resolve relative times (e.g.
+// --since 2h) consistently for all clusters.
+var startTime = time.Now()
+
 var example = `  # Gather data from all namespaces in current context in my-kubeconfig and
   # store it in gather.{timestamp}.
   kubectl gather --kubeconfig my-kubeconfig
@@ -67,53 +108,254 @@ func Execute() {
 	}
 }
 
+// ExecuteArgs executes the root command with args instead of the program
+// arguments.
+func ExecuteArgs(args []string) {
+	rootCmd.SetArgs(args)
+	Execute()
+}
+
 func init() {
-	rootCmd.Flags().StringVarP(&directory, "directory", "d", "",
+	addGatherFlags(rootCmd.Flags())
+	rootCmd.Flags().BoolVar(&again, "again", false,
+		"repeat the last successful gather with the same flags, in a new directory unless --directory is specified")
+
+	// Use plain, machine friendly version string.
+	rootCmd.SetVersionTemplate("{{.Version}}\n")
+}
+
+// addGatherFlags adds the flags used by commands gathering data.
+func addGatherFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&directory, "directory", "d", "",
 		"directory for storing gathered data (default \"gather.{timestamp}\")")
 
 	// Don't set default kubeconfig, so kubeconfig is empty unless the user
 	// specified the option. This is required to allow running remote commands
 	// using in-cluster config.
-	rootCmd.Flags().StringVar(&kubeconfig, "kubeconfig", "",
-		"the kubeconfig file to use")
+	flags.StringVar(&kubeconfig, "kubeconfig", "",
+		"the kubeconfig file to use, or a directory with a kubeconfig file per cluster")
 
-	rootCmd.Flags().StringSliceVar(&contexts, "contexts", nil,
+	flags.StringSliceVar(&contexts, "contexts", nil,
 		"comma separated list of contexts to gather data from")
-	rootCmd.Flags().StringSliceVarP(&namespaces, "namespaces", "n", nil,
-		"if specified, comma separated list of namespaces to gather data from")
-	rootCmd.Flags().StringSliceVar(&addons, "addons", nil,
+	flags.StringVar(&clustersFile, "clusters", "",
+		"if specified, gather the clusters in this fleet inventory file (--contexts selects clusters by name)")
+	flags.StringVar(&clusterSelector, "cluster-selector", "",
+		"if specified, gather only clusters in the --clusters file or managed clusters matching this label selector (e.g. role=dr)")
+	flags.BoolVar(&managedKubeconfigs, "managed-kubeconfig-from-secrets", false,
+		"gather the clusters managed by the hub, using the managed clusters admin kubeconfigs stored in secrets on the hub (--contexts selects clusters by name)")
+	flags.BoolVar(&assumeYes, "yes", false,
+		"assume yes for confirmation prompts")
+	flags.StringSliceVarP(&namespaces, "namespaces", "n", nil,
+		"if specified, comma separated list of namespaces to gather data from, prefix with \"cluster=\" to gather the namespace only in this cluster (e.g. hub=openshift-operators)")
+	flags.StringSliceVar(&addons, "addons", nil,
 		fmt.Sprintf("if specified, comma separated list of addons to enable (available addons: %s)",
 			availableAddons()))
-	rootCmd.Flags().BoolVarP(&remote, "remote", "r", false,
+	flags.BoolVarP(&remote, "remote", "r", false,
 		"run on the remote clusters (requires the \"oc\" command)")
-	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false,
+	flags.BoolVarP(&verbose, "verbose", "v", false,
 		"be more verbose")
-	rootCmd.Flags().StringVar(&logFormat, "log-format", "text", "Set the logging format [text, json]")
-
-	// Use plain, machine friendly version string.
-	rootCmd.SetVersionTemplate("{{.Version}}\n")
+	flags.StringVar(&logFormat, "log-format", "text", "Set the logging format [text, json]")
+	flags.StringVar(&maxInFlightBytes, "max-in-flight-bytes", "",
+		"if specified, limit the approximate memory used by objects held by workers (e.g. 512Mi)")
+	flags.BoolVar(&protobuf, "protobuf", false,
+		"list built-in resources using protobuf (faster on big clusters, drops fields unknown to this version)")
+	flags.DurationVar(&discoveryCacheTTL, "discovery-cache-ttl", 0,
+		"if specified, cache discovery results on disk for this duration (e.g. 10m)")
+	flags.BoolVar(&skipEmpty, "skip-empty", false,
+		"check if a resource type is empty using a cheap metadata request before listing it")
+	flags.StringSliceVar(&inventoryOnly, "inventory-only", nil,
+		"if specified, comma separated list of resources to record only in inventory.csv instead of gathering")
+	flags.IntVar(&maxPerResource, "max-per-resource", 0,
+		"if specified, gather only the newest N items of every resource type in every namespace (cluster scoped resources are limited to N items)")
+	flags.StringVar(&maxObjectSize, "max-object-size", "",
+		"if specified, skip objects larger than this size, storing only their metadata (e.g. 1Mi)")
+	flags.StringVar(&binaryFields, "binary-fields", gather.BinaryFieldsKeep,
+		"handling of large config map binaryData and secret data values [keep, omit, external]")
+	flags.StringVar(&binaryFieldsThreshold, "binary-fields-threshold", "4Ki",
+		"size of config map binaryData and secret data values handled by --binary-fields")
+	flags.StringSliceVar(&clusterResources, "cluster-resources", nil,
+		"if specified, comma separated list of cluster scoped resources or API groups to gather, prefix with \"-\" to exclude (e.g. -clusterroles,-clusterrolebindings)")
+	flags.BoolVar(&allVersions, "all-versions", false,
+		"gather all served versions of each resource, storing each version in a separate directory")
+	flags.BoolVar(&showAPIWarnings, "show-api-warnings", false,
+		"record API warnings such as deprecated APIs in deprecations.txt")
+	flags.DurationVar(&rookLogsSince, "rook-logs-since", 0,
+		"if specified, gather only ceph OSD and MON logs modified in this duration (e.g. 6h)")
+	flags.DurationVar(&addonTimeout, "addon-timeout", 30*time.Minute,
+		"limit the time an addon may spend on a single task (0 disables the limit)")
+	flags.StringVar(&copyBandwidth, "copy-bandwidth", "",
+		"if specified, limit the bandwidth in bytes per second used by every copy of a remote directory (e.g. 50Mi)")
+	flags.BoolVar(&partialMarkers, "partial-markers", false,
+		"write a PARTIAL marker in every namespace directory with data that could not be gathered")
+	flags.BoolVar(&retryFailed, "retry-failed", true,
+		"retry failed list, get and log operations once when the gather completes")
+	flags.IntVar(&logsPerNode, "logs-per-node", 4,
+		"limit the number of concurrent container log streams from every node (0 disables the limit)")
+	flags.StringVar(&logBandwidthLimit, "log-bandwidth-limit", "",
+		"if specified, limit the total bandwidth in bytes per second used for gathering logs and copying remote directories (e.g. 10Mi)")
+	flags.StringSliceVar(&rawEndpoints, "raw-endpoints", nil,
+		"if specified, comma separated list of API server paths to gather (e.g. /api/v1/nodes/{node}/proxy/stats/summary)")
+	flags.StringVar(&filesConfig, "files-config", "",
+		"if specified, YAML file with rules for copying files from containers of selected pods (requires agents)")
+	flags.BoolVar(&deterministic, "deterministic", false,
+		"do not record times and durations and sort output, so gathering an idle cluster twice produces identical files")
+	flags.BoolVar(&readOnly, "read-only", true,
+		"reject API requests modifying the cluster, and disable addons creating agent pods or running commands in pods")
+	flags.BoolVar(&allowAgents, "allow-agents", false,
+		"allow creating agent pods and running commands in pods in read only mode (required by the "+
+			strings.Join(gather.AgentAddons(), ", ")+" addons)")
+	flags.BoolVar(&requestLog, "request-log", false,
+		"record every API request made by the gather in requests.log in the cluster directory")
+	flags.BoolVar(&debugAPIDump, "debug-api-dump", false,
+		"store raw API responses for resource types that failed to decode or dump, for reporting parsing bugs")
+	flags.BoolVar(&skipUnreachable, "skip-unreachable", false,
+		"skip clusters that are not reachable instead of failing")
+	flags.StringVarP(&output, "output", "o", "",
+		"if specified, write the gather as a gzip compressed tar archive to this file (\"-\" for stdout) instead of keeping the gather directory")
+	flags.BoolVar(&appendGather, "append", false,
+		"merge into an existing gather directory, skipping resources already gathered")
+	flags.BoolVar(&byKind, "by-kind", false,
+		"create a by-kind directory with symlinks to namespaced resources grouped by kind")
+	flags.StringVar(&since, "since", "",
+		"if specified, gather only events and logs after this time (RFC3339 time or duration ago, e.g. 2h)")
+	flags.StringVar(&until, "until", "",
+		"if specified, gather only events and logs before this time (RFC3339 time or duration ago, e.g. 1h)")
+	flags.BoolVar(&force, "force", false,
+		"remove the gather directory lock held by a gather on another host (use only if the gather is not running)")
 }
 
 func runGather(cmd *cobra.Command, args []string) {
+	if again {
+		if err := loadLastRun(cmd); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Collected before validating the flags, which may modify them.
+	gatherArgs := gatherArgs(cmd.Flags())
+
+	clusters := prepareGather(cmd)
+	defer finishGather()
+
+	if again {
+		log.Infof("Gathering again with %q", gatherArgs)
+	}
+
+	gatherClusters(cmd, clusters)
+	saveLastRun(gatherArgs)
+}
+
+// prepareGather validates the flags, loads the clusters configurations, and
+// creates the gather directory and logger. The gather directory is created
+// only if at least one cluster is reachable.
+func prepareGather(cmd *cobra.Command) []*clusterConfig {
+	if err := validateGatherFlags(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
 	if directory == "" {
 		directory = defaultGatherDirectory()
 	}
 
-	log = createLogger(directory, verbose, logFormat)
-	defer func() {
-		_ = log.Sync()
-	}()
+	// Keep the logs in memory until we know that we can gather something, so
+	// we don't create an empty gather directory if we fail.
+	gatherLogFile = &logFile{}
+	log = createLogger(gatherLogFile, verbose, logFormat)
 
-	clusters, err := loadClusterConfigs(contexts, kubeconfig)
+	clusters, err := loadClusters()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	clusters, err = checkClusters(clusters, skipUnreachable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := prepareOutput(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Concurrent gathers writing to the same directory would interleave files
+	// and truncate gather.log.
+	lock, err := lockDirectory(directory, force)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gatherLock = lock
+
+	// The gather is incomplete until we write a new marker.
+	if err := gather.RemoveDone(directory); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := gatherLogFile.Create(directory, appendGather); err != nil {
+		log.Fatalf("Cannot create log file: %s", err)
+	}
+
+	return clusters
+}
+
+// loadClusters loads the configurations of the selected clusters.
+func loadClusters() ([]*clusterConfig, error) {
+	var clusters []*clusterConfig
+	var err error
+
+	switch {
+	case clustersFile != "":
+		clusters, err = loadFleetConfigs(clustersFile, contexts, clusterSelector)
+	case managedKubeconfigs:
+		clusters, err = loadManagedConfigs(contexts, clusterSelector)
+	default:
+		clusters, err = loadClusterConfigs(contexts, kubeconfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkClusterNamespaces(clusters); err != nil {
+		return nil, err
+	}
+
+	return clusters, nil
+}
+
+// finishGather releases the gather directory, flushes the logs, and writes
+// the gather to the output archive if needed.
+func finishGather() {
+	removeSecretKubeconfigs()
+	gatherLock.Release()
+	_ = log.Sync()
+	writeOutput()
+}
+
+// exitGather removes temporary files, flushes the logs, and exits with code.
+// Used when the gather cannot complete.
+func exitGather(code int) {
+	removeSecretKubeconfigs()
+	gatherLock.Release()
+	_ = log.Sync()
+	os.Exit(code)
+}
+
+// exitHook runs exitGather when logging a fatal error.
+type exitHook struct{}
+
+func (exitHook) OnWrite(*zapcore.CheckedEntry, []zapcore.Field) {
+	exitGather(1)
+}
+
+func gatherClusters(cmd *cobra.Command, clusters []*clusterConfig) {
 	if len(namespaces) != 0 {
 		log.Infof("Gathering from namespaces %q", namespaces)
 	} else {
 		log.Infof("Gathering from all namespaces")
 	}
+	for _, name := range slices.Sorted(maps.Keys(clusterNamespaces)) {
+		log.Infof("Gathering also from namespaces %q in cluster %q", clusterNamespaces[name], name)
+	}
 
 	if addons != nil {
 		log.Infof("Using addons %q", addons)
@@ -121,18 +363,49 @@ func runGather(cmd *cobra.Command, args []string) {
 		log.Infof("Using all addons")
 	}
 
-	if !cmd.Flags().Changed("directory") {
+	if output != "" {
+		log.Infof("Storing data temporarily in %q", directory)
+	} else if !cmd.Flags().Changed("directory") {
 		log.Infof("Storing data in %q", directory)
 	}
 
+	handleInterrupts()
+
 	if remote {
-		remoteGather(clusters)
+		remoteGather(clusters, cmd.Flags())
 	} else {
 		localGather(clusters)
 	}
+
+	done, err := gather.WriteDone(directory, deterministic)
+	if err != nil {
+		log.Fatalf("Cannot write %q: %s", gather.DoneName, err)
+	}
+
+	log.Debugf("Gather completed with %d files (checksum %s)", done.Files, done.Checksum)
+}
+
+// createLogger creates a logger logging to the console and to logfile.
+func createLogger(logfile *logFile, verbose bool, format string) *zap.SugaredLogger {
+	consoleEncoder, logfileEncoder := createEncoders(format)
+
+	core := zapcore.NewTee(
+		zapcore.NewCore(logfileEncoder, logfile, zapcore.DebugLevel),
+		zapcore.NewCore(consoleEncoder, zapcore.Lock(os.Stderr), consoleLevel(verbose)),
+	)
+
+	return zap.New(core, zap.WithFatalHook(exitHook{})).Named("gather").Sugar()
 }
 
-func createLogger(directory string, verbose bool, format string) *zap.SugaredLogger {
+// createConsoleLogger creates a logger logging only to the console, for
+// commands that do not have a gather directory.
+func createConsoleLogger(verbose bool, format string) *zap.SugaredLogger {
+	consoleEncoder, _ := createEncoders(format)
+	core := zapcore.NewCore(consoleEncoder, zapcore.Lock(os.Stderr), consoleLevel(verbose))
+	return zap.New(core).Named("gather").Sugar()
+}
+
+func createEncoders(format string) (zapcore.Encoder, zapcore.Encoder) {
 	consoleConfig := zap.NewProductionEncoderConfig()
 	logfileConfig := zap.NewProductionEncoderConfig()
 
@@ -167,26 +440,71 @@ func createLogger(directory string, verbose bool, format string) *zap.SugaredLog
 		stdlog.Fatalf("Invalid log-format: %q", format)
 	}
 
-	if err := os.MkdirAll(directory, 0750); err != nil {
-		stdlog.Fatalf("Cannot create directory: %s", err)
+	return consoleEncoder, logfileEncoder
+}
+
+func consoleLevel(verbose bool) zapcore.Level {
+	if verbose {
+		return zapcore.DebugLevel
 	}
+	return zapcore.InfoLevel
+}
 
-	logfile, err := os.Create(filepath.Join(directory, "gather.log"))
+// parseBytes parses a bytes flag value (e.g. 512Mi).
+func parseBytes(name string, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	q, err := resource.ParseQuantity(value)
 	if err != nil {
-		stdlog.Fatalf("Cannot create log file: %s", err)
+		return 0, fmt.Errorf("invalid %s %q: %s", name, value, err)
 	}
+	return q.Value(), nil
+}
 
-	consoleLevel := zapcore.InfoLevel
-	if verbose {
-		consoleLevel = zapcore.DebugLevel
+// formatBytes formats n bytes for logging (e.g. "12.3 MiB").
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n)
+	i := -1
+	for value >= unit && i < 4 {
+		value /= unit
+		i++
 	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTP"[i])
+}
 
-	core := zapcore.NewTee(
-		zapcore.NewCore(logfileEncoder, zapcore.Lock(logfile), zapcore.DebugLevel),
-		zapcore.NewCore(consoleEncoder, zapcore.Lock(os.Stderr), consoleLevel),
-	)
+// parseTime parses a time flag value. The value is a RFC3339 time (e.g.
+// 2024-06-01T10:00:00Z) or a duration before the program started (e.g. 2h).
+func parseTime(name string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return startTime.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q: expected RFC3339 time or duration", name, value)
+	}
+	return t, nil
+}
 
-	return zap.New(core).Named("gather").Sugar()
+// discoveryCacheDir returns the directory for caching discovery results on
+// disk, or an empty string if disk cache is disabled.
+func discoveryCacheDir() string {
+	if discoveryCacheTTL <= 0 {
+		return ""
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		log.Warnf("Cannot cache discovery results: %s", err)
+		return ""
+	}
+	return filepath.Join(dir, "kubectl-gather", "discovery")
 }
 
 func defaultGatherDirectory() string {
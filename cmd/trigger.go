@@ -0,0 +1,299 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	toolswatch "k8s.io/client-go/tools/watch"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+var onEvent []string
+var onPodPhase []string
+
+var triggerExample = `  # Wait until a pod fails in namespace "my-app" in clusters "dr1" or "dr2",
+  # and gather data from namespace "my-app" in both clusters.
+  kubectl gather trigger --contexts dr1,dr2 --on-pod-phase Failed -n my-app
+
+  # Wait for an event with reason "FailedMount" in any namespace, and gather
+  # data from the namespace of the event.
+  kubectl gather trigger --on-event reason=FailedMount`
+
+var triggerCmd = &cobra.Command{
+	Use:   "trigger",
+	Short: "Gather data when a matching event or pod phase transition occurs",
+	Long: `Wait for matching events or pod phase transitions, and gather data at the
+moment of the failure.
+
+Events are matched using field selectors like "reason=Failed" or
+"involvedObject.kind=Pod". Multiple selectors can be combined, all of them must
+match. If --namespaces is not specified, watch all namespaces and gather only
+the namespace of the matching object.`,
+	Example: triggerExample,
+	Args:    cobra.NoArgs,
+	Run:     runTrigger,
+}
+
+type triggerMatch struct {
+	Context     string
+	Namespace   string
+	Description string
+}
+
+func init() {
+	addGatherFlags(triggerCmd.Flags())
+	triggerCmd.Flags().StringSliceVar(&onEvent, "on-event", nil,
+		"gather when an event matching the comma separated field selectors occurs (e.g. reason=Failed)")
+	triggerCmd.Flags().StringSliceVar(&onPodPhase, "on-pod-phase", nil,
+		"gather when a pod transitions to one of the comma separated phases (e.g. Failed)")
+	triggerCmd.MarkFlagsOneRequired("on-event", "on-pod-phase")
+
+	rootCmd.AddCommand(triggerCmd)
+}
+
+func runTrigger(cmd *cobra.Command, args []string) {
+	clusters := prepareGather(cmd)
+	defer finishGather()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	match, err := waitForTrigger(ctx, clusters)
+	stop()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infof("Triggered by %s", match.Description)
+
+	if len(namespaces) == 0 && match.Namespace != "" {
+		namespaces = []string{match.Namespace}
+	}
+
+	gatherClusters(cmd, clusters)
+}
+
+// waitForTrigger watches all clusters and returns the first match.
+func waitForTrigger(ctx context.Context, clusters []*clusterConfig) (*triggerMatch, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	matches := make(chan *triggerMatch, 1)
+	errors := make(chan error, len(clusters))
+
+	for i := range clusters {
+		cluster := clusters[i]
+		go func() {
+			match, err := watchCluster(ctx, cluster)
+			if err != nil {
+				errors <- err
+				return
+			}
+			select {
+			case matches <- match:
+			default:
+			}
+		}()
+	}
+
+	failed := 0
+
+	for {
+		select {
+		case match := <-matches:
+			return match, nil
+		case err := <-errors:
+			failed++
+			if failed == len(clusters) {
+				return nil, err
+			}
+			log.Warn(err)
+		case <-ctx.Done():
+			return nil, fmt.Errorf("interrupted while waiting for trigger")
+		}
+	}
+}
+
+func watchCluster(ctx context.Context, cluster *clusterConfig) (*triggerMatch, error) {
+	client, err := kubernetes.NewForConfig(cluster.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	watchNamespaces := cluster.GatherNamespaces()
+	if len(watchNamespaces) == 0 {
+		watchNamespaces = []string{metav1.NamespaceAll}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	matches := make(chan *triggerMatch, 1)
+	errors := make(chan error, 2*len(watchNamespaces))
+	watchers := 0
+
+	start := func(fn func() (*triggerMatch, error)) {
+		watchers++
+		go func() {
+			match, err := fn()
+			if err != nil {
+				errors <- err
+				return
+			}
+			select {
+			case matches <- match:
+			default:
+			}
+		}()
+	}
+
+	for _, namespace := range watchNamespaces {
+		if len(onEvent) > 0 {
+			start(func() (*triggerMatch, error) {
+				return watchEvents(ctx, client, cluster.Context, namespace)
+			})
+		}
+		if len(onPodPhase) > 0 {
+			start(func() (*triggerMatch, error) {
+				return watchPods(ctx, client, cluster.Context, namespace)
+			})
+		}
+	}
+
+	for i := 0; i < watchers; i++ {
+		select {
+		case match := <-matches:
+			return match, nil
+		case err := <-errors:
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("cannot watch cluster %q: %s", cluster.Context, err)
+		}
+	}
+
+	return nil, fmt.Errorf("no watcher in cluster %q", cluster.Context)
+}
+
+type listWatcher struct {
+	ctx       context.Context
+	namespace string
+	selector  string
+	watchFunc func(string, metav1.ListOptions) (watch.Interface, error)
+}
+
+func (w *listWatcher) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	opts.FieldSelector = w.selector
+	return w.watchFunc(w.namespace, opts)
+}
+
+func watchEvents(ctx context.Context, client *kubernetes.Clientset, clusterName string, namespace string) (*triggerMatch, error) {
+	trigger, err := gather.NewEventTrigger(onEvent)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --on-event: %s", err)
+	}
+
+	opts := metav1.ListOptions{FieldSelector: trigger.Selector(), Limit: 1}
+	list, err := client.CoreV1().Events(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &listWatcher{
+		ctx:       ctx,
+		namespace: namespace,
+		selector:  trigger.Selector(),
+		watchFunc: func(ns string, opts metav1.ListOptions) (watch.Interface, error) {
+			return client.CoreV1().Events(ns).Watch(ctx, opts)
+		},
+	}
+
+	log.Debugf("Watching events matching %q in cluster %q namespace %q",
+		trigger.Selector(), clusterName, namespace)
+
+	return waitForMatch(w, list.ResourceVersion, func(event watch.Event) *triggerMatch {
+		e, ok := event.Object.(*corev1.Event)
+		if !ok || !trigger.Match(event.Type, e) {
+			return nil
+		}
+		return &triggerMatch{
+			Context:   clusterName,
+			Namespace: e.Namespace,
+			Description: fmt.Sprintf("event %q in cluster %q: %s %s %s/%s: %s",
+				e.Name, clusterName, e.Reason, e.InvolvedObject.Kind, e.Namespace,
+				e.InvolvedObject.Name, e.Message),
+		}
+	})
+}
+
+func watchPods(ctx context.Context, client *kubernetes.Clientset, clusterName string, namespace string) (*triggerMatch, error) {
+	list, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	trigger := gather.NewPodPhaseTrigger(onPodPhase, list.Items)
+
+	w := &listWatcher{
+		ctx:       ctx,
+		namespace: namespace,
+		watchFunc: func(ns string, opts metav1.ListOptions) (watch.Interface, error) {
+			return client.CoreV1().Pods(ns).Watch(ctx, opts)
+		},
+	}
+
+	log.Debugf("Watching pods phase %q in cluster %q namespace %q",
+		onPodPhase, clusterName, namespace)
+
+	return waitForMatch(w, list.ResourceVersion, func(event watch.Event) *triggerMatch {
+		pod, ok := event.Object.(*corev1.Pod)
+		if !ok || !trigger.Match(event.Type, pod) {
+			return nil
+		}
+		return &triggerMatch{
+			Context:   clusterName,
+			Namespace: pod.Namespace,
+			Description: fmt.Sprintf("pod \"%s/%s\" in cluster %q phase %s",
+				pod.Namespace, pod.Name, clusterName, pod.Status.Phase),
+		}
+	})
+}
+
+func waitForMatch(w *listWatcher, resourceVersion string, match func(watch.Event) *triggerMatch) (*triggerMatch, error) {
+	watcher, err := toolswatch.NewRetryWatcher(resourceVersion, w)
+	if err != nil {
+		return nil, err
+	}
+
+	defer watcher.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return nil, fmt.Errorf("watch closed")
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified, watch.Deleted:
+				if m := match(event); m != nil {
+					return m, nil
+				}
+			case watch.Error:
+				return nil, apierrors.FromObject(event.Object)
+			}
+		case <-w.ctx.Done():
+			return nil, w.ctx.Err()
+		}
+	}
+}
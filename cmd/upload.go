@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nirs/kubectl-gather/pkg/operator"
+)
+
+var uploadFile string
+var uploadTarget operator.S3Upload
+
+var uploadS3Cmd = &cobra.Command{
+	Use:   "upload-s3",
+	Short: "Upload a gather archive to an S3 bucket",
+	Long: `Upload a gather archive to an S3 bucket.
+
+Used by gather jobs with an S3 destination. The credentials are read from the
+AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.`,
+	Args:   cobra.NoArgs,
+	Hidden: true,
+	Run:    runUploadS3,
+}
+
+func init() {
+	uploadS3Cmd.Flags().StringVar(&uploadTarget.Endpoint, "endpoint", "",
+		"object store endpoint URL")
+	uploadS3Cmd.Flags().StringVar(&uploadTarget.Region, "region", "",
+		"bucket region (default \"us-east-1\")")
+	uploadS3Cmd.Flags().StringVar(&uploadTarget.Bucket, "bucket", "",
+		"bucket name")
+	uploadS3Cmd.Flags().StringVar(&uploadTarget.Key, "key", "",
+		"object key")
+	uploadS3Cmd.Flags().StringVar(&uploadFile, "file", "",
+		"file to upload")
+	uploadS3Cmd.Flags().BoolVarP(&verbose, "verbose", "v", false,
+		"be more verbose")
+	uploadS3Cmd.Flags().StringVar(&logFormat, "log-format", "text",
+		"Set the logging format [text, json]")
+
+	for _, name := range []string{"endpoint", "bucket", "key", "file"} {
+		_ = uploadS3Cmd.MarkFlagRequired(name)
+	}
+
+	operatorCmd.AddCommand(uploadS3Cmd)
+}
+
+func runUploadS3(cmd *cobra.Command, args []string) {
+	log = createConsoleLogger(verbose, logFormat)
+	defer func() {
+		_ = log.Sync()
+	}()
+
+	uploadTarget.AccessKeyID = os.Getenv(operator.S3AccessKeyIDKey)
+	uploadTarget.SecretAccessKey = os.Getenv(operator.S3SecretAccessKeyKey)
+	if uploadTarget.AccessKeyID == "" || uploadTarget.SecretAccessKey == "" {
+		log.Fatalf("%s and %s are required", operator.S3AccessKeyIDKey, operator.S3SecretAccessKeyKey)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	start := time.Now()
+
+	if err := operator.UploadS3(ctx, &uploadTarget, uploadFile); err != nil {
+		log.Fatalf("Cannot upload %q: %s", uploadFile, err)
+	}
+
+	log.Infof("Uploaded %q to s3://%s/%s in %.3f seconds",
+		uploadFile, uploadTarget.Bucket, uploadTarget.Key, time.Since(start).Seconds())
+}
@@ -0,0 +1,195 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// validateGatherFlags validates the gather flags before creating the gather
+// directory, so user errors do not leave empty gather directories.
+func validateGatherFlags() error {
+	var errs []error
+
+	var err error
+	namespaces, clusterNamespaces, err = parseNamespaces(namespaces)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// Validate the namespaces gathered in all clusters and in specific
+	// clusters together.
+	var scoped []string
+	for _, values := range clusterNamespaces {
+		scoped = append(scoped, values...)
+	}
+
+	options, err := gatherOptions(kubeconfig, "")
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		options.Namespaces = append(slices.Clone(namespaces), scoped...)
+		if err := options.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, selector := range onEvent {
+		if _, err := fields.ParseSelector(selector); err != nil {
+			errs = append(errs, fmt.Errorf("invalid event selector %q: %s", selector, err))
+		}
+	}
+
+	// must-gather creates a namespace and a pod running the gather.
+	if remote && readOnly && !allowAgents {
+		errs = append(errs, errors.New("--remote creates a must-gather pod in the cluster, not allowed in read only mode (use --allow-agents)"))
+	}
+
+	// The remote gather cannot access the existing gather directory.
+	if appendGather && remote {
+		errs = append(errs, errors.New("--append cannot be used with --remote"))
+	}
+
+	// The remote gather cannot access the files config.
+	if filesConfig != "" && remote {
+		errs = append(errs, errors.New("--files-config cannot be used with --remote"))
+	}
+
+	// The archive is created from a new temporary directory.
+	if appendGather && output != "" {
+		errs = append(errs, errors.New("--append cannot be used with --output"))
+	}
+
+	if output == "-" && isTerminal(os.Stdout) {
+		errs = append(errs, errors.New("refusing to write archive to a terminal, redirect or pipe the output"))
+	}
+
+	switch {
+	case clustersFile != "" && managedKubeconfigs:
+		errs = append(errs, errors.New("--clusters cannot be used with --managed-kubeconfig-from-secrets"))
+	case clustersFile != "":
+		if err := validateFleetFlags(); err != nil {
+			errs = append(errs, err)
+		}
+	case managedKubeconfigs:
+		// Contexts are managed cluster names, validated when listing the
+		// managed clusters.
+		if _, err := labels.Parse(clusterSelector); err != nil {
+			errs = append(errs, fmt.Errorf("invalid cluster selector %q: %s", clusterSelector, err))
+		}
+	default:
+		if clusterSelector != "" {
+			errs = append(errs, errors.New("--cluster-selector requires --clusters or --managed-kubeconfig-from-secrets"))
+		}
+		if err := validateContexts(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateContexts checks that the kubeconfig exists and contains the
+// requested contexts, suggesting similar contexts for unknown contexts.
+func validateContexts() error {
+	if kubeconfig != "" {
+		if _, err := os.Stat(kubeconfig); err != nil {
+			return fmt.Errorf("invalid kubeconfig: %s", err)
+		}
+	}
+
+	if len(contexts) == 0 {
+		// Using in cluster config or the current context.
+		return nil
+	}
+
+	path := kubeconfig
+	if path == "" {
+		path = defaultKubeconfig()
+	}
+
+	available, err := availableContexts(path)
+	if err != nil {
+		return fmt.Errorf("cannot load kubeconfig %q: %s", path, err)
+	}
+
+	var errs []error
+
+	for _, name := range contexts {
+		if slices.Contains(available, name) {
+			continue
+		}
+		if similar := similarNames(name, available); len(similar) > 0 {
+			errs = append(errs, fmt.Errorf("unknown context %q (did you mean %s?)",
+				name, strings.Join(similar, " or ")))
+		} else {
+			errs = append(errs, fmt.Errorf("unknown context %q (available contexts: %s)",
+				name, strings.Join(available, ", ")))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// availableContexts returns the sorted context names in a kubeconfig file or
+// directory.
+func availableContexts(path string) ([]string, error) {
+	if isDirectory(path) {
+		files, err := loadKubeconfigDir(path)
+		if err != nil {
+			return nil, err
+		}
+		return slices.Sorted(maps.Keys(files)), nil
+	}
+
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Sorted(maps.Keys(config.Contexts)), nil
+}
+
+// similarNames returns the quoted names similar to name.
+func similarNames(name string, names []string) []string {
+	var similar []string
+	for _, candidate := range names {
+		if strings.HasPrefix(candidate, name) || editDistance(name, candidate) <= 2 {
+			similar = append(similar, fmt.Sprintf("%q", candidate))
+		}
+	}
+	return similar
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate gathered custom resources against their schemas",
+	Long: `Validate gathered custom resources against their schemas.
+
+The schemas addon extracts the openAPIV3Schema of every custom resource
+definition to the schemas directory in the cluster directory. Validate
+checks the gathered custom resources against the schema of their version,
+surfacing objects that would fail re-creation on another cluster (e.g. a DR
+target cluster). The metadata and status are not validated. Exits with a
+non-zero status if invalid objects were found.`,
+	Example: `  # Validate the custom resources in the gather directory gather.local
+  kubectl gather validate -d gather.local`,
+	Args: cobra.NoArgs,
+	Run:  runValidate,
+}
+
+func init() {
+	validateCmd.Flags().StringVarP(&directory, "directory", "d", "",
+		"gather directory")
+	validateCmd.Flags().BoolVarP(&verbose, "verbose", "v", false,
+		"be more verbose")
+	validateCmd.Flags().StringVar(&logFormat, "log-format", "text",
+		"Set the logging format [text, json]")
+
+	_ = validateCmd.MarkFlagRequired("directory")
+
+	rootCmd.AddCommand(validateCmd)
+}
+
+func runValidate(cmd *cobra.Command, args []string) {
+	log = createConsoleLogger(verbose, logFormat)
+	defer func() {
+		_ = log.Sync()
+	}()
+
+	result, err := gather.ValidateSchemas(directory)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, problem := range result.Problems {
+		log.Error(problem)
+	}
+
+	if len(result.Problems) > 0 {
+		log.Fatalf("Gather %q has invalid objects: found %d problems", directory, len(result.Problems))
+	}
+
+	log.Infof("Gather %q is valid: validated %d objects", directory, result.Objects)
+}
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify that a gather directory is complete",
+	Long: `Verify that a gather directory is complete.
+
+A successful gather writes a DONE marker with the checksum of
+checksums.sha256, listing the checksums of all files in the gather
+directory. Verify checks the marker, the checksums of all files, and that
+every resource in the clusters indexes exists, so automation can reject
+incomplete or corrupted uploads. Exits with a non-zero status if the gather
+is incomplete.`,
+	Example: `  # Verify the gather directory gather.local
+  kubectl gather verify -d gather.local`,
+	Args: cobra.NoArgs,
+	Run:  runVerify,
+}
+
+func init() {
+	verifyCmd.Flags().StringVarP(&directory, "directory", "d", "",
+		"gather directory")
+	verifyCmd.Flags().BoolVarP(&verbose, "verbose", "v", false,
+		"be more verbose")
+	verifyCmd.Flags().StringVar(&logFormat, "log-format", "text",
+		"Set the logging format [text, json]")
+
+	_ = verifyCmd.MarkFlagRequired("directory")
+
+	rootCmd.AddCommand(verifyCmd)
+}
+
+func runVerify(cmd *cobra.Command, args []string) {
+	log = createConsoleLogger(verbose, logFormat)
+	defer func() {
+		_ = log.Sync()
+	}()
+
+	result, err := gather.Verify(directory)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, problem := range result.Problems {
+		log.Error(problem)
+	}
+
+	if len(result.Problems) > 0 {
+		log.Fatalf("Gather %q is incomplete: found %d problems", directory, len(result.Problems))
+	}
+
+	log.Infof("Gather %q is complete: verified %d files", directory, result.Files)
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"slices"
 	"strings"
 	"sync"
@@ -14,6 +15,10 @@ import (
 
 const kubeconfig = "clusters.yaml"
 
+// Directory with stub operators. Every stub is a directory with "crds.yaml"
+// and "objects.yaml" manifests.
+const stubsDir = "stubs"
+
 var names = []string{"kind-c1", "kind-c2"}
 
 func Names() []string {
@@ -24,7 +29,17 @@ func Kubeconfig() string {
 	return kubeconfig
 }
 
-func Create() error {
+// Create creates the clusters, deploys the stub operators, and applies the
+// fixtures in the fixtures directory. Manifests in the fixtures directory are
+// applied to all clusters, and manifests in a sub directory named after a
+// cluster (e.g. "fixtures/kind-c1") are applied only to this cluster. If
+// fixtures is empty, no fixture is applied.
+func Create(fixtures string, stubs []string) error {
+	for _, stub := range stubs {
+		if !slices.Contains(Stubs(), stub) {
+			return fmt.Errorf("Unknown stub %q (available stubs: %s)", stub, strings.Join(Stubs(), ", "))
+		}
+	}
 	log.Print("Creating clusters")
 	if err := execute(createCluster, names); err != nil {
 		return err
@@ -32,6 +47,22 @@ func Create() error {
 	if err := createKubeconfig(); err != nil {
 		return err
 	}
+	for _, stub := range stubs {
+		err := execute(func(name string) error {
+			return deployStub(name, stub)
+		}, names)
+		if err != nil {
+			return err
+		}
+	}
+	if fixtures != "" {
+		err := execute(func(name string) error {
+			return applyFixtures(name, fixtures)
+		}, names)
+		if err != nil {
+			return err
+		}
+	}
 	log.Print("Clusters created")
 	return nil
 }
@@ -117,6 +148,63 @@ func createKubeconfig() error {
 	return os.WriteFile(kubeconfig, data, 0640)
 }
 
+// Stubs returns the names of the available stub operators. A stub operator
+// deploys the operator CRDs and objects without the operator, exercising the
+// gather addons.
+func Stubs() []string {
+	entries, err := os.ReadDir(stubsDir)
+	if err != nil {
+		return nil
+	}
+	var stubs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			stubs = append(stubs, entry.Name())
+		}
+	}
+	return stubs
+}
+
+func deployStub(name string, stub string) error {
+	log.Printf("Deploying stub %q in cluster %q", stub, name)
+	crds := filepath.Join(stubsDir, stub, "crds.yaml")
+	if err := kubectl(name, "apply", "--filename", crds); err != nil {
+		return err
+	}
+	// Objects cannot be created before the CRDs are established.
+	err := kubectl(name, "wait", "--for", "condition=established", "--filename", crds)
+	if err != nil {
+		return err
+	}
+	objects := filepath.Join(stubsDir, stub, "objects.yaml")
+	return kubectl(name, "apply", "--filename", objects)
+}
+
+func kubectl(name string, args ...string) error {
+	cmd := exec.Command(
+		"kubectl",
+		append([]string{"--kubeconfig", kubeconfig, "--context", name}, args...)...,
+	)
+	return commands.LogStderr(cmd)
+}
+
+func applyFixtures(name string, fixtures string) error {
+	for _, dir := range []string{fixtures, filepath.Join(fixtures, name)} {
+		manifests, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+		if err != nil {
+			return err
+		}
+		if len(manifests) == 0 {
+			continue
+		}
+		log.Printf("Applying fixtures %q to cluster %q", dir, name)
+		if err := kubectl(name, "apply", "--filename", dir); err != nil {
+			return fmt.Errorf("Failed to apply fixtures %q: %s", dir, err)
+		}
+	}
+	return nil
+}
+
 func clusterExists(name string) (bool, error) {
 	cmd := exec.Command("kind", "get", "clusters")
 	log.Printf("Running %v", cmd)
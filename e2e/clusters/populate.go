@@ -0,0 +1,54 @@
+package clusters
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Label of namespaces created by Populate.
+const populateLabel = "e2e.gather.nirs.github.io/populated"
+
+// Populate creates namespaces in cluster name, with objects config maps in
+// every namespace, for testing gather performance with many objects.
+func Populate(name string, namespaces int, objects int) error {
+	log.Printf("Populating cluster %q with %d namespaces x %d objects", name, namespaces, objects)
+
+	manifest, err := os.CreateTemp("", "populate-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(manifest.Name())
+
+	if _, err := manifest.WriteString(populateManifest(namespaces, objects)); err != nil {
+		manifest.Close()
+		return err
+	}
+	if err := manifest.Close(); err != nil {
+		return err
+	}
+
+	// Server side apply is much faster with many objects.
+	return kubectl(name, "apply", "--server-side", "--filename", manifest.Name())
+}
+
+// Depopulate deletes the namespaces created by Populate.
+func Depopulate(name string) error {
+	log.Printf("Depopulating cluster %q", name)
+	return kubectl(name, "delete", "namespace", "--selector", populateLabel, "--wait=false")
+}
+
+func populateManifest(namespaces int, objects int) string {
+	var b strings.Builder
+	for i := 0; i < namespaces; i++ {
+		namespace := fmt.Sprintf("test-populate-%03d", i)
+		fmt.Fprintf(&b, "---\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: %s\n  labels:\n    %s: \"true\"\n",
+			namespace, populateLabel)
+		for j := 0; j < objects; j++ {
+			fmt.Fprintf(&b, "---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config-%04d\n  namespace: %s\ndata:\n  message: hello\n",
+				j, namespace)
+		}
+	}
+	return b.String()
+}
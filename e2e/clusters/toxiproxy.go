@@ -0,0 +1,235 @@
+package clusters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/nirs/kubectl-gather/e2e/commands"
+)
+
+const (
+	toxiproxyServer = "toxiproxy-server"
+	toxiproxyHost   = "127.0.0.1"
+	toxiproxyPort   = "8474"
+)
+
+// Proxy is a toxiproxy proxy between the tests and a cluster API server,
+// injecting API latency and connection drops.
+type Proxy struct {
+	name       string
+	kubeconfig string
+	server     *exec.Cmd
+	client     *http.Client
+}
+
+// Toxic is a toxiproxy toxic. See https://github.com/Shopify/toxiproxy#toxics
+// for the available toxics and attributes.
+type Toxic struct {
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Stream     string         `json:"stream,omitempty"`
+	Toxicity   float64        `json:"toxicity"`
+	Attributes map[string]int `json:"attributes"`
+}
+
+// ToxiproxyAvailable returns true if the toxiproxy server is installed.
+func ToxiproxyAvailable() bool {
+	_, err := exec.LookPath(toxiproxyServer)
+	return err == nil
+}
+
+// StartProxy starts a toxiproxy server and creates a proxy to cluster name API
+// server. Use Kubeconfig() to access the cluster via the proxy, and Stop()
+// to stop the proxy.
+func StartProxy(name string) (*Proxy, error) {
+	upstream, err := apiServerAddress(name)
+	if err != nil {
+		return nil, err
+	}
+
+	listen, err := freeAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Proxy{
+		name:       name,
+		kubeconfig: name + "-proxy.yaml",
+		server:     exec.Command(toxiproxyServer, "-host", toxiproxyHost, "-port", toxiproxyPort),
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+
+	log.Printf("Running %v", p.server)
+	if err := p.server.Start(); err != nil {
+		return nil, err
+	}
+
+	if err := p.waitUntilReady(); err != nil {
+		p.Stop()
+		return nil, err
+	}
+
+	proxy := map[string]any{
+		"name":     name,
+		"listen":   listen,
+		"upstream": upstream,
+		"enabled":  true,
+	}
+	if err := p.post("/proxies", proxy); err != nil {
+		p.Stop()
+		return nil, err
+	}
+
+	if err := p.createKubeconfig(listen); err != nil {
+		p.Stop()
+		return nil, err
+	}
+
+	log.Printf("Proxying cluster %q API server %q via %q", name, upstream, listen)
+	return p, nil
+}
+
+// Kubeconfig returns a kubeconfig accessing the cluster via the proxy. The
+// context name is the cluster name.
+func (p *Proxy) Kubeconfig() string {
+	return p.kubeconfig
+}
+
+// AddLatency adds latency in milliseconds to API server responses.
+func (p *Proxy) AddLatency(latency int) error {
+	return p.AddToxic(Toxic{
+		Name:       "latency",
+		Type:       "latency",
+		Stream:     "downstream",
+		Toxicity:   1,
+		Attributes: map[string]int{"latency": latency},
+	})
+}
+
+// AddDrops resets toxicity fraction (0-1) of the connections after timeout
+// milliseconds.
+func (p *Proxy) AddDrops(toxicity float64, timeout int) error {
+	return p.AddToxic(Toxic{
+		Name:       "drops",
+		Type:       "reset_peer",
+		Stream:     "downstream",
+		Toxicity:   toxicity,
+		Attributes: map[string]int{"timeout": timeout},
+	})
+}
+
+func (p *Proxy) AddToxic(toxic Toxic) error {
+	log.Printf("Adding toxic %+v to proxy %q", toxic, p.name)
+	return p.post("/proxies/"+p.name+"/toxics", toxic)
+}
+
+// Stop stops the toxiproxy server and removes the proxy kubeconfig.
+func (p *Proxy) Stop() {
+	log.Printf("Stopping proxy %q", p.name)
+	if err := p.server.Process.Kill(); err != nil {
+		log.Printf("Failed to kill %v: %s", p.server, err)
+	}
+	_ = p.server.Wait()
+	_ = os.Remove(p.kubeconfig)
+}
+
+func (p *Proxy) waitUntilReady() error {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		res, err := p.client.Get(p.url("/version"))
+		if err == nil {
+			res.Body.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timeout waiting for toxiproxy server: %s", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (p *Proxy) post(path string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	res, err := p.client.Post(p.url(path), "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("Failed to post %q: %s", path, res.Status)
+	}
+	return nil
+}
+
+func (p *Proxy) url(path string) string {
+	return "http://" + net.JoinHostPort(toxiproxyHost, toxiproxyPort) + path
+}
+
+// createKubeconfig creates a kubeconfig for the cluster with the proxy
+// address. The kind API server certificate is valid for 127.0.0.1.
+func (p *Proxy) createKubeconfig(listen string) error {
+	cmd := exec.Command(
+		"kubectl", "config", "view",
+		"--kubeconfig", kubeconfig,
+		"--context", p.name,
+		"--minify",
+		"--flatten",
+	)
+	log.Printf("Running %v", cmd)
+	data, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("Failed to get cluster %q config: %s: %s", p.name, err, commands.Stderr(err))
+	}
+	if err := os.WriteFile(p.kubeconfig, data, 0640); err != nil {
+		return err
+	}
+	cmd = exec.Command(
+		"kubectl", "config", "set-cluster", p.name,
+		"--kubeconfig", p.kubeconfig,
+		"--server", "https://"+listen,
+	)
+	return commands.LogStderr(cmd)
+}
+
+// apiServerAddress returns the host:port of cluster name API server.
+func apiServerAddress(name string) (string, error) {
+	cmd := exec.Command(
+		"kubectl", "config", "view",
+		"--kubeconfig", kubeconfig,
+		"--context", name,
+		"--minify",
+		"--output", "jsonpath={.clusters[0].cluster.server}",
+	)
+	log.Printf("Running %v", cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Failed to get cluster %q server: %s: %s", name, err, commands.Stderr(err))
+	}
+	u, err := url.Parse(strings.TrimSpace(string(out)))
+	if err != nil {
+		return "", err
+	}
+	return u.Host, nil
+}
+
+// freeAddress returns a free local address for the proxy.
+func freeAddress() (string, error) {
+	l, err := net.Listen("tcp", toxiproxyHost+":0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
@@ -8,6 +8,9 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var fixtures string
+var stubs []string
+
 var rootCmd = &cobra.Command{
 	Use:   "e2e",
 	Short: "Manage the e2e testing environment",
@@ -17,7 +20,7 @@ var createCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Create the e2e environment",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := clusters.Create(); err != nil {
+		if err := clusters.Create(fixtures, stubs); err != nil {
 			log.Fatal(err)
 		}
 	},
@@ -34,6 +37,10 @@ var deleteCmd = &cobra.Command{
 }
 
 func init() {
+	createCmd.Flags().StringVar(&fixtures, "fixtures", "fixtures",
+		"directory with manifests to apply to the clusters (empty to skip)")
+	createCmd.Flags().StringSliceVar(&stubs, "stubs", clusters.Stubs(),
+		"comma separated list of stub operators to deploy (CRDs and objects without the operator)")
 	rootCmd.AddCommand(deleteCmd)
 	rootCmd.AddCommand(createCmd)
 }
@@ -8,26 +8,40 @@ import (
 )
 
 func LogStderr(cmd *exec.Cmd) error {
+	wait, err := StartLogStderr(cmd)
+	if err != nil {
+		return err
+	}
+	return wait()
+}
+
+// StartLogStderr starts cmd and returns a function logging the command
+// stderr and waiting until the command completes. Useful for monitoring the
+// command while it runs.
+func StartLogStderr(cmd *exec.Cmd) (func() error, error) {
 	log.Printf("Running %v", cmd)
 	pipe, err := cmd.StderrPipe()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if err := cmd.Start(); err != nil {
-		return err
+		return nil, err
 	}
-	reader := bufio.NewReader(pipe)
-	for {
-		line, _, err := reader.ReadLine()
-		if err != nil {
-			if err != io.EOF {
-				log.Printf("Failed to read from command stderr: %s", err)
+	wait := func() error {
+		reader := bufio.NewReader(pipe)
+		for {
+			line, _, err := reader.ReadLine()
+			if err != nil {
+				if err != io.EOF {
+					log.Printf("Failed to read from command stderr: %s", err)
+				}
+				break
 			}
-			break
+			log.Print(string(line))
 		}
-		log.Print(string(line))
+		return cmd.Wait()
 	}
-	return cmd.Wait()
+	return wait, nil
 }
 
 func Stderr(err error) []byte {
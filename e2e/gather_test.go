@@ -1,16 +1,44 @@
 package e2e_test
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/nirs/kubectl-gather/e2e/clusters"
 	"github.com/nirs/kubectl-gather/e2e/commands"
+	"github.com/nirs/kubectl-gather/e2e/validate"
 )
 
 const executable = "../kubectl-gather"
 
+var update = flag.Bool("update", false, "update the golden snapshots")
+
+// Golden snapshot of gathering the "test-common" namespace from every
+// cluster (see fixtures/common.yaml).
+const goldenCommon = "golden/test-common.txt"
+
+// Golden snapshot options: the cluster name is replaced, files depending on
+// timing (e.g. events expire after one hour, containers may restart) are
+// ignored, and the structure of the metadata is compared.
+var goldenOptions = validate.Options{
+	Ignore: []string{
+		"previous.log",
+		"termination.txt",
+		"requests.log",
+		"namespaces/*/events.k8s.io/events/*",
+	},
+	Schemas: []string{
+		"metadata.json",
+	},
+}
+
 func TestGather(t *testing.T) {
 	cmd := exec.Command(
 		executable,
@@ -37,3 +65,135 @@ func TestJSONLogs(t *testing.T) {
 	}
 	// XXX verify gathered data.
 }
+
+func TestGatherGolden(t *testing.T) {
+	directory := "test-gather-golden.out"
+	cmd := exec.Command(
+		executable,
+		"--contexts", strings.Join(clusters.Names(), ","),
+		"--kubeconfig", clusters.Kubeconfig(),
+		"--directory", directory,
+		"--namespaces", "test-common",
+	)
+	if err := commands.LogStderr(cmd); err != nil {
+		t.Fatalf("kubectl-gather failed: %s", err)
+	}
+	for _, name := range clusters.Names() {
+		opts := goldenOptions
+		opts.Replace = map[string]string{name: "{cluster}"}
+		err := validate.Compare(filepath.Join(directory, name), goldenCommon, opts, *update)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestGatherStubs(t *testing.T) {
+	directory := "test-gather-stubs.out"
+	cmd := exec.Command(
+		executable,
+		"--contexts", strings.Join(clusters.Names(), ","),
+		"--kubeconfig", clusters.Kubeconfig(),
+		"--directory", directory,
+		// The rook addon runs commands in the tools pod.
+		"--allow-agents",
+	)
+	if err := commands.LogStderr(cmd); err != nil {
+		t.Fatalf("kubectl-gather failed: %s", err)
+	}
+	// Resources deployed by the stub operators (see stubs/).
+	resources := []string{
+		"namespaces/rook-ceph/ceph.rook.io/cephclusters/my-cluster.yaml",
+		"namespaces/rook-ceph/ceph.rook.io/cephblockpools/replicapool.yaml",
+		"namespaces/velero/velero.io/backups/my-backup.yaml",
+		"namespaces/velero/velero.io/restores/my-restore.yaml",
+		"namespaces/test-kubevirt/kubevirt.io/virtualmachines/my-vm.yaml",
+		"namespaces/test-kubevirt/kubevirt.io/virtualmachineinstances/my-vm.yaml",
+	}
+	for _, name := range clusters.Names() {
+		for _, resource := range resources {
+			path := filepath.Join(directory, name, resource)
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("stub resource not gathered: %s", err)
+			}
+		}
+		// The rook addon inspected the cephcluster and ran the commands in
+		// the stub tools pod.
+		manifest := filepath.Join(directory, name, "namespaces/rook-ceph/addons/rook/commands.json")
+		if _, err := os.Stat(manifest); err != nil {
+			t.Errorf("rook addon did not inspect cephcluster: %s", err)
+		}
+	}
+}
+
+func TestGatherSlowAPI(t *testing.T) {
+	proxy := startProxy(t)
+	if err := proxy.AddLatency(200); err != nil {
+		t.Fatal(err)
+	}
+	directory := "test-gather-slow-api.out"
+	cmd := exec.Command(
+		executable,
+		"--contexts", clusters.Names()[0],
+		"--kubeconfig", proxy.Kubeconfig(),
+		"--directory", directory,
+	)
+	if err := commands.LogStderr(cmd); err != nil {
+		t.Fatalf("kubectl-gather failed: %s", err)
+	}
+	checkMetadata(t, filepath.Join(directory, clusters.Names()[0]))
+}
+
+func TestGatherConnectionDrops(t *testing.T) {
+	proxy := startProxy(t)
+	if err := proxy.AddDrops(0.2, 0); err != nil {
+		t.Fatal(err)
+	}
+	directory := "test-gather-connection-drops.out"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(
+		ctx,
+		executable,
+		"--contexts", clusters.Names()[0],
+		"--kubeconfig", proxy.Kubeconfig(),
+		"--directory", directory,
+	)
+	// Some requests fail, but we must gather partial results without
+	// hanging.
+	if err := commands.LogStderr(cmd); err != nil {
+		t.Logf("kubectl-gather failed: %s", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("kubectl-gather did not complete: %s", ctx.Err())
+	}
+	checkMetadata(t, filepath.Join(directory, clusters.Names()[0]))
+}
+
+func startProxy(t *testing.T) *clusters.Proxy {
+	if !clusters.ToxiproxyAvailable() {
+		t.Skip("toxiproxy-server not available")
+	}
+	proxy, err := clusters.StartProxy(clusters.Names()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(proxy.Stop)
+	return proxy
+}
+
+func checkMetadata(t *testing.T, clusterDir string) {
+	data, err := os.ReadFile(filepath.Join(clusterDir, "metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metadata struct {
+		Count int `json:"count"`
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Count == 0 {
+		t.Errorf("no resource gathered from %q", clusterDir)
+	}
+}
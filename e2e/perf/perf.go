@@ -0,0 +1,97 @@
+// Package perf measures the duration and memory usage of a command, for
+// detecting performance regressions.
+package perf
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nirs/kubectl-gather/e2e/commands"
+)
+
+// Interval between memory samples.
+const sampleInterval = 100 * time.Millisecond
+
+// Result is the performance of a command.
+type Result struct {
+	Duration time.Duration
+
+	// Maximum resident set size in bytes, sampled every 100 milliseconds. Zero
+	// if memory cannot be sampled on this platform.
+	MaxRSS int64
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf("duration %.3f seconds, max rss %.1f MiB",
+		r.Duration.Seconds(), float64(r.MaxRSS)/(1<<20))
+}
+
+// Run runs cmd, logging its stderr, and returns the command performance.
+func Run(cmd *exec.Cmd) (*Result, error) {
+	start := time.Now()
+
+	wait, err := commands.StartLogStderr(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var maxRSS atomic.Int64
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(sampleInterval)
+		defer ticker.Stop()
+		for {
+			if rss, err := processRSS(cmd.Process.Pid); err == nil && rss > maxRSS.Load() {
+				maxRSS.Store(rss)
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	err = wait()
+	close(done)
+	<-sampled
+
+	return &Result{Duration: time.Since(start), MaxRSS: maxRSS.Load()}, err
+}
+
+// processRSS returns the resident set size of process pid in bytes, using
+// /proc/{pid}/status. Available only on Linux.
+func processRSS(pid int) (int64, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// VmRSS:	   12345 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "VmRSS:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kb << 10, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, fmt.Errorf("VmRSS not found for pid %d", pid)
+}
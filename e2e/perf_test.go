@@ -0,0 +1,62 @@
+package e2e_test
+
+import (
+	"flag"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/nirs/kubectl-gather/e2e/clusters"
+	"github.com/nirs/kubectl-gather/e2e/perf"
+)
+
+var (
+	perfTest       = flag.Bool("perf", false, "run the performance test")
+	perfNamespaces = flag.Int("perf-namespaces", 50, "number of namespaces to create for the performance test")
+	perfObjects    = flag.Int("perf-objects", 100, "number of objects to create in every namespace for the performance test")
+	perfDuration   = flag.Duration("perf-max-duration", 2*time.Minute, "maximum gather duration")
+	perfRSS        = flag.Int64("perf-max-rss", 512, "maximum gather resident set size in MiB")
+)
+
+// TestGatherPerformance gathers a cluster populated with many objects, and
+// fails if the gather is slower or uses more memory than the thresholds,
+// guarding against regressions like queue deadlocks.
+func TestGatherPerformance(t *testing.T) {
+	if !*perfTest {
+		t.Skip("performance test not enabled (use -perf)")
+	}
+
+	name := clusters.Names()[0]
+	if err := clusters.Populate(name, *perfNamespaces, *perfObjects); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := clusters.Depopulate(name); err != nil {
+			t.Logf("Cannot depopulate cluster %q: %s", name, err)
+		}
+	})
+
+	cmd := exec.Command(
+		executable,
+		"--contexts", name,
+		"--kubeconfig", clusters.Kubeconfig(),
+		"--directory", "test-gather-perf.out",
+	)
+	result, err := perf.Run(cmd)
+	if err != nil {
+		t.Fatalf("kubectl-gather failed: %s", err)
+	}
+
+	t.Logf("Gathered %d namespaces x %d objects: %s", *perfNamespaces, *perfObjects, result)
+
+	if result.Duration > *perfDuration {
+		t.Errorf("gather took %.3f seconds (max %.3f seconds)",
+			result.Duration.Seconds(), perfDuration.Seconds())
+	}
+
+	if result.MaxRSS == 0 {
+		t.Log("Memory usage not available on this platform")
+	} else if maxRSS := *perfRSS << 20; result.MaxRSS > maxRSS {
+		t.Errorf("gather used %d MiB (max %d MiB)", result.MaxRSS>>20, *perfRSS)
+	}
+}
@@ -0,0 +1,229 @@
+// Package validate compares gathered data with golden snapshots, catching
+// unintended changes to the output layout that break downstream parsers.
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Dynamic parts of generated resource names. Kubernetes generates random
+// suffixes using an alphabet without vowels, so normal words (e.g.
+// "kube-proxy") are not matched.
+var dynamicNames = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	// Pod template hash and pod suffix (e.g. "coredns-5d78c9869d-8w6kq").
+	{regexp.MustCompile(`-[bcdfghjklmnpqrstvwxz2456789]{8,10}-[bcdfghjklmnpqrstvwxz2456789]{5}$`), "-*"},
+	// Pod template hash (e.g. replica set "coredns-5d78c9869d").
+	{regexp.MustCompile(`-[bcdfghjklmnpqrstvwxz2456789]{8,10}$`), "-*"},
+	// Generated name (e.g. "kube-proxy-x7vkp").
+	{regexp.MustCompile(`-[bcdfghjklmnpqrstvwxz2456789]{5}$`), "-*"},
+	// Event name (e.g. "busybox.17d8a3b1c2e4f5a6").
+	{regexp.MustCompile(`\.[0-9a-f]{16}$`), ".*"},
+	// UID (e.g. "pvc-0b2a3c4d-...").
+	{regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`), "*"},
+}
+
+// Options configure the snapshot.
+type Options struct {
+	// Replace maps dynamic strings in paths (e.g. the cluster name) to stable
+	// placeholders.
+	Replace map[string]string
+
+	// Ignore is a list of patterns (see path.Match) for paths that may or may
+	// not exist (e.g. "*/previous.log"). Patterns without a slash match the
+	// file name.
+	Ignore []string
+
+	// Schemas is a list of JSON files (relative paths) recorded with their
+	// structure, replacing values with their type.
+	Schemas []string
+}
+
+// Snapshot returns a normalized snapshot of the gathered tree in dir. The
+// snapshot includes the sorted unique normalized paths, and the structure of
+// the schema files.
+func Snapshot(dir string, opts Options) (string, error) {
+	replacer := newReplacer(opts.Replace)
+	paths := map[string]struct{}{}
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = normalizePath(replacer.Replace(filepath.ToSlash(rel)))
+		if !ignored(rel, opts.Ignore) {
+			paths[rel] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+
+	for _, p := range slices.Sorted(maps.Keys(paths)) {
+		fmt.Fprintln(&b, p)
+	}
+
+	for _, name := range opts.Schemas {
+		schema, err := jsonSchema(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s: %s\n", name, schema)
+	}
+
+	return b.String(), nil
+}
+
+// Compare compares the snapshot of dir with the golden snapshot file. If
+// update is true, the golden file is written instead.
+func Compare(dir string, golden string, opts Options, update bool) error {
+	snapshot, err := Snapshot(dir, opts)
+	if err != nil {
+		return err
+	}
+
+	if update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0750); err != nil {
+			return err
+		}
+		return os.WriteFile(golden, []byte(snapshot), 0640)
+	}
+
+	data, err := os.ReadFile(golden)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("golden snapshot %q is missing (run \"make update-golden\" to create it)", golden)
+		}
+		return err
+	}
+
+	if diff := Diff(string(data), snapshot); diff != "" {
+		return fmt.Errorf("gathered tree %q does not match golden snapshot %q:\n%s", dir, golden, diff)
+	}
+
+	return nil
+}
+
+// Diff returns the lines missing in actual ("-") and the unexpected lines in
+// actual ("+"), or an empty string if the snapshots are equal.
+func Diff(expected string, actual string) string {
+	want := strings.Split(strings.TrimSpace(expected), "\n")
+	got := strings.Split(strings.TrimSpace(actual), "\n")
+
+	var b strings.Builder
+	for _, line := range want {
+		if !slices.Contains(got, line) {
+			fmt.Fprintf(&b, "- %s\n", line)
+		}
+	}
+	for _, line := range got {
+		if !slices.Contains(want, line) {
+			fmt.Fprintf(&b, "+ %s\n", line)
+		}
+	}
+	return b.String()
+}
+
+// normalizePath replaces dynamic names in every path component.
+func normalizePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		ext := path.Ext(part)
+		name := strings.TrimSuffix(part, ext)
+		for _, dn := range dynamicNames {
+			name = dn.re.ReplaceAllString(name, dn.replacement)
+		}
+		parts[i] = name + ext
+	}
+	return strings.Join(parts, "/")
+}
+
+func ignored(p string, patterns []string) bool {
+	for _, pattern := range patterns {
+		target := p
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(p)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonSchema returns the structure of a JSON file, replacing values with
+// their type.
+func jsonSchema(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return "", fmt.Errorf("invalid json %q: %w", name, err)
+	}
+
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(valueSchema(value)); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(b.String()), nil
+}
+
+func valueSchema(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		schema := map[string]interface{}{}
+		for key, item := range v {
+			schema[key] = valueSchema(item)
+		}
+		return schema
+	case []interface{}:
+		if len(v) == 0 {
+			return []interface{}{}
+		}
+		return []interface{}{valueSchema(v[0])}
+	case string:
+		return "<string>"
+	case float64:
+		return "<number>"
+	case bool:
+		return "<bool>"
+	default:
+		return "<null>"
+	}
+}
+
+func newReplacer(replace map[string]string) *strings.Replacer {
+	var pairs []string
+	for _, old := range slices.Sorted(maps.Keys(replace)) {
+		pairs = append(pairs, old, replace[old])
+	}
+	return strings.NewReplacer(pairs...)
+}
@@ -4,14 +4,25 @@
 package gather
 
 import (
+	"context"
+	"fmt"
+	"maps"
 	"net/http"
+	"runtime/debug"
 	"slices"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 )
 
+// AddonWorkFunc is addon work queued on the work queue. The context is
+// cancelled when the work does not complete in the addon timeout. Work must
+// pass the context to blocking calls (e.g. RemoteCommand.WithContext), so it
+// exits soon after it was cancelled.
+type AddonWorkFunc func(ctx context.Context) error
+
 type AddonBackend interface {
 	// Config returns the rest config for this cluster that can be used to
 	// create a new client.
@@ -27,18 +38,60 @@ type AddonBackend interface {
 	// Options returns gathering options for this cluster.
 	Options() *Options
 
-	// Queue function on the work queue.
-	Queue(WorkFunc)
+	// Queue function on the work queue. The time spent in the function is
+	// accounted to the addon in the cluster timing.
+	Queue(AddonWorkFunc)
+
+	// QueueNamespace queues function on the work queue. The time spent in the
+	// function is accounted to the addon in the namespace timing.
+	QueueNamespace(string, AddonWorkFunc)
 
 	// GatherResource gathers the specified resource asynchronically.
 	GatherResource(schema.GroupVersionResource, types.NamespacedName)
+
+	// AddError records data that could not be gathered in the error report
+	// (e.g. resource "pods/log", namespace, name, reason LogFailed), marking
+	// the namespace as partially gathered.
+	AddError(resource string, namespace string, name string, reason string, err error)
+
+	// Retry runs work again when the gather completes, after recording an
+	// error with AddError for the same resource, namespace and name. The
+	// recorded errors are replaced by the errors recorded by the retry.
+	// Retries are skipped if Options.RetryFailed is not set, or if the
+	// operation failing with err cannot succeed.
+	Retry(resource string, namespace string, name string, err error, work AddonWorkFunc)
 }
 
+// Time to wait for addon work cancelled after the addon timeout to exit.
+const abandonedAddonsTimeout = 30 * time.Second
+
+// AddonFailed is recorded in the error report when an addon panics or does
+// not complete in time. The resource is the addon name.
+const AddonFailed = "AddonFailed"
+
 type addonFunc func(AddonBackend) (Addon, error)
 
+type backendFunc func(name string, info addonInfo) AddonBackend
+
 type addonInfo struct {
-	Resource  string
+	// Resources inspected by the addon.
+	Resources []string
 	AddonFunc addonFunc
+
+	// MaxConcurrency limits the number of addon work functions running at
+	// the same time, preventing the addon from overwhelming the cluster (e.g.
+	// too many agent pods or remote commands). If zero, the addon may use all
+	// workers.
+	MaxConcurrency int
+
+	// Priority of addon work in the work queue.
+	Priority Priority
+
+	// Agents is true if the addon creates agent pods or runs commands in
+	// pods. Such addons are disabled in read only mode unless agents are
+	// allowed. Addons running optional commands may check
+	// Options.AgentsAllowed before running them instead.
+	Agents bool
 }
 
 var addonRegistry = map[string]addonInfo{}
@@ -47,26 +100,173 @@ func registerAddon(name string, ai addonInfo) {
 	addonRegistry[name] = ai
 }
 
-func createAddons(backend AddonBackend) (map[string]Addon, error) {
-	registry := map[string]Addon{}
+// enabledAddon is an addon created for gathering a cluster.
+type enabledAddon struct {
+	Name string
+	Addon
+}
+
+// createAddons creates the enabled addons, mapping resource names to the
+// addons inspecting the resource. Addons inspecting the same resource are
+// sorted by name. An addon function may return a nil addon if the addon has
+// nothing to do with the current options.
+func createAddons(opts *Options, newBackend backendFunc) (map[string][]*enabledAddon, error) {
+	registry := map[string][]*enabledAddon{}
 
-	for name, addonInfo := range addonRegistry {
-		if addonEnabled(name, backend.Options()) {
-			addon, err := addonInfo.AddonFunc(backend)
+	for _, name := range slices.Sorted(maps.Keys(addonRegistry)) {
+		addonInfo := addonRegistry[name]
+		if addonEnabled(name, opts) {
+			// Addons enabled explicitly are rejected by Options.Validate.
+			if addonInfo.Agents && !opts.AgentsAllowed() {
+				opts.Log.Warnf("Addon %q creates agent pods or runs commands in pods, disabled in read only mode (use --allow-agents to enable it)", name)
+				continue
+			}
+			addon, err := addonInfo.AddonFunc(newBackend(name, addonInfo))
 			if err != nil {
 				return nil, err
 			}
-			registry[addonInfo.Resource] = addon
+			if addon == nil {
+				continue
+			}
+			enabled := &enabledAddon{Name: name, Addon: addon}
+			for _, resource := range addonInfo.Resources {
+				registry[resource] = append(registry[resource], enabled)
+			}
 		}
 	}
 
 	return registry, nil
 }
 
+// runAddon runs addon work, isolating the gather from a misbehaving addon. A
+// panic in the work is recovered and recorded in the error report. If the
+// work does not complete in the addon timeout, its context is cancelled and we
+// stop waiting, so the worker can continue with other work. The gather waits
+// for abandoned work before completing.
+func (g *Gatherer) runAddon(name string, namespace string, work AddonWorkFunc) error {
+	return g.runAddonTimeout(name, namespace, g.opts.AddonTimeout, work)
+}
+
+// runAddonTimeout runs addon work like runAddon, with timeout instead of the
+// addon timeout. If timeout is zero, the work is not limited.
+func (g *Gatherer) runAddonTimeout(name string, namespace string, timeout time.Duration, work AddonWorkFunc) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+		defer cancel()
+		defer func() {
+			if r := recover(); r != nil {
+				g.log.Errorf("Addon %q panicked: %v\n%s", name, r, debug.Stack())
+				g.addAddonError(name, namespace, fmt.Errorf("%w: %v", ErrAddonPanic, r))
+				done <- nil
+			}
+		}()
+		done <- work(ctx)
+	}()
+
+	if timeout == 0 {
+		return <-done
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		cancel()
+		err := fmt.Errorf("%w after %s", ErrAddonTimeout, timeout)
+		g.log.Warnf("Addon %q %s, work cancelled", name, err)
+		g.addAddonError(name, namespace, err)
+		g.abandonAddon(name, namespace, exited)
+		return nil
+	}
+}
+
+// abandonedAddon is addon work that did not complete in time. The work
+// context was cancelled, but the work may still be running.
+type abandonedAddon struct {
+	name      string
+	namespace string
+	exited    <-chan struct{}
+}
+
+func (g *Gatherer) abandonAddon(name string, namespace string, exited <-chan struct{}) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.abandoned = append(g.abandoned, abandonedAddon{name: name, namespace: namespace, exited: exited})
+}
+
+// waitForAbandonedAddons waits until abandoned addon work exits, so it does
+// not modify the gather directory after the gather completes. Work still
+// running after timeout is recorded in the error report, since its output may
+// be incomplete or modified later.
+func (g *Gatherer) waitForAbandonedAddons(timeout time.Duration) {
+	g.mutex.Lock()
+	abandoned := g.abandoned
+	g.abandoned = nil
+	g.mutex.Unlock()
+
+	if len(abandoned) == 0 {
+		return
+	}
+
+	g.log.Debugf("Waiting for %d abandoned addon work", len(abandoned))
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	expired := false
+
+	for _, a := range abandoned {
+		if !expired {
+			select {
+			case <-a.exited:
+				continue
+			case <-timer.C:
+				expired = true
+			}
+		}
+		select {
+		case <-a.exited:
+		default:
+			err := fmt.Errorf("%w: still running %s after cancellation", ErrAddonTimeout, timeout)
+			g.log.Warnf("Addon %q %s", a.name, err)
+			g.addAddonError(a.name, a.namespace, err)
+		}
+	}
+}
+
+func (g *Gatherer) addAddonError(name string, namespace string, err error) {
+	g.errors.Add(GatherError{
+		Resource:  name,
+		Namespace: namespace,
+		Reason:    AddonFailed,
+		Kind:      ErrorKind(err),
+		Message:   err.Error(),
+	})
+}
+
 func addonEnabled(name string, opts *Options) bool {
 	return opts.Addons == nil || slices.Contains(opts.Addons, name)
 }
 
+// AgentAddons returns the names of the addons creating agent pods or running
+// commands in pods.
+func AgentAddons() []string {
+	var addonNames []string
+	for name, info := range addonRegistry {
+		if info.Agents {
+			addonNames = append(addonNames, name)
+		}
+	}
+	slices.Sort(addonNames)
+	return addonNames
+}
+
 func AvailableAddons() []string {
 	addonNames := make([]string, 0, len(addonRegistry))
 	for name := range addonRegistry {
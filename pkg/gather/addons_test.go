@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunAddonTimeoutCancelsWork(t *testing.T) {
+	g, _ := newTestGatherer(t, Options{}, &fakeLister{})
+
+	exited := make(chan struct{})
+	err := g.runAddonTimeout("test", "my-app", 10*time.Millisecond, func(ctx context.Context) error {
+		defer close(exited)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g.waitForAbandonedAddons(time.Second)
+
+	select {
+	case <-exited:
+	default:
+		t.Fatal("abandoned work still running")
+	}
+
+	errs := g.errors.Errors()
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %+v", errs)
+	}
+	if e := errs[0]; e.Resource != "test" || e.Namespace != "my-app" || e.Reason != AddonFailed || e.Kind != "AddonTimeout" {
+		t.Errorf("unexpected error %+v", e)
+	}
+}
+
+func TestWaitForAbandonedAddonsStillRunning(t *testing.T) {
+	g, _ := newTestGatherer(t, Options{}, &fakeLister{})
+
+	// Work ignoring the context.
+	exited := make(chan struct{})
+	g.abandonAddon("test", "my-app", exited)
+	defer close(exited)
+
+	timeout := 10 * time.Millisecond
+	start := time.Now()
+	g.waitForAbandonedAddons(timeout)
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Errorf("returned after %s before timeout", elapsed)
+	}
+
+	errs := g.errors.Errors()
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %+v", errs)
+	}
+	if e := errs[0]; e.Resource != "test" || e.Reason != AddonFailed || e.Kind != "AddonTimeout" {
+		t.Errorf("unexpected error %+v", e)
+	}
+}
+
+func TestQueueNamespaceKeepsSlotUntilWorkExits(t *testing.T) {
+	g, _ := newTestGatherer(t, Options{AddonTimeout: 10 * time.Millisecond}, &fakeLister{})
+	b := newGatherBackend(g, "test", addonInfo{MaxConcurrency: 1})
+
+	release := make(chan struct{})
+	var firstExited atomic.Bool
+	var overlapped atomic.Bool
+
+	g.wq.Start()
+
+	// Times out and ignores the context, holding the slot until released.
+	b.QueueNamespace("my-app", func(context.Context) error {
+		<-release
+		firstExited.Store(true)
+		return nil
+	})
+	b.QueueNamespace("my-app", func(context.Context) error {
+		if !firstExited.Load() {
+			overlapped.Store(true)
+		}
+		return nil
+	})
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	if err := g.wq.Wait(); err != nil && !errors.Is(err, ErrAddonTimeout) {
+		t.Fatal(err)
+	}
+	g.waitForAbandonedAddons(time.Second)
+
+	if overlapped.Load() {
+		t.Error("work started before abandoned work released the slot")
+	}
+}
+
+func TestQueueNamespaceDoesNotBlockWorkers(t *testing.T) {
+	g, _ := newTestGatherer(t, Options{AddonTimeout: 10 * time.Millisecond}, &fakeLister{})
+	g.wq = NewWorkQueue(1, 0)
+	b := newGatherBackend(g, "test", addonInfo{MaxConcurrency: 1})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	g.wq.Start()
+
+	// Times out and ignores the context, holding the only slot until released.
+	b.QueueNamespace("my-app", func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	b.QueueNamespace("my-app", func(context.Context) error {
+		return nil
+	})
+
+	// Let the first work time out, so the only worker is free while the
+	// second work waits for the slot.
+	<-started
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan struct{})
+	g.wq.Queue(func() error {
+		close(done)
+		return nil
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("resource work blocked by addon waiting for a slot")
+	}
+
+	close(release)
+
+	if err := g.wq.Wait(); err != nil && !errors.Is(err, ErrAddonTimeout) {
+		t.Fatal(err)
+	}
+	g.waitForAbandonedAddons(time.Second)
+}
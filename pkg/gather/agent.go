@@ -6,6 +6,7 @@ package gather
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -20,8 +21,39 @@ import (
 
 const (
 	agentPodTimeoutSeconds = 60
+
+	// TemporaryLabel marks temporary resources created during gathering. If
+	// gathering crashed, leftover resources can be found and deleted using
+	// this label.
+	TemporaryLabel = "gather.nirs.github.io/temporary"
 )
 
+// agentPods tracks running agent pods, so we can delete them when the
+// program is interrupted.
+var agentPods = struct {
+	mutex   sync.Mutex
+	pods    map[*AgentPod]struct{}
+	stopped bool
+}{
+	pods: map[*AgentPod]struct{}{},
+}
+
+// DeleteAgentPods deletes all agent pods and prevents creation of new agent
+// pods. Called when the program is interrupted.
+func DeleteAgentPods() {
+	agentPods.mutex.Lock()
+	agentPods.stopped = true
+	pods := make([]*AgentPod, 0, len(agentPods.pods))
+	for agent := range agentPods.pods {
+		pods = append(pods, agent)
+	}
+	agentPods.mutex.Unlock()
+
+	for _, agent := range pods {
+		agent.Delete()
+	}
+}
+
 type AgentPod struct {
 	Client *kubernetes.Clientset
 	Log    *zap.SugaredLogger
@@ -35,6 +67,9 @@ func NewAgentPod(name string, client *kubernetes.Clientset, log *zap.SugaredLogg
 	pod := corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: "gather-agent-" + name,
+			Labels: map[string]string{
+				TemporaryLabel: "true",
+			},
 
 			// TODO: Use a tempoary random gather namespace so we don't leave
 			// leftovers in real namespaces, and if we leave leftovers is it
@@ -68,6 +103,13 @@ func NewAgentPod(name string, client *kubernetes.Clientset, log *zap.SugaredLogg
 }
 
 func (a *AgentPod) Create() error {
+	agentPods.mutex.Lock()
+	defer agentPods.mutex.Unlock()
+
+	if agentPods.stopped {
+		return fmt.Errorf("cannot create agent pod %q: %w", a, ErrInterrupted)
+	}
+
 	a.Log.Debugf("Starting agent pod %q", a)
 	pod, err := a.Client.CoreV1().Pods(a.Pod.Namespace).
 		Create(context.TODO(), a.Pod, metav1.CreateOptions{})
@@ -76,6 +118,7 @@ func (a *AgentPod) Create() error {
 	}
 
 	a.Pod = pod
+	agentPods.pods[a] = struct{}{}
 	return nil
 }
 
@@ -110,22 +153,32 @@ func (a *AgentPod) WaitUntilRunning() error {
 			case corev1.PodRunning:
 				return nil
 			case corev1.PodFailed:
-				return fmt.Errorf("agent pod %q failed", a)
+				return fmt.Errorf("%w: agent pod %q failed", ErrAgentPodFailed, a)
 			case corev1.PodSucceeded:
-				return fmt.Errorf("agent pod %q terminated", a)
+				return fmt.Errorf("%w: agent pod %q terminated", ErrAgentPodFailed, a)
 			}
 		case watch.Error:
 			err := apierrors.FromObject(event.Object)
-			return fmt.Errorf("agent pod %q watch error: %s", a, err)
+			return fmt.Errorf("%w: agent pod %q watch error: %w", ErrAgentPodFailed, a, err)
 		case watch.Deleted:
-			return fmt.Errorf("agent pod %q was deleted", a)
+			return fmt.Errorf("%w: agent pod %q was deleted", ErrAgentPodFailed, a)
 		}
 	}
 
-	return fmt.Errorf("timeout waiting for agent pod %q running phase", a)
+	return fmt.Errorf("%w: timeout waiting for agent pod %q running phase", ErrAgentPodFailed, a)
 }
 
 func (a *AgentPod) Delete() {
+	agentPods.mutex.Lock()
+	_, ok := agentPods.pods[a]
+	delete(agentPods.pods, a)
+	agentPods.mutex.Unlock()
+
+	// Already deleted when interrupted.
+	if !ok {
+		return
+	}
+
 	a.Log.Debugf("Deleting agent pod %q", a)
 	err := a.Client.CoreV1().Pods(a.Pod.Namespace).
 		Delete(context.TODO(), a.Pod.Name, metav1.DeleteOptions{})
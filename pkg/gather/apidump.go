@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	stderrors "errors"
+	"path"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const apiDumpDir = "api-dump"
+
+// apiDumps records the raw list responses already stored, so every resource
+// is dumped once per namespace.
+type apiDumps struct {
+	mutex  sync.Mutex
+	dumped map[string]struct{}
+}
+
+func (d *apiDumps) Add(relpath string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.dumped[relpath]; ok {
+		return false
+	}
+
+	if d.dumped == nil {
+		d.dumped = map[string]struct{}{}
+	}
+	d.dumped[relpath] = struct{}{}
+	return true
+}
+
+// isDecodeError returns true if listing failed after the API server returned
+// the list, for example when an object of an exotic custom resource cannot be
+// decoded. Errors returned by the API server are not related to parsing.
+func isDecodeError(err error) bool {
+	var status apierrors.APIStatus
+	return !stderrors.As(err, &status)
+}
+
+// dumpAPIResponse stores the raw JSON response for the first page of resource
+// r in namespace, so maintainers can reproduce parsing bugs with the exact
+// data the gather failed to handle. Used only when Options.DebugAPIDump is
+// set.
+func (g *Gatherer) dumpAPIResponse(r *resourceInfo, namespace string) {
+	if !g.opts.DebugAPIDump {
+		return
+	}
+
+	segments := resourcePath(r, namespace)
+	relpath := path.Join(clusterDir, apiDumpDir, path.Join(segments...)+".json")
+	if !g.apiDumps.Add(relpath) {
+		return
+	}
+
+	opts := metav1.ListOptions{Limit: listResourcesLimit}
+	data, err := g.stream.Get().
+		AbsPath(segments...).
+		SpecificallyVersionedParams(&opts, metav1.ParameterCodec, metav1.SchemeGroupVersion).
+		DoRaw(context.TODO())
+	if err != nil {
+		g.log.Warnf("Cannot dump %q response: %s", r.Name(), err)
+		return
+	}
+
+	dst, err := g.output.CreateResource(relpath)
+	if err != nil {
+		g.log.Warnf("Cannot create %q: %s", relpath, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if _, err := dst.Write(data); err != nil {
+		g.log.Warnf("Cannot write %q: %s", relpath, err)
+		return
+	}
+
+	g.log.Debugf("Dumped %q response to %q", r.Name(), relpath)
+}
@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestGatherResourcesDebugAPIDump(t *testing.T) {
+	response := `{"kind":"PersistentVolumeList","apiVersion":"v1","items":[{"bad":`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, response)
+	}))
+	defer server.Close()
+
+	lister := &fakeLister{err: fmt.Errorf("unexpected EOF")}
+	g, _ := newTestGatherer(t, Options{DebugAPIDump: true}, lister)
+
+	stream, err := newStreamClient(&rest.Config{Host: server.URL}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.stream = stream
+
+	g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+	g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+
+	data, err := os.ReadFile(filepath.Join(g.output.base, clusterDir, apiDumpDir, "api", "v1", "persistentvolumes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != response {
+		t.Errorf("expected response %q, got %q", response, data)
+	}
+}
@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	apiServicesReportName = "apiservices-report.yaml"
+)
+
+var apiServicesResource = schema.GroupVersionResource{
+	Group:    "apiregistration.k8s.io",
+	Version:  "v1",
+	Resource: "apiservices",
+}
+
+// APIServicesReport records the availability of aggregated APIs. Broken
+// aggregated APIs fail discovery of their group, so resources in the group
+// cannot be gathered, and are often the root cause of other failures.
+type APIServicesReport struct {
+	// Group versions that failed discovery. Resources in these group versions
+	// were not gathered.
+	FailedGroups []FailedGroup `json:"failedGroups"`
+
+	// Aggregated API services and API services that are not available.
+	APIServices []APIServiceStatus `json:"apiServices"`
+}
+
+type FailedGroup struct {
+	GroupVersion string `json:"groupVersion"`
+	Error        string `json:"error"`
+}
+
+type APIServiceStatus struct {
+	Name      string `json:"name"`
+	Service   string `json:"service,omitempty"`
+	Available string `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// recordDiscoveryError records the groups that failed discovery in the api
+// services report and the error report, so one broken group does not prevent
+// gathering the other groups. Returns the error if this is not a partial
+// discovery failure.
+func (g *Gatherer) recordDiscoveryError(err error) error {
+	var failed *discovery.ErrGroupDiscoveryFailed
+	if !errors.As(err, &failed) {
+		return err
+	}
+
+	for gv, err := range failed.Groups {
+		g.log.Warnf("Cannot discover %q: %s", gv.String(), err)
+		g.failedGroups = append(g.failedGroups, FailedGroup{
+			GroupVersion: gv.String(),
+			Error:        err.Error(),
+		})
+		g.errors.Add(GatherError{
+			Resource: gv.String(),
+			Reason:   DiscoveryFailed,
+			Kind:     ErrorKind(wrapAPIError(err)),
+			Message:  err.Error(),
+		})
+	}
+
+	slices.SortFunc(g.failedGroups, func(a, b FailedGroup) int {
+		return strings.Compare(a.GroupVersion, b.GroupVersion)
+	})
+
+	return nil
+}
+
+// gatherAPIServicesReport writes the api services report to the cluster
+// directory.
+func (g *Gatherer) gatherAPIServicesReport() {
+	report := APIServicesReport{FailedGroups: g.failedGroups}
+
+	list, err := g.client.Resource(apiServicesResource).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		g.log.Warnf("Cannot list %q: %s", apiServicesResource.GroupResource().String(), err)
+	} else {
+		for i := range list.Items {
+			status := apiServiceStatus(&list.Items[i])
+			if status.Service != "" || status.Available != string(metav1.ConditionTrue) {
+				report.APIServices = append(report.APIServices, status)
+			}
+		}
+	}
+
+	data, err := yaml.Marshal(&report)
+	if err != nil {
+		g.log.Warnf("Cannot encode %q: %s", apiServicesReportName, err)
+		return
+	}
+
+	dst, err := g.output.CreateClusterFile(apiServicesReportName)
+	if err != nil {
+		g.log.Warnf("Cannot create %q: %s", apiServicesReportName, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if _, err := dst.Write(data); err != nil {
+		g.log.Warnf("Cannot write %q: %s", apiServicesReportName, err)
+	}
+}
+
+func apiServiceStatus(item *unstructured.Unstructured) APIServiceStatus {
+	status := APIServiceStatus{
+		Name:      item.GetName(),
+		Available: string(metav1.ConditionUnknown),
+	}
+
+	namespace, _, _ := unstructured.NestedString(item.Object, "spec", "service", "namespace")
+	name, _, _ := unstructured.NestedString(item.Object, "spec", "service", "name")
+	if name != "" {
+		status.Service = namespace + "/" + name
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(item.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Available" {
+			continue
+		}
+		status.Available, _ = condition["status"].(string)
+		status.Reason, _ = condition["reason"].(string)
+		status.Message, _ = condition["message"].(string)
+	}
+
+	return status
+}
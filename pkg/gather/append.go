@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// loadPrevious loads the index, metadata, errors, inventory and timing of
+// previous gathers in the cluster directory, so resources are not gathered
+// again when appending, and the reports written when the gather completes
+// include the previous gathers. An empty cluster directory is a valid previous
+// gather.
+func (g *Gatherer) loadPrevious() error {
+	entries, err := ReadIndex(g.output.base)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			g.log.Debugf("No previous gather in %q", g.output.base)
+			return nil
+		}
+		return fmt.Errorf("cannot append to %q: %w", g.output.base, err)
+	}
+
+	metadata, err := readMetadata(g.output.base)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot append to %q: %w", g.output.base, err)
+	}
+
+	previousErrors, err := readErrors(g.output.base)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot append to %q: %w", g.output.base, err)
+	}
+
+	rows, err := readInventory(g.output.base)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot append to %q: %w", g.output.base, err)
+	}
+
+	timing, err := readTiming(g.output.base)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot append to %q: %w", g.output.base, err)
+	}
+
+	g.previous = make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		g.previous[entry.Path] = false
+		g.index.Add(entry)
+	}
+
+	if metadata != nil {
+		g.previousAddons = metadata.Addons
+		g.skippedResources = metadata.SkippedResources
+		g.truncatedResources = metadata.TruncatedResources
+	}
+
+	g.previousErrors = previousErrors
+	g.previousTiming = timing
+	g.inventory.AddPrevious(rows)
+
+	g.log.Infof("Appending to previous gather with %d resources (addons %q)",
+		len(entries), g.previousAddons)
+
+	return nil
+}
+
+// claimPrevious returns true if the resource at relpath was gathered by a
+// previous gather. first is true the first time this gather sees it.
+func (g *Gatherer) claimPrevious(relpath string) (gathered bool, first bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	seen, ok := g.previous[relpath]
+	if !ok {
+		return false, false
+	}
+
+	g.previous[relpath] = true
+	return true, !seen
+}
+
+// readMetadata reads the metadata of the cluster directory.
+func readMetadata(clusterDir string) (*Metadata, error) {
+	data, err := os.ReadFile(filepath.Join(clusterDir, metadataName))
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &Metadata{}
+	if err := json.Unmarshal(data, metadata); err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestGatherResourcesAppend(t *testing.T) {
+	dir := t.TempDir()
+	lister := &fakeLister{items: newItems(10)}
+
+	// First gather 5 items.
+	g, _ := newTestGathererIn(t, dir, Options{}, &fakeLister{items: newItems(5)})
+	g.dumper = &resourceWriter{output: &g.output, index: &g.index, written: &g.written}
+	g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+	g.writeIndex()
+	g.writeMetadata(true)
+
+	// Append gathers only the new items.
+	g, dumper := newTestGathererIn(t, dir, Options{Append: true}, lister)
+	g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+
+	if len(dumper.items) != 5 {
+		t.Errorf("expected 5 new items, got %q", dumper.items)
+	}
+	if g.Count() != 5 {
+		t.Errorf("expected count 5, got %d", g.Count())
+	}
+	if n := len(g.index.Entries()); n != 5 {
+		t.Errorf("expected 5 previous index entries, got %d", n)
+	}
+
+	g.writeMetadata(true)
+	metadata, err := readMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Count != 10 {
+		t.Errorf("expected metadata count 10, got %d", metadata.Count)
+	}
+}
+
+func TestGatherResourcesAppendEmptyDirectory(t *testing.T) {
+	lister := &fakeLister{items: newItems(3)}
+	g, dumper := newTestGatherer(t, Options{Append: true}, lister)
+
+	g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+
+	if len(dumper.items) != 3 {
+		t.Errorf("expected 3 items, got %q", dumper.items)
+	}
+}
+
+func TestGatherResourcesAppendPartial(t *testing.T) {
+	dir := t.TempDir()
+	secrets := &resourceInfo{
+		GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: "secrets"},
+		Namespaced:           true,
+	}
+	configMaps := &resourceInfo{
+		GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		Namespaced:           true,
+	}
+
+	// First gather fails to list persistent volumes.
+	lister := &fakeLister{err: errors.NewServiceUnavailable("try later")}
+	g, _ := newTestGathererIn(t, dir, Options{}, lister)
+	g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+	item := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "my-app", Name: "s1"}}
+	if err := g.inventory.Add(secrets, item); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	g.timing.AddRun(start, start.Add(time.Second))
+	finishTestGather(t, g)
+
+	// Append gathers other resources without errors.
+	g, _ = newTestGathererIn(t, dir, Options{Append: true}, &fakeLister{items: newItems(3)})
+	g.gatherResources(&persistentVolumes, "other")
+	item = &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "my-app", Name: "cm1"}}
+	if err := g.inventory.Add(configMaps, item); err != nil {
+		t.Fatal(err)
+	}
+	g.timing.AddRun(start.Add(5*time.Second), start.Add(7*time.Second))
+	finishTestGather(t, g)
+
+	errs, err := readErrors(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0].Resource != "persistentvolumes" {
+		t.Errorf("expected previous error, got %+v", errs)
+	}
+
+	metadata, err := readMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !metadata.Partial || !slices.Equal(metadata.FailedResources, []string{"persistentvolumes"}) {
+		t.Errorf("expected partial gather with failed persistentvolumes, got %+v", metadata)
+	}
+
+	rows, err := readInventory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0][0] != "secrets" || rows[1][0] != "configmaps" {
+		t.Errorf("expected previous and new inventory rows, got %q", rows)
+	}
+
+	timing, err := readTiming(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timing.Total != 7 || len(timing.Runs) != 2 {
+		t.Errorf("expected 2 runs in 7 seconds, got %+v", timing)
+	}
+}
+
+// finishTestGather writes the reports written when Gather completes.
+func finishTestGather(t *testing.T, g *Gatherer) {
+	if err := g.inventory.Close(); err != nil {
+		t.Fatal(err)
+	}
+	g.writeTiming()
+	g.writeIndex()
+	g.writeErrors()
+	g.writeMetadata(true)
+}
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// WriteArchive writes a gzip compressed tar archive of directory to w. Entries
+// are stored under name, so extracting the archive creates the directory name.
+// Regular files, directories and symbolic links are archived, other files are
+// skipped.
+func WriteArchive(directory string, name string, w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+
+	err := filepath.WalkDir(directory, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relpath, err := filepath.Rel(directory, filename)
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		return writeArchiveEntry(tw, filename, path.Join(name, filepath.ToSlash(relpath)), info)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func writeArchiveEntry(tw *tar.Writer, filename string, name string, info fs.FileInfo) error {
+	var link string
+
+	switch mode := info.Mode(); {
+	case mode.IsRegular(), mode.IsDir():
+	case mode&fs.ModeSymlink != 0:
+		target, err := os.Readlink(filename)
+		if err != nil {
+			return err
+		}
+		link = filepath.ToSlash(target)
+	default:
+		return nil
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Copy only the size in the header; gather.log may grow while we archive.
+	_, err = io.CopyN(tw, f, hdr.Size)
+	return err
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteArchive(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "cluster", "nodes"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cluster", "nodes", "node1.yaml"), []byte("kind: Node\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("cluster/nodes/node1.yaml", filepath.Join(dir, "node1.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteArchive(dir, "gather.test", &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := map[string]string{}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[hdr.Name] = string(data) + hdr.Linkname
+	}
+
+	expected := map[string]string{
+		"gather.test/":                         "",
+		"gather.test/cluster/":                 "",
+		"gather.test/cluster/nodes/":           "",
+		"gather.test/cluster/nodes/node1.yaml": "kind: Node\n",
+		"gather.test/node1.yaml":               "cluster/nodes/node1.yaml",
+	}
+	if !maps.Equal(entries, expected) {
+		t.Errorf("expected entries %v, got %v", expected, entries)
+	}
+}
@@ -0,0 +1,473 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	autoscalerName          = "autoscaler"
+	nodeGroupsReportName    = "node-groups.txt"
+	scalingEventsReportName = "scaling-events.txt"
+
+	// Config map recording the cluster autoscaler status.
+	autoscalerStatusConfigMap = "cluster-autoscaler-status"
+
+	// Label of nodes created by a karpenter node pool.
+	nodePoolLabel = "karpenter.sh/nodepool"
+
+	// OpenShift machine set annotations configured by the machine autoscaler.
+	machineSetMinSizeAnnotation = "machine.openshift.io/cluster-api-autoscaler-node-group-min-size"
+	machineSetMaxSizeAnnotation = "machine.openshift.io/cluster-api-autoscaler-node-group-max-size"
+)
+
+var (
+	machineSetsResource = schema.GroupVersionResource{Group: "machine.openshift.io", Version: "v1beta1", Resource: "machinesets"}
+	nodePoolsResource   = schema.GroupVersionResource{Group: "karpenter.sh", Version: "v1", Resource: "nodepools"}
+
+	// Label selectors for the cluster autoscaler and karpenter pods, used by
+	// OpenShift, the upstream manifests and the helm charts.
+	autoscalerPodSelectors = []string{
+		"k8s-app=cluster-autoscaler",
+		"app=cluster-autoscaler",
+		"app.kubernetes.io/name=cluster-autoscaler",
+		"app.kubernetes.io/name=clusterapi-cluster-autoscaler",
+		"app.kubernetes.io/name=karpenter",
+	}
+
+	// Event sources of the autoscalers.
+	autoscalerEventSources = []string{"cluster-autoscaler", "karpenter"}
+)
+
+// nodeGroup describes the capacity of a group of nodes scaled by an
+// autoscaler.
+type nodeGroup struct {
+	Kind      string
+	Namespace string
+	Name      string
+
+	// Desired number of nodes, or -1 if the group has no desired size.
+	Desired int64
+
+	// Number of ready nodes.
+	Ready int64
+
+	// Size limits configured for the autoscaler.
+	Min string
+	Max string
+
+	// Resource limits and usage of karpenter node pools.
+	Limits string
+	Usage  string
+
+	Problems []string
+}
+
+// scalingEvent is an event reported by an autoscaler.
+type scalingEvent struct {
+	Time    time.Time
+	Type    string
+	Reason  string
+	Object  string
+	Message string
+}
+
+// AutoscalerAddon records the cluster autoscaler and karpenter pods with
+// their logs, the scaling events, and a capacity report of the node groups,
+// since scaling failures frequently accompany the incidents being gathered.
+type AutoscalerAddon struct {
+	AddonBackend
+	client  *kubernetes.Clientset
+	dynamic dynamic.Interface
+	log     *zap.SugaredLogger
+	once    sync.Once
+}
+
+func init() {
+	registerAddon(autoscalerName, addonInfo{
+		Resources: []string{"machine.openshift.io/machinesets", "karpenter.sh/nodepools"},
+		AddonFunc: NewAutoscalerAddon,
+		Priority:  PriorityAddons,
+	})
+}
+
+func NewAutoscalerAddon(backend AddonBackend) (Addon, error) {
+	client, err := kubernetes.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	return &AutoscalerAddon{
+		AddonBackend: backend,
+		client:       client,
+		dynamic:      dynamicClient,
+		log:          backend.Options().Log.Named(autoscalerName),
+	}, nil
+}
+
+func (a *AutoscalerAddon) Inspect(item *unstructured.Unstructured) error {
+	a.log.Debugf("Inspecting %s %q", strings.ToLower(item.GetKind()), item.GetName())
+
+	// All node groups are reported together.
+	a.once.Do(func() {
+		a.Queue(func(ctx context.Context) error {
+			a.gatherPods(ctx)
+			return nil
+		})
+		a.Queue(func(context.Context) error {
+			a.gatherNodeGroups()
+			return nil
+		})
+		a.Queue(func(context.Context) error {
+			a.gatherScalingEvents()
+			return nil
+		})
+	})
+
+	return nil
+}
+
+// gatherPods gathers the autoscaler pods with their logs, and the cluster
+// autoscaler status config map.
+func (a *AutoscalerAddon) gatherPods(ctx context.Context) {
+	namespaces := map[string]struct{}{}
+
+	for _, selector := range autoscalerPodSelectors {
+		pods, err := a.client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			a.log.Warnf("Cannot list pods with selector %q: %s", selector, err)
+			continue
+		}
+
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			a.log.Debugf("Gathering autoscaler pod \"%s/%s\"", pod.Namespace, pod.Name)
+			a.GatherResource(podsResource, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name})
+
+			if !logsAddonGathers(a.Options(), pod.Namespace) {
+				gatherPodLogs(ctx, a, a.client, a.log, pod)
+			}
+
+			namespaces[pod.Namespace] = struct{}{}
+		}
+	}
+
+	configMapsResource := corev1.SchemeGroupVersion.WithResource("configmaps")
+
+	for namespace := range namespaces {
+		_, err := a.client.CoreV1().ConfigMaps(namespace).Get(ctx, autoscalerStatusConfigMap, metav1.GetOptions{})
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				a.log.Warnf("Cannot get config map \"%s/%s\": %s", namespace, autoscalerStatusConfigMap, err)
+			}
+			continue
+		}
+		a.GatherResource(configMapsResource, types.NamespacedName{Namespace: namespace, Name: autoscalerStatusConfigMap})
+	}
+}
+
+// gatherNodeGroups writes the capacity report of the machine sets and node
+// pools.
+func (a *AutoscalerAddon) gatherNodeGroups() {
+	ctx := context.TODO()
+	var groups []nodeGroup
+
+	machineSets, err := a.dynamic.Resource(machineSetsResource).Namespace(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			a.log.Warnf("Cannot list machinesets: %s", err)
+		}
+	} else {
+		for i := range machineSets.Items {
+			groups = append(groups, machineSetNodeGroup(&machineSets.Items[i]))
+		}
+	}
+
+	nodePools, err := a.dynamic.Resource(nodePoolsResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			a.log.Warnf("Cannot list nodepools: %s", err)
+		}
+	} else if len(nodePools.Items) > 0 {
+		readyNodes, err := a.readyNodesByPool()
+		if err != nil {
+			a.log.Warnf("Cannot list nodes: %s", err)
+		}
+		for i := range nodePools.Items {
+			pool := &nodePools.Items[i]
+			groups = append(groups, nodePoolNodeGroup(pool, readyNodes[pool.GetName()]))
+		}
+	}
+
+	if len(groups) == 0 {
+		return
+	}
+
+	a.writeReport(nodeGroupsReportName, func(w io.Writer) error {
+		return writeNodeGroupsReport(w, groups)
+	})
+}
+
+// readyNodesByPool returns the number of ready nodes in every node pool.
+func (a *AutoscalerAddon) readyNodesByPool() (map[string]int64, error) {
+	nodes, err := a.client.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{LabelSelector: nodePoolLabel})
+	if err != nil {
+		return nil, err
+	}
+
+	ready := map[string]int64{}
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		for _, c := range node.Status.Conditions {
+			if c.Type == corev1.NodeReady && c.Status == corev1.ConditionTrue {
+				ready[node.Labels[nodePoolLabel]]++
+			}
+		}
+	}
+
+	return ready, nil
+}
+
+// gatherScalingEvents writes the events reported by the autoscalers in the
+// gather time window, sorted by time.
+func (a *AutoscalerAddon) gatherScalingEvents() {
+	opts := a.Options()
+	var events []scalingEvent
+
+	for _, source := range autoscalerEventSources {
+		list, err := a.dynamic.Resource(eventsResource).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("source", source).String(),
+		})
+		if err != nil {
+			a.log.Warnf("Cannot list %s events: %s", source, err)
+			continue
+		}
+
+		for i := range list.Items {
+			event := newScalingEvent(&list.Items[i])
+			if !opts.Since.IsZero() && event.Time.Before(opts.Since) {
+				continue
+			}
+			if !opts.Until.IsZero() && event.Time.After(opts.Until) {
+				continue
+			}
+			events = append(events, event)
+		}
+	}
+
+	if len(events) == 0 {
+		return
+	}
+
+	a.writeReport(scalingEventsReportName, func(w io.Writer) error {
+		return writeScalingEventsReport(w, events)
+	})
+}
+
+func (a *AutoscalerAddon) writeReport(name string, write func(io.Writer) error) {
+	dir, err := a.Output().CreateAddonDir(autoscalerName)
+	if err != nil {
+		a.log.Warnf("Cannot create autoscaler directory: %s", err)
+		return
+	}
+
+	dst, err := createFile(dir, name)
+	if err != nil {
+		a.log.Warnf("Cannot create %q: %s", name, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if err := write(dst); err != nil {
+		a.log.Warnf("Cannot write %q: %s", name, err)
+	}
+}
+
+func machineSetNodeGroup(machineSet *unstructured.Unstructured) nodeGroup {
+	group := nodeGroup{
+		Kind:      "MachineSet",
+		Namespace: machineSet.GetNamespace(),
+		Name:      machineSet.GetName(),
+		Min:       machineSet.GetAnnotations()[machineSetMinSizeAnnotation],
+		Max:       machineSet.GetAnnotations()[machineSetMaxSizeAnnotation],
+	}
+
+	group.Desired, _, _ = unstructured.NestedInt64(machineSet.Object, "spec", "replicas")
+	group.Ready, _, _ = unstructured.NestedInt64(machineSet.Object, "status", "readyReplicas")
+
+	if group.Ready < group.Desired {
+		group.Problems = append(group.Problems, fmt.Sprintf("%d of %d replicas ready", group.Ready, group.Desired))
+	}
+
+	if max, err := strconv.ParseInt(group.Max, 10, 64); err == nil && group.Desired >= max {
+		group.Problems = append(group.Problems, "at max size")
+	}
+
+	if message, _, _ := unstructured.NestedString(machineSet.Object, "status", "errorMessage"); message != "" {
+		group.Problems = append(group.Problems, message)
+	}
+
+	return group
+}
+
+func nodePoolNodeGroup(nodePool *unstructured.Unstructured, readyNodes int64) nodeGroup {
+	group := nodeGroup{
+		Kind:    "NodePool",
+		Name:    nodePool.GetName(),
+		Desired: -1,
+		Ready:   readyNodes,
+	}
+
+	limits, _, _ := unstructured.NestedStringMap(nodePool.Object, "spec", "limits")
+	usage, _, _ := unstructured.NestedStringMap(nodePool.Object, "status", "resources")
+
+	group.Limits = formatResourceMap(limits)
+	group.Usage = formatResourceMap(usage)
+
+	for _, name := range slices.Sorted(maps.Keys(limits)) {
+		limit, err := resource.ParseQuantity(limits[name])
+		if err != nil {
+			continue
+		}
+		used, err := resource.ParseQuantity(usage[name])
+		if err != nil {
+			continue
+		}
+		if used.Cmp(limit) >= 0 {
+			group.Problems = append(group.Problems, fmt.Sprintf("reached %s limit", name))
+		}
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(nodePool.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Ready" || condition["status"] == string(metav1.ConditionTrue) {
+			continue
+		}
+		problem := "not ready"
+		if reason, _ := condition["reason"].(string); reason != "" {
+			problem += ": " + reason
+		}
+		group.Problems = append(group.Problems, problem)
+	}
+
+	return group
+}
+
+func newScalingEvent(item *unstructured.Unstructured) scalingEvent {
+	event := scalingEvent{}
+	event.Time, _ = eventTime(item)
+	event.Type, _, _ = unstructured.NestedString(item.Object, "type")
+	event.Reason, _, _ = unstructured.NestedString(item.Object, "reason")
+	event.Message, _, _ = unstructured.NestedString(item.Object, "message")
+
+	kind, _, _ := unstructured.NestedString(item.Object, "involvedObject", "kind")
+	namespace, _, _ := unstructured.NestedString(item.Object, "involvedObject", "namespace")
+	name, _, _ := unstructured.NestedString(item.Object, "involvedObject", "name")
+	event.Object = strings.ToLower(kind) + "/" + name
+	if namespace != "" {
+		event.Object = namespace + "/" + event.Object
+	}
+
+	return event
+}
+
+// formatResourceMap formats resources sorted by name (e.g.
+// "cpu=100,memory=400Gi").
+func formatResourceMap(resources map[string]string) string {
+	var items []string
+	for _, name := range slices.Sorted(maps.Keys(resources)) {
+		items = append(items, name+"="+resources[name])
+	}
+	return strings.Join(items, ",")
+}
+
+// writeNodeGroupsReport writes the node groups sorted by kind, namespace and
+// name.
+//
+//	KIND         NAME                            DESIRED   READY   MIN   MAX   LIMITS    USAGE    PROBLEMS
+//	MachineSet   openshift-machine-api/worker-a  3         2       1     3     -         -        2 of 3 replicas ready, at max size
+func writeNodeGroupsReport(w io.Writer, groups []nodeGroup) error {
+	slices.SortFunc(groups, func(a, b nodeGroup) int {
+		if c := strings.Compare(a.Kind, b.Kind); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Namespace, b.Namespace); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAME\tDESIRED\tREADY\tMIN\tMAX\tLIMITS\tUSAGE\tPROBLEMS")
+
+	for i := range groups {
+		g := &groups[i]
+
+		name := g.Name
+		if g.Namespace != "" {
+			name = g.Namespace + "/" + name
+		}
+
+		desired := "-"
+		if g.Desired >= 0 {
+			desired = strconv.FormatInt(g.Desired, 10)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			g.Kind, name, desired, g.Ready, orDash(g.Min), orDash(g.Max),
+			orDash(g.Limits), orDash(g.Usage), orDash(strings.Join(g.Problems, ", ")))
+	}
+
+	return tw.Flush()
+}
+
+// writeScalingEventsReport writes the events sorted by time.
+//
+//	TIME                   TYPE     REASON             OBJECT              MESSAGE
+//	2024-06-01T10:20:30Z   Normal   TriggeredScaleUp   myapp/pod/web-abc   pod triggered scale-up: ...
+func writeScalingEventsReport(w io.Writer, events []scalingEvent) error {
+	slices.SortStableFunc(events, func(a, b scalingEvent) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tTYPE\tREASON\tOBJECT\tMESSAGE")
+
+	for _, e := range events {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			e.Time.UTC().Format(time.RFC3339), e.Type, e.Reason, e.Object,
+			strings.ReplaceAll(e.Message, "\n", " "))
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestMachineSetNodeGroup(t *testing.T) {
+	machineSet := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "machine.openshift.io/v1beta1",
+		"kind":       "MachineSet",
+		"metadata": map[string]interface{}{
+			"name":      "worker-a",
+			"namespace": "openshift-machine-api",
+			"annotations": map[string]interface{}{
+				machineSetMinSizeAnnotation: "1",
+				machineSetMaxSizeAnnotation: "3",
+			},
+		},
+		"spec":   map[string]interface{}{"replicas": int64(3)},
+		"status": map[string]interface{}{"readyReplicas": int64(2)},
+	}}
+
+	group := machineSetNodeGroup(machineSet)
+	expected := nodeGroup{
+		Kind:      "MachineSet",
+		Namespace: "openshift-machine-api",
+		Name:      "worker-a",
+		Desired:   3,
+		Ready:     2,
+		Min:       "1",
+		Max:       "3",
+		Problems:  []string{"2 of 3 replicas ready", "at max size"},
+	}
+	if !reflect.DeepEqual(group, expected) {
+		t.Errorf("expected %+v, got %+v", expected, group)
+	}
+}
+
+func TestNodePoolNodeGroup(t *testing.T) {
+	nodePool := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "karpenter.sh/v1",
+		"kind":       "NodePool",
+		"metadata":   map[string]interface{}{"name": "default"},
+		"spec": map[string]interface{}{
+			"limits": map[string]interface{}{"cpu": "16", "memory": "64Gi"},
+		},
+		"status": map[string]interface{}{
+			"resources": map[string]interface{}{"cpu": "16", "memory": "32Gi"},
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "False", "reason": "NodeClassNotReady"},
+			},
+		},
+	}}
+
+	group := nodePoolNodeGroup(nodePool, 4)
+	expected := nodeGroup{
+		Kind:     "NodePool",
+		Name:     "default",
+		Desired:  -1,
+		Ready:    4,
+		Limits:   "cpu=16,memory=64Gi",
+		Usage:    "cpu=16,memory=32Gi",
+		Problems: []string{"reached cpu limit", "not ready: NodeClassNotReady"},
+	}
+	if !reflect.DeepEqual(group, expected) {
+		t.Errorf("expected %+v, got %+v", expected, group)
+	}
+}
+
+func TestWriteScalingEventsReport(t *testing.T) {
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	events := []scalingEvent{
+		{Time: now.Add(time.Minute), Type: "Warning", Reason: "FailedScaleUp", Object: "myapp/pod/web", Message: "max node group\nsize reached"},
+		{Time: now, Type: "Normal", Reason: "TriggeredScaleUp", Object: "myapp/pod/web", Message: "pod triggered scale-up"},
+	}
+
+	var buf bytes.Buffer
+	if err := writeScalingEventsReport(&buf, events); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got:\n%s", buf.String())
+	}
+
+	// Sorted by time, messages on a single line.
+	if !strings.HasPrefix(lines[1], "2024-06-01T10:00:00Z") || !strings.Contains(lines[1], "TriggeredScaleUp") {
+		t.Errorf("unexpected line %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], "max node group size reached") {
+		t.Errorf("unexpected line %q", lines[2])
+	}
+}
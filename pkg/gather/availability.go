@@ -0,0 +1,301 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	availabilityName       = "availability"
+	availabilityReportName = "availability-report.yaml"
+)
+
+// AvailabilityReport correlates the horizontal pod autoscalers and pod
+// disruption budgets in a namespace with the current replica counts and
+// disruption allowances, flagging misconfigurations.
+type AvailabilityReport struct {
+	HorizontalPodAutoscalers []AutoscalerStatus       `json:"horizontalPodAutoscalers,omitempty"`
+	PodDisruptionBudgets     []DisruptionBudgetStatus `json:"podDisruptionBudgets,omitempty"`
+}
+
+// AutoscalerStatus describes a horizontal pod autoscaler and its scale target.
+type AutoscalerStatus struct {
+	Name            string   `json:"name"`
+	Target          string   `json:"target"`
+	MinReplicas     int32    `json:"minReplicas"`
+	MaxReplicas     int32    `json:"maxReplicas"`
+	CurrentReplicas int32    `json:"currentReplicas"`
+	DesiredReplicas int32    `json:"desiredReplicas"`
+	TargetReplicas  *int32   `json:"targetReplicas,omitempty"`
+	Problems        []string `json:"problems,omitempty"`
+}
+
+// DisruptionBudgetStatus describes a pod disruption budget and the
+// disruptions it allows.
+type DisruptionBudgetStatus struct {
+	Name               string   `json:"name"`
+	MinAvailable       string   `json:"minAvailable,omitempty"`
+	MaxUnavailable     string   `json:"maxUnavailable,omitempty"`
+	ExpectedPods       int32    `json:"expectedPods"`
+	CurrentHealthy     int32    `json:"currentHealthy"`
+	DesiredHealthy     int32    `json:"desiredHealthy"`
+	DisruptionsAllowed int32    `json:"disruptionsAllowed"`
+	Problems           []string `json:"problems,omitempty"`
+}
+
+type availabilityAddon struct {
+	AddonBackend
+	client  *kubernetes.Clientset
+	dynamic *dynamic.DynamicClient
+	log     *zap.SugaredLogger
+
+	// Namespaces with inspected autoscalers and disruption budgets.
+	mutex      sync.Mutex
+	namespaces map[string]struct{}
+}
+
+func init() {
+	registerAddon(availabilityName, addonInfo{
+		Resources: []string{"autoscaling/horizontalpodautoscalers", "policy/poddisruptionbudgets"},
+		AddonFunc: NewAvailabilityAddon,
+		Priority:  PriorityAddons,
+	})
+}
+
+func NewAvailabilityAddon(backend AddonBackend) (Addon, error) {
+	client, err := kubernetes.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	return &availabilityAddon{
+		AddonBackend: backend,
+		client:       client,
+		dynamic:      dynamicClient,
+		log:          backend.Options().Log.Named(availabilityName),
+		namespaces:   map[string]struct{}{},
+	}, nil
+}
+
+func (a *availabilityAddon) Inspect(item *unstructured.Unstructured) error {
+	namespace := item.GetNamespace()
+
+	// Autoscalers and disruption budgets are analyzed once per namespace.
+	if a.addNamespace(namespace) {
+		a.QueueNamespace(namespace, func(context.Context) error {
+			a.analyzeNamespace(namespace)
+			return nil
+		})
+	}
+
+	return nil
+}
+
+func (a *availabilityAddon) addNamespace(namespace string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, ok := a.namespaces[namespace]; ok {
+		return false
+	}
+
+	a.namespaces[namespace] = struct{}{}
+	return true
+}
+
+func (a *availabilityAddon) analyzeNamespace(namespace string) {
+	a.log.Debugf("Analyzing autoscalers and disruption budgets in namespace %q", namespace)
+	ctx := context.TODO()
+	report := AvailabilityReport{}
+
+	hpas, err := a.client.AutoscalingV2().HorizontalPodAutoscalers(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		a.log.Warnf("Cannot list horizontalpodautoscalers in namespace %q: %s", namespace, err)
+	} else {
+		for i := range hpas.Items {
+			report.HorizontalPodAutoscalers = append(report.HorizontalPodAutoscalers,
+				a.inspectAutoscaler(&hpas.Items[i]))
+		}
+	}
+
+	pdbs, err := a.client.PolicyV1().PodDisruptionBudgets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		a.log.Warnf("Cannot list poddisruptionbudgets in namespace %q: %s", namespace, err)
+	} else {
+		for i := range pdbs.Items {
+			report.PodDisruptionBudgets = append(report.PodDisruptionBudgets,
+				inspectDisruptionBudget(&pdbs.Items[i]))
+		}
+	}
+
+	if len(report.HorizontalPodAutoscalers) == 0 && len(report.PodDisruptionBudgets) == 0 {
+		return
+	}
+
+	a.writeAvailabilityReport(namespace, &report)
+}
+
+func (a *availabilityAddon) inspectAutoscaler(hpa *autoscalingv2.HorizontalPodAutoscaler) AutoscalerStatus {
+	ref := hpa.Spec.ScaleTargetRef
+	status := AutoscalerStatus{
+		Name:            hpa.Name,
+		Target:          ref.Kind + "/" + ref.Name,
+		MinReplicas:     1,
+		MaxReplicas:     hpa.Spec.MaxReplicas,
+		CurrentReplicas: hpa.Status.CurrentReplicas,
+		DesiredReplicas: hpa.Status.DesiredReplicas,
+	}
+	if hpa.Spec.MinReplicas != nil {
+		status.MinReplicas = *hpa.Spec.MinReplicas
+	}
+
+	replicas, err := a.targetReplicas(hpa.Namespace, ref)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			status.Problems = append(status.Problems, fmt.Sprintf("scale target %s not found", status.Target))
+		} else {
+			status.Problems = append(status.Problems, fmt.Sprintf("cannot get scale target %s: %s", status.Target, err))
+		}
+	} else {
+		status.TargetReplicas = &replicas
+	}
+
+	status.Problems = append(status.Problems, autoscalerProblems(hpa, status.TargetReplicas)...)
+
+	return status
+}
+
+// targetReplicas returns the replicas of the autoscaler scale target, using
+// the scale sub resource supported by all scalable resources.
+func (a *availabilityAddon) targetReplicas(namespace string, ref autoscalingv2.CrossVersionObjectReference) (int32, error) {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return 0, err
+	}
+
+	// Scalable resources use the lowercase plural kind (e.g. "deployments").
+	gvr := gv.WithResource(strings.ToLower(ref.Kind) + "s")
+
+	scale, err := a.dynamic.Resource(gvr).
+		Namespace(namespace).
+		Get(context.TODO(), ref.Name, metav1.GetOptions{}, "scale")
+	if err != nil {
+		return 0, err
+	}
+
+	replicas, _, err := unstructured.NestedInt64(scale.Object, "spec", "replicas")
+	if err != nil {
+		return 0, err
+	}
+
+	return int32(replicas), nil
+}
+
+// autoscalerProblems returns the misconfigurations of hpa. targetReplicas is
+// nil if the scale target replicas are unknown.
+func autoscalerProblems(hpa *autoscalingv2.HorizontalPodAutoscaler, targetReplicas *int32) []string {
+	var problems []string
+
+	minReplicas := int32(1)
+	if hpa.Spec.MinReplicas != nil {
+		minReplicas = *hpa.Spec.MinReplicas
+	}
+
+	if minReplicas == hpa.Spec.MaxReplicas {
+		problems = append(problems, fmt.Sprintf("min replicas equal max replicas %d, cannot scale", minReplicas))
+	} else if hpa.Status.CurrentReplicas >= hpa.Spec.MaxReplicas {
+		problems = append(problems, fmt.Sprintf("at max replicas %d", hpa.Spec.MaxReplicas))
+	}
+
+	if targetReplicas != nil && (*targetReplicas < minReplicas || *targetReplicas > hpa.Spec.MaxReplicas) {
+		problems = append(problems, fmt.Sprintf("target replicas %d outside of range %d-%d",
+			*targetReplicas, minReplicas, hpa.Spec.MaxReplicas))
+	}
+
+	for _, c := range hpa.Status.Conditions {
+		if c.Status != corev1.ConditionFalse {
+			continue
+		}
+		switch c.Type {
+		case autoscalingv2.AbleToScale:
+			problems = append(problems, fmt.Sprintf("unable to scale: %s: %s", c.Reason, c.Message))
+		case autoscalingv2.ScalingActive:
+			problems = append(problems, fmt.Sprintf("scaling not active: %s: %s", c.Reason, c.Message))
+		}
+	}
+
+	return problems
+}
+
+func inspectDisruptionBudget(pdb *policyv1.PodDisruptionBudget) DisruptionBudgetStatus {
+	status := DisruptionBudgetStatus{
+		Name:               pdb.Name,
+		ExpectedPods:       pdb.Status.ExpectedPods,
+		CurrentHealthy:     pdb.Status.CurrentHealthy,
+		DesiredHealthy:     pdb.Status.DesiredHealthy,
+		DisruptionsAllowed: pdb.Status.DisruptionsAllowed,
+	}
+	if pdb.Spec.MinAvailable != nil {
+		status.MinAvailable = pdb.Spec.MinAvailable.String()
+	}
+	if pdb.Spec.MaxUnavailable != nil {
+		status.MaxUnavailable = pdb.Spec.MaxUnavailable.String()
+	}
+
+	switch {
+	case status.ExpectedPods == 0:
+		status.Problems = append(status.Problems, "selects no pods")
+	case status.DisruptionsAllowed > 0:
+	case status.CurrentHealthy < status.DesiredHealthy:
+		status.Problems = append(status.Problems, fmt.Sprintf(
+			"blocks drain: %d of %d pods healthy, %d required",
+			status.CurrentHealthy, status.ExpectedPods, status.DesiredHealthy))
+	default:
+		status.Problems = append(status.Problems, fmt.Sprintf(
+			"blocks drain: no disruption allowed with %d healthy pods", status.CurrentHealthy))
+	}
+
+	return status
+}
+
+func (a *availabilityAddon) writeAvailabilityReport(namespace string, report *AvailabilityReport) {
+	data, err := yaml.Marshal(report)
+	if err != nil {
+		a.log.Warnf("Cannot encode %q: %s", availabilityReportName, err)
+		return
+	}
+
+	dir, err := a.Output().CreateAddonDir(availabilityName, namespacesDir, namespace)
+	if err != nil {
+		a.log.Warnf("Cannot create %q directory: %s", namespace, err)
+		return
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, availabilityReportName), data, 0640); err != nil {
+		a.log.Warnf("Cannot write %q: %s", availabilityReportName, err)
+	}
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"slices"
+	"testing"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestAutoscalerProblems(t *testing.T) {
+	int32Ptr := func(i int32) *int32 { return &i }
+
+	cases := []struct {
+		name           string
+		min            *int32
+		max            int32
+		current        int32
+		targetReplicas *int32
+		conditions     []autoscalingv2.HorizontalPodAutoscalerCondition
+		problems       []string
+	}{
+		{"ok", int32Ptr(2), 10, 4, int32Ptr(4), nil, nil},
+		{"at max", int32Ptr(2), 10, 10, int32Ptr(10), nil, []string{"at max replicas 10"}},
+		{"cannot scale", int32Ptr(3), 3, 3, int32Ptr(3), nil,
+			[]string{"min replicas equal max replicas 3, cannot scale"}},
+		{"default min", nil, 1, 1, nil, nil,
+			[]string{"min replicas equal max replicas 1, cannot scale"}},
+		{"target outside range", int32Ptr(2), 10, 4, int32Ptr(12), nil,
+			[]string{"target replicas 12 outside of range 2-10"}},
+		{"scaling not active", int32Ptr(2), 10, 4, int32Ptr(4),
+			[]autoscalingv2.HorizontalPodAutoscalerCondition{
+				{Type: autoscalingv2.ScalingActive, Status: corev1.ConditionFalse,
+					Reason: "FailedGetResourceMetric", Message: "no metrics"},
+				{Type: autoscalingv2.AbleToScale, Status: corev1.ConditionTrue},
+			},
+			[]string{"scaling not active: FailedGetResourceMetric: no metrics"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{
+				Spec: autoscalingv2.HorizontalPodAutoscalerSpec{MinReplicas: c.min, MaxReplicas: c.max},
+				Status: autoscalingv2.HorizontalPodAutoscalerStatus{
+					CurrentReplicas: c.current,
+					Conditions:      c.conditions,
+				},
+			}
+			problems := autoscalerProblems(hpa, c.targetReplicas)
+			if !slices.Equal(problems, c.problems) {
+				t.Errorf("expected %q, got %q", c.problems, problems)
+			}
+		})
+	}
+}
+
+func TestInspectDisruptionBudget(t *testing.T) {
+	cases := []struct {
+		name     string
+		status   policyv1.PodDisruptionBudgetStatus
+		problems []string
+	}{
+		{"ok", policyv1.PodDisruptionBudgetStatus{
+			ExpectedPods: 3, CurrentHealthy: 3, DesiredHealthy: 2, DisruptionsAllowed: 1}, nil},
+		{"no pods", policyv1.PodDisruptionBudgetStatus{}, []string{"selects no pods"}},
+		{"unhealthy", policyv1.PodDisruptionBudgetStatus{
+			ExpectedPods: 3, CurrentHealthy: 1, DesiredHealthy: 2},
+			[]string{"blocks drain: 1 of 3 pods healthy, 2 required"}},
+		{"no disruption allowed", policyv1.PodDisruptionBudgetStatus{
+			ExpectedPods: 3, CurrentHealthy: 3, DesiredHealthy: 3},
+			[]string{"blocks drain: no disruption allowed with 3 healthy pods"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			minAvailable := intstr.FromString("50%")
+			pdb := &policyv1.PodDisruptionBudget{
+				ObjectMeta: metav1.ObjectMeta{Name: "myapp"},
+				Spec:       policyv1.PodDisruptionBudgetSpec{MinAvailable: &minAvailable},
+				Status:     c.status,
+			}
+			status := inspectDisruptionBudget(pdb)
+			if status.MinAvailable != "50%" {
+				t.Errorf("expected minAvailable 50%%, got %q", status.MinAvailable)
+			}
+			if !slices.Equal(status.Problems, c.problems) {
+				t.Errorf("expected %q, got %q", c.problems, status.Problems)
+			}
+		})
+	}
+}
@@ -4,7 +4,9 @@
 package gather
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -12,7 +14,21 @@ import (
 )
 
 type gatherBackend struct {
-	g *Gatherer
+	g        *Gatherer
+	name     string
+	priority Priority
+
+	// Limits the number of running addon work functions. If nil, the addon
+	// is not limited.
+	limiter *Limiter
+}
+
+func newGatherBackend(g *Gatherer, name string, info addonInfo) *gatherBackend {
+	b := &gatherBackend{g: g, name: name, priority: info.Priority}
+	if info.MaxConcurrency > 0 {
+		b.limiter = NewLimiter(info.MaxConcurrency)
+	}
+	return b
 }
 
 func (b *gatherBackend) Config() *rest.Config {
@@ -31,8 +47,27 @@ func (b *gatherBackend) Output() *OutputDirectory {
 	return &b.g.output
 }
 
-func (b *gatherBackend) Queue(work WorkFunc) {
-	b.g.wq.Queue(work)
+func (b *gatherBackend) Queue(work AddonWorkFunc) {
+	b.QueueNamespace("", work)
+}
+
+func (b *gatherBackend) QueueNamespace(namespace string, work AddonWorkFunc) {
+	// Work waiting for the limiter stays in the queue, so workers continue to
+	// run other work.
+	b.g.wq.QueueLimited(b.priority, b.limiter, func() error {
+		start := time.Now()
+		defer func() {
+			b.g.timing.Add(namespace, b.name, time.Since(start))
+		}()
+		return b.g.runAddon(b.name, namespace, func(ctx context.Context) error {
+			// Release the slot when the work exits, not when we stop waiting
+			// for it after a timeout, so abandoned work is limited.
+			if b.limiter != nil {
+				defer b.g.wq.Release(b.limiter)
+			}
+			return work(ctx)
+		})
+	})
 }
 
 func (b *gatherBackend) GatherResource(gvr schema.GroupVersionResource, name types.NamespacedName) {
@@ -41,3 +76,20 @@ func (b *gatherBackend) GatherResource(gvr schema.GroupVersionResource, name typ
 		return nil
 	})
 }
+
+func (b *gatherBackend) AddError(resource string, namespace string, name string, reason string, err error) {
+	b.g.errors.Add(GatherError{
+		Resource:  resource,
+		Namespace: namespace,
+		Name:      name,
+		Reason:    reason,
+		Kind:      ErrorKind(err),
+		Message:   err.Error(),
+	})
+}
+
+func (b *gatherBackend) Retry(resource string, namespace string, name string, err error, work AddonWorkFunc) {
+	b.g.retryLater(resource, namespace, name, err, func() error {
+		return b.g.runAddonTimeout(b.name, namespace, retryTimeout(b.g.opts.AddonTimeout), work)
+	})
+}
@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// Maximum read size when bandwidth is limited, smoothing the rate.
+const maxBandwidthBurst = 1024 * 1024
+
+// newBandwidthLimiter returns a limiter allowing bandwidth bytes per second,
+// or nil if bandwidth is not limited.
+func newBandwidthLimiter(bandwidth int64) *rate.Limiter {
+	if bandwidth <= 0 {
+		return nil
+	}
+	burst := int(min(bandwidth, maxBandwidthBurst))
+	return rate.NewLimiter(rate.Limit(bandwidth), burst)
+}
+
+// limitedReader limits the bandwidth of reading from r. Reading waits until
+// all limiters allow the bytes read.
+type limitedReader struct {
+	r        io.Reader
+	limiters []*rate.Limiter
+	burst    int
+}
+
+// newLimitedReader returns a reader limiting the bandwidth of reading from r
+// using limiters. Nil limiters are ignored, so if all limiters are nil, r is
+// returned as is.
+func newLimitedReader(r io.Reader, limiters ...*rate.Limiter) io.Reader {
+	l := &limitedReader{r: r}
+	for _, limiter := range limiters {
+		if limiter == nil {
+			continue
+		}
+		if l.burst == 0 || limiter.Burst() < l.burst {
+			l.burst = limiter.Burst()
+		}
+		l.limiters = append(l.limiters, limiter)
+	}
+
+	if len(l.limiters) == 0 {
+		return r
+	}
+
+	return l
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > l.burst {
+		p = p[:l.burst]
+	}
+
+	n, err := l.r.Read(p)
+	if n > 0 {
+		for _, limiter := range l.limiters {
+			if err := limiter.WaitN(context.TODO(), n); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// readSizes records the size of every read.
+type readSizes struct {
+	r     io.Reader
+	sizes []int
+}
+
+func (r *readSizes) Read(p []byte) (int, error) {
+	r.sizes = append(r.sizes, len(p))
+	return r.r.Read(p)
+}
+
+func TestLimitedReader(t *testing.T) {
+	src := strings.NewReader("data")
+	if r := newLimitedReader(src, nil, newBandwidthLimiter(0)); r != src {
+		t.Errorf("expected unlimited reader, got %T", r)
+	}
+
+	data := bytes.Repeat([]byte("x"), 4096)
+	sizes := &readSizes{r: bytes.NewReader(data)}
+	r := newLimitedReader(sizes, newBandwidthLimiter(1024*1024), rate.NewLimiter(rate.Limit(1<<30), 1024))
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("expected %d bytes, got %d", len(data), buf.Len())
+	}
+
+	// Reads are limited by the smallest burst.
+	for _, size := range sizes.sizes {
+		if size > 1024 {
+			t.Errorf("expected reads up to 1024 bytes, got %v", sizes.sizes)
+			break
+		}
+	}
+}
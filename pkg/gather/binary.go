@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Handling of large binary values.
+const (
+	// Keep binary values in the resource.
+	BinaryFieldsKeep = "keep"
+
+	// Remove binary values from the resource.
+	BinaryFieldsOmit = "omit"
+
+	// Move binary values to files next to the resource file.
+	BinaryFieldsExternal = "external"
+)
+
+// Annotations listing the binary values removed from a resource (e.g.
+// "binaryData/firmware.bin,binaryData/logo.png").
+const (
+	omittedFieldsAnnotation  = "kubectl-gather/omitted-fields"
+	externalFieldsAnnotation = "kubectl-gather/external-fields"
+)
+
+// Prefix of annotations added when gathering, removed when exporting
+// manifests.
+const gatherAnnotationsPrefix = "kubectl-gather/"
+
+// binaryField returns the field holding base64 encoded values in resource r,
+// or an empty string if the resource has no binary field.
+func binaryField(r *resourceInfo) string {
+	if r.Group != "" {
+		return ""
+	}
+	switch r.Resource {
+	case "configmaps":
+		return "binaryData"
+	case "secrets":
+		return "data"
+	default:
+		return ""
+	}
+}
+
+// stripBinaryFields returns item without binary values larger than the
+// threshold, keeping the YAML readable and diffs small. When using external
+// binary fields, the decoded values are written to files in a directory next
+// to the resource file (e.g. "configmaps/name/binaryData/key" for
+// "configmaps/name.yaml"). Removed values are listed in an annotation. If no
+// value was removed, item is returned as is.
+func (w *resourceWriter) stripBinaryFields(r *resourceInfo, item *unstructured.Unstructured, relpath string) (*unstructured.Unstructured, error) {
+	if w.binaryFields == "" || w.binaryFields == BinaryFieldsKeep {
+		return item, nil
+	}
+
+	field := binaryField(r)
+	if field == "" {
+		return item, nil
+	}
+
+	values, ok := item.Object[field].(map[string]any)
+	if !ok {
+		return item, nil
+	}
+
+	var removed []string
+	var names []string
+
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		encoded, ok := values[key].(string)
+		if !ok || int64(base64.StdEncoding.DecodedLen(len(encoded))) <= w.binaryFieldsThreshold {
+			continue
+		}
+
+		if w.binaryFields == BinaryFieldsExternal {
+			data, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				// Not a binary value, keep it.
+				continue
+			}
+			dir := strings.TrimSuffix(relpath, ".yaml")
+			if err := w.writeBinaryValue(path.Join(dir, field, SafeName(key)), data); err != nil {
+				return nil, err
+			}
+		}
+
+		removed = append(removed, key)
+		names = append(names, path.Join(field, key))
+	}
+
+	if len(removed) == 0 {
+		return item, nil
+	}
+
+	stripped := item.DeepCopy()
+	strippedValues := stripped.Object[field].(map[string]any)
+	for _, key := range removed {
+		delete(strippedValues, key)
+	}
+
+	annotation := omittedFieldsAnnotation
+	if w.binaryFields == BinaryFieldsExternal {
+		annotation = externalFieldsAnnotation
+	}
+
+	annotations := stripped.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[annotation] = strings.Join(names, ",")
+	stripped.SetAnnotations(annotations)
+
+	return stripped, nil
+}
+
+func (w *resourceWriter) writeBinaryValue(relpath string, data []byte) error {
+	dst, err := w.output.CreateResource(relpath)
+	if err != nil {
+		return err
+	}
+
+	defer dst.Close()
+
+	writer := &countingWriter{w: dst, count: w.written}
+	_, err = writer.Write(data)
+	return err
+}
+
+// restoreBinaryFields restores the binary values moved to files when
+// gathering item described by entry. Fails if binary values were omitted,
+// since the resource cannot be reconstructed.
+func restoreBinaryFields(clusterDir string, entry IndexEntry, item *unstructured.Unstructured) error {
+	annotations := item.GetAnnotations()
+
+	if omitted := annotations[omittedFieldsAnnotation]; omitted != "" {
+		return fmt.Errorf("%s %q was gathered without binary values %q (gather with --binary-fields=external to export it)",
+			entry.Resource, entry.Name, omitted)
+	}
+
+	external := annotations[externalFieldsAnnotation]
+	if external == "" {
+		return nil
+	}
+
+	dir := strings.TrimSuffix(entry.Path, ".yaml")
+
+	for _, name := range strings.Split(external, ",") {
+		field, key, found := strings.Cut(name, "/")
+		if !found {
+			return fmt.Errorf("invalid external field %q in %q", name, entry.Path)
+		}
+
+		relpath := path.Join(dir, field, SafeName(key))
+		data, err := os.ReadFile(filepath.Join(clusterDir, filepath.FromSlash(relpath)))
+		if err != nil {
+			return err
+		}
+
+		err = unstructured.SetNestedField(item.Object, base64.StdEncoding.EncodeToString(data), field, key)
+		if err != nil {
+			return fmt.Errorf("cannot restore %q in %q: %w", name, entry.Path, err)
+		}
+	}
+
+	return nil
+}
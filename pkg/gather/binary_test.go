@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestDumpBinaryFields(t *testing.T) {
+	configMaps := resourceInfo{
+		GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		Kind:                 "ConfigMap",
+		Namespaced:           true,
+	}
+
+	large := bytes.Repeat([]byte{0xff}, 2048)
+
+	item := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": "firmware", "namespace": "my-app"},
+		"binaryData": map[string]any{
+			"small.bin": base64.StdEncoding.EncodeToString([]byte("small")),
+			"large.bin": base64.StdEncoding.EncodeToString(large),
+		},
+	}}
+
+	for _, mode := range []string{BinaryFieldsOmit, BinaryFieldsExternal} {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			var written atomic.Int64
+			w := &resourceWriter{
+				output:                NewOutputDirectory(dir),
+				index:                 &index{},
+				written:               &written,
+				binaryFields:          mode,
+				binaryFieldsThreshold: 1024,
+			}
+
+			if err := w.Dump(&configMaps, item); err != nil {
+				t.Fatal(err)
+			}
+
+			relpath := NamespacedResourcePath("my-app", "configmaps", "firmware")
+			data, err := os.ReadFile(filepath.Join(dir, relpath))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), "small.bin:") {
+				t.Errorf("small value removed:\n%s", data)
+			}
+			if strings.Contains(string(data), "large.bin:") {
+				t.Errorf("large value not removed:\n%s", data)
+			}
+			if !strings.Contains(string(data), "kubectl-gather/"+mode) {
+				t.Errorf("removed values annotation missing:\n%s", data)
+			}
+
+			external := filepath.Join(dir, "namespaces", "my-app", "configmaps", "firmware", "binaryData", "large.bin")
+			value, err := os.ReadFile(external)
+			if mode == BinaryFieldsExternal {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(value, large) {
+					t.Errorf("unexpected external value")
+				}
+			} else if !os.IsNotExist(err) {
+				t.Errorf("unexpected external value: %v", err)
+			}
+
+			// The original item is not modified.
+			if _, ok := item.Object["binaryData"].(map[string]any)["large.bin"]; !ok {
+				t.Errorf("original item modified")
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Cleanup deletes leftover temporary resources (agent pods, namespaces)
+// created by previous gathers that crashed or were killed. Resources created
+// less than minAge ago may belong to a running gather and are skipped. If
+// dryRun is true, the resources are logged but not deleted. Returns the number
+// of leftover resources found.
+func Cleanup(config *rest.Config, dryRun bool, minAge time.Duration, log *zap.SugaredLogger) (int, error) {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return 0, err
+	}
+
+	return cleanup(context.TODO(), client, dryRun, minAge, log)
+}
+
+func cleanup(ctx context.Context, client kubernetes.Interface, dryRun bool, minAge time.Duration, log *zap.SugaredLogger) (int, error) {
+	opts := metav1.ListOptions{LabelSelector: TemporaryLabel + "=true"}
+
+	var deleteOpts metav1.DeleteOptions
+	action := "Deleting"
+	if dryRun {
+		deleteOpts.DryRun = []string{metav1.DryRunAll}
+		action = "Would delete"
+	}
+
+	// Resources created after this time may be used by a running gather.
+	newest := time.Now().Add(-minAge)
+
+	count := 0
+
+	pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.CreationTimestamp.After(newest) {
+			log.Debugf("Skipping pod \"%s/%s\" created at %s", pod.Namespace, pod.Name,
+				pod.CreationTimestamp.UTC().Format(time.RFC3339))
+			continue
+		}
+		log.Infof("%s pod \"%s/%s\"", action, pod.Namespace, pod.Name)
+		err := client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, deleteOpts)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return count, err
+		}
+		count++
+	}
+
+	namespaces, err := client.CoreV1().Namespaces().List(ctx, opts)
+	if err != nil {
+		return count, err
+	}
+
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+		if ns.CreationTimestamp.After(newest) {
+			log.Debugf("Skipping namespace %q created at %s", ns.Name,
+				ns.CreationTimestamp.UTC().Format(time.RFC3339))
+			continue
+		}
+		log.Infof("%s namespace %q", action, ns.Name)
+		err := client.CoreV1().Namespaces().Delete(ctx, ns.Name, deleteOpts)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCleanupSkipsNewResources(t *testing.T) {
+	old := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+	now := metav1.Now()
+	labels := map[string]string{TemporaryLabel: "true"}
+
+	client := fake.NewSimpleClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default", Name: "old-agent", Labels: labels, CreationTimestamp: old}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default", Name: "new-agent", Labels: labels, CreationTimestamp: now}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name: "old-namespace", Labels: labels, CreationTimestamp: old}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name: "new-namespace", Labels: labels, CreationTimestamp: now}},
+	)
+
+	ctx := context.Background()
+	count, err := cleanup(ctx, client, false, time.Hour, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 deleted resources, got %d", count)
+	}
+
+	pods, err := client.CoreV1().Pods("default").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 1 || pods.Items[0].Name != "new-agent" {
+		t.Errorf("unexpected pods %+v", pods.Items)
+	}
+
+	namespaces, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(namespaces.Items) != 1 || namespaces.Items[0].Name != "new-namespace" {
+		t.Errorf("unexpected namespaces %+v", namespaces.Items)
+	}
+}
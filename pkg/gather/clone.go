@@ -0,0 +1,302 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	cloneFieldManager = "kubectl-gather"
+
+	// Time to wait until applied custom resource definitions are established.
+	crdEstablishedTimeout  = 60 * time.Second
+	crdEstablishedInterval = time.Second
+)
+
+var customResourceDefinitionsResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// CloneOptions configure cloning a gathered namespace.
+type CloneOptions struct {
+	// Cluster directory name. If empty, the namespace must be gathered in a
+	// single cluster.
+	Cluster string
+
+	// Namespace to clone.
+	Namespace string
+
+	// StorageClasses maps storage classes in the gathered cluster to storage
+	// classes in the target cluster.
+	StorageClasses map[string]string
+
+	// Log is used for logging the clone progress. If not set, messages are
+	// discarded.
+	Log *zap.SugaredLogger
+}
+
+func (o *CloneOptions) logger() *zap.SugaredLogger {
+	if o.Log != nil {
+		return o.Log
+	}
+	return zap.NewNop().Sugar()
+}
+
+// CloneResult describes the cloned resources.
+type CloneResult struct {
+	// Number of applied custom resource definitions.
+	CRDs int
+
+	// Number of custom resource definitions already existing in the target
+	// cluster, not applied.
+	ExistingCRDs int
+
+	// Number of applied resources.
+	Resources int
+}
+
+// Clone reconstructs a namespace gathered in directory on the cluster
+// accessed by config, applying the exported manifests in dependency order.
+// The custom resource definitions of the custom resources in the namespace
+// are applied first, and the namespace resources are applied when the
+// definitions are established. Custom resource definitions already existing
+// in the target cluster are not modified, since they may be used by other
+// namespaces. Resources failing to apply are reported in the returned error,
+// but do not stop the clone.
+func Clone(directory string, config *rest.Config, opts *CloneOptions) (*CloneResult, error) {
+	log := opts.logger()
+
+	clusterDir, err := findNamespaceCluster(directory, opts.Cluster, opts.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests, err := namespaceManifests(clusterDir, opts.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	crds, err := crdManifests(clusterDir, manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range manifests {
+		mapStorageClasses(m.Object, opts.StorageClasses)
+	}
+
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.TODO()
+	result := &CloneResult{}
+
+	errs := applyCRDs(ctx, client, crds, result, log)
+
+	for _, m := range crds {
+		if err := waitForCRD(ctx, client, m.Object.GetName()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	warnMissingStorageClasses(ctx, client, manifests, log)
+
+	for _, m := range manifests {
+		if err := applyManifest(ctx, client, m); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Debugf("Applied %s %q", m.Resource.Resource, m.Object.GetName())
+		result.Resources++
+	}
+
+	return result, errors.Join(errs...)
+}
+
+// applyCRDs applies the custom resource definitions missing in the target
+// cluster. Existing definitions may be a different version used by other
+// namespaces, so we do not take ownership of their fields.
+func applyCRDs(ctx context.Context, client dynamic.Interface, crds []manifest, result *CloneResult, log *zap.SugaredLogger) []error {
+	var errs []error
+
+	for _, m := range crds {
+		name := m.Object.GetName()
+
+		_, err := client.Resource(customResourceDefinitionsResource).Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			log.Debugf("Customresourcedefinition %q exists, not applying", name)
+			result.ExistingCRDs++
+			continue
+		}
+		if !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("cannot get customresourcedefinition %q: %w", name, err))
+			continue
+		}
+
+		if err := applyManifest(ctx, client, m); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Debugf("Applied customresourcedefinition %q", name)
+		result.CRDs++
+	}
+
+	return errs
+}
+
+// crdManifests returns the cleaned manifests of the gathered custom resource
+// definitions of the custom resources in manifests.
+func crdManifests(clusterDir string, manifests []manifest) ([]manifest, error) {
+	entries, err := ReadIndex(clusterDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var crds []manifest
+	seen := map[string]struct{}{}
+
+	for _, m := range manifests {
+		name := m.Resource.Resource + "." + m.Resource.Group
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+
+		i := slices.IndexFunc(entries, func(e IndexEntry) bool {
+			return e.Resource == "apiextensions.k8s.io/customresourcedefinitions" && e.Name == name
+		})
+		if i == -1 {
+			// Built in resource.
+			continue
+		}
+
+		crd, err := readManifest(clusterDir, entries[i])
+		if err != nil {
+			return nil, err
+		}
+
+		cleanManifest(crd.Object)
+		crds = append(crds, crd)
+	}
+
+	return crds, nil
+}
+
+// mapStorageClasses replaces the storage classes of persistent volume claims
+// and stateful sets volume claim templates.
+func mapStorageClasses(item *unstructured.Unstructured, classes map[string]string) {
+	if len(classes) == 0 {
+		return
+	}
+
+	switch item.GetKind() {
+	case "PersistentVolumeClaim":
+		mapStorageClass(item.Object, classes, "spec", "storageClassName")
+	case "StatefulSet":
+		templates, found, _ := unstructured.NestedSlice(item.Object, "spec", "volumeClaimTemplates")
+		if !found {
+			return
+		}
+		for _, template := range templates {
+			if t, ok := template.(map[string]any); ok {
+				mapStorageClass(t, classes, "spec", "storageClassName")
+			}
+		}
+		_ = unstructured.SetNestedSlice(item.Object, templates, "spec", "volumeClaimTemplates")
+	}
+}
+
+func mapStorageClass(obj map[string]any, classes map[string]string, fields ...string) {
+	name, found, _ := unstructured.NestedString(obj, fields...)
+	if !found {
+		return
+	}
+	if mapped, ok := classes[name]; ok {
+		_ = unstructured.SetNestedField(obj, mapped, fields...)
+	}
+}
+
+// warnMissingStorageClasses warns about storage classes used by persistent
+// volume claims that do not exist in the target cluster. The claims will not
+// be bound until the storage class is created or mapped.
+func warnMissingStorageClasses(ctx context.Context, client dynamic.Interface, manifests []manifest, log *zap.SugaredLogger) {
+	for _, m := range manifests {
+		if m.Object.GetKind() != "PersistentVolumeClaim" {
+			continue
+		}
+
+		name, _, _ := unstructured.NestedString(m.Object.Object, "spec", "storageClassName")
+		if name == "" {
+			continue
+		}
+
+		_, err := client.Resource(storageClassesResource).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			log.Warnf("Storage class %q used by persistentvolumeclaim %q not found (use --storage-class-map to map it)",
+				name, m.Object.GetName())
+		}
+	}
+}
+
+// applyManifest applies m using server side apply, taking ownership of
+// fields managed by other managers.
+func applyManifest(ctx context.Context, client dynamic.Interface, m manifest) error {
+	var resource dynamic.ResourceInterface = client.Resource(m.Resource)
+	if namespace := m.Object.GetNamespace(); namespace != "" {
+		resource = client.Resource(m.Resource).Namespace(namespace)
+	}
+
+	_, err := resource.Apply(ctx, m.Object.GetName(), m.Object, metav1.ApplyOptions{
+		FieldManager: cloneFieldManager,
+		Force:        true,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot apply %s %q: %w", m.Resource.Resource, m.Object.GetName(), err)
+	}
+
+	return nil
+}
+
+// waitForCRD waits until the custom resource definition name is established,
+// so custom resources can be created.
+func waitForCRD(ctx context.Context, client dynamic.Interface, name string) error {
+	err := wait.PollUntilContextTimeout(ctx, crdEstablishedInterval, crdEstablishedTimeout, true,
+		func(ctx context.Context) (bool, error) {
+			crd, err := client.Resource(customResourceDefinitionsResource).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, nil
+			}
+			conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+			for _, c := range conditions {
+				condition, ok := c.(map[string]any)
+				if ok && condition["type"] == "Established" && condition["status"] == "True" {
+					return true, nil
+				}
+			}
+			return false, nil
+		})
+	if err != nil {
+		return fmt.Errorf("customresourcedefinition %q not established: %w", name, err)
+	}
+
+	return nil
+}
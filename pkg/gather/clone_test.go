@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+)
+
+func TestMapStorageClasses(t *testing.T) {
+	classes := map[string]string{"ceph-rbd": "standard"}
+
+	pvc := &unstructured.Unstructured{Object: map[string]any{
+		"kind": "PersistentVolumeClaim",
+		"spec": map[string]any{"storageClassName": "ceph-rbd"},
+	}}
+	mapStorageClasses(pvc, classes)
+	if name, _, _ := unstructured.NestedString(pvc.Object, "spec", "storageClassName"); name != "standard" {
+		t.Errorf("expected storage class %q, got %q", "standard", name)
+	}
+
+	sts := &unstructured.Unstructured{Object: map[string]any{
+		"kind": "StatefulSet",
+		"spec": map[string]any{
+			"volumeClaimTemplates": []any{
+				map[string]any{"spec": map[string]any{"storageClassName": "ceph-rbd"}},
+				map[string]any{"spec": map[string]any{"storageClassName": "other"}},
+			},
+		},
+	}}
+	mapStorageClasses(sts, classes)
+	templates, _, _ := unstructured.NestedSlice(sts.Object, "spec", "volumeClaimTemplates")
+	var names []string
+	for _, template := range templates {
+		name, _, _ := unstructured.NestedString(template.(map[string]any), "spec", "storageClassName")
+		names = append(names, name)
+	}
+	if expected := []string{"standard", "other"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected storage classes %q, got %q", expected, names)
+	}
+}
+
+func TestCRDManifests(t *testing.T) {
+	clusterDir := filepath.Join(t.TempDir(), "cluster1")
+	output := NewOutputDirectory(clusterDir)
+	idx := &index{}
+	var written atomic.Int64
+	w := &resourceWriter{output: output, index: idx, written: &written}
+
+	crds := resourceInfo{
+		GroupVersionResource: customResourceDefinitionsResource,
+		Kind:                 "CustomResourceDefinition",
+	}
+	crd := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]any{"name": "widgets.example.com", "resourceVersion": "1234"},
+		"spec":       map[string]any{"group": "example.com"},
+		"status":     map[string]any{"acceptedNames": map[string]any{"kind": "Widget"}},
+	}}
+	if err := w.Dump(&crds, crd); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Write(output); err != nil {
+		t.Fatal(err)
+	}
+
+	manifests := []manifest{
+		{Resource: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}},
+		{Resource: schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}},
+		{Resource: schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}},
+	}
+
+	result, err := crdManifests(clusterDir, manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 {
+		t.Fatalf("expected 1 crd, got %d", len(result))
+	}
+	if result[0].Resource != customResourceDefinitionsResource {
+		t.Errorf("expected resource %v, got %v", customResourceDefinitionsResource, result[0].Resource)
+	}
+	expected := map[string]any{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]any{"name": "widgets.example.com"},
+		"spec":       map[string]any{"group": "example.com"},
+	}
+	if !reflect.DeepEqual(result[0].Object.Object, expected) {
+		t.Errorf("expected %v, got %v", expected, result[0].Object.Object)
+	}
+}
+
+func TestApplyCRDsExisting(t *testing.T) {
+	existing := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]any{"name": "widgets.example.com"},
+	}}
+	scheme := runtime.NewScheme()
+	client := fakedynamic.NewSimpleDynamicClientWithCustomListKinds(scheme,
+		map[schema.GroupVersionResource]string{customResourceDefinitionsResource: "CustomResourceDefinitionList"},
+		existing)
+
+	crds := []manifest{{Resource: customResourceDefinitionsResource, Object: existing.DeepCopy()}}
+	result := &CloneResult{}
+
+	errs := applyCRDs(context.TODO(), client, crds, result, zap.NewNop().Sugar())
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if result.CRDs != 0 || result.ExistingCRDs != 1 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() != "get" {
+			t.Errorf("unexpected action %q", action.GetVerb())
+		}
+	}
+}
@@ -4,6 +4,8 @@
 package gather
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -16,25 +18,74 @@ import (
 )
 
 type RemoteCommand struct {
+	ctx       context.Context
 	pod       *corev1.Pod
 	opts      *Options
 	log       *zap.SugaredLogger
 	directory string
+	container string
 }
 
 var specialCharacters *regexp.Regexp
 
 func NewRemoteCommand(pod *corev1.Pod, opts *Options, log *zap.SugaredLogger, directroy string) *RemoteCommand {
-	return &RemoteCommand{pod: pod, opts: opts, log: log, directory: directroy}
+	return &RemoteCommand{ctx: context.Background(), pod: pod, opts: opts, log: log, directory: directroy}
+}
+
+// WithContext returns a copy of c killing commands when ctx is cancelled.
+// Addon work must use the work context, so commands are killed when the work
+// is cancelled.
+func (c *RemoteCommand) WithContext(ctx context.Context) *RemoteCommand {
+	copy := *c
+	copy.ctx = ctx
+	return &copy
+}
+
+// InContainer returns a copy of c running commands in container instead of
+// the first pod container.
+func (c *RemoteCommand) InContainer(name string) *RemoteCommand {
+	copy := *c
+	copy.container = name
+	return &copy
 }
 
 func (c *RemoteCommand) Gather(command ...string) error {
+	return c.GatherTimeout(0, command...)
+}
+
+// GatherTimeout gathers command output, killing the command if it does not
+// complete within timeout. If timeout is zero, wait until the command
+// completes.
+func (c *RemoteCommand) GatherTimeout(timeout time.Duration, command ...string) error {
+	return c.GatherAs(c.Filename(command...), timeout, command...)
+}
+
+// GatherAs gathers command output to file name in the commands directory.
+// Useful when the command line does not make a good file name. If timeout is
+// zero, wait until the command completes.
+func (c *RemoteCommand) GatherAs(filename string, timeout time.Duration, command ...string) error {
+	if err := checkAgentsAllowed(c.opts); err != nil {
+		return err
+	}
+
 	start := time.Now()
 
+	ctx := c.ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	container := c.container
+	if container == "" {
+		container = c.pod.Spec.Containers[0].Name
+	}
+
 	args := []string{
 		"exec",
 		c.pod.Name,
-		"--container=" + c.pod.Spec.Containers[0].Name,
+		"--container=" + container,
 		"--namespace=" + c.pod.Namespace,
 	}
 	if c.opts.Kubeconfig != "" {
@@ -46,23 +97,34 @@ func (c *RemoteCommand) Gather(command ...string) error {
 	args = append(args, "--")
 	args = append(args, command...)
 
-	filename := c.Filename(command...)
 	writer, err := os.Create(filepath.Join(c.directory, filename))
 	if err != nil {
 		return err
 	}
 
 	defer writer.Close()
-	cmd := exec.Command("kubectl", args...)
+	cmd := exec.CommandContext(ctx, "kubectl", args...)
 	cmd.Stdout = writer
 
 	c.log.Debugf("Running command: %s", cmd)
 	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%w after %s", ErrCommandTimeout, timeout)
+	}
+	if ctx.Err() == context.Canceled {
+		return fmt.Errorf("command %q cancelled", filename)
+	}
+
 	c.log.Debugf("Gathered %q in %.3f seconds", filename, time.Since(start).Seconds())
 
 	return err
 }
 
+// Path returns the path to the command output file.
+func (c *RemoteCommand) Path(command ...string) string {
+	return filepath.Join(c.directory, c.Filename(command...))
+}
+
 func (c *RemoteCommand) Filename(command ...string) string {
 	name := strings.Join(command, " ")
 	return specialCharacters.ReplaceAllString(name, "-")
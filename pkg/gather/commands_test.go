@@ -0,0 +1,28 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRemoteCommandCopies(t *testing.T) {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main"}}}}
+	rc := NewRemoteCommand(pod, &Options{}, zap.NewNop().Sugar(), t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sidecar := rc.InContainer("sidecar").WithContext(ctx)
+	if sidecar.container != "sidecar" || sidecar.ctx != ctx {
+		t.Errorf("unexpected command %+v", sidecar)
+	}
+	if rc.container != "" || rc.ctx != context.Background() {
+		t.Errorf("original command modified %+v", rc)
+	}
+}
@@ -0,0 +1,356 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const containersReportName = "containers.csv"
+
+var containersReportHeader = []string{
+	"pod", "container", "type", "image", "imageID", "requests", "limits", "env",
+}
+
+// containersReport records the images, resources and environment of the
+// containers of gathered pods. The report is written to containers.csv in
+// every namespace directory when the gather completes, making it easy to
+// audit containers without reading all pod YAMLs.
+type containersReport struct {
+	output *OutputDirectory
+	mutex  sync.Mutex
+	rows   map[string][][]string
+}
+
+func newContainersReport(output *OutputDirectory) *containersReport {
+	return &containersReport{output: output, rows: map[string][][]string{}}
+}
+
+// isPods returns true if resource r is the core pods resource.
+func isPods(r *resourceInfo) bool {
+	return r.Group == "" && r.Resource == "pods"
+}
+
+// Add adds the containers of pod to the report.
+func (c *containersReport) Add(item *unstructured.Unstructured) error {
+	pod := &corev1.Pod{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, pod); err != nil {
+		return err
+	}
+
+	rows := podContainerRows(pod)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.rows[pod.Namespace] = append(c.rows[pod.Namespace], rows...)
+
+	return nil
+}
+
+// Write writes the report to every namespace directory. When appending, rows
+// of the previous gather are kept.
+func (c *containersReport) Write(appending bool) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var errs []error
+
+	for _, namespace := range slices.Sorted(maps.Keys(c.rows)) {
+		relpath := path.Join(namespacesDir, namespace, containersReportName)
+		rows := c.rows[namespace]
+
+		if appending {
+			previous, err := readContainersReport(filepath.Join(c.output.base, filepath.FromSlash(relpath)))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("cannot read %q: %s", relpath, err))
+			}
+			rows = append(rows, previous...)
+		}
+
+		if err := c.writeNamespace(relpath, rows); err != nil {
+			errs = append(errs, fmt.Errorf("cannot write %q: %s", relpath, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *containersReport) writeNamespace(relpath string, rows [][]string) error {
+	slices.SortFunc(rows, func(a, b []string) int {
+		return slices.Compare(a, b)
+	})
+	rows = slices.CompactFunc(rows, slices.Equal)
+
+	dst, err := c.output.CreateResource(relpath)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(dst)
+	if err := writer.Write(containersReportHeader); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		dst.Close()
+		return err
+	}
+
+	return dst.Close()
+}
+
+// readContainersReport returns the rows in an existing report, or no rows if
+// the report does not exist.
+func readContainersReport(filename string) ([][]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	return rows[1:], nil
+}
+
+// podContainerRows returns a report row for every container in pod.
+func podContainerRows(pod *corev1.Pod) [][]string {
+	var rows [][]string
+
+	add := func(containerType string, c *corev1.Container, statuses []corev1.ContainerStatus) {
+		status := findContainerStatus(statuses, c.Name)
+		imageID := ""
+		if status != nil {
+			imageID = status.ImageID
+		}
+		rows = append(rows, []string{
+			pod.Name,
+			c.Name,
+			containerType,
+			c.Image,
+			imageID,
+			formatResourceList(c.Resources.Requests),
+			formatResourceList(c.Resources.Limits),
+			formatEnv(c.EnvFrom, c.Env),
+		})
+	}
+
+	for i := range pod.Spec.InitContainers {
+		c := &pod.Spec.InitContainers[i]
+		add(initContainerType(c), c, pod.Status.InitContainerStatuses)
+	}
+	for i := range pod.Spec.Containers {
+		add("regular", &pod.Spec.Containers[i], pod.Status.ContainerStatuses)
+	}
+	for i := range pod.Spec.EphemeralContainers {
+		c := corev1.Container(pod.Spec.EphemeralContainers[i].EphemeralContainerCommon)
+		add("ephemeral", &c, pod.Status.EphemeralContainerStatuses)
+	}
+
+	return rows
+}
+
+// initContainerType returns "sidecar" for init containers that keep running
+// while the pod is running (restartPolicy: Always), and "init" for init
+// containers that must complete before the regular containers start.
+func initContainerType(c *corev1.Container) string {
+	if c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+		return "sidecar"
+	}
+	return "init"
+}
+
+func findContainerStatus(statuses []corev1.ContainerStatus, name string) *corev1.ContainerStatus {
+	for i := range statuses {
+		if statuses[i].Name == name {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+// formatResourceList formats resources sorted by name (e.g.
+// "cpu=100m;memory=128Mi").
+func formatResourceList(resources corev1.ResourceList) string {
+	var items []string
+	for _, name := range slices.Sorted(maps.Keys(resources)) {
+		quantity := resources[name]
+		items = append(items, string(name)+"="+quantity.String())
+	}
+	return strings.Join(items, ";")
+}
+
+// formatEnv formats the container environment (e.g.
+// "LEVEL=debug;TOKEN=<secret:app/token>"). Values from secrets and other
+// sources are shown as references, so the report never includes secret
+// values.
+func formatEnv(envFrom []corev1.EnvFromSource, env []corev1.EnvVar) string {
+	var items []string
+
+	for _, source := range envFrom {
+		var ref string
+		switch {
+		case source.SecretRef != nil:
+			ref = "<secret:" + source.SecretRef.Name + ">"
+		case source.ConfigMapRef != nil:
+			ref = "<configmap:" + source.ConfigMapRef.Name + ">"
+		default:
+			continue
+		}
+		items = append(items, source.Prefix+"*="+ref)
+	}
+
+	for _, e := range env {
+		items = append(items, e.Name+"="+envValue(&e))
+	}
+
+	return strings.Join(items, ";")
+}
+
+func envValue(e *corev1.EnvVar) string {
+	from := e.ValueFrom
+	switch {
+	case from == nil:
+		return e.Value
+	case from.SecretKeyRef != nil:
+		return "<secret:" + from.SecretKeyRef.Name + "/" + from.SecretKeyRef.Key + ">"
+	case from.ConfigMapKeyRef != nil:
+		return "<configmap:" + from.ConfigMapKeyRef.Name + "/" + from.ConfigMapKeyRef.Key + ">"
+	case from.FieldRef != nil:
+		return "<field:" + from.FieldRef.FieldPath + ">"
+	case from.ResourceFieldRef != nil:
+		return "<resource:" + from.ResourceFieldRef.Resource + ">"
+	default:
+		return "<unknown>"
+	}
+}
+
+// ContainerSummary describes a pod container in containers.yaml in the pod
+// directory. Containers are listed in startup order: init containers and
+// sidecars start one by one in this order, then the regular containers are
+// started. Ephemeral containers are started on demand.
+type ContainerSummary struct {
+	Name string `json:"name"`
+
+	// Position of the container in startup order, starting at 1.
+	Order int `json:"order"`
+
+	// Container type: "init", "sidecar", "regular", or "ephemeral".
+	Type string `json:"type"`
+
+	Image        string                 `json:"image"`
+	Ready        bool                   `json:"ready"`
+	Started      *bool                  `json:"started,omitempty"`
+	RestartCount int32                  `json:"restartCount"`
+	State        *ContainerStateSummary `json:"state,omitempty"`
+	LastState    *ContainerStateSummary `json:"lastState,omitempty"`
+}
+
+// ContainerStateSummary describes the current or last state of a container.
+type ContainerStateSummary struct {
+	// State name: "waiting", "running", or "terminated".
+	Name       string       `json:"name"`
+	Reason     string       `json:"reason,omitempty"`
+	ExitCode   *int32       `json:"exitCode,omitempty"`
+	StartedAt  *metav1.Time `json:"startedAt,omitempty"`
+	FinishedAt *metav1.Time `json:"finishedAt,omitempty"`
+}
+
+// podContainersSummary returns a summary of all containers in pod in startup
+// order. Container statuses are matched by name, since the kubelet sorts the
+// regular containers statuses by name.
+func podContainersSummary(pod *corev1.Pod) []ContainerSummary {
+	var result []ContainerSummary
+
+	add := func(containerType string, c *corev1.Container, statuses []corev1.ContainerStatus) {
+		summary := ContainerSummary{
+			Name:  c.Name,
+			Order: len(result) + 1,
+			Type:  containerType,
+			Image: c.Image,
+		}
+		if status := findContainerStatus(statuses, c.Name); status != nil {
+			summary.Ready = status.Ready
+			summary.Started = status.Started
+			summary.RestartCount = status.RestartCount
+			summary.State = containerStateSummary(&status.State)
+			summary.LastState = containerStateSummary(&status.LastTerminationState)
+		}
+		result = append(result, summary)
+	}
+
+	for i := range pod.Spec.InitContainers {
+		c := &pod.Spec.InitContainers[i]
+		add(initContainerType(c), c, pod.Status.InitContainerStatuses)
+	}
+	for i := range pod.Spec.Containers {
+		add("regular", &pod.Spec.Containers[i], pod.Status.ContainerStatuses)
+	}
+	for i := range pod.Spec.EphemeralContainers {
+		c := corev1.Container(pod.Spec.EphemeralContainers[i].EphemeralContainerCommon)
+		add("ephemeral", &c, pod.Status.EphemeralContainerStatuses)
+	}
+
+	return result
+}
+
+// containerStateSummary returns a summary of state, or nil if state is
+// empty.
+func containerStateSummary(state *corev1.ContainerState) *ContainerStateSummary {
+	switch {
+	case state.Waiting != nil:
+		return &ContainerStateSummary{
+			Name:   "waiting",
+			Reason: state.Waiting.Reason,
+		}
+	case state.Running != nil:
+		return &ContainerStateSummary{
+			Name:      "running",
+			StartedAt: timeOrNil(state.Running.StartedAt),
+		}
+	case state.Terminated != nil:
+		return &ContainerStateSummary{
+			Name:       "terminated",
+			Reason:     state.Terminated.Reason,
+			ExitCode:   &state.Terminated.ExitCode,
+			StartedAt:  timeOrNil(state.Terminated.StartedAt),
+			FinishedAt: timeOrNil(state.Terminated.FinishedAt),
+		}
+	default:
+		return nil
+	}
+}
+
+func timeOrNil(t metav1.Time) *metav1.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
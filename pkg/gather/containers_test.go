@@ -0,0 +1,208 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestContainersReport(t *testing.T) {
+	pod := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]any{"namespace": "myapp", "name": "server-1"},
+		"spec": map[string]any{
+			"initContainers": []any{
+				map[string]any{"name": "setup", "image": "setup:1.0"},
+			},
+			"containers": []any{
+				map[string]any{
+					"name":  "server",
+					"image": "server:2.1",
+					"resources": map[string]any{
+						"requests": map[string]any{"memory": "128Mi", "cpu": "100m"},
+						"limits":   map[string]any{"memory": "256Mi"},
+					},
+					"envFrom": []any{
+						map[string]any{"prefix": "DB_", "secretRef": map[string]any{"name": "db"}},
+					},
+					"env": []any{
+						map[string]any{"name": "LEVEL", "value": "debug"},
+						map[string]any{"name": "TOKEN", "valueFrom": map[string]any{
+							"secretKeyRef": map[string]any{"name": "app", "key": "token"},
+						}},
+					},
+				},
+			},
+		},
+		"status": map[string]any{
+			"containerStatuses": []any{
+				map[string]any{"name": "server", "imageID": "server@sha256:1234"},
+			},
+		},
+	}}
+
+	directory := t.TempDir()
+	report := newContainersReport(NewOutputDirectory(directory))
+	if err := report.Add(pod); err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Write(false); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(directory, "namespaces", "myapp", containersReportName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "pod,container,type,image,imageID,requests,limits,env\n" +
+		"server-1,server,regular,server:2.1,server@sha256:1234,cpu=100m;memory=128Mi,memory=256Mi," +
+		"DB_*=<secret:db>;LEVEL=debug;TOKEN=<secret:app/token>\n" +
+		"server-1,setup,init,setup:1.0,,,,\n"
+	if string(data) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, data)
+	}
+
+	// Appending keeps rows of the previous gather.
+	other := pod.DeepCopy()
+	other.SetName("server-2")
+	report = newContainersReport(NewOutputDirectory(directory))
+	if err := report.Add(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Write(true); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = os.ReadFile(filepath.Join(directory, "namespaces", "myapp", containersReportName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 5 {
+		t.Errorf("expected 5 lines, got %d:\n%s", lines, data)
+	}
+}
+
+func TestPodContainersSummary(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	started := true
+	startedAt := metav1.NewTime(time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC))
+	finishedAt := metav1.NewTime(startedAt.Add(time.Second))
+
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{
+				{Name: "setup", Image: "setup:1.0"},
+				{Name: "proxy", Image: "proxy:2.0", RestartPolicy: &always},
+			},
+			Containers: []corev1.Container{
+				{Name: "server", Image: "server:2.1"},
+				{Name: "metrics", Image: "metrics:1.0"},
+			},
+		},
+		Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name: "setup",
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						Reason: "Completed", StartedAt: startedAt, FinishedAt: finishedAt,
+					}},
+				},
+				{
+					Name:    "proxy",
+					Ready:   true,
+					Started: &started,
+					State:   corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: finishedAt}},
+				},
+			},
+			// Sorted by name by the kubelet.
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name:  "metrics",
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+				},
+				{
+					Name:         "server",
+					RestartCount: 2,
+					State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+					LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						Reason: "Error", ExitCode: 1, StartedAt: finishedAt, FinishedAt: finishedAt,
+					}},
+				},
+			},
+		},
+	}
+
+	exitCode := int32(1)
+	zero := int32(0)
+	expected := []ContainerSummary{
+		{
+			Name:  "setup",
+			Order: 1,
+			Type:  "init",
+			Image: "setup:1.0",
+			State: &ContainerStateSummary{
+				Name: "terminated", Reason: "Completed", ExitCode: &zero, StartedAt: &startedAt, FinishedAt: &finishedAt,
+			},
+		},
+		{
+			Name:    "proxy",
+			Order:   2,
+			Type:    "sidecar",
+			Image:   "proxy:2.0",
+			Ready:   true,
+			Started: &started,
+			State:   &ContainerStateSummary{Name: "running", StartedAt: &finishedAt},
+		},
+		{
+			Name:         "server",
+			Order:        3,
+			Type:         "regular",
+			Image:        "server:2.1",
+			RestartCount: 2,
+			State:        &ContainerStateSummary{Name: "waiting", Reason: "CrashLoopBackOff"},
+			LastState: &ContainerStateSummary{
+				Name: "terminated", Reason: "Error", ExitCode: &exitCode, StartedAt: &finishedAt, FinishedAt: &finishedAt,
+			},
+		},
+		{
+			Name:  "metrics",
+			Order: 4,
+			Type:  "regular",
+			Image: "metrics:1.0",
+			State: &ContainerStateSummary{Name: "waiting", Reason: "ImagePullBackOff"},
+		},
+	}
+
+	summary := podContainersSummary(pod)
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("expected %+v, got %+v", expected, summary)
+	}
+
+	// Containers listed from the pod status are sorted in startup order.
+	containers := []*containerInfo{
+		{Name: "setup", Type: "init"},
+		{Name: "proxy", Type: "init"},
+		{Name: "metrics", Type: "regular"},
+		{Name: "server", Type: "regular"},
+	}
+	sortContainers(containers, summary)
+	var names []string
+	for _, c := range containers {
+		names = append(names, c.Name+"/"+c.Type)
+	}
+	if expected := []string{"setup/init", "proxy/sidecar", "server/regular", "metrics/regular"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %q, got %q", expected, names)
+	}
+}
@@ -0,0 +1,267 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/printers"
+	"sigs.k8s.io/yaml"
+)
+
+// Directories in a must-gather tree (created by "oc adm inspect").
+const (
+	mustGatherClusterDir    = "cluster-scoped-resources"
+	mustGatherNamespacesDir = "namespaces"
+
+	// Group directory name for the core group.
+	mustGatherCoreGroup = "core"
+)
+
+// mustGatherConverter converts a must-gather tree to a cluster directory.
+type mustGatherConverter struct {
+	output OutputDirectory
+	index  index
+	log    *zap.SugaredLogger
+
+	// Converted resources paths. Some resources (e.g. pods) may be stored
+	// both in a list and in a separate file.
+	paths map[string]struct{}
+}
+
+// ConvertMustGather converts a must-gather directory created by "oc adm
+// must-gather" to a cluster directory. Resources and container logs are
+// stored in the cluster directory layout and recorded in the cluster index.
+// Files that are not resources or container logs are ignored. Returns the
+// number of converted resources.
+func ConvertMustGather(src string, dst string, log *zap.SugaredLogger) (int, error) {
+	c := &mustGatherConverter{
+		output: OutputDirectory{base: dst},
+		log:    log,
+		paths:  map[string]struct{}{},
+	}
+
+	roots, err := findMustGatherRoots(src)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(roots) == 0 {
+		return 0, fmt.Errorf("no must-gather data found in %q", src)
+	}
+
+	for _, root := range roots {
+		log.Debugf("Converting %q", root)
+		if err := c.convertRoot(root); err != nil {
+			return 0, err
+		}
+	}
+
+	// Writing the index makes the output a cluster directory.
+	if err := c.index.Write(&c.output); err != nil {
+		return 0, err
+	}
+
+	return len(c.paths), nil
+}
+
+// findMustGatherRoots returns the directories containing must-gather data.
+// There is one directory for every must-gather image.
+func findMustGatherRoots(src string) ([]string, error) {
+	var roots []string
+
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		for _, name := range []string{mustGatherClusterDir, mustGatherNamespacesDir} {
+			if info, err := os.Stat(filepath.Join(path, name)); err == nil && info.IsDir() {
+				roots = append(roots, path)
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return roots, nil
+}
+
+func (c *mustGatherConverter) convertRoot(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+
+		switch {
+		case strings.HasSuffix(rel, ".log"):
+			return c.convertLog(path, parts)
+		case strings.HasSuffix(rel, ".yaml"):
+			return c.convertResources(path, parts)
+		default:
+			return nil
+		}
+	})
+}
+
+// convertLog converts container log
+// "namespaces/{ns}/pods/{pod}/{container}/{container}/logs/{current,previous}.log".
+func (c *mustGatherConverter) convertLog(path string, parts []string) error {
+	if len(parts) != 8 || parts[0] != mustGatherNamespacesDir || parts[2] != "pods" || parts[6] != "logs" {
+		c.log.Debugf("Skipping %q", path)
+		return nil
+	}
+
+	namespace, pod, container := parts[1], parts[3], parts[4]
+	which := strings.TrimSuffix(parts[7], ".log")
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	dst, err := c.output.CreateContainerLog(namespace, pod, container, which)
+	if err != nil {
+		return err
+	}
+
+	defer dst.Close()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// convertResources converts a resource or a list of resources. The group and
+// resource are taken from the path, since the resource name cannot be
+// computed from the kind without discovery:
+//
+//	cluster-scoped-resources/{group}/{resource}/{name}.yaml
+//	namespaces/{ns}/{ns}.yaml
+//	namespaces/{ns}/{group}/{resource}.yaml
+//	namespaces/{ns}/{group}/{resource}/{name}.yaml
+//	namespaces/{ns}/pods/{pod}/{pod}.yaml
+func (c *mustGatherConverter) convertResources(path string, parts []string) error {
+	var gr schema.GroupResource
+	namespaced := true
+
+	switch {
+	case len(parts) == 4 && parts[0] == mustGatherClusterDir:
+		gr = mustGatherGroupResource(parts[1], parts[2])
+		namespaced = false
+	case len(parts) == 3 && parts[0] == mustGatherNamespacesDir && parts[2] == parts[1]+".yaml":
+		gr = schema.GroupResource{Resource: "namespaces"}
+		namespaced = false
+	case len(parts) == 4 && parts[0] == mustGatherNamespacesDir:
+		gr = mustGatherGroupResource(parts[2], strings.TrimSuffix(parts[3], ".yaml"))
+	case len(parts) == 5 && parts[0] == mustGatherNamespacesDir && parts[2] == "pods":
+		gr = schema.GroupResource{Resource: "pods"}
+	case len(parts) == 5 && parts[0] == mustGatherNamespacesDir:
+		gr = mustGatherGroupResource(parts[2], parts[3])
+	default:
+		c.log.Debugf("Skipping %q", path)
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+		c.log.Warnf("Cannot decode %q: %s", path, err)
+		return nil
+	}
+
+	r := &resourceInfo{
+		GroupVersionResource: gr.WithVersion(""),
+		Namespaced:           namespaced,
+	}
+
+	if !obj.IsList() {
+		return c.dumpResource(r, obj)
+	}
+
+	return obj.EachListItem(func(item runtime.Object) error {
+		return c.dumpResource(r, item.(*unstructured.Unstructured))
+	})
+}
+
+func mustGatherGroupResource(group string, resource string) schema.GroupResource {
+	if group == mustGatherCoreGroup {
+		group = ""
+	}
+	return schema.GroupResource{Group: group, Resource: resource}
+}
+
+func (c *mustGatherConverter) dumpResource(r *resourceInfo, item *unstructured.Unstructured) error {
+	if item.GetName() == "" {
+		return nil
+	}
+
+	var relpath string
+	if r.Namespaced {
+		relpath = NamespacedResourcePath(item.GetNamespace(), r.Directory(), item.GetName())
+	} else {
+		relpath = ClusterResourcePath(r.Directory(), item.GetName())
+	}
+
+	if _, ok := c.paths[relpath]; ok {
+		return nil
+	}
+	c.paths[relpath] = struct{}{}
+
+	dst, err := c.output.CreateResource(relpath)
+	if err != nil {
+		return err
+	}
+
+	defer dst.Close()
+
+	writer := bufio.NewWriter(dst)
+	printer := printers.YAMLPrinter{}
+	if err := printer.PrintObj(item, writer); err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	c.index.Add(IndexEntry{
+		Resource:  r.Name(),
+		Namespace: item.GetNamespace(),
+		Name:      item.GetName(),
+		Path:      relpath,
+	})
+
+	return nil
+}
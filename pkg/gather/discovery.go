@@ -0,0 +1,389 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	apidiscoveryv2 "k8s.io/api/apidiscovery/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+const discoveryName = "discovery.json"
+
+// discoveryCache keeps discovery results for the process lifetime, so
+// gathering the same cluster again skips the discovery requests.
+var discoveryCache = struct {
+	mutex  sync.Mutex
+	items  map[string][]*metav1.APIResourceList
+	groups map[string]*discoveryGroups
+}{
+	items:  map[string][]*metav1.APIResourceList{},
+	groups: map[string]*discoveryGroups{},
+}
+
+// discoveryGroups are the server groups and resources in all versions.
+type discoveryGroups struct {
+	Groups    []*metav1.APIGroup        `json:"groups"`
+	Resources []*metav1.APIResourceList `json:"resources"`
+}
+
+var unsafeCacheKey = regexp.MustCompile(`[^\w\.-]+`)
+
+// serverPreferredResources returns the server preferred resources, using the
+// discovery cache if possible. Results are cached per cluster URL and server
+// version in memory, and on disk if Options.DiscoveryCacheDir is set.
+func (g *Gatherer) serverPreferredResources() ([]*metav1.APIResourceList, error) {
+	key, err := g.discoveryCacheKey()
+	if err != nil {
+		return nil, err
+	}
+
+	discoveryCache.mutex.Lock()
+	items, ok := discoveryCache.items[key]
+	discoveryCache.mutex.Unlock()
+
+	if ok {
+		g.log.Debugf("Using cached discovery for %q", key)
+		return items, nil
+	}
+
+	ok = g.readDiscoveryCache(key, &items)
+	if !ok {
+		items, err = g.discovery.ServerPreferredResources()
+		if err != nil {
+			// Partial results when some groups failed discovery; we gather
+			// what we can, but do not cache the partial results.
+			if err := g.recordDiscoveryError(err); err != nil {
+				return nil, err
+			}
+			return items, nil
+		}
+		g.writeDiscoveryCache(key, items)
+	}
+
+	discoveryCache.mutex.Lock()
+	discoveryCache.items[key] = items
+	discoveryCache.mutex.Unlock()
+
+	return items, nil
+}
+
+// serverGroupsAndResources returns the server groups and resources in all
+// versions, using the discovery cache like serverPreferredResources. The
+// result is discovered once per gather, and shared by the resource selection
+// and the discovery document. If some groups failed discovery, the partial
+// result is returned with a *discovery.ErrGroupDiscoveryFailed error.
+func (g *Gatherer) serverGroupsAndResources() ([]*metav1.APIGroup, []*metav1.APIResourceList, error) {
+	g.groupsOnce.Do(func() {
+		g.groups, g.groupsErr = g.discoverGroups()
+	})
+
+	if g.groups == nil {
+		return nil, nil, g.groupsErr
+	}
+
+	return g.groups.Groups, g.groups.Resources, g.groupsErr
+}
+
+func (g *Gatherer) discoverGroups() (*discoveryGroups, error) {
+	key, err := g.discoveryCacheKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key = "groups@" + key
+
+	discoveryCache.mutex.Lock()
+	result, ok := discoveryCache.groups[key]
+	discoveryCache.mutex.Unlock()
+
+	if ok {
+		g.log.Debugf("Using cached discovery for %q", key)
+		return result, nil
+	}
+
+	result = &discoveryGroups{}
+	if !g.readDiscoveryCache(key, result) {
+		groups, items, err := g.discovery.ServerGroupsAndResources()
+		result = &discoveryGroups{Groups: groups, Resources: items}
+		if err != nil {
+			// Partial results are not cached.
+			return result, err
+		}
+		g.writeDiscoveryCache(key, result)
+	}
+
+	discoveryCache.mutex.Lock()
+	discoveryCache.groups[key] = result
+	discoveryCache.mutex.Unlock()
+
+	return result, nil
+}
+
+// discoveryCacheKey returns the cluster URL and server version.
+func (g *Gatherer) discoveryCacheKey() (string, error) {
+	version, err := g.discovery.ServerVersion()
+	if err != nil {
+		return "", err
+	}
+
+	return g.config.Host + "@" + version.GitVersion, nil
+}
+
+func (g *Gatherer) discoveryCachePath(key string) string {
+	name := unsafeCacheKey.ReplaceAllString(key, "_") + ".json"
+	return filepath.Join(g.opts.DiscoveryCacheDir, name)
+}
+
+// readDiscoveryCache reads the cached discovery results for key into v.
+// Returns false if the cache does not exist or expired.
+func (g *Gatherer) readDiscoveryCache(key string, v any) bool {
+	if g.opts.DiscoveryCacheDir == "" {
+		return false
+	}
+
+	path := g.discoveryCachePath(key)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	if time.Since(info.ModTime()) > g.opts.DiscoveryCacheTTL {
+		g.log.Debugf("Discovery cache %q expired", path)
+		return false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		g.log.Debugf("Cannot read discovery cache: %s", err)
+		return false
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		g.log.Debugf("Cannot parse discovery cache %q: %s", path, err)
+		return false
+	}
+
+	g.log.Debugf("Using discovery cache %q", path)
+	return true
+}
+
+func (g *Gatherer) writeDiscoveryCache(key string, v any) {
+	if g.opts.DiscoveryCacheDir == "" {
+		return
+	}
+
+	if err := os.MkdirAll(g.opts.DiscoveryCacheDir, 0750); err != nil {
+		g.log.Warnf("Cannot create discovery cache directory: %s", err)
+		return
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		g.log.Warnf("Cannot encode discovery cache: %s", err)
+		return
+	}
+
+	// Write to temporary file and rename, so concurrent gathers never read a
+	// partly written cache.
+	path := g.discoveryCachePath(key)
+	tmp, err := os.CreateTemp(g.opts.DiscoveryCacheDir, ".tmp-*")
+	if err != nil {
+		g.log.Warnf("Cannot create discovery cache: %s", err)
+		return
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		g.log.Warnf("Cannot write discovery cache: %s", err)
+		return
+	}
+
+	if err := tmp.Close(); err != nil {
+		g.log.Warnf("Cannot write discovery cache: %s", err)
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		g.log.Warnf("Cannot write discovery cache: %s", err)
+	}
+}
+
+// gatherDiscovery writes the API server discovery document to
+// cluster/discovery.json, so offline tools can resolve kinds, short names
+// and verbs exactly as the live cluster. The document uses the aggregated
+// discovery format (apidiscovery.k8s.io/v2 APIGroupDiscoveryList) for all
+// servers. Group versions that failed discovery are marked as stale.
+func (g *Gatherer) gatherDiscovery() {
+	groups, items, err := g.serverGroupsAndResources()
+	var failed map[schema.GroupVersion]error
+	if err != nil {
+		var groupsErr *discovery.ErrGroupDiscoveryFailed
+		if !errors.As(err, &groupsErr) {
+			g.log.Warnf("Cannot discover api resources: %s", err)
+			return
+		}
+		// Failed groups were reported when listing api resources.
+		failed = groupsErr.Groups
+	}
+
+	doc := discoveryDocument(groups, items, failed)
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		g.log.Warnf("Cannot encode %q: %s", discoveryName, err)
+		return
+	}
+
+	relpath := path.Join(clusterDir, discoveryName)
+	dst, err := g.output.CreateResource(relpath)
+	if err != nil {
+		g.log.Warnf("Cannot create %q: %s", relpath, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if _, err := dst.Write(data); err != nil {
+		g.log.Warnf("Cannot write %q: %s", relpath, err)
+	}
+}
+
+// discoveryDocument converts the discovery groups and resources lists to an
+// aggregated discovery document. Versions are ordered by preference, and
+// subresources (e.g. "pods/status") are nested in their resource.
+func discoveryDocument(
+	groups []*metav1.APIGroup,
+	items []*metav1.APIResourceList,
+	failed map[schema.GroupVersion]error,
+) *apidiscoveryv2.APIGroupDiscoveryList {
+	lists := map[string]*metav1.APIResourceList{}
+	for _, list := range items {
+		lists[list.GroupVersion] = list
+	}
+
+	doc := &apidiscoveryv2.APIGroupDiscoveryList{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apidiscoveryv2.SchemeGroupVersion.String(),
+			Kind:       "APIGroupDiscoveryList",
+		},
+		Items: []apidiscoveryv2.APIGroupDiscovery{},
+	}
+
+	for _, group := range groups {
+		entry := apidiscoveryv2.APIGroupDiscovery{
+			ObjectMeta: metav1.ObjectMeta{Name: group.Name},
+			Versions:   []apidiscoveryv2.APIVersionDiscovery{},
+		}
+
+		// The preferred version is first.
+		versions := slices.Clone(group.Versions)
+		slices.SortStableFunc(versions, func(a, b metav1.GroupVersionForDiscovery) int {
+			if a.Version == group.PreferredVersion.Version {
+				return -1
+			}
+			if b.Version == group.PreferredVersion.Version {
+				return 1
+			}
+			return 0
+		})
+
+		for _, version := range versions {
+			gv := schema.GroupVersion{Group: group.Name, Version: version.Version}
+			freshness := apidiscoveryv2.DiscoveryFreshnessCurrent
+			if _, ok := failed[gv]; ok {
+				freshness = apidiscoveryv2.DiscoveryFreshnessStale
+			}
+			entry.Versions = append(entry.Versions, apidiscoveryv2.APIVersionDiscovery{
+				Version:   version.Version,
+				Resources: discoveryResources(gv, lists[version.GroupVersion]),
+				Freshness: freshness,
+			})
+		}
+
+		doc.Items = append(doc.Items, entry)
+	}
+
+	return doc
+}
+
+func discoveryResources(gv schema.GroupVersion, list *metav1.APIResourceList) []apidiscoveryv2.APIResourceDiscovery {
+	resources := []apidiscoveryv2.APIResourceDiscovery{}
+	if list == nil {
+		return resources
+	}
+
+	index := map[string]int{}
+
+	for i := range list.APIResources {
+		res := &list.APIResources[i]
+		if strings.Contains(res.Name, "/") {
+			continue
+		}
+
+		scope := apidiscoveryv2.ScopeCluster
+		if res.Namespaced {
+			scope = apidiscoveryv2.ScopeNamespace
+		}
+
+		index[res.Name] = len(resources)
+		resources = append(resources, apidiscoveryv2.APIResourceDiscovery{
+			Resource:         res.Name,
+			ResponseKind:     discoveryKind(gv, res),
+			Scope:            scope,
+			SingularResource: res.SingularName,
+			Verbs:            res.Verbs,
+			ShortNames:       res.ShortNames,
+			Categories:       res.Categories,
+		})
+	}
+
+	for i := range list.APIResources {
+		res := &list.APIResources[i]
+		name, subresource, found := strings.Cut(res.Name, "/")
+		if !found {
+			continue
+		}
+
+		j, ok := index[name]
+		if !ok {
+			continue
+		}
+
+		resources[j].Subresources = append(resources[j].Subresources, apidiscoveryv2.APISubresourceDiscovery{
+			Subresource:  subresource,
+			ResponseKind: discoveryKind(gv, res),
+			Verbs:        res.Verbs,
+		})
+	}
+
+	return resources
+}
+
+// discoveryKind returns the response kind of resource. Resources returning a
+// kind in another group (e.g. "deployments/scale") specify the group and
+// version.
+func discoveryKind(gv schema.GroupVersion, res *metav1.APIResource) *metav1.GroupVersionKind {
+	kind := &metav1.GroupVersionKind{Group: gv.Group, Version: gv.Version, Kind: res.Kind}
+	if res.Group != "" || res.Version != "" {
+		kind.Group = res.Group
+		kind.Version = res.Version
+	}
+	return kind
+}
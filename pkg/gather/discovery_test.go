@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	apidiscoveryv2 "k8s.io/api/apidiscovery/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestDiscoveryDocument(t *testing.T) {
+	groups := []*metav1.APIGroup{
+		{
+			Name: "apps",
+			Versions: []metav1.GroupVersionForDiscovery{
+				{GroupVersion: "apps/v1beta1", Version: "v1beta1"},
+				{GroupVersion: "apps/v1", Version: "v1"},
+			},
+			PreferredVersion: metav1.GroupVersionForDiscovery{GroupVersion: "apps/v1", Version: "v1"},
+		},
+	}
+	items := []*metav1.APIResourceList{
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{
+					Name:         "deployments",
+					SingularName: "deployment",
+					Namespaced:   true,
+					Kind:         "Deployment",
+					Verbs:        []string{"get", "list"},
+					ShortNames:   []string{"deploy"},
+					Categories:   []string{"all"},
+				},
+				{
+					Name:    "deployments/scale",
+					Group:   "autoscaling",
+					Version: "v1",
+					Kind:    "Scale",
+					Verbs:   []string{"get", "patch"},
+				},
+			},
+		},
+	}
+	failed := map[schema.GroupVersion]error{
+		{Group: "apps", Version: "v1beta1"}: stderrors.New("service unavailable"),
+	}
+
+	doc := discoveryDocument(groups, items, failed)
+
+	expected := []apidiscoveryv2.APIGroupDiscovery{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "apps"},
+			Versions: []apidiscoveryv2.APIVersionDiscovery{
+				{
+					Version: "v1",
+					Resources: []apidiscoveryv2.APIResourceDiscovery{
+						{
+							Resource:         "deployments",
+							ResponseKind:     &metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+							Scope:            apidiscoveryv2.ScopeNamespace,
+							SingularResource: "deployment",
+							Verbs:            []string{"get", "list"},
+							ShortNames:       []string{"deploy"},
+							Categories:       []string{"all"},
+							Subresources: []apidiscoveryv2.APISubresourceDiscovery{
+								{
+									Subresource:  "scale",
+									ResponseKind: &metav1.GroupVersionKind{Group: "autoscaling", Version: "v1", Kind: "Scale"},
+									Verbs:        []string{"get", "patch"},
+								},
+							},
+						},
+					},
+					Freshness: apidiscoveryv2.DiscoveryFreshnessCurrent,
+				},
+				{
+					Version:   "v1beta1",
+					Resources: []apidiscoveryv2.APIResourceDiscovery{},
+					Freshness: apidiscoveryv2.DiscoveryFreshnessStale,
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(doc.Items, expected) {
+		t.Errorf("expected %+v, got %+v", expected, doc.Items)
+	}
+}
+
+func TestGatherDiscoveryUsesCachedResources(t *testing.T) {
+	g, _ := newTestGatherer(t, Options{AllVersions: true}, &fakeLister{})
+	fake := g.discovery.(*fakeDiscovery).FakeDiscovery
+	fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"list"}},
+			},
+		},
+	}
+
+	if _, err := g.listAPIResources(); err != nil {
+		t.Fatal(err)
+	}
+	g.gatherDiscovery()
+
+	// Gathering the same cluster again uses the cache.
+	g2, _ := newTestGatherer(t, Options{}, &fakeLister{})
+	g2.discovery = g.discovery
+	g2.gatherDiscovery()
+
+	requests := 0
+	for _, action := range fake.Actions() {
+		if action.GetResource().Resource == "resource" {
+			requests++
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected 1 discovery request, got %d", requests)
+	}
+
+	for _, dir := range []string{g.output.base, g2.output.base} {
+		if _, err := os.Stat(filepath.Join(dir, clusterDir, discoveryName)); err != nil {
+			t.Error(err)
+		}
+	}
+}
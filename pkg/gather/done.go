@@ -0,0 +1,281 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// DoneName is the completion marker written at the end of a successful
+	// gather.
+	DoneName = "DONE"
+
+	checksumsName = "checksums.sha256"
+
+	// Appended by every gather, including after the marker was written.
+	gatherLogName = "gather.log"
+)
+
+// Done describes a completed gather. It is written to the DONE file in the
+// gather directory when the gather completes successfully, so consumers can
+// reject incomplete gathers.
+type Done struct {
+	// Version of the program creating the gather.
+	Version string `json:"version"`
+
+	// Time when the gather completed. Empty in a deterministic gather.
+	Time *time.Time `json:"time,omitempty"`
+
+	// Number of files listed in checksums.sha256.
+	Files int `json:"files"`
+
+	// SHA256 checksum of checksums.sha256, listing the checksums of all files
+	// in the gather directory.
+	Checksum string `json:"checksum"`
+}
+
+// VerifyResult describes the result of verifying a gather directory.
+type VerifyResult struct {
+	// Number of verified files.
+	Files int
+
+	// Problems found in the gather directory. Empty if the gather is
+	// complete.
+	Problems []string
+}
+
+// WriteDone writes the checksums of all files in the gather directory to
+// checksums.sha256, and the DONE marker with the checksum of the checksums
+// file. The gather log is not included, since it is written until the
+// program terminates. Symbolic links are not included.
+func WriteDone(directory string, deterministic bool) (*Done, error) {
+	// A previous marker is invalid once the gather directory is modified.
+	if err := RemoveDone(directory); err != nil {
+		return nil, err
+	}
+
+	files, err := checksumFiles(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var checksums bytes.Buffer
+	for _, relpath := range files {
+		sum, err := fileChecksum(filepath.Join(directory, filepath.FromSlash(relpath)))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&checksums, "%s  %s\n", sum, relpath)
+	}
+
+	if err := os.WriteFile(filepath.Join(directory, checksumsName), checksums.Bytes(), 0640); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(checksums.Bytes())
+	done := &Done{
+		Version:  Version,
+		Files:    len(files),
+		Checksum: hex.EncodeToString(sum[:]),
+	}
+	if !deterministic {
+		now := time.Now()
+		done.Time = &now
+	}
+
+	data, err := json.MarshalIndent(done, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(filepath.Join(directory, DoneName), append(data, '\n'), 0640); err != nil {
+		return nil, err
+	}
+
+	return done, nil
+}
+
+// RemoveDone removes the DONE marker from directory, marking the gather as
+// incomplete.
+func RemoveDone(directory string) error {
+	err := os.Remove(filepath.Join(directory, DoneName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Verify checks that the gather directory is complete: the DONE marker
+// exists, the checksums file matches the marker, every file matches its
+// checksum, and every resource in the clusters indexes exists. Files added
+// after the gather completed (e.g. report.html) are ignored.
+func Verify(directory string) (*VerifyResult, error) {
+	result := &VerifyResult{}
+
+	data, err := os.ReadFile(filepath.Join(directory, DoneName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			result.Problems = append(result.Problems, "missing DONE marker: gather is incomplete")
+			return result, nil
+		}
+		return nil, err
+	}
+
+	done := &Done{}
+	if err := json.Unmarshal(data, done); err != nil {
+		result.Problems = append(result.Problems, fmt.Sprintf("invalid DONE marker: %s", err))
+		return result, nil
+	}
+
+	checksums, err := os.ReadFile(filepath.Join(directory, checksumsName))
+	if err != nil {
+		result.Problems = append(result.Problems, fmt.Sprintf("cannot read checksums: %s", err))
+		return result, nil
+	}
+
+	sum := sha256.Sum256(checksums)
+	if hex.EncodeToString(sum[:]) != done.Checksum {
+		result.Problems = append(result.Problems, "checksums do not match the DONE marker")
+		return result, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		expected, relpath, found := strings.Cut(scanner.Text(), "  ")
+		if !found {
+			result.Problems = append(result.Problems, fmt.Sprintf("invalid checksum line %q", scanner.Text()))
+			continue
+		}
+
+		result.Files++
+
+		actual, err := fileChecksum(filepath.Join(directory, filepath.FromSlash(relpath)))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				result.Problems = append(result.Problems, fmt.Sprintf("missing file %q", relpath))
+			} else {
+				result.Problems = append(result.Problems, fmt.Sprintf("cannot read %q: %s", relpath, err))
+			}
+			continue
+		}
+
+		if actual != expected {
+			result.Problems = append(result.Problems, fmt.Sprintf("checksum mismatch for %q", relpath))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if result.Files != done.Files {
+		result.Problems = append(result.Problems, fmt.Sprintf("expected %d files, found %d checksums",
+			done.Files, result.Files))
+	}
+
+	problems, err := verifyIndexes(directory)
+	if err != nil {
+		return nil, err
+	}
+	result.Problems = append(result.Problems, problems...)
+
+	return result, nil
+}
+
+// verifyIndexes checks that every resource in the clusters indexes exists.
+func verifyIndexes(directory string) ([]string, error) {
+	clusterDirs, err := FindClusterDirs(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+
+	for _, clusterDir := range clusterDirs {
+		entries, err := ReadIndex(clusterDir)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("cannot read index in %q: %s", clusterDir, err))
+			continue
+		}
+
+		for _, entry := range entries {
+			filename := filepath.Join(clusterDir, filepath.FromSlash(path.Clean(entry.Path)))
+			if _, err := os.Stat(filename); err != nil {
+				problems = append(problems, fmt.Sprintf("resource %q in index missing: %s", entry.Path, err))
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// checksumFiles returns the sorted paths of the regular files in directory,
+// relative to directory and using "/" separator.
+func checksumFiles(directory string) ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(directory, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		relpath, err := filepath.Rel(directory, filename)
+		if err != nil {
+			return err
+		}
+
+		relpath = filepath.ToSlash(relpath)
+		switch relpath {
+		case DoneName, checksumsName, gatherLogName:
+			return nil
+		}
+
+		// Locks of running gathers (e.g. ".gather.lock").
+		if strings.HasPrefix(path.Base(relpath), ".") && strings.HasSuffix(relpath, ".lock") {
+			return nil
+		}
+
+		files = append(files, relpath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(files)
+	return files, nil
+}
+
+func fileChecksum(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
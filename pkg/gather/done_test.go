@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWriteDoneAndVerify(t *testing.T) {
+	dir := t.TempDir()
+	clusterDir := filepath.Join(dir, "cluster1")
+
+	output := NewOutputDirectory(clusterDir)
+	idx := &index{}
+	var written atomic.Int64
+	w := &resourceWriter{output: output, index: idx, written: &written}
+	for _, item := range newItems(3) {
+		if err := w.Dump(&persistentVolumes, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := idx.Write(output); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, gatherLogName), []byte("log\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := WriteDone(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Files != 4 {
+		t.Errorf("expected 4 files, got %d", done.Files)
+	}
+
+	// The gather log may be modified after the gather completed.
+	if err := os.WriteFile(filepath.Join(dir, gatherLogName), []byte("more log\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Verify(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != 4 || len(result.Problems) != 0 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	relpath := ClusterResourcePath("persistentvolumes", "pv-001")
+	if err := os.WriteFile(filepath.Join(clusterDir, relpath), []byte("modified\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(clusterDir, ClusterResourcePath("persistentvolumes", "pv-002"))); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = Verify(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Checksum mismatch, missing file, and missing resource in index.
+	if len(result.Problems) != 3 {
+		t.Errorf("expected 3 problems, got %q", result.Problems)
+	}
+
+	if err := RemoveDone(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = Verify(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Problems) != 1 || !strings.Contains(result.Problems[0], "missing DONE") {
+		t.Errorf("expected missing marker, got %q", result.Problems)
+	}
+}
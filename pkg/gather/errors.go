@@ -0,0 +1,335 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	errorsName = "errors.yaml"
+)
+
+// Failure modes recorded in the error report.
+const (
+	// Listing a resource failed.
+	ListFailed = "ListFailed"
+
+	// Listing a resource failed because of a broken conversion webhook. Items
+	// were fetched individually.
+	ConversionFailed = "ConversionFailed"
+
+	// Getting a single resource failed.
+	GetFailed = "GetFailed"
+
+	// The object is larger than the max object size and was not stored.
+	ObjectTooLarge = "ObjectTooLarge"
+
+	// Discovery of an API group version failed (e.g. broken aggregated API).
+	// Resources in the group version were not gathered. The resource is the
+	// group version.
+	DiscoveryFailed = "DiscoveryFailed"
+)
+
+// Kinds of errors returned by the gatherer or recorded in the error report.
+// Errors wrap one of these errors, so callers can check the kind of error
+// with errors.Is().
+var (
+	// Listing or getting a resource is not allowed.
+	ErrListForbidden = errors.New("list forbidden")
+
+	// The list continue token expired.
+	ErrResourceExpired = errors.New("resource expired")
+
+	// A conversion webhook failed.
+	ErrConversionFailed = errors.New("conversion failed")
+
+	// The API server is temporarily unavailable, overloaded, or timed out.
+	ErrServerUnavailable = errors.New("server unavailable")
+
+	// An object is larger than the max object size.
+	ErrObjectTooLarge = errors.New("object too large")
+
+	// An agent pod failed to start.
+	ErrAgentPodFailed = errors.New("agent pod failed")
+
+	// An addon did not complete in the addon timeout.
+	ErrAddonTimeout = errors.New("addon timed out")
+
+	// An addon panicked.
+	ErrAddonPanic = errors.New("addon panicked")
+
+	// A command did not complete in the command timeout.
+	ErrCommandTimeout = errors.New("command timed out")
+
+	// The gather was interrupted.
+	ErrInterrupted = errors.New("gather interrupted")
+)
+
+// errorKinds maps error kinds to names recorded in the error report.
+var errorKinds = []struct {
+	err  error
+	name string
+}{
+	{ErrListForbidden, "ListForbidden"},
+	{ErrResourceExpired, "ResourceExpired"},
+	{ErrConversionFailed, "ConversionFailed"},
+	{ErrServerUnavailable, "ServerUnavailable"},
+	{ErrObjectTooLarge, "ObjectTooLarge"},
+	{ErrAgentPodFailed, "AgentPodFailed"},
+	{ErrAddonTimeout, "AddonTimeout"},
+	{ErrAddonPanic, "AddonPanic"},
+	{ErrCommandTimeout, "CommandTimeout"},
+	{ErrInterrupted, "Interrupted"},
+	{ErrReadOnly, "ReadOnly"},
+}
+
+// ErrorKind returns the name of the kind of err (e.g. "ListForbidden"), or
+// an empty string if err is not one of the known kinds.
+func ErrorKind(err error) string {
+	for _, k := range errorKinds {
+		if errors.Is(err, k.err) {
+			return k.name
+		}
+	}
+	return ""
+}
+
+// IsRetryable returns true if the operation failing with err may succeed if
+// retried later.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrResourceExpired) || errors.Is(err, ErrServerUnavailable)
+}
+
+// kindError wraps an error with its kind, keeping the error message.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// wrapAPIError wraps an error returned when listing or getting resources with
+// its kind. The API server error is kept, so callers can still inspect it.
+func wrapAPIError(err error) error {
+	var kind error
+	switch {
+	case apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err):
+		kind = ErrListForbidden
+	case apierrors.IsResourceExpired(err) || apierrors.IsGone(err):
+		kind = ErrResourceExpired
+	case isConversionError(err):
+		kind = ErrConversionFailed
+	case apierrors.IsServiceUnavailable(err) || apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err):
+		kind = ErrServerUnavailable
+	default:
+		return err
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// GatherError describes resources that could not be gathered.
+type GatherError struct {
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Reason    string `json:"reason"`
+
+	// Kind of the error (e.g. "ListForbidden"), if known.
+	Kind string `json:"kind,omitempty"`
+
+	Message string `json:"message"`
+
+	// Retried is set if the error was recorded when retrying failed
+	// operations at the end of the gather.
+	Retried bool `json:"retried,omitempty"`
+}
+
+// errorReport collects errors from all workers. The report is written to
+// errors.yaml in the cluster directory if any error was recorded.
+type errorReport struct {
+	mutex    sync.Mutex
+	errors   []GatherError
+	retrying bool
+}
+
+func (r *errorReport) Add(e GatherError) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	e.Retried = r.retrying
+	r.errors = append(r.errors, e)
+}
+
+// Retrying marks errors recorded from now on as retried.
+func (r *errorReport) Retrying() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.retrying = true
+}
+
+// Remove removes the errors recorded for resource in namespace with name. If
+// name is empty, all errors for resource in namespace are removed.
+func (r *errorReport) Remove(resource string, namespace string, name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.errors = slices.DeleteFunc(r.errors, func(e GatherError) bool {
+		return e.matches(resource, namespace, name)
+	})
+}
+
+// Has returns true if an error was recorded for resource in namespace with
+// name. If name is empty, any error for resource in namespace matches.
+func (r *errorReport) Has(resource string, namespace string, name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return slices.ContainsFunc(r.errors, func(e GatherError) bool {
+		return e.matches(resource, namespace, name)
+	})
+}
+
+// Len returns the number of recorded errors.
+func (r *errorReport) Len() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.errors)
+}
+
+// Kinds returns the number of recorded errors by kind.
+func (r *errorReport) Kinds() map[string]int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var kinds map[string]int
+	for i := range r.errors {
+		if kind := r.errors[i].Kind; kind != "" {
+			if kinds == nil {
+				kinds = map[string]int{}
+			}
+			kinds[kind]++
+		}
+	}
+
+	return kinds
+}
+
+// Errors returns the recorded errors sorted by resource, namespace and name.
+func (r *errorReport) Errors() []GatherError {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	errors := slices.Clone(r.errors)
+	slices.SortFunc(errors, compareErrors)
+
+	return errors
+}
+
+func compareErrors(a, b GatherError) int {
+	if c := strings.Compare(a.Resource, b.Resource); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.Namespace, b.Namespace); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Name, b.Name)
+}
+
+func (e *GatherError) matches(resource string, namespace string, name string) bool {
+	return e.Resource == resource && e.Namespace == namespace && (name == "" || e.Name == name)
+}
+
+func (g *Gatherer) addError(r *resourceInfo, namespace string, name string, reason string, err error) {
+	g.errors.Add(GatherError{
+		Resource:  r.Name(),
+		Namespace: namespace,
+		Name:      name,
+		Reason:    reason,
+		Kind:      ErrorKind(err),
+		Message:   err.Error(),
+	})
+}
+
+// allErrors returns the errors recorded by this gather and by previous
+// gathers when appending, sorted by resource, namespace and name. Previous
+// errors recorded again by this gather are replaced.
+func (g *Gatherer) allErrors() []GatherError {
+	errors := g.errors.Errors()
+	if len(g.previousErrors) == 0 {
+		return errors
+	}
+
+	for _, e := range g.previousErrors {
+		if !slices.ContainsFunc(errors, func(o GatherError) bool {
+			return o.Resource == e.Resource && o.Namespace == e.Namespace && o.Name == e.Name && o.Reason == e.Reason
+		}) {
+			errors = append(errors, e)
+		}
+	}
+
+	slices.SortFunc(errors, compareErrors)
+	return errors
+}
+
+// readErrors reads the error report of the cluster directory.
+func readErrors(clusterDir string) ([]GatherError, error) {
+	data, err := os.ReadFile(filepath.Join(clusterDir, errorsName))
+	if err != nil {
+		return nil, err
+	}
+
+	var errors []GatherError
+	if err := yaml.Unmarshal(data, &errors); err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", errorsName, err)
+	}
+
+	return errors, nil
+}
+
+func (g *Gatherer) writeErrors() {
+	errors := g.allErrors()
+	if len(errors) == 0 {
+		return
+	}
+
+	data, err := yaml.Marshal(errors)
+	if err != nil {
+		g.log.Warnf("Cannot encode %q: %s", errorsName, err)
+		return
+	}
+
+	dst, err := g.output.CreateFile(errorsName)
+	if err != nil {
+		g.log.Warnf("Cannot create %q: %s", errorsName, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if _, err := dst.Write(data); err != nil {
+		g.log.Warnf("Cannot write %q: %s", errorsName, err)
+	}
+}
+
+// isConversionError returns true if err was caused by a failing conversion
+// webhook. The API server does not return a specific reason, so we must
+// inspect the message (e.g. "conversion webhook for example.com/v1, Kind=Foo
+// failed: ...").
+func isConversionError(err error) bool {
+	return strings.Contains(err.Error(), "conversion webhook")
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	stderrors "errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestWrapAPIError(t *testing.T) {
+	gr := schema.GroupResource{Resource: "pods"}
+	cases := []struct {
+		err       error
+		kind      error
+		name      string
+		retryable bool
+	}{
+		{errors.NewForbidden(gr, "", stderrors.New("denied")), ErrListForbidden, "ListForbidden", false},
+		{errors.NewUnauthorized("no token"), ErrListForbidden, "ListForbidden", false},
+		{errors.NewResourceExpired("expired"), ErrResourceExpired, "ResourceExpired", true},
+		{errors.NewInternalError(stderrors.New("conversion webhook for example.com/v1, Kind=Foo failed")),
+			ErrConversionFailed, "ConversionFailed", false},
+		{errors.NewServiceUnavailable("try later"), ErrServerUnavailable, "ServerUnavailable", true},
+		{errors.NewTooManyRequests("slow down", 1), ErrServerUnavailable, "ServerUnavailable", true},
+		{errors.NewNotFound(gr, "pod"), nil, "", false},
+		{stderrors.New("unexpected EOF"), nil, "", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.err.Error(), func(t *testing.T) {
+			err := wrapAPIError(c.err)
+			if c.kind != nil && !stderrors.Is(err, c.kind) {
+				t.Errorf("expected %v, got %v", c.kind, err)
+			}
+			if !stderrors.Is(err, c.err) {
+				t.Errorf("original error not wrapped: %v", err)
+			}
+			if err.Error() != c.err.Error() {
+				t.Errorf("expected message %q, got %q", c.err.Error(), err.Error())
+			}
+			if name := ErrorKind(err); name != c.name {
+				t.Errorf("expected kind %q, got %q", c.name, name)
+			}
+			if retryable := IsRetryable(err); retryable != c.retryable {
+				t.Errorf("expected retryable %v, got %v", c.retryable, retryable)
+			}
+		})
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	cases := []struct {
+		err  error
+		name string
+	}{
+		{&ObjectTooLargeError{Size: 2, Limit: 1}, "ObjectTooLarge"},
+		{fmt.Errorf("%w: agent pod %q failed", ErrAgentPodFailed, "ns/agent"), "AgentPodFailed"},
+		{fmt.Errorf("%w after %s", ErrAddonTimeout, time.Minute), "AddonTimeout"},
+		{fmt.Errorf("%w: rejected DELETE /api/v1/pods", ErrReadOnly), "ReadOnly"},
+		{stderrors.New("other"), ""},
+	}
+
+	for _, c := range cases {
+		if name := ErrorKind(c.err); name != c.name {
+			t.Errorf("expected kind %q for %q, got %q", c.name, c.err, name)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// exportSchema creates the tables for exporting a gather directory to SQL.
+const exportSchema = `CREATE TABLE resources (
+  cluster TEXT NOT NULL,
+  resource TEXT NOT NULL,
+  kind TEXT,
+  namespace TEXT,
+  name TEXT NOT NULL,
+  path TEXT NOT NULL,
+  creation_timestamp TEXT,
+  labels TEXT,
+  object TEXT
+);
+CREATE INDEX resources_kind ON resources (cluster, kind, namespace, name);
+CREATE INDEX resources_resource ON resources (cluster, resource, namespace, name);
+CREATE TABLE events (
+  cluster TEXT NOT NULL,
+  namespace TEXT,
+  time TEXT,
+  type TEXT,
+  reason TEXT,
+  object TEXT,
+  message TEXT
+);
+CREATE INDEX events_time ON events (cluster, time);
+`
+
+// ExportSQL writes SQL statements loading the resources and events in the
+// gather directory. Resources are stored as JSON text with extracted columns,
+// so they can be queried with SQLite JSON functions. Returns the number of
+// exported resources.
+func ExportSQL(directory string, w io.Writer) (int, error) {
+	clusterDirs, err := FindClusterDirs(directory)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(clusterDirs) == 0 {
+		return 0, fmt.Errorf("no cluster directory found in %q", directory)
+	}
+
+	writer := bufio.NewWriter(w)
+	writer.WriteString("BEGIN TRANSACTION;\n")
+	writer.WriteString(exportSchema)
+
+	count := 0
+
+	for _, dir := range clusterDirs {
+		cluster, err := filepath.Rel(directory, dir)
+		if err != nil {
+			return 0, err
+		}
+
+		entries, err := ReadIndex(dir)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, entry := range entries {
+			item, err := ReadResource(dir, entry)
+			if err != nil {
+				return 0, err
+			}
+
+			labels, err := json.Marshal(item.GetLabels())
+			if err != nil {
+				return 0, err
+			}
+
+			object, err := json.Marshal(item.Object)
+			if err != nil {
+				return 0, err
+			}
+
+			var created string
+			if ts := item.GetCreationTimestamp(); !ts.IsZero() {
+				created = ts.UTC().Format(time.RFC3339)
+			}
+
+			fmt.Fprintf(writer, "INSERT INTO resources VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s);\n",
+				sqlString(cluster),
+				sqlString(entry.Resource),
+				sqlString(item.GetKind()),
+				sqlString(entry.Namespace),
+				sqlString(entry.Name),
+				sqlString(entry.Path),
+				sqlString(created),
+				sqlString(string(labels)),
+				sqlString(string(object)))
+
+			if entry.Resource == "events.k8s.io/events" {
+				event := eventRow(item)
+				fmt.Fprintf(writer, "INSERT INTO events VALUES (%s, %s, %s, %s, %s, %s, %s);\n",
+					sqlString(cluster),
+					sqlString(event.Namespace),
+					sqlString(event.Time),
+					sqlString(event.Type),
+					sqlString(event.Reason),
+					sqlString(event.Object),
+					sqlString(event.Message))
+			}
+
+			count++
+		}
+	}
+
+	writer.WriteString("COMMIT;\n")
+
+	return count, writer.Flush()
+}
+
+// sqlString returns s as a quoted SQL string literal.
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSQLString(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected string
+	}{
+		{"", "''"},
+		{"web", "'web'"},
+		{"it's", "'it''s'"},
+		{"''", "''''''"},
+		{`{"a": "b\n"}`, `'{"a": "b\n"}'`},
+	}
+
+	for _, c := range cases {
+		if s := sqlString(c.value); s != c.expected {
+			t.Errorf("sqlString(%q): expected %s, got %s", c.value, c.expected, s)
+		}
+	}
+}
+
+func TestExportSQL(t *testing.T) {
+	dir := t.TempDir()
+
+	writeCluster(t, filepath.Join(dir, "dr1"), []testResource{
+		{IndexEntry{
+			Resource:  "configmaps",
+			Namespace: "my-app",
+			Name:      "o'brien",
+			Path:      "namespaces/my-app/configmaps/o'brien.yaml",
+		}, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: o'brien
+  namespace: my-app
+  creationTimestamp: "2024-06-01T10:00:00Z"
+  labels:
+    app: it's
+`},
+		{IndexEntry{
+			Resource:  "events.k8s.io/events",
+			Namespace: "my-app",
+			Name:      "web.17a",
+			Path:      "namespaces/my-app/events.k8s.io/events/web.17a.yaml",
+		}, `apiVersion: events.k8s.io/v1
+kind: Event
+metadata:
+  name: web.17a
+  namespace: my-app
+eventTime: "2024-06-01T10:01:00.000000Z"
+type: Warning
+reason: FailedMount
+note: volume "data" can't be mounted
+regarding:
+  kind: Pod
+  name: web
+`},
+	})
+
+	var buf bytes.Buffer
+	count, err := ExportSQL(dir, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 resources, got %d", count)
+	}
+
+	sql := buf.String()
+	if !strings.HasPrefix(sql, "BEGIN TRANSACTION;\n"+exportSchema) || !strings.HasSuffix(sql, "COMMIT;\n") {
+		t.Errorf("unexpected transaction:\n%s", sql)
+	}
+
+	for _, expected := range []string{
+		`INSERT INTO resources VALUES ('dr1', 'configmaps', 'ConfigMap', 'my-app', 'o''brien', ` +
+			`'namespaces/my-app/configmaps/o''brien.yaml', '2024-06-01T10:00:00Z', '{"app":"it''s"}', `,
+		`INSERT INTO events VALUES ('dr1', 'my-app', '2024-06-01T10:01:00.000000Z', 'Warning', 'FailedMount', ` +
+			`'Pod/web', 'volume "data" can''t be mounted');`,
+	} {
+		if !strings.Contains(sql, expected) {
+			t.Errorf("expected %s in:\n%s", expected, sql)
+		}
+	}
+}
+
+func TestExportSQLNoClusters(t *testing.T) {
+	if _, err := ExportSQL(t.TempDir(), &bytes.Buffer{}); err == nil {
+		t.Error("export of empty directory succeeded")
+	}
+}
+
+type testResource struct {
+	entry IndexEntry
+	data  string
+}
+
+// writeCluster writes resources and their index in a cluster directory.
+func writeCluster(t *testing.T, clusterDir string, resources []testResource) {
+	var entries []IndexEntry
+	for _, r := range resources {
+		path := filepath.Join(clusterDir, filepath.FromSlash(r.entry.Path))
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(r.data), 0640); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, r.entry)
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(clusterDir, indexName), data, 0640); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -5,35 +5,355 @@ package gather
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 )
 
+const (
+	// Number of parallel copies when gathering a directory with multiple
+	// sub directories.
+	copyWorkers = 4
+
+	// Interval for logging progress of long copies.
+	copyProgressInterval = 10 * time.Second
+
+	// Number of attempts to copy remote files. When copying fails (e.g. pod
+	// evicted, network error), we retry copying only the files not received
+	// yet.
+	copyAttempts = 3
+
+	// Delay before retrying, multiplied by the attempt number.
+	copyRetryDelay = 2 * time.Second
+)
+
 type RemoteDirectory struct {
-	pod  *corev1.Pod
-	opts *Options
-	log  *zap.SugaredLogger
+	ctx       context.Context
+	pod       *corev1.Pod
+	container string
+	opts      *Options
+	log       *zap.SugaredLogger
+	limiter   *rate.Limiter
 }
 
 var tarFileChangedError *regexp.Regexp
 
 func NewRemoteDirectory(pod *corev1.Pod, opts *Options, log *zap.SugaredLogger) *RemoteDirectory {
-	return &RemoteDirectory{pod: pod, opts: opts, log: log}
+	return NewRemoteContainerDirectory(pod, pod.Spec.Containers[0].Name, opts, log)
+}
+
+// NewRemoteContainerDirectory returns a remote directory copying files from
+// the specified pod container. The container must have tar.
+func NewRemoteContainerDirectory(pod *corev1.Pod, container string, opts *Options, log *zap.SugaredLogger) *RemoteDirectory {
+	return &RemoteDirectory{
+		ctx:       context.Background(),
+		pod:       pod,
+		container: container,
+		opts:      opts,
+		log:       log,
+		limiter:   newBandwidthLimiter(opts.CopyBandwidth),
+	}
+}
+
+// WithContext returns a copy of d killing copy commands when ctx is
+// cancelled.
+func (d *RemoteDirectory) WithContext(ctx context.Context) *RemoteDirectory {
+	copy := *d
+	copy.ctx = ctx
+	return &copy
 }
 
+// Gather copies directory src to dst. If src has multiple sub directories,
+// every sub directory is copied in parallel, speeding up copying of big
+// directories.
 func (d *RemoteDirectory) Gather(src string, dst string) error {
-	// We run remote tar and pipe the output to local tar:
-	// kubectl exec ... -- tar cf - src | tar xf - -C dst
+	if err := checkAgentsAllowed(d.opts); err != nil {
+		return err
+	}
+
+	progress := d.startProgress(src)
+	defer progress.Stop()
+
+	strip := d.pathComponents(src)
+
+	chunks, err := d.splitDirectory(src)
+	if err != nil {
+		d.log.Debugf("Cannot split %q, copying as one chunk: %s", src, err)
+		chunks = nil
+	}
+
+	if len(chunks) < 2 {
+		// We run remote tar and pipe the output to local tar:
+		// kubectl exec ... -- tar cf - src | tar xf - -C dst
+		return d.copy("", []string{src}, dst, strip, progress)
+	}
+
+	d.log.Debugf("Copying %q in %d chunks", src, len(chunks))
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var errs []error
+
+	sem := make(chan struct{}, copyWorkers)
+
+	for _, chunk := range chunks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := d.copy("", chunk, dst, strip, progress); err != nil {
+				mutex.Lock()
+				errs = append(errs, err)
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// splitDirectory splits directory src to chunks that can be copied in
+// parallel: one chunk for every sub directory, and one chunk for the other
+// files.
+func (d *RemoteDirectory) splitDirectory(src string) ([][]string, error) {
+	dirs, err := d.remoteFind(src, "-mindepth", "1", "-maxdepth", "1", "-type", "d")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dirs) < 2 {
+		return nil, nil
+	}
+
+	files, err := d.remoteFind(src, "-mindepth", "1", "-maxdepth", "1", "!", "-type", "d")
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks [][]string
+	for _, dir := range dirs {
+		chunks = append(chunks, []string{dir})
+	}
+	if len(files) > 0 {
+		chunks = append(chunks, files)
+	}
+
+	return chunks, nil
+}
+
+// remoteFind runs remote find with args and returns the found paths.
+func (d *RemoteDirectory) remoteFind(args ...string) ([]string, error) {
+	var findError bytes.Buffer
+	remoteFind := d.remoteCommand(findCommand(args...)...)
+	remoteFind.Stderr = &findError
+
+	d.log.Debugf("Running remote find: %s", remoteFind)
+	out, err := remoteFind.Output()
+	if err != nil {
+		return nil, fmt.Errorf("remote find error: %s: %q", err, findError.String())
+	}
+
+	return splitFindOutput(out), nil
+}
+
+// findCommand returns a find command line with args, separating found paths
+// with NUL, so paths with spaces or newlines are not split. Since -print0 is
+// appended to args, an expression using -o must be in parentheses.
+func findCommand(args ...string) []string {
+	command := make([]string, 0, len(args)+2)
+	command = append(command, "find")
+	command = append(command, args...)
+	return append(command, "-print0")
+}
+
+// splitFindOutput returns the paths in find -print0 output.
+func splitFindOutput(out []byte) []string {
+	var paths []string
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// GatherRecent gathers files in directory src matching one of the shell
+// patterns, and modified in the last since duration.
+func (d *RemoteDirectory) GatherRecent(src string, dst string, patterns []string, since time.Duration) error {
+	if err := checkAgentsAllowed(d.opts); err != nil {
+		return err
+	}
+
+	// We find the files using remote find, and copy them using remote tar:
+	// kubectl exec ... -- tar cf - file1 file2 ... | tar xf - -C dst
+	findArgs := []string{src, "-type", "f", "("}
+	for i, pattern := range patterns {
+		if i > 0 {
+			findArgs = append(findArgs, "-o")
+		}
+		findArgs = append(findArgs, "-name", pattern)
+	}
+	minutes := int(math.Ceil(since.Minutes()))
+	findArgs = append(findArgs, ")", "-mmin", "-"+strconv.Itoa(minutes))
+
+	files, err := d.remoteFind(findArgs...)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		d.log.Debugf("No recent files in %q", src)
+		return nil
+	}
+
+	progress := d.startProgress(src)
+	defer progress.Stop()
+
+	return d.copy("", files, dst, d.pathComponents(src), progress)
+}
+
+// GatherFind gathers the files found by running remote find with findArgs
+// (e.g. "/host/etc/multipath.conf", "/host/etc/multipath"). The files are
+// stored in dst keeping their path relative to root. Missing files are
+// ignored.
+func (d *RemoteDirectory) GatherFind(root string, dst string, findArgs ...string) error {
+	if err := checkAgentsAllowed(d.opts); err != nil {
+		return err
+	}
+
+	var findError bytes.Buffer
+	remoteFind := d.remoteCommand(findCommand(findArgs...)...)
+	remoteFind.Stderr = &findError
+
+	// find fails if some of the paths are missing, but reports the found
+	// files.
+	d.log.Debugf("Running remote find: %s", remoteFind)
+	out, err := remoteFind.Output()
+
+	var files []string
+	for _, file := range splitFindOutput(out) {
+		if rel, ok := strings.CutPrefix(file, strings.TrimSuffix(root, "/")+"/"); ok {
+			files = append(files, rel)
+		}
+	}
+
+	if len(files) == 0 {
+		if err != nil {
+			d.log.Debugf("Remote find error: %s: %q", err, findError.String())
+		}
+		return nil
+	}
+
+	progress := d.startProgress(root)
+	defer progress.Stop()
+
+	return d.copy(root, files, dst, 0, progress)
+}
+
+// copy copies remote paths relative to root (or absolute paths if root is
+// empty) to dst, stripping strip path components. If copying fails, retry
+// copying only the files that were not received.
+func (d *RemoteDirectory) copy(root string, paths []string, dst string, strip int, progress *copyProgress) error {
+	received := map[string]struct{}{}
+
+	for attempt := 1; ; attempt++ {
+		err := d.copyOnce(root, paths, dst, strip, progress, received)
+		if err == nil || attempt == copyAttempts || d.ctx.Err() != nil {
+			return err
+		}
+
+		d.log.Warnf("Error copying %q (attempt %d/%d), retrying: %s",
+			progress.src, attempt, copyAttempts, err)
+		// Do not delay cancellation of the addon work.
+		if sleep(d.ctx, copyRetryDelay*time.Duration(attempt)) != nil {
+			return err
+		}
+
+		paths, err = d.remainingFiles(root, paths, received)
+		if err != nil {
+			return err
+		}
+
+		if len(paths) == 0 {
+			return nil
+		}
+
+		d.log.Debugf("Copying remaining %d files from %q", len(paths), progress.src)
+	}
+}
+
+// sleep waits for delay, returning the context error early if ctx is
+// cancelled.
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// remainingFiles returns the files in remote paths that were not received.
+func (d *RemoteDirectory) remainingFiles(root string, paths []string, received map[string]struct{}) ([]string, error) {
+	findArgs := make([]string, 0, len(paths)+2)
+	for _, p := range paths {
+		if root != "" {
+			p = root + "/" + p
+		}
+		findArgs = append(findArgs, p)
+	}
+	findArgs = append(findArgs, "-type", "f")
+
+	files, err := d.remoteFind(findArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	var remaining []string
+	for _, file := range files {
+		if root != "" {
+			file = strings.TrimPrefix(file, strings.TrimSuffix(root, "/")+"/")
+		}
+		if _, ok := received[archiveName(file)]; !ok {
+			remaining = append(remaining, file)
+		}
+	}
+
+	return remaining, nil
+}
+
+// copyOnce runs remote tar and pipes the output to local tar. Files extracted
+// completely by local tar are added to received.
+func (d *RemoteDirectory) copyOnce(root string, paths []string, dst string, strip int, progress *copyProgress, received map[string]struct{}) error {
+	tarArgs := []string{"tar", "cf", "-"}
+	if root != "" {
+		tarArgs = append(tarArgs, "-C", root)
+	}
+	remoteTar := d.remoteCommand(append(tarArgs, paths...)...)
 
 	var remoteError bytes.Buffer
-	remoteTar := d.remoteTarCommand(src)
 	remoteTar.Stderr = &remoteError
 
 	pipe, err := remoteTar.StdoutPipe()
@@ -42,9 +362,11 @@ func (d *RemoteDirectory) Gather(src string, dst string) error {
 	}
 
 	var localError bytes.Buffer
-	localTar := d.localTarCommand(dst, d.pathComponents(src))
+	var localOutput bytes.Buffer
+	localTar := d.localTarCommand(dst, strip)
 	localTar.Stderr = &localError
-	localTar.Stdin = pipe
+	localTar.Stdout = &localOutput
+	localTar.Stdin = newLimitedReader(&copyReader{r: pipe, progress: progress}, d.limiter, d.opts.logLimiter)
 
 	d.log.Debugf("Starting remote tar: %s", remoteTar)
 	err = remoteTar.Start()
@@ -63,8 +385,22 @@ func (d *RemoteDirectory) Gather(src string, dst string) error {
 	// fails, the local tar exit. However if the local tar fails, the remote tar
 	// blocks forever.
 	localErr := localTar.Wait()
+	if localErr != nil {
+		// Nobody reads the pipe now; unblock the remote tar.
+		pipe.Close()
+	}
 	remoteErr := remoteTar.Wait()
 
+	// Local tar lists every member before extracting it, so the last member
+	// may be incomplete if copying failed.
+	names := strings.Split(strings.TrimSuffix(localOutput.String(), "\n"), "\n")
+	if localErr != nil || remoteErr != nil {
+		names = names[:len(names)-1]
+	}
+	for _, name := range names {
+		received[archiveName(name)] = struct{}{}
+	}
+
 	if remoteErr != nil {
 		stderr := remoteError.String()
 		if !d.isFileChangedError(remoteErr, stderr) {
@@ -88,12 +424,12 @@ func (d *RemoteDirectory) isFileChangedError(err error, stderr string) bool {
 	return ok && exitErr.ExitCode() == 1 && tarFileChangedError.MatchString(stderr)
 }
 
-func (d *RemoteDirectory) remoteTarCommand(src string) *exec.Cmd {
+func (d *RemoteDirectory) remoteCommand(command ...string) *exec.Cmd {
 	args := []string{
 		"exec",
 		d.pod.Name,
 		"--namespace=" + d.pod.Namespace,
-		"--container=" + d.pod.Spec.Containers[0].Name,
+		"--container=" + d.container,
 	}
 
 	if d.opts.Kubeconfig != "" {
@@ -102,20 +438,21 @@ func (d *RemoteDirectory) remoteTarCommand(src string) *exec.Cmd {
 	if d.opts.Context != "" {
 		args = append(args, "--context="+d.opts.Context)
 	}
-	args = append(args, "--", "tar", "cf", "-", src)
+	args = append(args, "--")
+	args = append(args, command...)
 
-	return exec.Command("kubectl", args...)
+	return exec.CommandContext(d.ctx, "kubectl", args...)
 }
 
 func (d *RemoteDirectory) localTarCommand(dst string, strip int) *exec.Cmd {
 	args := []string{
-		"xf",
+		"xvf",
 		"-",
 		"--directory=" + dst,
 		"--strip-components=" + strconv.Itoa(strip),
 	}
 
-	return exec.Command("tar", args...)
+	return exec.CommandContext(d.ctx, "tar", args...)
 }
 
 func (d *RemoteDirectory) silentTerminate(cmd *exec.Cmd) {
@@ -128,12 +465,80 @@ func (d *RemoteDirectory) silentTerminate(cmd *exec.Cmd) {
 	_ = cmd.Wait()
 }
 
+// archiveName returns the name of path in a tar archive.
+func archiveName(path string) string {
+	return strings.TrimPrefix(path, "/")
+}
+
 func (d *RemoteDirectory) pathComponents(s string) int {
 	sep := string(os.PathSeparator)
 	trimmed := strings.Trim(s, sep)
 	return strings.Count(trimmed, sep) + 1
 }
 
+// copyProgress tracks the bytes copied from a remote directory, logging the
+// progress periodically.
+type copyProgress struct {
+	src   string
+	start time.Time
+	bytes atomic.Int64
+	done  chan struct{}
+	log   *zap.SugaredLogger
+}
+
+func (d *RemoteDirectory) startProgress(src string) *copyProgress {
+	p := &copyProgress{
+		src:   src,
+		start: time.Now(),
+		done:  make(chan struct{}),
+		log:   d.log,
+	}
+
+	go func() {
+		ticker := time.NewTicker(copyProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.log.Infof("Copying %q: %s", p.src, p)
+			case <-p.done:
+				return
+			}
+		}
+	}()
+
+	return p
+}
+
+func (p *copyProgress) Add(n int) {
+	p.bytes.Add(int64(n))
+}
+
+func (p *copyProgress) Stop() {
+	close(p.done)
+	p.log.Debugf("Copied %q: %s", p.src, p)
+}
+
+func (p *copyProgress) String() string {
+	elapsed := time.Since(p.start).Seconds()
+	mib := float64(p.bytes.Load()) / (1024 * 1024)
+	return fmt.Sprintf("%.2f MiB in %.3f seconds (%.2f MiB/s)", mib, elapsed, mib/elapsed)
+}
+
+// copyReader reads remote tar output, recording progress.
+type copyReader struct {
+	r        io.Reader
+	progress *copyProgress
+}
+
+func (r *copyReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.progress.Add(n)
+	}
+	return n, err
+}
+
 func init() {
 	tarFileChangedError = regexp.MustCompile(`(?im)^tar: .+ file changed as we read it$`)
 }
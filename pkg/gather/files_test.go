@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSleep(t *testing.T) {
+	if err := sleep(context.Background(), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSleepCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := sleep(ctx, time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("sleep returned %s after cancel", elapsed)
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	command := findCommand("/var/log", "-type", "f", "(", "-name", "*.log", "-o", "-name", "*.gz", ")")
+	expected := []string{"find", "/var/log", "-type", "f", "(", "-name", "*.log", "-o", "-name", "*.gz", ")", "-print0"}
+	if !slices.Equal(command, expected) {
+		t.Errorf("expected %q, got %q", expected, command)
+	}
+}
+
+func TestSplitFindOutput(t *testing.T) {
+	cases := []struct {
+		name     string
+		out      string
+		expected []string
+	}{
+		{"empty", "", nil},
+		{"one", "/data/a\x00", []string{"/data/a"}},
+		{"spaces", "/data/my file\x00/data/b\x00", []string{"/data/my file", "/data/b"}},
+		{"newline", "/data/line\nbreak\x00", []string{"/data/line\nbreak"}},
+		{"no trailing nul", "/data/a\x00/data/b", []string{"/data/a", "/data/b"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if paths := splitFindOutput([]byte(c.out)); !slices.Equal(paths, c.expected) {
+				t.Errorf("expected %q, got %q", c.expected, paths)
+			}
+		})
+	}
+}
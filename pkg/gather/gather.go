@@ -4,25 +4,28 @@
 package gather
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/go-logr/logr"
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/cli-runtime/pkg/printers"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
 )
 
@@ -41,7 +44,181 @@ type Options struct {
 	Context    string
 	Namespaces []string
 	Addons     []string
-	Log        *zap.SugaredLogger
+
+	// MaxInFlightBytes limits the approximate memory used by objects held by
+	// workers. When the limit is exceeded, workers listing resources block
+	// until other workers are done with their objects. If zero, memory usage
+	// is not limited.
+	MaxInFlightBytes int64
+
+	// Protobuf enables listing built-in resources using protobuf, reducing
+	// API server CPU usage and transfer size. Fields unknown to this version
+	// of the Kubernetes client libraries are dropped when converting the
+	// objects to YAML. Other resources are listed using JSON.
+	Protobuf bool
+
+	// DiscoveryCacheDir is a directory for caching discovery results between
+	// runs. If empty, discovery results are cached only in memory.
+	DiscoveryCacheDir string
+
+	// DiscoveryCacheTTL is the time discovery results cached on disk are
+	// valid.
+	DiscoveryCacheTTL time.Duration
+
+	// SkipEmpty checks if a resource type has any items using a cheap metadata
+	// only request before listing it. On clusters with many resource types and
+	// namespaces this avoids many useless list requests.
+	SkipEmpty bool
+
+	// InventoryOnly lists resources that should not be gathered. The names of
+	// these resources are recorded in inventory.csv. Resources are specified
+	// by full name (e.g. "events.k8s.io/events") or resource name (e.g.
+	// "secrets").
+	InventoryOnly []string
+
+	// MaxPerResource limits the number of items gathered for every resource
+	// type in every namespace. When a namespace has more items, the newest
+	// items by creation time are gathered, and the truncation is recorded in
+	// metadata.json. All items are still listed. If zero, the number of items
+	// is not limited.
+	MaxPerResource int
+
+	// MaxObjectSize limits the size in bytes of stored objects. Larger
+	// objects (e.g. config maps with embedded binaries) are replaced with a
+	// marker file containing the object metadata, and recorded in the error
+	// report. If zero, the size is not limited.
+	MaxObjectSize int64
+
+	// BinaryFields controls handling of ConfigMap binaryData and Secret data
+	// values larger than BinaryFieldsThreshold bytes: BinaryFieldsKeep (the
+	// default), BinaryFieldsOmit, or BinaryFieldsExternal. Removed values are
+	// listed in an annotation.
+	BinaryFields          string
+	BinaryFieldsThreshold int64
+
+	// ClusterResources selects the cluster scoped resources to gather when
+	// gathering all namespaces. Resources are matched like Resources, or by
+	// API group (e.g. "rbac.authorization.k8s.io"). Names prefixed with "-"
+	// are excluded. If no name is included, all cluster scoped resources not
+	// excluded are gathered.
+	ClusterResources []string
+
+	// AllVersions gathers every served version of each resource instead of
+	// the preferred version. Each version is stored in a separate directory.
+	// Useful for debugging conversion webhooks.
+	AllVersions bool
+
+	// ShowAPIWarnings records API warnings (e.g. deprecated APIs) in
+	// deprecations.txt. If false, warnings are ignored.
+	ShowAPIWarnings bool
+
+	// Resources limits gathering to the specified resources. Resources are
+	// matched by full name (e.g. "apps/deployments"), resource name, singular
+	// name, short name, or kind (case insensitive). If empty, all resources
+	// are gathered.
+	Resources []string
+
+	// Name limits gathering to resources with this name.
+	Name string
+
+	// RookLogsSince limits the rook addon to gather only OSD and MON logs
+	// modified in the specified duration. If zero, all ceph logs are gathered.
+	RookLogsSince time.Duration
+
+	// RawEndpoints lists API server paths (e.g. "/api/v1/nodes/{node}/proxy/stats/summary")
+	// to gather as is. The placeholder "{node}" is expanded to every node, and
+	// "{namespace}" to every gathered namespace. Responses are stored in the
+	// "raw" directory of the cluster, or of the namespace if the endpoint
+	// uses the "{namespace}" placeholder.
+	RawEndpoints []string
+
+	// ByKind creates a "by-kind" directory with symlinks to all namespaced
+	// resources grouped by kind (e.g. "by-kind/apps/deployments/{namespace}/{name}.yaml").
+	ByKind bool
+
+	// Since and Until limit events and container logs to a time window. Events
+	// observed and log lines logged outside of the window are not gathered.
+	// If zero, the window is not limited.
+	Since time.Time
+	Until time.Time
+
+	// Deterministic makes gathering an idle cluster twice produce identical
+	// files, for diffing and caching gathers. Times and durations are not
+	// recorded, and files listing multiple items are sorted.
+	Deterministic bool
+
+	// ReadOnly rejects API requests modifying the cluster, and disables
+	// addons creating agent pods or running commands in pods, unless
+	// AllowAgents is set.
+	ReadOnly bool
+
+	// AllowAgents allows creating agent pods and running commands in pods
+	// in read only mode.
+	AllowAgents bool
+
+	// RequestLog records every API request made by the gatherer (time,
+	// verb, path, status, latency) in requests.log in the cluster directory.
+	RequestLog bool
+
+	// Append merges the gather into an existing cluster directory. Resources
+	// in the existing index are not gathered again, and are inspected only by
+	// addons not used by the previous gathers. The reports (e.g. errors.yaml,
+	// inventory.csv, metadata.json) include the previous gathers, so data
+	// missing in a previous partial gather is still reported.
+	Append bool
+
+	// AddonTimeout limits the time an addon may spend inspecting a resource
+	// or running queued work. When the timeout expires, the failure is
+	// recorded in the error report and the worker continues with other work.
+	// If zero, addons are not limited.
+	AddonTimeout time.Duration
+
+	// Files lists rules for copying files from containers of selected pods
+	// by the files addon (e.g. application configuration and logs). Copying
+	// requires agents.
+	Files []FilesRule
+
+	// CopyBandwidth limits the bandwidth in bytes per second used by every
+	// copy of a remote directory (e.g. ceph logs). If zero, the bandwidth is
+	// not limited.
+	CopyBandwidth int64
+
+	// PartialMarkers writes a PARTIAL marker in every namespace directory
+	// with data that could not be gathered. Partially gathered namespaces are
+	// always recorded in metadata.json.
+	PartialMarkers bool
+
+	// RetryFailed retries failed list, get and log operations once when the
+	// gather completes, serially and with longer timeouts. Errors that
+	// remain are marked as retried in the error report.
+	RetryFailed bool
+
+	// LogsPerNode limits the number of concurrent container log streams from
+	// every node, avoiding overloading the node kubelet. If zero, streams are
+	// not limited.
+	LogsPerNode int
+
+	// LogBandwidth limits the total bandwidth in bytes per second used for
+	// gathering container logs and copying remote directories, shared by all
+	// workers, so gathering over a slow link does not saturate it. If zero,
+	// the bandwidth is not limited.
+	LogBandwidth int64
+
+	// Limits LogBandwidth, shared by all users of the options.
+	logLimiter *rate.Limiter
+
+	// DebugAPIDump stores the raw JSON response for the first page of
+	// resource types that failed to decode or dump in the "api-dump"
+	// directory of the cluster, for reproducing parsing bugs.
+	DebugAPIDump bool
+
+	// Log is the logger used by the gather. Programs using a *zap.Logger can
+	// use its Sugar() method. If nil, Logger is used.
+	Log *zap.SugaredLogger
+
+	// Logger is a logr logger used if Log is nil, for programs using logr
+	// (e.g. controller-runtime). If neither is set, messages are discarded.
+	Logger logr.Logger
 }
 
 type Addon interface {
@@ -52,19 +229,88 @@ type Addon interface {
 type Gatherer struct {
 	config     *rest.Config
 	httpClient *http.Client
-	client     *dynamic.DynamicClient
-	addons     map[string]Addon
+	client     dynamic.Interface
+	metadata   metadata.Interface
+	discovery  discovery.DiscoveryInterface
+	stream     *rest.RESTClient
+	lister     resourceLister
+	dumper     resourceDumper
+	limiter    *byteLimiter
+	addons     map[string][]*enabledAddon
 	output     OutputDirectory
 	opts       *Options
 	wq         *WorkQueue
 	log        *zap.SugaredLogger
 	mutex      sync.Mutex
 	resources  map[string]struct{}
+	timing     *Timing
+	inventory  *inventory
+	containers *containersReport
+	errors     errorReport
+	apiDumps   apiDumps
+	retries    retryList
+	index      index
+	warnings   *warningRecorder
+	requests   *requestLog
+
+	// Set when gathering starts and when interrupted, protected by mutex.
+	startTime   time.Time
+	interrupted bool
+
+	// Bytes written to resource files.
+	written atomic.Int64
+
+	// Resources gathered by previous gathers when appending, protected by
+	// mutex. Maps resource path to true if seen by this gather.
+	previous map[string]bool
+
+	// Addons used by previous gathers when appending.
+	previousAddons []string
+
+	// Errors recorded by previous gathers when appending.
+	previousErrors []GatherError
+
+	// Time spent by previous gathers when appending.
+	previousTiming *Timing
+
+	// Time spent gathering each resource, protected by mutex.
+	resourceTiming Durations
+
+	// Addon work cancelled after the addon timeout, protected by mutex.
+	abandoned []abandonedAddon
+
+	// Serializes writing metadata.
+	metadataMutex sync.Mutex
+
+	// Group versions that failed discovery.
+	failedGroups []FailedGroup
+
+	// Resources filtered out by design, protected by mutex.
+	skippedResources []SkippedResource
+
+	// Resources with more items than MaxPerResource, protected by mutex.
+	truncatedResources []TruncatedResource
+
+	// Server groups and resources in all versions, discovered when needed.
+	groupsOnce sync.Once
+	groups     *discoveryGroups
+	groupsErr  error
+
+	// All namespaces in the cluster, listed when needed.
+	namespacesOnce sync.Once
+	namespaces     []string
+	namespacesErr  error
 }
 
 type resourceInfo struct {
 	schema.GroupVersionResource
+	Kind       string
 	Namespaced bool
+
+	// Versioned is set when gathering all versions. The resource is stored in
+	// a version directory, and addons inspect only the preferred version.
+	Versioned bool
+	Preferred bool
 }
 
 // Name returns the full name of the reosurce, used as the directory name in the
@@ -78,6 +324,21 @@ func (r *resourceInfo) Name() string {
 	return r.Group + "/" + r.Resource
 }
 
+// Directory returns the directory name for storing the resource in the
+// cluster or namespace directory. When gathering all versions, each version
+// is stored in a version directory.
+func (r *resourceInfo) Directory() string {
+	if r.Versioned {
+		return r.Name() + "/" + r.Version
+	}
+	return r.Name()
+}
+
+// Inspectable returns true if addons should inspect this resource.
+func (r *resourceInfo) Inspectable() bool {
+	return !r.Versioned || r.Preferred
+}
+
 func New(config *rest.Config, directory string, opts Options) (*Gatherer, error) {
 	// We want list all api resources (~80) quickly, gather logs from all pods,
 	// and run various commands on the nodes. This change makes gathering 60
@@ -85,10 +346,49 @@ func New(config *rest.Config, directory string, opts Options) (*Gatherer, error)
 	config.QPS = 50
 	config.Burst = 100
 
-	// Disable the useless deprecated warnings.
-	// TODO: Make this configurable to allow arnings during development.
-	config.WarningHandler = rest.NoWarnings{}
+	// Warnings are not useful when gathering data, but deprecation warnings
+	// are useful for upgrade planning, so we can record them.
+	var warnings *warningRecorder
+	if opts.ShowAPIWarnings {
+		warnings = newWarningRecorder()
+		config.WarningHandler = warnings
+	} else {
+		config.WarningHandler = rest.NoWarnings{}
+	}
+
+	// Avoid wrapping the caller config transport.
+	config = rest.CopyConfig(config)
+
+	if opts.ReadOnly {
+		config.Wrap(newReadOnlyGuard(opts.AllowAgents))
+	}
+
+	// Wraps the read only guard, so rejected requests are logged.
+	var requests *requestLog
+	if opts.RequestLog {
+		var err error
+		requests, err = newRequestLog(NewOutputDirectory(directory), opts.Append)
+		if err != nil {
+			return nil, err
+		}
+		config.Wrap(requests.Wrap)
+	}
+
+	g, err := newClientsGatherer(config, directory, opts)
+	if err != nil {
+		if requests != nil {
+			requests.Close()
+		}
+		return nil, err
+	}
+
+	g.warnings = warnings
+	g.requests = requests
+	return g, nil
+}
 
+// newClientsGatherer creates a gatherer with clients for config.
+func newClientsGatherer(config *rest.Config, directory string, opts Options) (*Gatherer, error) {
 	httpClient, err := rest.HTTPClientFor(config)
 	if err != nil {
 		return nil, err
@@ -99,21 +399,100 @@ func New(config *rest.Config, directory string, opts Options) (*Gatherer, error)
 		return nil, err
 	}
 
+	metadataClient, err := metadata.NewForConfigAndClient(config, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfigAndClient(config, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := newStreamClient(config, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	var protobuf *rest.RESTClient
+	if opts.Protobuf {
+		protobuf, err = newProtobufClient(config, httpClient)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	clients := &gatherClients{
+		config:     config,
+		httpClient: httpClient,
+		dynamic:    client,
+		metadata:   metadataClient,
+		discovery:  discoveryClient,
+		stream:     stream,
+		protobuf:   protobuf,
+	}
+
+	return newGatherer(clients, directory, opts)
+}
+
+// newGatherer creates a gatherer using clients to access the cluster.
+func newGatherer(clients *gatherClients, directory string, opts Options) (*Gatherer, error) {
+	opts.Log = opts.logger()
+	opts.logLimiter = newBandwidthLimiter(opts.LogBandwidth)
+
 	// TODO: make configurable
 	wq := NewWorkQueue(6, 500)
 
 	g := &Gatherer{
-		config:     config,
-		httpClient: httpClient,
-		client:     client,
+		config:     clients.config,
+		httpClient: clients.httpClient,
+		client:     clients.dynamic,
+		metadata:   clients.metadata,
+		discovery:  clients.discovery,
+		stream:     clients.stream,
+		lister:     clients.lister,
+		limiter:    newByteLimiter(opts.MaxInFlightBytes),
 		output:     OutputDirectory{base: directory},
 		opts:       &opts,
 		wq:         wq,
 		log:        opts.Log,
 		resources:  make(map[string]struct{}),
+		timing:     newTiming(),
+
+		resourceTiming: Durations{},
 	}
 
-	addons, err := createAddons(&gatherBackend{g})
+	if g.lister == nil {
+		g.lister = &apiLister{
+			stream:   clients.stream,
+			protobuf: clients.protobuf,
+			limiter:  g.limiter,
+			log:      g.log,
+		}
+	}
+
+	g.dumper = &resourceWriter{
+		output:        &g.output,
+		index:         &g.index,
+		written:       &g.written,
+		maxObjectSize: g.opts.MaxObjectSize,
+
+		binaryFields:          g.opts.BinaryFields,
+		binaryFieldsThreshold: g.opts.BinaryFieldsThreshold,
+	}
+
+	g.inventory = &inventory{output: &g.output, sorted: g.opts.Deterministic}
+	g.containers = newContainersReport(&g.output)
+
+	if g.opts.Append {
+		if err := g.loadPrevious(); err != nil {
+			return nil, err
+		}
+	}
+
+	addons, err := createAddons(g.opts, func(name string, info addonInfo) AddonBackend {
+		return newGatherBackend(g, name, info)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -123,18 +502,107 @@ func New(config *rest.Config, directory string, opts Options) (*Gatherer, error)
 }
 
 func (g *Gatherer) Gather() error {
+	start := time.Now()
+
+	g.mutex.Lock()
+	g.startTime = start
+	g.mutex.Unlock()
+
 	g.wq.Start()
 	g.wq.Queue(func() error {
 		return g.gatherAPIResources()
 	})
-	return g.wq.Wait()
+	err := g.wq.Wait()
+	if err == nil {
+		err = g.retryFailed()
+	}
+
+	g.waitForAbandonedAddons(abandonedAddonsTimeout)
+
+	if err := g.inventory.Close(); err != nil {
+		g.log.Warnf("Cannot write %q: %s", inventoryName, err)
+	}
+
+	if err := g.containers.Write(g.opts.Append); err != nil {
+		g.log.Warnf("Cannot write containers report: %s", err)
+	}
+
+	g.timing.AddRun(start, time.Now())
+	if !g.opts.Deterministic {
+		g.writeTiming()
+	}
+	g.writeIndex()
+	if g.opts.ByKind {
+		g.writeByKind()
+	}
+	g.writeErrors()
+	if g.opts.PartialMarkers {
+		g.writePartialMarkers()
+	}
+	g.writeWarnings()
+	g.writeMetadata(true)
+
+	if g.requests != nil {
+		if err := g.requests.Close(); err != nil {
+			g.log.Warnf("Cannot write %q: %s", requestLogName, err)
+		}
+	}
+
+	return err
+}
+
+// Interrupt stops queuing new work and drops queued work. Work already running
+// will complete and Gather will return. The gather metadata is updated
+// immediately to mark the gather as interrupted, in case the program is
+// terminated before Gather returns.
+func (g *Gatherer) Interrupt() {
+	g.mutex.Lock()
+	g.interrupted = true
+	g.mutex.Unlock()
+
+	g.wq.Stop()
+	g.writeMetadata(false)
 }
 
+// Interrupted returns true if the gather was interrupted.
+func (g *Gatherer) Interrupted() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.interrupted
+}
+
+// Count returns the number of resources gathered. When appending, resources
+// gathered by previous gathers are not counted.
 func (g *Gatherer) Count() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
 	return len(g.resources)
 }
 
+func (g *Gatherer) writeTiming() {
+	g.log.Debugf("Time spent per namespace in seconds:\n%s", g.timing.Summary())
+
+	timing := g.timing
+	if g.previousTiming != nil {
+		timing = g.previousTiming
+		timing.Merge(g.timing)
+	}
+
+	dst, err := g.output.CreateFile(timingName)
+	if err != nil {
+		g.log.Warnf("Cannot create %q: %s", timingName, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if err := timing.WriteJSON(dst); err != nil {
+		g.log.Warnf("Cannot write %q: %s", timingName, err)
+	}
+}
+
 func (g *Gatherer) gatherAPIResources() error {
+	start := time.Now()
 	var namespaces []string
 
 	if len(g.opts.Namespaces) > 0 {
@@ -161,13 +629,63 @@ func (g *Gatherer) gatherAPIResources() error {
 	resources, err := g.listAPIResources()
 	if err != nil {
 		// We cannot gather anything.
-		return fmt.Errorf("cannot list api resources: %s", err)
+		return fmt.Errorf("cannot list api resources: %w", err)
+	}
+
+	if len(g.opts.Resources) > 0 && len(resources) == 0 {
+		g.log.Warnf("No resource matching %q", g.opts.Resources)
+	}
+
+	g.timing.Prepare = time.Since(start).Seconds()
+
+	g.wq.Queue(func() error {
+		g.gatherAPIServicesReport()
+		return nil
+	})
+
+	g.wq.Queue(func() error {
+		g.gatherWebhooksReport()
+		return nil
+	})
+
+	g.wq.Queue(func() error {
+		g.gatherVersionInfo()
+		return nil
+	})
+
+	g.wq.Queue(func() error {
+		g.gatherDiscovery()
+		return nil
+	})
+
+	// Resource usage and scheduling pressure are not useful when gathering
+	// specific resources.
+	if len(g.opts.Resources) == 0 {
+		g.queueTop(namespaces)
+		g.wq.Queue(func() error {
+			g.gatherSchedulingReport(namespaces)
+			return nil
+		})
+	}
+
+	if len(g.opts.RawEndpoints) > 0 {
+		g.wq.Queue(func() error {
+			g.gatherRawEndpoints(namespaces)
+			return nil
+		})
 	}
 
 	for i := range resources {
 		r := &resources[i]
 		for j := range namespaces {
 			namespace := namespaces[j]
+			if g.inventoryOnly(r) {
+				g.wq.Queue(func() error {
+					g.gatherInventory(r, namespace)
+					return nil
+				})
+				continue
+			}
 			g.wq.Queue(func() error {
 				g.gatherResources(r, namespace)
 				return nil
@@ -181,12 +699,11 @@ func (g *Gatherer) gatherAPIResources() error {
 func (g *Gatherer) listAPIResources() ([]resourceInfo, error) {
 	start := time.Now()
 
-	client, err := discovery.NewDiscoveryClientForConfigAndClient(g.config, g.httpClient)
-	if err != nil {
-		return nil, err
+	if g.opts.AllVersions {
+		return g.listAllVersionsAPIResources(start)
 	}
 
-	items, err := client.ServerPreferredResources()
+	items, err := g.serverPreferredResources()
 	if err != nil {
 		return nil, err
 	}
@@ -204,12 +721,14 @@ func (g *Gatherer) listAPIResources() ([]resourceInfo, error) {
 
 		for i := range list.APIResources {
 			res := &list.APIResources[i]
-			if !g.shouldGather(gv, res) {
+			if reason := g.skipReason(gv, res); reason != "" {
+				g.addSkippedResource(gv, res, reason)
 				continue
 			}
 
 			resources = append(resources, resourceInfo{
 				GroupVersionResource: gv.WithResource(res.Name),
+				Kind:                 res.Kind,
 				Namespaced:           res.Namespaced,
 			})
 		}
@@ -220,18 +739,90 @@ func (g *Gatherer) listAPIResources() ([]resourceInfo, error) {
 	return resources, nil
 }
 
+// listAllVersionsAPIResources returns all served versions of all resources.
+func (g *Gatherer) listAllVersionsAPIResources(start time.Time) ([]resourceInfo, error) {
+	groups, items, err := g.serverGroupsAndResources()
+	if err != nil {
+		if err := g.recordDiscoveryError(err); err != nil {
+			return nil, err
+		}
+	}
+
+	preferred := map[string]string{}
+	for _, group := range groups {
+		preferred[group.Name] = group.PreferredVersion.Version
+	}
+
+	resources := []resourceInfo{}
+
+	for _, list := range items {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+
+		for i := range list.APIResources {
+			res := &list.APIResources[i]
+
+			// Skip subresources (e.g. "pods/status").
+			if strings.Contains(res.Name, "/") {
+				continue
+			}
+
+			if reason := g.skipReason(gv, res); reason != "" {
+				g.addSkippedResource(gv, res, reason)
+				continue
+			}
+
+			resources = append(resources, resourceInfo{
+				GroupVersionResource: gv.WithResource(res.Name),
+				Kind:                 res.Kind,
+				Namespaced:           res.Namespaced,
+				Versioned:            true,
+				Preferred:            preferred[gv.Group] == gv.Version,
+			})
+		}
+	}
+
+	g.log.Debugf("Listed %d api resources in all versions in %.3f seconds",
+		len(resources), time.Since(start).Seconds())
+
+	return resources, nil
+}
+
 // gatherNamespaces gathers the requested namespaces and return a list of
 // available namespaces on this cluster.
 func (g *Gatherer) gatherNamespaces() ([]string, error) {
-	gvr := corev1.SchemeGroupVersion.WithResource("namespaces")
+	items, err := g.getNamespaces()
+	if err != nil {
+		return nil, err
+	}
+
 	var found []string
 
+	for _, ns := range items {
+		r := resourceInfo{GroupVersionResource: namespacesResource, Versioned: g.opts.AllVersions, Preferred: true}
+		key := g.keyFromResource(&r, ns)
+		if g.addResource(key) {
+			g.dumpResource(&r, ns, key)
+		}
+
+		found = append(found, ns.GetName())
+	}
+
+	return found, nil
+}
+
+// getNamespaces returns the requested namespaces existing on this cluster.
+func (g *Gatherer) getNamespaces() ([]*unstructured.Unstructured, error) {
+	var found []*unstructured.Unstructured
+
 	for _, namespace := range g.opts.Namespaces {
-		ns, err := g.client.Resource(gvr).
+		ns, err := g.client.Resource(namespacesResource).
 			Get(context.TODO(), namespace, metav1.GetOptions{})
 		if err != nil {
 			if !errors.IsNotFound(err) {
-				return nil, fmt.Errorf("cannot get namespace %q: %s", namespace, err)
+				return nil, fmt.Errorf("cannot get namespace %q: %w", namespace, err)
 			}
 
 			// Expected condition when gathering multiple clusters.
@@ -239,67 +830,211 @@ func (g *Gatherer) gatherNamespaces() ([]string, error) {
 			continue
 		}
 
-		r := resourceInfo{GroupVersionResource: gvr}
-		key := g.keyFromResource(&r, ns)
-		if g.addResource(key) {
-			if err := g.dumpResource(&r, ns); err != nil {
-				g.log.Warnf("Cannot dump %q: %s", key, err)
-			}
-		}
-
-		found = append(found, namespace)
+		found = append(found, ns)
 	}
 
 	return found, nil
 }
 
-func (g *Gatherer) shouldGather(gv schema.GroupVersion, res *metav1.APIResource) bool {
+// skipReason returns the reason for not gathering resource res, or an empty
+// string if the resource should be gathered.
+func (g *Gatherer) skipReason(gv schema.GroupVersion, res *metav1.APIResource) string {
 	// We cannot gather resources we cannot list.
 	if !slices.Contains(res.Verbs, "list") {
-		return false
+		return SkipNotListable
 	}
 
 	if len(g.opts.Namespaces) != 0 {
 		// If we gather specific namespace, we must use only namespaced resources.
 		if !res.Namespaced {
-			return false
+			return SkipClusterScoped
 		}
 
 		// olm bug? - returned for *every namespace* when listing by namespace.
 		// https://github.com/operator-framework/operator-lifecycle-manager/issues/2932
 		if res.Name == "packagemanifests" && gv.Group == "packages.operators.coreos.com" {
-			return false
+			return SkipPackageManifests
 		}
 	}
 
+	if !res.Namespaced && !selectClusterResource(g.opts.ClusterResources, gv, res) {
+		return SkipClusterResourceExcluded
+	}
+
 	// Skip "events", replaced by "events.events.k8s.io".  Otherwise we
 	// get all events twice, as "events" and as "events.events.k8s.io",
 	// both resources contain the same content.
 	if res.Name == "events" && gv.Group == "" {
-		return false
+		return SkipDuplicateEvents
 	}
 
 	// Avoid warning: "v1 ComponentStatus is deprecated in v1.19+"
 	if res.Name == "componentstatuses" && gv.Group == "" {
+		return SkipDeprecated
+	}
+
+	if len(g.opts.Resources) > 0 && !matchResource(g.opts.Resources, gv, res) {
+		return SkipNotSelected
+	}
+
+	return ""
+}
+
+// selectClusterResource returns true if cluster scoped resource res is selected
+// by names. Names prefixed with "-" exclude resources, other names include
+// resources.
+func selectClusterResource(names []string, gv schema.GroupVersion, res *metav1.APIResource) bool {
+	var include []string
+	var exclude []string
+
+	for _, name := range names {
+		if excluded, found := strings.CutPrefix(name, "-"); found {
+			exclude = append(exclude, excluded)
+		} else {
+			include = append(include, name)
+		}
+	}
+
+	if matchResourceOrGroup(exclude, gv, res) {
 		return false
 	}
 
-	return true
+	return len(include) == 0 || matchResourceOrGroup(include, gv, res)
+}
+
+// matchResourceOrGroup returns true if resource res matches one of names, or
+// if one of names is the resource API group. Resource names do not contain
+// dots, so a name with dots and without "/" is a group.
+func matchResourceOrGroup(names []string, gv schema.GroupVersion, res *metav1.APIResource) bool {
+	for _, name := range names {
+		if strings.Contains(name, ".") && !strings.Contains(name, "/") && strings.ToLower(name) == gv.Group {
+			return true
+		}
+	}
+	return matchResource(names, gv, res)
+}
+
+// matchResource returns true if resource res matches one of names.
+func matchResource(names []string, gv schema.GroupVersion, res *metav1.APIResource) bool {
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if gv.Group != "" && name == gv.Group+"/"+res.Name {
+			return true
+		}
+		if name == res.Name || name == res.SingularName || name == strings.ToLower(res.Kind) {
+			return true
+		}
+		if slices.Contains(res.ShortNames, name) {
+			return true
+		}
+	}
+	return false
 }
 
 func (g *Gatherer) gatherResources(r *resourceInfo, namespace string) {
 	start := time.Now()
 
+	if g.opts.SkipEmpty && g.isEmpty(r, namespace) {
+		elapsed := time.Since(start)
+		g.timing.Add(namespace, resourcesCategory, elapsed)
+		g.addResourceTime(r, elapsed)
+		return
+	}
+
 	opts := metav1.ListOptions{Limit: listResourcesLimit}
+	if g.opts.Name != "" {
+		opts.FieldSelector = fields.OneTermEqualSelector(metav1.ObjectNameField, g.opts.Name).String()
+	}
+
 	count := 0
+	var inspectTime time.Duration
+
+	var addons []*enabledAddon
+	if r.Inspectable() {
+		addons = g.addons[r.Name()]
+	}
+
+	gatherItem := func(item *unstructured.Unstructured) {
+		if !g.inTimeWindow(r, item) {
+			return
+		}
+
+		key := g.keyFromResource(r, item)
+
+		inspect := addons
+
+		if gathered, first := g.claimPrevious(itemPath(r, item)); gathered {
+			if !first {
+				return
+			}
+			// Inspect only by addons not used by the previous gathers.
+			inspect = slices.DeleteFunc(slices.Clone(addons), func(addon *enabledAddon) bool {
+				return slices.Contains(g.previousAddons, addon.Name)
+			})
+		} else {
+			if !g.addResource(key) {
+				return
+			}
+
+			count += 1
+
+			if g.dumpResource(r, item, key) && isPods(r) {
+				if err := g.containers.Add(item); err != nil {
+					g.log.Warnf("Cannot add %q to containers report: %s", key, err)
+				}
+			}
+		}
+
+		for _, addon := range inspect {
+			inspectStart := time.Now()
+			err := g.runAddon(addon.Name, item.GetNamespace(), func(context.Context) error {
+				return addon.Inspect(item)
+			})
+			if err != nil {
+				g.log.Warnf("Cannot inspect %q: %s", key, err)
+			}
+			elapsed := time.Since(inspectStart)
+			g.timing.Add(item.GetNamespace(), addon.Name, elapsed)
+			inspectTime += elapsed
+		}
+	}
+
+	// When limiting the number of items, items are collected while listing,
+	// and the newest items are gathered when listing completes. The limit
+	// applies to every namespace, also when listing all namespaces in one
+	// list or in per namespace lists.
+	collectItem := gatherItem
+	var newest *newestItems
+	if g.opts.MaxPerResource > 0 {
+		newest = newNewestItems(g.opts.MaxPerResource)
+		collectItem = func(item *unstructured.Unstructured) {
+			if g.inTimeWindow(r, item) {
+				newest.Add(item)
+			}
+		}
+	}
+
+	split := false
 
 	for {
-		list, err := g.listResources(r, namespace, opts)
+		meta, err := g.lister.List(r, namespace, opts, collectItem)
 		if err != nil {
+			err = wrapAPIError(err)
+
 			// Fall back to full list only if this was an attempt to get the next
 			// page and the resource expired.
 			if opts.Continue == "" || !errors.IsResourceExpired(err) {
 				g.log.Warnf("Cannot list %q: %s", r.Name(), err)
+				if isConversionError(err) {
+					g.addError(r, namespace, "", ConversionFailed, err)
+					g.gatherItemsByName(r, namespace, collectItem)
+				} else {
+					g.addError(r, namespace, "", ListFailed, err)
+					if isDecodeError(err) {
+						g.dumpAPIResponse(r, namespace)
+					}
+				}
+				g.retryResources(r, namespace, err)
 				break
 			}
 
@@ -308,76 +1043,187 @@ func (g *Gatherer) gatherResources(r *resourceInfo, namespace string) {
 			opts.Limit = 0
 			opts.Continue = ""
 
-			list, err = g.listResources(r, namespace, opts)
+			// The full list includes the items collected from the previous
+			// pages.
+			if newest != nil {
+				newest = newNewestItems(g.opts.MaxPerResource)
+			}
+
+			meta, err = g.lister.List(r, namespace, opts, collectItem)
 			if err != nil {
+				err = wrapAPIError(err)
 				g.log.Warnf("Cannot list %q: %s", r.Name(), err)
+				g.addError(r, namespace, "", ListFailed, err)
+				g.retryResources(r, namespace, err)
 				break
 			}
 		}
 
-		addon := g.addons[r.Name()]
-
-		for i := range list.Items {
-			item := &list.Items[i]
-			key := g.keyFromResource(r, item)
-
-			if !g.addResource(key) {
-				continue
-			}
-
-			count += 1
-
-			if err := g.dumpResource(r, item); err != nil {
-				g.log.Warnf("Cannot dump %q: %s", key, err)
-			}
-
-			if addon != nil {
-				if err := addon.Inspect(item); err != nil {
-					g.log.Warnf("Cannot inspect %q: %s", key, err)
-				}
-			}
+		opts.Continue = meta.Continue
+		if opts.Continue == "" {
+			break
 		}
 
-		opts.Continue = list.GetContinue()
-		if opts.Continue == "" {
+		if namespace == metav1.NamespaceAll && r.Namespaced && g.queueNamespacedLists(r) {
+			split = true
 			break
 		}
 	}
 
+	// Items collected from the first page are gathered by the namespace lists.
+	if newest != nil && !split {
+		for _, item := range newest.Items() {
+			gatherItem(item)
+		}
+		g.addTruncatedResources(newest.Truncated(r.Name()))
+	}
+
+	elapsed := time.Since(start) - inspectTime
+	g.timing.Add(namespace, resourcesCategory, elapsed)
+	g.addResourceTime(r, elapsed)
 	g.log.Debugf("Gathered %d %q in %.3f seconds", count, r.Name(), time.Since(start).Seconds())
 }
 
-func (g *Gatherer) listResources(r *resourceInfo, namespace string, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
-	start := time.Now()
+// retryResources retries gathering resource r in namespace when the gather
+// completes. Items already gathered are skipped.
+func (g *Gatherer) retryResources(r *resourceInfo, namespace string, err error) {
+	g.retryLater(r.Name(), namespace, "", err, func() error {
+		g.gatherResources(r, namespace)
+		return nil
+	})
+}
 
-	ctx := context.TODO()
-	var list *unstructured.UnstructuredList
+// isEmpty returns true if resource r has no items in namespace, using a
+// metadata only request for single item. Returns false if the check failed,
+// so we fall back to normal listing.
+func (g *Gatherer) isEmpty(r *resourceInfo, namespace string) bool {
+	opts := metav1.ListOptions{Limit: 1}
+
+	var list *metav1.PartialObjectMetadataList
 	var err error
 
 	if r.Namespaced {
-		list, err = g.client.Resource(r.GroupVersionResource).
+		list, err = g.metadata.Resource(r.GroupVersionResource).
 			Namespace(namespace).
-			List(ctx, opts)
+			List(context.TODO(), opts)
 	} else {
-		list, err = g.client.Resource(r.GroupVersionResource).
-			List(ctx, opts)
+		list, err = g.metadata.Resource(r.GroupVersionResource).
+			List(context.TODO(), opts)
 	}
 
 	if err != nil {
-		return nil, err
+		g.log.Debugf("Cannot check if %q is empty: %s", r.Name(), err)
+		return false
 	}
 
-	g.log.Debugf("Listed %d %q in %.3f seconds", len(list.Items), r.Name(), time.Since(start).Seconds())
+	return len(list.Items) == 0
+}
+
+// gatherItemsByName gathers resource r items one by one, when listing failed
+// because of a broken conversion webhook. Items stored in the requested version
+// do not need conversion, so we can get them even if the list failed. Items
+// that cannot be fetched are recorded in the error report.
+func (g *Gatherer) gatherItemsByName(r *resourceInfo, namespace string, fn func(*unstructured.Unstructured)) {
+	g.log.Debugf("Falling back to getting %q items by name", r.Name())
+
+	opts := metav1.ListOptions{Limit: listResourcesLimit}
+
+	for {
+		var list *metav1.PartialObjectMetadataList
+		var err error
+
+		if r.Namespaced {
+			list, err = g.metadata.Resource(r.GroupVersionResource).
+				Namespace(namespace).
+				List(context.TODO(), opts)
+		} else {
+			list, err = g.metadata.Resource(r.GroupVersionResource).
+				List(context.TODO(), opts)
+		}
+
+		if err != nil {
+			err = wrapAPIError(err)
+			g.log.Warnf("Cannot list %q metadata: %s", r.Name(), err)
+			g.addError(r, namespace, "", ListFailed, err)
+			return
+		}
 
-	return list, nil
+		for i := range list.Items {
+			name := types.NamespacedName{Namespace: list.Items[i].Namespace, Name: list.Items[i].Name}
+			item, err := g.getResource(r, name)
+			if err != nil {
+				err = wrapAPIError(err)
+				g.log.Warnf("Cannot get %q: %s", g.keyFromName(r, name), err)
+				g.addError(r, name.Namespace, name.Name, GetFailed, err)
+				continue
+			}
+			fn(item)
+		}
+
+		opts.Continue = list.GetContinue()
+		if opts.Continue == "" {
+			return
+		}
+	}
+}
+
+// queueNamespacedLists queues listing of resource r in every namespace,
+// returning true if listing was queued. Used when a resource has more than
+// one page of items in all namespaces, since listing namespaces in parallel is
+// much faster than a sequential list of all namespaces on big clusters. Items
+// already gathered from the first page are skipped.
+func (g *Gatherer) queueNamespacedLists(r *resourceInfo) bool {
+	namespaces, err := g.listNamespaces()
+	if err != nil {
+		g.log.Debugf("Cannot split %q listing per namespace: %s", r.Name(), err)
+		return false
+	}
+
+	g.log.Debugf("Listing %q in %d namespaces in parallel", r.Name(), len(namespaces))
+
+	for i := range namespaces {
+		namespace := namespaces[i]
+		g.wq.Queue(func() error {
+			g.gatherResources(r, namespace)
+			return nil
+		})
+	}
+
+	return true
+}
+
+// listNamespaces returns the names of all namespaces in the cluster.
+func (g *Gatherer) listNamespaces() ([]string, error) {
+	g.namespacesOnce.Do(func() {
+		gvr := corev1.SchemeGroupVersion.WithResource("namespaces")
+		list, err := g.client.Resource(gvr).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			g.namespacesErr = err
+			return
+		}
+
+		for i := range list.Items {
+			g.namespaces = append(g.namespaces, list.Items[i].GetName())
+		}
+	})
+
+	return g.namespaces, g.namespacesErr
 }
 
 func (g *Gatherer) gatherResource(gvr schema.GroupVersionResource, name types.NamespacedName) {
 	start := time.Now()
 
-	r := resourceInfo{GroupVersionResource: gvr, Namespaced: name.Namespace != ""}
+	r := resourceInfo{
+		GroupVersionResource: gvr,
+		Namespaced:           name.Namespace != "",
+		Versioned:            g.opts.AllVersions,
+		Preferred:            true,
+	}
 
 	key := g.keyFromName(&r, name)
+	if gathered, _ := g.claimPrevious(namePath(&r, name)); gathered {
+		return
+	}
 	if !g.addResource(key) {
 		return
 	}
@@ -385,14 +1231,22 @@ func (g *Gatherer) gatherResource(gvr schema.GroupVersionResource, name types.Na
 	item, err := g.getResource(&r, name)
 	if err != nil {
 		g.log.Warnf("Cannot get %q: %s", key, err)
+		if !errors.IsNotFound(err) {
+			g.addError(&r, name.Namespace, name.Name, GetFailed, err)
+			g.removeResource(key)
+			g.retryLater(r.Name(), name.Namespace, name.Name, err, func() error {
+				g.gatherResource(gvr, name)
+				return nil
+			})
+		}
 		return
 	}
 
-	if err := g.dumpResource(&r, item); err != nil {
-		g.log.Warnf("Cannot dump %q: %s", key, err)
+	if !g.dumpResource(&r, item, key) {
 		return
 	}
 
+	g.timing.Add(name.Namespace, resourcesCategory, time.Since(start))
 	g.log.Debugf("Gathered %q in %.3f seconds", key, time.Since(start).Seconds())
 }
 
@@ -410,30 +1264,6 @@ func (g *Gatherer) getResource(r *resourceInfo, name types.NamespacedName) (*uns
 	}
 }
 
-func (g *Gatherer) dumpResource(r *resourceInfo, item *unstructured.Unstructured) error {
-	dst, err := g.createResource(r, item)
-	if err != nil {
-		return err
-	}
-
-	defer dst.Close()
-	writer := bufio.NewWriter(dst)
-	printer := printers.YAMLPrinter{}
-	if err := printer.PrintObj(item, writer); err != nil {
-		return err
-	}
-
-	return writer.Flush()
-}
-
-func (g *Gatherer) createResource(r *resourceInfo, item *unstructured.Unstructured) (io.WriteCloser, error) {
-	if r.Namespaced {
-		return g.output.CreateNamespacedResource(item.GetNamespace(), r.Name(), item.GetName())
-	} else {
-		return g.output.CreateClusterResource(r.Name(), item.GetName())
-	}
-}
-
 func (g *Gatherer) keyFromResource(r *resourceInfo, item *unstructured.Unstructured) string {
 	name := types.NamespacedName{Namespace: item.GetNamespace(), Name: item.GetName()}
 	return g.keyFromName(r, name)
@@ -441,9 +1271,9 @@ func (g *Gatherer) keyFromResource(r *resourceInfo, item *unstructured.Unstructu
 
 func (g *Gatherer) keyFromName(r *resourceInfo, name types.NamespacedName) string {
 	if r.Namespaced {
-		return fmt.Sprintf("namespaces/%s/%s/%s", name.Namespace, r.Name(), name.Name)
+		return fmt.Sprintf("namespaces/%s/%s/%s", name.Namespace, r.Directory(), name.Name)
 	} else {
-		return fmt.Sprintf("cluster/%s/%s", r.Name(), name.Name)
+		return fmt.Sprintf("cluster/%s/%s", r.Directory(), name.Name)
 	}
 }
 
@@ -458,3 +1288,11 @@ func (g *Gatherer) addResource(key string) bool {
 	g.resources[key] = struct{}{}
 	return true
 }
+
+// removeResource removes a resource that could not be gathered, so it can be
+// gathered again.
+func (g *Gatherer) removeResource(key string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.resources, key)
+}
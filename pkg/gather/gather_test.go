@@ -0,0 +1,427 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+var persistentVolumes = resourceInfo{
+	GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumes"},
+	Kind:                 "PersistentVolume",
+}
+
+// fakeLister lists items in pages of opts.Limit items. The continue token is
+// the index of the next item.
+type fakeLister struct {
+	items []*unstructured.Unstructured
+
+	// If true, getting the next page fails with expired error.
+	expireContinue bool
+
+	// If set, listing fails with this error.
+	err error
+
+	mutex sync.Mutex
+	calls []metav1.ListOptions
+}
+
+func (l *fakeLister) List(r *resourceInfo, namespace string, opts metav1.ListOptions, fn func(*unstructured.Unstructured)) (*metav1.ListMeta, error) {
+	l.mutex.Lock()
+	l.calls = append(l.calls, opts)
+	l.mutex.Unlock()
+
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	start := 0
+	if opts.Continue != "" {
+		if l.expireContinue {
+			return nil, errors.NewResourceExpired("continue token expired")
+		}
+		var err error
+		start, err = strconv.Atoi(opts.Continue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	end := len(l.items)
+	if opts.Limit > 0 {
+		end = min(start+int(opts.Limit), len(l.items))
+	}
+
+	for _, item := range l.items[start:end] {
+		fn(item.DeepCopy())
+	}
+
+	meta := &metav1.ListMeta{}
+	if end < len(l.items) {
+		meta.Continue = strconv.Itoa(end)
+	}
+
+	return meta, nil
+}
+
+// fakeDumper records the dumped items.
+type fakeDumper struct {
+	mutex sync.Mutex
+	items []string
+}
+
+func (d *fakeDumper) Dump(r *resourceInfo, item *unstructured.Unstructured) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.items = append(d.items, r.Name()+"/"+item.GetName())
+	return nil
+}
+
+// fakeDiscovery returns preferred resources, not supported by the client-go
+// fake discovery.
+type fakeDiscovery struct {
+	*fakediscovery.FakeDiscovery
+	preferred []*metav1.APIResourceList
+
+	// If set, returned with the preferred resources.
+	err error
+}
+
+func (d *fakeDiscovery) ServerPreferredResources() ([]*metav1.APIResourceList, error) {
+	return d.preferred, d.err
+}
+
+func newTestGatherer(t *testing.T, opts Options, lister resourceLister, objects ...runtime.Object) (*Gatherer, *fakeDumper) {
+	return newTestGathererIn(t, t.TempDir(), opts, lister, objects...)
+}
+
+func newTestGathererIn(t *testing.T, directory string, opts Options, lister resourceLister, objects ...runtime.Object) (*Gatherer, *fakeDumper) {
+	opts.Log = zap.NewNop().Sugar()
+	if opts.Addons == nil {
+		opts.Addons = []string{}
+	}
+
+	fake := &clienttesting.Fake{}
+
+	clients := &gatherClients{
+		// Discovery results are cached per host.
+		config:  &rest.Config{Host: "https://" + t.Name()},
+		dynamic: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), objects...),
+		discovery: &fakeDiscovery{
+			FakeDiscovery: &fakediscovery.FakeDiscovery{Fake: fake},
+		},
+		lister: lister,
+	}
+
+	g, err := newGatherer(clients, directory, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dumper := &fakeDumper{}
+	g.dumper = dumper
+
+	return g, dumper
+}
+
+func newItems(count int) []*unstructured.Unstructured {
+	var items []*unstructured.Unstructured
+	for i := 0; i < count; i++ {
+		item := &unstructured.Unstructured{}
+		item.SetAPIVersion("v1")
+		item.SetKind("PersistentVolume")
+		item.SetName(fmt.Sprintf("pv-%03d", i))
+		items = append(items, item)
+	}
+	return items
+}
+
+func TestGatherResourcesPages(t *testing.T) {
+	lister := &fakeLister{items: newItems(250)}
+	g, dumper := newTestGatherer(t, Options{}, lister)
+
+	g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+
+	if len(dumper.items) != 250 {
+		t.Errorf("expected 250 items, got %d", len(dumper.items))
+	}
+	if len(lister.calls) != 3 {
+		t.Errorf("expected 3 list calls, got %d", len(lister.calls))
+	}
+}
+
+func TestGatherResourcesExpiredFallback(t *testing.T) {
+	lister := &fakeLister{items: newItems(150), expireContinue: true}
+	g, dumper := newTestGatherer(t, Options{}, lister)
+
+	g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+
+	// First page, expired next page, full list.
+	if len(lister.calls) != 3 {
+		t.Fatalf("expected 3 list calls, got %d", len(lister.calls))
+	}
+	if last := lister.calls[2]; last.Limit != 0 || last.Continue != "" {
+		t.Errorf("expected full list, got %+v", last)
+	}
+
+	// Items from the first page are listed again, but dumped once.
+	if len(dumper.items) != 150 {
+		t.Errorf("expected 150 items, got %d", len(dumper.items))
+	}
+	if g.Count() != 150 {
+		t.Errorf("expected count 150, got %d", g.Count())
+	}
+	if len(g.errors.Errors()) != 0 {
+		t.Errorf("unexpected errors: %+v", g.errors.Errors())
+	}
+}
+
+func TestGatherResourcesDedup(t *testing.T) {
+	lister := &fakeLister{items: newItems(10)}
+	g, dumper := newTestGatherer(t, Options{}, lister)
+
+	g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+	g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+
+	if len(dumper.items) != 10 {
+		t.Errorf("expected 10 items, got %d", len(dumper.items))
+	}
+}
+
+func TestGatherResourcesListFailed(t *testing.T) {
+	lister := &fakeLister{err: errors.NewServiceUnavailable("try later")}
+	g, dumper := newTestGatherer(t, Options{}, lister)
+
+	g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+
+	if len(dumper.items) != 0 {
+		t.Errorf("expected no items, got %d", len(dumper.items))
+	}
+
+	errs := g.errors.Errors()
+	if len(errs) != 1 || errs[0].Reason != ListFailed || errs[0].Resource != "persistentvolumes" {
+		t.Errorf("expected ListFailed error, got %+v", errs)
+	}
+	if errs[0].Kind != "ServerUnavailable" {
+		t.Errorf("expected ServerUnavailable kind, got %q", errs[0].Kind)
+	}
+}
+
+func TestSkipReason(t *testing.T) {
+	list := []string{"get", "list", "watch"}
+
+	cases := []struct {
+		name     string
+		opts     Options
+		gv       schema.GroupVersion
+		resource metav1.APIResource
+		reason   string
+	}{
+		{
+			name:     "gathered",
+			gv:       schema.GroupVersion{Version: "v1"},
+			resource: metav1.APIResource{Name: "pods", Namespaced: true, Verbs: list},
+		},
+		{
+			name:     "not listable",
+			gv:       schema.GroupVersion{Group: "authorization.k8s.io", Version: "v1"},
+			resource: metav1.APIResource{Name: "selfsubjectreviews", Verbs: []string{"create"}},
+			reason:   SkipNotListable,
+		},
+		{
+			name:     "cluster scoped with namespaces",
+			opts:     Options{Namespaces: []string{"default"}},
+			gv:       schema.GroupVersion{Version: "v1"},
+			resource: metav1.APIResource{Name: "nodes", Verbs: list},
+			reason:   SkipClusterScoped,
+		},
+		{
+			name:     "cluster scoped without namespaces",
+			gv:       schema.GroupVersion{Version: "v1"},
+			resource: metav1.APIResource{Name: "nodes", Verbs: list},
+		},
+		{
+			name:     "package manifests with namespaces",
+			opts:     Options{Namespaces: []string{"default"}},
+			gv:       schema.GroupVersion{Group: "packages.operators.coreos.com", Version: "v1"},
+			resource: metav1.APIResource{Name: "packagemanifests", Namespaced: true, Verbs: list},
+			reason:   SkipPackageManifests,
+		},
+		{
+			name:     "core events",
+			gv:       schema.GroupVersion{Version: "v1"},
+			resource: metav1.APIResource{Name: "events", Namespaced: true, Verbs: list},
+			reason:   SkipDuplicateEvents,
+		},
+		{
+			name:     "events.k8s.io events",
+			gv:       schema.GroupVersion{Group: "events.k8s.io", Version: "v1"},
+			resource: metav1.APIResource{Name: "events", Namespaced: true, Verbs: list},
+		},
+		{
+			name:     "component statuses",
+			gv:       schema.GroupVersion{Version: "v1"},
+			resource: metav1.APIResource{Name: "componentstatuses", Verbs: list},
+			reason:   SkipDeprecated,
+		},
+		{
+			name:     "selected by kind",
+			opts:     Options{Resources: []string{"Deployment"}},
+			gv:       schema.GroupVersion{Group: "apps", Version: "v1"},
+			resource: metav1.APIResource{Name: "deployments", Kind: "Deployment", Namespaced: true, Verbs: list},
+		},
+		{
+			name:     "not selected",
+			opts:     Options{Resources: []string{"apps/deployments"}},
+			gv:       schema.GroupVersion{Version: "v1"},
+			resource: metav1.APIResource{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: list},
+			reason:   SkipNotSelected,
+		},
+		{
+			name:     "cluster resource included",
+			opts:     Options{ClusterResources: []string{"nodes", "pv"}},
+			gv:       schema.GroupVersion{Version: "v1"},
+			resource: metav1.APIResource{Name: "persistentvolumes", ShortNames: []string{"pv"}, Verbs: list},
+		},
+		{
+			name:     "cluster resource not included",
+			opts:     Options{ClusterResources: []string{"nodes", "pv"}},
+			gv:       schema.GroupVersion{Group: "storage.k8s.io", Version: "v1"},
+			resource: metav1.APIResource{Name: "storageclasses", Verbs: list},
+			reason:   SkipClusterResourceExcluded,
+		},
+		{
+			name:     "cluster resource group excluded",
+			opts:     Options{ClusterResources: []string{"-rbac.authorization.k8s.io"}},
+			gv:       schema.GroupVersion{Group: "rbac.authorization.k8s.io", Version: "v1"},
+			resource: metav1.APIResource{Name: "clusterroles", Verbs: list},
+			reason:   SkipClusterResourceExcluded,
+		},
+		{
+			name:     "cluster resource excluded",
+			opts:     Options{ClusterResources: []string{"-apiservices"}},
+			gv:       schema.GroupVersion{Group: "apiregistration.k8s.io", Version: "v1"},
+			resource: metav1.APIResource{Name: "apiservices", Verbs: list},
+			reason:   SkipClusterResourceExcluded,
+		},
+		{
+			name:     "namespaced resource not excluded",
+			opts:     Options{ClusterResources: []string{"-rbac.authorization.k8s.io"}},
+			gv:       schema.GroupVersion{Group: "rbac.authorization.k8s.io", Version: "v1"},
+			resource: metav1.APIResource{Name: "roles", Namespaced: true, Verbs: list},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g, _ := newTestGatherer(t, c.opts, &fakeLister{})
+			if reason := g.skipReason(c.gv, &c.resource); reason != c.reason {
+				t.Errorf("expected reason %q, got %q", c.reason, reason)
+			}
+		})
+	}
+}
+
+func TestListAPIResources(t *testing.T) {
+	g, _ := newTestGatherer(t, Options{}, &fakeLister{})
+	g.discovery.(*fakeDiscovery).preferred = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: []string{"list"}},
+				{Name: "events", Kind: "Event", Namespaced: true, Verbs: []string{"list"}},
+				{Name: "bindings", Kind: "Binding", Namespaced: true, Verbs: []string{"create"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", Kind: "Deployment", Namespaced: true, Verbs: []string{"list"}},
+			},
+		},
+	}
+
+	resources, err := g.listAPIResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for i := range resources {
+		names = append(names, resources[i].Name())
+	}
+	expected := []string{"pods", "apps/deployments"}
+	if !slices.Equal(names, expected) {
+		t.Errorf("expected resources %q, got %q", expected, names)
+	}
+
+	skipped := []SkippedResource{
+		{Resource: "bindings", Version: "v1", Reason: SkipNotListable},
+		{Resource: "events", Version: "v1", Reason: SkipDuplicateEvents},
+	}
+	if !slices.Equal(g.skippedResources, skipped) {
+		t.Errorf("expected skipped resources %+v, got %+v", skipped, g.skippedResources)
+	}
+}
+
+func TestListAPIResourcesPartialDiscovery(t *testing.T) {
+	g, _ := newTestGatherer(t, Options{}, &fakeLister{})
+	fake := g.discovery.(*fakeDiscovery)
+	fake.preferred = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: []string{"list"}},
+			},
+		},
+	}
+	metricsGV := schema.GroupVersion{Group: "metrics.k8s.io", Version: "v1beta1"}
+	fake.err = &discovery.ErrGroupDiscoveryFailed{
+		Groups: map[schema.GroupVersion]error{
+			metricsGV: errors.NewServiceUnavailable("try later"),
+		},
+	}
+
+	resources, err := g.listAPIResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 1 || resources[0].Name() != "pods" {
+		t.Errorf("expected available resources, got %+v", resources)
+	}
+
+	if len(g.failedGroups) != 1 || g.failedGroups[0].GroupVersion != metricsGV.String() {
+		t.Errorf("expected failed group %q, got %+v", metricsGV, g.failedGroups)
+	}
+
+	errs := g.errors.Errors()
+	if len(errs) != 1 || errs[0].Reason != DiscoveryFailed || errs[0].Resource != metricsGV.String() {
+		t.Errorf("expected DiscoveryFailed error, got %+v", errs)
+	}
+	if errs[0].Kind != "ServerUnavailable" {
+		t.Errorf("expected ServerUnavailable kind, got %q", errs[0].Kind)
+	}
+
+	// Other errors fail the gather.
+	fake.err = errors.NewServiceUnavailable("try later")
+	if _, err := g.listAPIResources(); err == nil {
+		t.Error("expected discovery error")
+	}
+}
@@ -0,0 +1,208 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package gathertest provides helpers for unit testing addons without a
+// cluster.
+package gathertest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+var _ gather.AddonBackend = &Backend{}
+
+// Resource is a resource gathered by an addon.
+type Resource struct {
+	GVR  schema.GroupVersionResource
+	Name types.NamespacedName
+}
+
+// Backend is a fake gather.AddonBackend. Queued functions run synchronously
+// in the calling goroutine with a context that is never cancelled, and
+// gathered resources are recorded instead of gathered, so a test can call
+// addon.Inspect() with crafted objects and check the results when Inspect
+// returns.
+//
+// The output directory is a temporary directory removed when the test
+// completes. Addons copy files from pods using tar, so the output cannot be
+// kept in memory.
+//
+// The config and http client access a local API server returning 404 for all
+// requests, so addon clients can be created, and optional APIs look like they
+// are not installed.
+type Backend struct {
+	server  *httptest.Server
+	config  *rest.Config
+	base    string
+	output  *gather.OutputDirectory
+	options *gather.Options
+
+	mutex        sync.Mutex
+	resources    []Resource
+	namespaces   []string
+	errors       []error
+	gatherErrors []gather.GatherError
+	retries      []gather.AddonWorkFunc
+}
+
+// NewBackend returns a fake backend using opts. If opts.Log is not set, logs
+// are written to the test log.
+func NewBackend(t testing.TB, opts gather.Options) *Backend {
+	if opts.Log == nil {
+		opts.Log = zaptest.NewLogger(t).Sugar()
+	}
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+
+	base := t.TempDir()
+
+	return &Backend{
+		server:  server,
+		config:  &rest.Config{Host: server.URL},
+		base:    base,
+		output:  gather.NewOutputDirectory(base),
+		options: &opts,
+	}
+}
+
+// Config implements gather.AddonBackend.
+func (b *Backend) Config() *rest.Config {
+	return b.config
+}
+
+// HTTPClient implements gather.AddonBackend.
+func (b *Backend) HTTPClient() *http.Client {
+	return b.server.Client()
+}
+
+// Output implements gather.AddonBackend.
+func (b *Backend) Output() *gather.OutputDirectory {
+	return b.output
+}
+
+// Options implements gather.AddonBackend.
+func (b *Backend) Options() *gather.Options {
+	return b.options
+}
+
+// Queue implements gather.AddonBackend, running work synchronously.
+func (b *Backend) Queue(work gather.AddonWorkFunc) {
+	b.run(work)
+}
+
+// QueueNamespace implements gather.AddonBackend, running work synchronously
+// and recording the namespace.
+func (b *Backend) QueueNamespace(namespace string, work gather.AddonWorkFunc) {
+	b.mutex.Lock()
+	b.namespaces = append(b.namespaces, namespace)
+	b.mutex.Unlock()
+
+	b.run(work)
+}
+
+// GatherResource implements gather.AddonBackend, recording the resource.
+func (b *Backend) GatherResource(gvr schema.GroupVersionResource, name types.NamespacedName) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.resources = append(b.resources, Resource{GVR: gvr, Name: name})
+}
+
+// AddError implements gather.AddonBackend, recording the error.
+func (b *Backend) AddError(resource string, namespace string, name string, reason string, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.gatherErrors = append(b.gatherErrors, gather.GatherError{
+		Resource:  resource,
+		Namespace: namespace,
+		Name:      name,
+		Reason:    reason,
+		Kind:      gather.ErrorKind(err),
+		Message:   err.Error(),
+	})
+}
+
+// Retry implements gather.AddonBackend, recording the work. Use RunRetries()
+// to run the recorded work.
+func (b *Backend) Retry(resource string, namespace string, name string, err error, work gather.AddonWorkFunc) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.retries = append(b.retries, work)
+}
+
+// RunRetries runs the work recorded with Retry() synchronously, in call
+// order, and returns the number of retried functions.
+func (b *Backend) RunRetries() int {
+	b.mutex.Lock()
+	retries := b.retries
+	b.retries = nil
+	b.mutex.Unlock()
+
+	for _, work := range retries {
+		b.run(work)
+	}
+
+	return len(retries)
+}
+
+// Resources returns the resources gathered by the addon, in call order.
+func (b *Backend) Resources() []Resource {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]Resource(nil), b.resources...)
+}
+
+// Namespaces returns the namespaces of functions queued with
+// QueueNamespace(), in call order.
+func (b *Backend) Namespaces() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]string(nil), b.namespaces...)
+}
+
+// Errors returns the errors returned by queued functions.
+func (b *Backend) Errors() []error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]error(nil), b.errors...)
+}
+
+// GatherErrors returns the errors recorded by the addon with AddError(), in
+// call order.
+func (b *Backend) GatherErrors() []gather.GatherError {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]gather.GatherError(nil), b.gatherErrors...)
+}
+
+// Dir returns the cluster directory used by the output.
+func (b *Backend) Dir() string {
+	return b.base
+}
+
+// ReadFile returns the content of a file in the cluster directory. The path
+// is relative to the cluster directory and uses "/" separator.
+func (b *Backend) ReadFile(relpath string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(b.base, filepath.FromSlash(relpath)))
+}
+
+func (b *Backend) run(work gather.AddonWorkFunc) {
+	if err := work(context.Background()); err != nil {
+		b.mutex.Lock()
+		b.errors = append(b.errors, err)
+		b.mutex.Unlock()
+	}
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gathertest_test
+
+import (
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+	"github.com/nirs/kubectl-gather/pkg/gather/gathertest"
+)
+
+func newPVC(spec map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]any{
+			"apiVersion": "v1",
+			"kind":       "PersistentVolumeClaim",
+			"metadata": map[string]any{
+				"name":      "pvc1",
+				"namespace": "app",
+			},
+			"spec": spec,
+		},
+	}
+}
+
+func TestPVCAddonGathersVolumeAndClass(t *testing.T) {
+	backend := gathertest.NewBackend(t, gather.Options{Namespaces: []string{"app"}})
+	addon, err := gather.NewPVCAddon(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pvc := newPVC(map[string]any{
+		"volumeName":       "pv1",
+		"storageClassName": "rbd",
+	})
+	if err := addon.Inspect(pvc); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []gathertest.Resource{
+		{
+			GVR:  schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumes"},
+			Name: types.NamespacedName{Name: "pv1"},
+		},
+		{
+			GVR:  schema.GroupVersionResource{Group: "storage.k8s.io", Version: "v1", Resource: "storageclasses"},
+			Name: types.NamespacedName{Name: "rbd"},
+		},
+	}
+	if resources := backend.Resources(); !slices.Equal(resources, expected) {
+		t.Errorf("expected resources %+v, got %+v", expected, resources)
+	}
+
+	// Snapshots are inspected once per namespace.
+	if err := addon.Inspect(pvc); err != nil {
+		t.Fatal(err)
+	}
+	if namespaces := backend.Namespaces(); !slices.Equal(namespaces, []string{"app"}) {
+		t.Errorf("expected namespaces [app], got %q", namespaces)
+	}
+	if errs := backend.Errors(); len(errs) != 0 {
+		t.Errorf("unexpected errors: %s", errs)
+	}
+}
+
+func TestPVCAddonAllNamespaces(t *testing.T) {
+	backend := gathertest.NewBackend(t, gather.Options{})
+	addon, err := gather.NewPVCAddon(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pvc := newPVC(map[string]any{"volumeName": "pv1"})
+	if err := addon.Inspect(pvc); err != nil {
+		t.Fatal(err)
+	}
+
+	// Related resources are gathered anyway when gathering all namespaces.
+	if resources := backend.Resources(); len(resources) != 0 {
+		t.Errorf("expected no resources, got %+v", resources)
+	}
+}
+
+func TestPVCAddonUnboundClaim(t *testing.T) {
+	backend := gathertest.NewBackend(t, gather.Options{Namespaces: []string{"app"}})
+	addon, err := gather.NewPVCAddon(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No volume, and the API server has no default storage class.
+	pvc := newPVC(map[string]any{})
+	if err := addon.Inspect(pvc); err != nil {
+		t.Fatal(err)
+	}
+
+	if resources := backend.Resources(); len(resources) != 0 {
+		t.Errorf("expected no resources, got %+v", resources)
+	}
+}
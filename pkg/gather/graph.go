@@ -0,0 +1,384 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	graphJSONName = "graph.json"
+	graphDOTName  = "graph.dot"
+)
+
+// Relations between objects in the dependency graph.
+const (
+	// The source object is an owner of the target object.
+	RelationOwns = "owns"
+
+	// The persistent volume claim is bound to the persistent volume.
+	RelationBinds = "binds"
+
+	// The source object uses the target object (e.g. a pod using a secret).
+	RelationUses = "uses"
+
+	// The service endpoints or the endpoints target pod.
+	RelationTargets = "targets"
+)
+
+// Graph describes how objects in a namespace are connected.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is an object in the graph. Objects referenced by other objects
+// but not found in the gather directory are marked as missing.
+type GraphNode struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Missing   bool   `json:"missing,omitempty"`
+}
+
+type GraphEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Relation string `json:"relation"`
+}
+
+// graphBuilder builds the graph of one namespace.
+type graphBuilder struct {
+	nodes map[string]*GraphNode
+	edges map[GraphEdge]struct{}
+
+	// Ids of gathered cluster scoped objects referenced by namespaced
+	// objects.
+	cluster map[string]struct{}
+}
+
+func newGraphBuilder(cluster map[string]struct{}) *graphBuilder {
+	return &graphBuilder{
+		nodes:   map[string]*GraphNode{},
+		edges:   map[GraphEdge]struct{}{},
+		cluster: cluster,
+	}
+}
+
+func graphNodeID(kind string, namespace string, name string) string {
+	if namespace == "" {
+		return kind + "/" + name
+	}
+	return kind + "/" + namespace + "/" + name
+}
+
+// AddObject adds a gathered object to the graph.
+func (b *graphBuilder) AddObject(kind string, namespace string, name string) string {
+	id := graphNodeID(kind, namespace, name)
+	if node, ok := b.nodes[id]; ok {
+		node.Missing = false
+	} else {
+		b.nodes[id] = &GraphNode{ID: id, Kind: kind, Namespace: namespace, Name: name}
+	}
+	return id
+}
+
+// AddEdge adds an edge to a referenced object.
+func (b *graphBuilder) AddEdge(from string, kind string, namespace string, name string, relation string) {
+	if name == "" {
+		return
+	}
+	id := b.addReference(kind, namespace, name)
+	b.edges[GraphEdge{From: from, To: id, Relation: relation}] = struct{}{}
+}
+
+// AddReverseEdge adds an edge from a referenced object to object to.
+func (b *graphBuilder) AddReverseEdge(kind string, namespace string, name string, to string, relation string) {
+	if name == "" {
+		return
+	}
+	id := b.addReference(kind, namespace, name)
+	b.edges[GraphEdge{From: id, To: to, Relation: relation}] = struct{}{}
+}
+
+// addReference adds a referenced object if it was not added yet. Namespaced
+// objects are marked as missing until added, and cluster scoped objects are
+// marked as missing if they were not gathered.
+func (b *graphBuilder) addReference(kind string, namespace string, name string) string {
+	id := graphNodeID(kind, namespace, name)
+	if _, ok := b.nodes[id]; !ok {
+		missing := true
+		if namespace == "" {
+			_, found := b.cluster[id]
+			missing = !found
+		}
+		b.nodes[id] = &GraphNode{ID: id, Kind: kind, Namespace: namespace, Name: name, Missing: missing}
+	}
+	return id
+}
+
+// Graph returns the graph sorted by node id and edges.
+func (b *graphBuilder) Graph() *Graph {
+	graph := &Graph{
+		Nodes: make([]GraphNode, 0, len(b.nodes)),
+		Edges: make([]GraphEdge, 0, len(b.edges)),
+	}
+
+	for _, node := range b.nodes {
+		graph.Nodes = append(graph.Nodes, *node)
+	}
+	slices.SortFunc(graph.Nodes, func(a, b GraphNode) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	for edge := range b.edges {
+		graph.Edges = append(graph.Edges, edge)
+	}
+	slices.SortFunc(graph.Edges, func(a, b GraphEdge) int {
+		if c := strings.Compare(a.From, b.From); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.To, b.To); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Relation, b.Relation)
+	})
+
+	return graph
+}
+
+// WriteGraphs builds the dependency graph of every namespace in the cluster
+// directory, and writes it to graph.json and graph.dot in the namespace
+// directory. Returns the number of graphs written.
+func WriteGraphs(clusterDir string) (int, error) {
+	entries, err := ReadIndex(clusterDir)
+	if err != nil {
+		return 0, err
+	}
+
+	// Persistent volumes and storage classes are cluster scoped, but we need
+	// them to connect claims to volumes and storage classes.
+	cluster := map[string]struct{}{}
+	volumeClasses := map[string]string{}
+	for _, entry := range entries {
+		switch entry.Resource {
+		case "persistentvolumes":
+			item, err := ReadResource(clusterDir, entry)
+			if err != nil {
+				return 0, err
+			}
+			class, _, _ := unstructured.NestedString(item.Object, "spec", "storageClassName")
+			volumeClasses[item.GetName()] = class
+			cluster[graphNodeID("PersistentVolume", "", entry.Name)] = struct{}{}
+		case "storage.k8s.io/storageclasses":
+			cluster[graphNodeID("StorageClass", "", entry.Name)] = struct{}{}
+		}
+	}
+
+	builders := map[string]*graphBuilder{}
+
+	for _, entry := range entries {
+		if entry.Namespace == "" {
+			continue
+		}
+
+		item, err := ReadResource(clusterDir, entry)
+		if err != nil {
+			return 0, err
+		}
+
+		builder, ok := builders[entry.Namespace]
+		if !ok {
+			builder = newGraphBuilder(cluster)
+			builders[entry.Namespace] = builder
+		}
+
+		addGraphObject(builder, item, volumeClasses)
+	}
+
+	for namespace, builder := range builders {
+		dir := filepath.Join(clusterDir, namespacesDir, namespace)
+		if err := writeGraph(dir, namespace, builder.Graph()); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(builders), nil
+}
+
+// addGraphObject adds item and its references to the graph.
+func addGraphObject(b *graphBuilder, item *unstructured.Unstructured, volumeClasses map[string]string) {
+	namespace := item.GetNamespace()
+	id := b.AddObject(item.GetKind(), namespace, item.GetName())
+
+	for _, ref := range item.GetOwnerReferences() {
+		b.AddReverseEdge(ref.Kind, namespace, ref.Name, id, RelationOwns)
+	}
+
+	switch item.GetKind() {
+	case "PersistentVolumeClaim":
+		volume, _, _ := unstructured.NestedString(item.Object, "spec", "volumeName")
+		b.AddEdge(id, "PersistentVolume", "", volume, RelationBinds)
+		if volume != "" && volumeClasses[volume] != "" {
+			pv := graphNodeID("PersistentVolume", "", volume)
+			b.AddEdge(pv, "StorageClass", "", volumeClasses[volume], RelationUses)
+		}
+		class, _, _ := unstructured.NestedString(item.Object, "spec", "storageClassName")
+		b.AddEdge(id, "StorageClass", "", class, RelationUses)
+	case "Pod":
+		addPodEdges(b, id, item)
+	case "Service":
+		// Endpoints have the same name as the service.
+		b.AddEdge(id, "Endpoints", namespace, item.GetName(), RelationTargets)
+	case "Endpoints":
+		subsets, _, _ := unstructured.NestedSlice(item.Object, "subsets")
+		for _, s := range subsets {
+			subset, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, field := range []string{"addresses", "notReadyAddresses"} {
+				addresses, _, _ := unstructured.NestedSlice(subset, field)
+				for _, a := range addresses {
+					address, ok := a.(map[string]interface{})
+					if !ok {
+						continue
+					}
+					kind, _, _ := unstructured.NestedString(address, "targetRef", "kind")
+					name, _, _ := unstructured.NestedString(address, "targetRef", "name")
+					if kind == "Pod" {
+						b.AddEdge(id, kind, namespace, name, RelationTargets)
+					}
+				}
+			}
+		}
+	}
+}
+
+// addPodEdges adds edges from pod to the service account, config maps,
+// secrets and persistent volume claims used by the pod.
+func addPodEdges(b *graphBuilder, id string, pod *unstructured.Unstructured) {
+	namespace := pod.GetNamespace()
+
+	serviceAccount, _, _ := unstructured.NestedString(pod.Object, "spec", "serviceAccountName")
+	b.AddEdge(id, "ServiceAccount", namespace, serviceAccount, RelationUses)
+
+	volumes, _, _ := unstructured.NestedSlice(pod.Object, "spec", "volumes")
+	for _, v := range volumes {
+		volume, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		name, _, _ := unstructured.NestedString(volume, "configMap", "name")
+		b.AddEdge(id, "ConfigMap", namespace, name, RelationUses)
+
+		name, _, _ = unstructured.NestedString(volume, "secret", "secretName")
+		b.AddEdge(id, "Secret", namespace, name, RelationUses)
+
+		name, _, _ = unstructured.NestedString(volume, "persistentVolumeClaim", "claimName")
+		b.AddEdge(id, "PersistentVolumeClaim", namespace, name, RelationUses)
+
+		sources, _, _ := unstructured.NestedSlice(volume, "projected", "sources")
+		for _, s := range sources {
+			source, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(source, "configMap", "name")
+			b.AddEdge(id, "ConfigMap", namespace, name, RelationUses)
+			name, _, _ = unstructured.NestedString(source, "secret", "name")
+			b.AddEdge(id, "Secret", namespace, name, RelationUses)
+		}
+	}
+
+	for _, field := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		containers, _, _ := unstructured.NestedSlice(pod.Object, "spec", field)
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			envFrom, _, _ := unstructured.NestedSlice(container, "envFrom")
+			for _, e := range envFrom {
+				source, ok := e.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				name, _, _ := unstructured.NestedString(source, "configMapRef", "name")
+				b.AddEdge(id, "ConfigMap", namespace, name, RelationUses)
+				name, _, _ = unstructured.NestedString(source, "secretRef", "name")
+				b.AddEdge(id, "Secret", namespace, name, RelationUses)
+			}
+
+			env, _, _ := unstructured.NestedSlice(container, "env")
+			for _, e := range env {
+				variable, ok := e.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				name, _, _ := unstructured.NestedString(variable, "valueFrom", "configMapKeyRef", "name")
+				b.AddEdge(id, "ConfigMap", namespace, name, RelationUses)
+				name, _, _ = unstructured.NestedString(variable, "valueFrom", "secretKeyRef", "name")
+				b.AddEdge(id, "Secret", namespace, name, RelationUses)
+			}
+		}
+	}
+}
+
+func writeGraph(dir string, namespace string, graph *Graph) error {
+	data, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, graphJSONName), append(data, '\n'), 0640); err != nil {
+		return err
+	}
+
+	dst, err := os.Create(filepath.Join(dir, graphDOTName))
+	if err != nil {
+		return err
+	}
+
+	defer dst.Close()
+
+	writer := bufio.NewWriter(dst)
+	writeDOT(writer, namespace, graph)
+	return writer.Flush()
+}
+
+// writeDOT writes graph in graphviz DOT format. Missing objects are drawn
+// with a dashed border.
+func writeDOT(w io.Writer, namespace string, graph *Graph) {
+	fmt.Fprintf(w, "digraph %q {\n", namespace)
+	fmt.Fprintf(w, "  rankdir=LR;\n")
+	fmt.Fprintf(w, "  node [shape=box];\n")
+
+	for _, node := range graph.Nodes {
+		label := node.Kind + "\n" + node.Name
+		if node.Missing {
+			fmt.Fprintf(w, "  %q [label=%q, style=dashed];\n", node.ID, label)
+		} else {
+			fmt.Fprintf(w, "  %q [label=%q];\n", node.ID, label)
+		}
+	}
+
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(w, "  %q -> %q [label=%q];\n", edge.From, edge.To, edge.Relation)
+	}
+
+	fmt.Fprintf(w, "}\n")
+}
@@ -0,0 +1,180 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	indexName = "index.json"
+	byKindDir = "by-kind"
+)
+
+// IndexEntry maps a gathered resource to its path in the cluster directory.
+// Since resource names may be escaped or truncated to make them valid file
+// names, the index is the only reliable way to find a resource by name.
+type IndexEntry struct {
+	// Full resource name (e.g. "apps/deployments").
+	Resource string `json:"resource"`
+
+	// Resource namespace, empty for cluster scoped resources.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Resource name.
+	Name string `json:"name"`
+
+	// Path relative to the cluster directory, using "/" separator.
+	Path string `json:"path"`
+}
+
+// index records the resources gathered in a cluster. It is written to
+// index.json in the cluster directory when gathering is done.
+type index struct {
+	mutex   sync.Mutex
+	entries []IndexEntry
+}
+
+func (i *index) Add(entry IndexEntry) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.entries = append(i.entries, entry)
+}
+
+// Entries returns the index entries sorted by path.
+func (i *index) Entries() []IndexEntry {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	entries := slices.Clone(i.entries)
+	slices.SortFunc(entries, func(a, b IndexEntry) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return entries
+}
+
+// Write writes the index to index.json in the output directory.
+func (i *index) Write(output *OutputDirectory) error {
+	data, err := json.MarshalIndent(i.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dst, err := output.CreateFile(indexName)
+	if err != nil {
+		return err
+	}
+
+	defer dst.Close()
+
+	_, err = dst.Write(append(data, '\n'))
+	return err
+}
+
+func (g *Gatherer) writeIndex() {
+	if err := g.index.Write(&g.output); err != nil {
+		g.log.Warnf("Cannot write %q: %s", indexName, err)
+	}
+}
+
+// ReadIndex reads the index of the cluster directory.
+func ReadIndex(clusterDir string) ([]IndexEntry, error) {
+	data, err := os.ReadFile(filepath.Join(clusterDir, indexName))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []IndexEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// ReadResource reads the resource described by entry from the cluster
+// directory.
+func ReadResource(clusterDir string, entry IndexEntry) (*unstructured.Unstructured, error) {
+	data, err := os.ReadFile(filepath.Join(clusterDir, filepath.FromSlash(path.Clean(entry.Path))))
+	if err != nil {
+		return nil, err
+	}
+
+	item := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(data, &item.Object); err != nil {
+		return nil, fmt.Errorf("cannot decode %q: %s", entry.Path, err)
+	}
+
+	return item, nil
+}
+
+// FindClusterDirs returns the cluster directories in the gather directory.
+// A cluster directory is a directory containing an index.
+func FindClusterDirs(directory string) ([]string, error) {
+	var dirs []string
+
+	err := filepath.WalkDir(directory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(path, indexName)); err == nil {
+			dirs = append(dirs, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dirs, nil
+}
+
+// writeByKind creates a symlink for every namespaced resource in the
+// by-kind directory (e.g. "by-kind/apps/deployments/{namespace}/{name}.yaml"),
+// so all instances of a kind can be viewed across namespaces.
+func (g *Gatherer) writeByKind() {
+	for _, entry := range g.index.Entries() {
+		if entry.Namespace == "" {
+			continue
+		}
+
+		link := filepath.Join(g.output.base, byKindDir, filepath.FromSlash(entry.Resource),
+			entry.Namespace, path.Base(entry.Path))
+		target := filepath.Join(g.output.base, filepath.FromSlash(entry.Path))
+
+		relpath, err := filepath.Rel(filepath.Dir(link), target)
+		if err != nil {
+			g.log.Warnf("Cannot create %q: %s", byKindDir, err)
+			return
+		}
+
+		if err := os.MkdirAll(filepath.Dir(link), 0750); err != nil {
+			g.log.Warnf("Cannot create %q: %s", byKindDir, err)
+			return
+		}
+
+		if err := os.Symlink(relpath, link); err != nil && !errors.Is(err, fs.ErrExist) {
+			// Symlinks may not be supported on this file system.
+			g.log.Warnf("Cannot create %q: %s", byKindDir, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	inventoryName = "inventory.csv"
+)
+
+var inventoryHeader = []string{"resource", "namespace", "name", "creationTimestamp"}
+
+// inventory records the names of resources gathered without their content.
+// The inventory file is created when the first item is added. Every item is
+// recorded once, even if it is listed in multiple versions.
+type inventory struct {
+	output *OutputDirectory
+	mutex  sync.Mutex
+	file   io.WriteCloser
+	writer *csv.Writer
+
+	// Recorded items by resource, namespace and name.
+	seen map[string]struct{}
+
+	// Rows recorded by previous gathers when appending, written when the
+	// inventory file is created.
+	previous [][]string
+
+	// If true, rows are kept until closing the inventory and written sorted.
+	sorted bool
+	rows   [][]string
+}
+
+func (i *inventory) Add(r *resourceInfo, item *metav1.PartialObjectMetadata) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	row := []string{
+		r.Name(),
+		item.Namespace,
+		item.Name,
+		item.CreationTimestamp.UTC().Format(time.RFC3339),
+	}
+
+	if !i.addKey(row) {
+		return nil
+	}
+
+	if i.writer == nil {
+		file, err := i.output.CreateFile(inventoryName)
+		if err != nil {
+			return err
+		}
+		i.file = file
+		i.writer = csv.NewWriter(file)
+		if err := i.writer.Write(inventoryHeader); err != nil {
+			return err
+		}
+		if err := i.write(i.previous...); err != nil {
+			return err
+		}
+	}
+
+	return i.write(row)
+}
+
+// AddPrevious adds the rows recorded by previous gathers when appending.
+// The rows are kept in the inventory file if this gather records more items.
+func (i *inventory) AddPrevious(rows [][]string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	for _, row := range rows {
+		if i.addKey(row) {
+			i.previous = append(i.previous, row)
+		}
+	}
+}
+
+// addKey returns false if the item in row was already recorded.
+func (i *inventory) addKey(row []string) bool {
+	key := row[0] + "/" + row[1] + "/" + row[2]
+	if _, ok := i.seen[key]; ok {
+		return false
+	}
+
+	if i.seen == nil {
+		i.seen = map[string]struct{}{}
+	}
+	i.seen[key] = struct{}{}
+	return true
+}
+
+func (i *inventory) write(rows ...[]string) error {
+	if i.sorted {
+		i.rows = append(i.rows, rows...)
+		return nil
+	}
+
+	for _, row := range rows {
+		if err := i.writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (i *inventory) Close() error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if i.writer == nil {
+		return nil
+	}
+
+	if i.sorted {
+		slices.SortFunc(i.rows, func(a, b []string) int {
+			return slices.Compare(a, b)
+		})
+		if err := i.writer.WriteAll(i.rows); err != nil {
+			i.file.Close()
+			return err
+		}
+	}
+
+	i.writer.Flush()
+	if err := i.writer.Error(); err != nil {
+		i.file.Close()
+		return err
+	}
+
+	return i.file.Close()
+}
+
+// inventoryOnly returns true if resource r should be inventoried instead of
+// gathered. Resources are matched by full name (e.g. "events.k8s.io/events")
+// or resource name (e.g. "secrets").
+func (g *Gatherer) inventoryOnly(r *resourceInfo) bool {
+	return slices.Contains(g.opts.InventoryOnly, r.Name()) ||
+		slices.Contains(g.opts.InventoryOnly, r.Resource)
+}
+
+// gatherInventory lists resource r metadata and records the items in the
+// inventory. This is much faster and smaller than gathering the resources.
+func (g *Gatherer) gatherInventory(r *resourceInfo, namespace string) {
+	start := time.Now()
+
+	opts := metav1.ListOptions{Limit: listResourcesLimit}
+	count := 0
+
+	for {
+		var list *metav1.PartialObjectMetadataList
+		var err error
+
+		if r.Namespaced {
+			list, err = g.metadata.Resource(r.GroupVersionResource).
+				Namespace(namespace).
+				List(context.TODO(), opts)
+		} else {
+			list, err = g.metadata.Resource(r.GroupVersionResource).
+				List(context.TODO(), opts)
+		}
+
+		if err != nil {
+			err = wrapAPIError(err)
+			g.log.Warnf("Cannot list %q metadata: %s", r.Name(), err)
+			g.addError(r, namespace, "", ListFailed, err)
+			g.retryLater(r.Name(), namespace, "", err, func() error {
+				g.gatherInventory(r, namespace)
+				return nil
+			})
+			break
+		}
+
+		for i := range list.Items {
+			if err := g.inventory.Add(r, &list.Items[i]); err != nil {
+				g.log.Warnf("Cannot add %q to inventory: %s", r.Name(), err)
+				return
+			}
+		}
+
+		count += len(list.Items)
+
+		opts.Continue = list.GetContinue()
+		if opts.Continue == "" {
+			break
+		}
+	}
+
+	g.timing.Add(namespace, resourcesCategory, time.Since(start))
+	g.log.Debugf("Inventoried %d %q in %.3f seconds", count, r.Name(), time.Since(start).Seconds())
+}
+
+// readInventory returns the rows in the inventory of the cluster directory,
+// without the header.
+func readInventory(clusterDir string) ([][]string, error) {
+	f, err := os.Open(filepath.Join(clusterDir, inventoryName))
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = len(inventoryHeader)
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", inventoryName, err)
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	return rows[1:], nil
+}
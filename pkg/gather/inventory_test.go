@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakemetadata "k8s.io/client-go/metadata/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestInventoryAllVersions(t *testing.T) {
+	dir := t.TempDir()
+	inv := &inventory{output: NewOutputDirectory(dir)}
+
+	item := &metav1.PartialObjectMetadata{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "my-app", Name: "cm1"},
+	}
+	for _, version := range []string{"v1", "v2"} {
+		r := &resourceInfo{
+			GroupVersionResource: schema.GroupVersionResource{Group: "example.com", Version: version, Resource: "configs"},
+			Namespaced:           true,
+			Versioned:            true,
+		}
+		if err := inv.Add(r, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := inv.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, inventoryName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Errorf("expected header and 1 row, got %q", rows)
+	}
+}
+
+func TestGatherInventoryListFailed(t *testing.T) {
+	g, _ := newTestGatherer(t, Options{}, &fakeLister{})
+
+	metadataClient := fakemetadata.NewSimpleMetadataClient(runtime.NewScheme())
+	metadataClient.PrependReactor("list", "*", func(clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", nil)
+	})
+	g.metadata = metadataClient
+
+	r := &resourceInfo{
+		GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: "secrets"},
+		Namespaced:           true,
+	}
+	g.gatherInventory(r, "my-app")
+
+	errs := g.errors.Errors()
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %+v", errs)
+	}
+	if e := errs[0]; e.Resource != "secrets" || e.Namespace != "my-app" || e.Reason != ListFailed || e.Kind != "ListForbidden" {
+		t.Errorf("unexpected error %+v", e)
+	}
+}
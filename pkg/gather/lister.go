@@ -0,0 +1,192 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+)
+
+// resourceLister lists resource r in namespace, calling fn for every item.
+// Returns the list metadata for getting the next page.
+type resourceLister interface {
+	List(r *resourceInfo, namespace string, opts metav1.ListOptions, fn func(*unstructured.Unstructured)) (*metav1.ListMeta, error)
+}
+
+// resourceDumper stores a gathered resource.
+type resourceDumper interface {
+	Dump(r *resourceInfo, item *unstructured.Unstructured) error
+}
+
+// gatherClients are the clients used by the gatherer to access the cluster.
+// Tests replace them with fake clients.
+type gatherClients struct {
+	config     *rest.Config
+	httpClient *http.Client
+	dynamic    dynamic.Interface
+	metadata   metadata.Interface
+	discovery  discovery.DiscoveryInterface
+	stream     *rest.RESTClient
+	protobuf   *rest.RESTClient
+
+	// Lists resources. If nil, resources are listed using the stream and
+	// protobuf clients.
+	lister resourceLister
+}
+
+// apiLister lists resources from the API server. Lists are streamed, or
+// listed using protobuf if protobuf is not nil.
+type apiLister struct {
+	stream   *rest.RESTClient
+	protobuf *rest.RESTClient
+	limiter  *byteLimiter
+	log      *zap.SugaredLogger
+}
+
+// List lists resources streaming the response, calling fn for every item.
+// Items are decoded one at a time, so memory usage does not depend on the
+// number of items in the list.
+func (l *apiLister) List(r *resourceInfo, namespace string, opts metav1.ListOptions, fn func(*unstructured.Unstructured)) (*metav1.ListMeta, error) {
+	if l.protobuf != nil {
+		if listKind, ok := protobufListKind(r); ok {
+			return l.listProtobuf(r, namespace, opts, listKind, fn)
+		}
+	}
+
+	start := time.Now()
+
+	src, err := l.stream.Get().
+		AbsPath(resourcePath(r, namespace)...).
+		SpecificallyVersionedParams(&opts, metav1.ParameterCodec, metav1.SchemeGroupVersion).
+		Stream(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	defer src.Close()
+
+	count := 0
+	meta, err := newListDecoder(src, l.limiter).Decode(func(item *unstructured.Unstructured) {
+		count++
+		fn(item)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	l.log.Debugf("Listed %d %q in %.3f seconds", count, r.Name(), time.Since(start).Seconds())
+
+	return meta, nil
+}
+
+// resourceWriter stores resources as YAML files in the output directory and
+// records them in the index.
+type resourceWriter struct {
+	output *OutputDirectory
+	index  *index
+
+	// Bytes written to resource files.
+	written *atomic.Int64
+
+	// Objects larger than maxObjectSize bytes are not stored. If zero, the
+	// size is not limited.
+	maxObjectSize int64
+
+	// Handling of binary values larger than binaryFieldsThreshold bytes.
+	binaryFields          string
+	binaryFieldsThreshold int64
+}
+
+func (w *resourceWriter) Dump(r *resourceInfo, item *unstructured.Unstructured) error {
+	relpath := itemPath(r, item)
+	printer := printers.YAMLPrinter{}
+
+	item, err := w.stripBinaryFields(r, item, relpath)
+	if err != nil {
+		return err
+	}
+
+	// Encode the object in memory to check the size before writing.
+	var encoded *bytes.Buffer
+	if w.maxObjectSize > 0 {
+		encoded = &bytes.Buffer{}
+		if err := printer.PrintObj(item, encoded); err != nil {
+			return err
+		}
+		if size := int64(encoded.Len()); size > w.maxObjectSize {
+			return w.skipObject(relpath, item, size)
+		}
+	}
+
+	dst, err := w.output.CreateResource(relpath)
+	if err != nil {
+		return err
+	}
+
+	defer dst.Close()
+	writer := bufio.NewWriter(&countingWriter{w: dst, count: w.written})
+	if encoded != nil {
+		_, err = encoded.WriteTo(writer)
+	} else {
+		err = printer.PrintObj(item, writer)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	w.index.Add(IndexEntry{
+		Resource:  r.Name(),
+		Namespace: item.GetNamespace(),
+		Name:      item.GetName(),
+		Path:      relpath,
+	})
+
+	return nil
+}
+
+// countingWriter adds the number of bytes written to count.
+type countingWriter struct {
+	w     io.Writer
+	count *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.count.Add(int64(n))
+	return n, err
+}
+
+// itemPath returns the path of item relative to the cluster directory.
+func itemPath(r *resourceInfo, item *unstructured.Unstructured) string {
+	return namePath(r, types.NamespacedName{Namespace: item.GetNamespace(), Name: item.GetName()})
+}
+
+// namePath returns the path of resource name relative to the cluster
+// directory.
+func namePath(r *resourceInfo, name types.NamespacedName) string {
+	if r.Namespaced {
+		return NamespacedResourcePath(name.Namespace, r.Directory(), name.Name)
+	} else {
+		return ClusterResourcePath(r.Directory(), name.Name)
+	}
+}
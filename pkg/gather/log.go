@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"github.com/go-logr/logr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// logger returns the logger used by the gather: Log if set, Logger if set,
+// or a logger discarding all messages.
+func (o *Options) logger() *zap.SugaredLogger {
+	switch {
+	case o.Log != nil:
+		return o.Log
+	case o.Logger.GetSink() != nil:
+		return zap.New(&logrCore{logger: o.Logger}).Sugar()
+	default:
+		return zap.NewNop().Sugar()
+	}
+}
+
+// logrCore sends zap log entries to a logr logger, so programs using logr
+// (e.g. controller-runtime) can embed the gather. Debug messages are logged
+// at verbosity 1, other messages at verbosity 0, and error messages using
+// the logr Error method.
+type logrCore struct {
+	logger logr.Logger
+	fields []zapcore.Field
+}
+
+func (c *logrCore) Enabled(level zapcore.Level) bool {
+	return c.logger.V(logrVerbosity(level)).Enabled()
+}
+
+func (c *logrCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(clone.fields[:len(clone.fields):len(clone.fields)], fields...)
+	return &clone
+}
+
+func (c *logrCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *logrCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(encoder)
+	}
+	for _, f := range fields {
+		f.AddTo(encoder)
+	}
+
+	keysAndValues := make([]any, 0, 2*len(encoder.Fields))
+	for k, v := range encoder.Fields {
+		keysAndValues = append(keysAndValues, k, v)
+	}
+
+	logger := c.logger
+	if entry.LoggerName != "" {
+		logger = logger.WithName(entry.LoggerName)
+	}
+
+	if entry.Level >= zapcore.ErrorLevel {
+		logger.Error(nil, entry.Message, keysAndValues...)
+	} else {
+		logger.V(logrVerbosity(entry.Level)).Info(entry.Message, keysAndValues...)
+	}
+
+	return nil
+}
+
+func (c *logrCore) Sync() error {
+	return nil
+}
+
+func logrVerbosity(level zapcore.Level) int {
+	if level < zapcore.InfoLevel {
+		return 1
+	}
+	return 0
+}
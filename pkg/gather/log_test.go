@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+)
+
+func TestOptionsLogger(t *testing.T) {
+	if log := (&Options{}).logger(); log == nil {
+		t.Fatal("expected nop logger")
+	}
+
+	var lines []string
+	logger := funcr.New(func(prefix, args string) {
+		lines = append(lines, prefix+" "+args)
+	}, funcr.Options{Verbosity: 0})
+
+	log := (&Options{Logger: logger}).logger().Named("files")
+	log.Debugf("debug %d", 1)
+	log.Infof("info %d", 2)
+	log.Errorw("error", "pod", "ns/pod")
+
+	expected := []string{
+		`files "level"=0 "msg"="info 2"`,
+		`files "msg"="error" "error"=null "pod"="ns/pod"`,
+	}
+	if !slices.Equal(lines, expected) {
+		t.Errorf("expected lines %q, got %q", expected, lines)
+	}
+}
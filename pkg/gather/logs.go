@@ -7,29 +7,66 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
 
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
 )
 
 const (
-	logsName = "logs"
+	logsName           = "logs"
+	containersName     = "containers.txt"
+	containersYAMLName = "containers.yaml"
+	terminationName    = "termination.txt"
+
+	// Resource name of container logs in the error report.
+	podLogsResource = "pods/log"
 )
 
+// LogFailed is recorded in the error report when getting a container log
+// failed.
+const LogFailed = "LogFailed"
+
+// Container status keys in pod status, and the container type reported in
+// containers.txt. Init containers running as sidecars are reported as
+// "sidecar" (see sortContainers).
+var containerStatusKeys = []struct {
+	Key  string
+	Type string
+}{
+	{"initContainerStatuses", "init"},
+	{"containerStatuses", "regular"},
+	{"ephemeralContainerStatuses", "ephemeral"},
+}
+
 type LogsAddon struct {
 	AddonBackend
 	client *kubernetes.Clientset
 	log    *zap.SugaredLogger
+	nodes  *nodeLimiter
 }
 
 type containerInfo struct {
 	Namespace      string
 	Pod            string
+	Node           string
 	Name           string
+	Type           string
 	HasPreviousLog bool
+
+	// Container status, used for the pod containers summary.
+	Status map[string]interface{}
 }
 
 func (c containerInfo) String() string {
@@ -38,8 +75,9 @@ func (c containerInfo) String() string {
 
 func init() {
 	registerAddon(logsName, addonInfo{
-		Resource:  "pods",
+		Resources: []string{"pods"},
 		AddonFunc: NewLogsAddon,
+		Priority:  PriorityLogs,
 	})
 }
 
@@ -53,6 +91,7 @@ func NewLogsAddon(backend AddonBackend) (Addon, error) {
 		AddonBackend: backend,
 		client:       client,
 		log:          backend.Options().Log.Named(logsName),
+		nodes:        newNodeLimiter(backend.Options().LogsPerNode),
 	}, nil
 }
 
@@ -65,19 +104,35 @@ func (a *LogsAddon) Inspect(pod *unstructured.Unstructured) error {
 			pod.GetNamespace(), pod.GetName(), err)
 	}
 
+	typed := &corev1.Pod{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(pod.Object, typed); err != nil {
+		a.log.Warnf("Cannot convert pod \"%s/%s\": %s", pod.GetNamespace(), pod.GetName(), err)
+	} else {
+		summary := podContainersSummary(typed)
+		sortContainers(containers, summary)
+		a.writeContainersYAML(pod, summary)
+	}
+
+	a.writeContainersSummary(pod, containers)
+
 	for i := range containers {
 		container := containers[i]
 
-		a.Queue(func() error {
-			opts := corev1.PodLogOptions{Container: container.Name}
-			a.gatherContainerLog(container, &opts)
+		a.writeTermination(container)
+
+		a.QueueNamespace(container.Namespace, func(ctx context.Context) error {
+			defer a.nodes.Acquire(container.Node)()
+			opts := a.logOptions(container)
+			a.gatherContainerLog(ctx, container, &opts)
 			return nil
 		})
 
 		if container.HasPreviousLog {
-			a.Queue(func() error {
-				opts := corev1.PodLogOptions{Container: container.Name, Previous: true}
-				a.gatherContainerLog(container, &opts)
+			a.QueueNamespace(container.Namespace, func(ctx context.Context) error {
+				defer a.nodes.Acquire(container.Node)()
+				opts := a.logOptions(container)
+				opts.Previous = true
+				a.gatherContainerLog(ctx, container, &opts)
 				return nil
 			})
 		}
@@ -86,7 +141,24 @@ func (a *LogsAddon) Inspect(pod *unstructured.Unstructured) error {
 	return nil
 }
 
-func (a *LogsAddon) gatherContainerLog(container *containerInfo, opts *corev1.PodLogOptions) {
+// logOptions returns the log options for container, limiting the log to the
+// gather time window. Since the API cannot limit the end time, we need the
+// timestamps to drop lines logged after the window.
+func (a *LogsAddon) logOptions(container *containerInfo) corev1.PodLogOptions {
+	opts := corev1.PodLogOptions{Container: container.Name}
+
+	if since := a.Options().Since; !since.IsZero() {
+		opts.SinceTime = &metav1.Time{Time: since}
+	}
+
+	if !a.Options().Until.IsZero() {
+		opts.Timestamps = true
+	}
+
+	return opts
+}
+
+func (a *LogsAddon) gatherContainerLog(ctx context.Context, container *containerInfo, opts *corev1.PodLogOptions) {
 	start := time.Now()
 
 	which := "current"
@@ -96,15 +168,21 @@ func (a *LogsAddon) gatherContainerLog(container *containerInfo, opts *corev1.Po
 
 	req := a.client.CoreV1().Pods(container.Namespace).GetLogs(container.Pod, opts)
 
-	src, err := req.Stream(context.TODO())
+	src, err := req.Stream(ctx)
 	if err != nil {
 		// Getting the log is possible only if a container is running, but
 		// checking the container state before the call is racy. We get a
 		// BadRequest error like: "container ... in pod ... is waiting to start:
 		// PodInitializing" so there is no way to detect the actul problem.
-		// Since this is expected situation, and getting logs is best effort, we
-		// log this in debug level.
-		a.log.Debugf("Cannot get log for \"%s/%s\": %v", container, which, err)
+		// The pod may also be deleted since it was listed. Since these are
+		// expected situations, and getting logs is best effort, we log them in
+		// debug level. Other failures are recorded in the error report.
+		if apierrors.IsBadRequest(err) || apierrors.IsNotFound(err) {
+			a.log.Debugf("Cannot get log for \"%s/%s\": %v", container, which, err)
+		} else {
+			a.log.Warnf("Cannot get log for \"%s/%s\": %v", container, which, err)
+			a.addLogError(container, opts, err)
+		}
 		return
 	}
 
@@ -119,9 +197,17 @@ func (a *LogsAddon) gatherContainerLog(container *containerInfo, opts *corev1.Po
 
 	defer dst.Close()
 
-	n, err := io.Copy(dst, src)
+	reader := newLimitedReader(src, a.Options().logLimiter)
+
+	var n int64
+	if until := a.Options().Until; !until.IsZero() {
+		n, err = copyLogUntil(dst, reader, until)
+	} else {
+		n, err = io.Copy(dst, reader)
+	}
 	if err != nil {
 		a.log.Warnf("Cannot copy \"%s/%s.log\": %s", container, which, err)
+		a.addLogError(container, opts, err)
 	}
 
 	elapsed := time.Since(start).Seconds()
@@ -130,10 +216,26 @@ func (a *LogsAddon) gatherContainerLog(container *containerInfo, opts *corev1.Po
 		container, which, elapsed, rate)
 }
 
+// addLogError records a failure to get a container log, and retries getting
+// the log when the gather completes.
+func (a *LogsAddon) addLogError(container *containerInfo, opts *corev1.PodLogOptions, err error) {
+	name := container.Pod + "/" + container.Name
+	a.AddError(podLogsResource, container.Namespace, name, LogFailed, err)
+
+	retryOpts := *opts
+	a.Retry(podLogsResource, container.Namespace, name, err, func(ctx context.Context) error {
+		a.gatherContainerLog(ctx, container, &retryOpts)
+		return nil
+	})
+}
+
 func (a *LogsAddon) listContainers(pod *unstructured.Unstructured) ([]*containerInfo, error) {
 	var result []*containerInfo
 
-	for _, key := range []string{"containerStatuses", "initContainerStatuses"} {
+	node, _, _ := unstructured.NestedString(pod.Object, "spec", "nodeName")
+
+	for _, statusKey := range containerStatusKeys {
+		key := statusKey.Key
 		statuses, found, err := unstructured.NestedSlice(pod.Object, "status", key)
 		if err != nil {
 			a.log.Warnf("Cannot get %q for pod \"%s/%s\": %s",
@@ -163,8 +265,11 @@ func (a *LogsAddon) listContainers(pod *unstructured.Unstructured) ([]*container
 			result = append(result, &containerInfo{
 				Namespace:      pod.GetNamespace(),
 				Pod:            pod.GetName(),
+				Node:           node,
 				Name:           name,
+				Type:           statusKey.Type,
 				HasPreviousLog: containerHasPreviousLog(status),
+				Status:         status,
 			})
 		}
 	}
@@ -172,6 +277,27 @@ func (a *LogsAddon) listContainers(pod *unstructured.Unstructured) ([]*container
 	return result, nil
 }
 
+// sortContainers sorts containers in startup order, and sets the container
+// type using the containers summary, reporting sidecars.
+func sortContainers(containers []*containerInfo, summary []ContainerSummary) {
+	order := map[string]int{}
+	for _, s := range summary {
+		order[s.Name] = s.Order
+	}
+
+	for _, c := range containers {
+		if i, ok := order[c.Name]; ok {
+			c.Type = summary[i-1].Type
+		} else {
+			order[c.Name] = len(summary) + 1
+		}
+	}
+
+	slices.SortStableFunc(containers, func(a, b *containerInfo) int {
+		return order[a.Name] - order[b.Name]
+	})
+}
+
 // containerHasPreviousLog returns true if we can get a previous log for a
 // container, based on container status.
 //
@@ -188,3 +314,261 @@ func containerHasPreviousLog(status map[string]interface{}) bool {
 
 	return containerID != ""
 }
+
+// writeContainersSummary writes the state, restart count and exit codes of
+// all pod containers to containers.txt in the pod directory.
+func (a *LogsAddon) writeContainersSummary(pod *unstructured.Unstructured, containers []*containerInfo) {
+	if len(containers) == 0 {
+		return
+	}
+
+	dst, err := a.Output().CreatePodFile(pod.GetNamespace(), pod.GetName(), containersName)
+	if err != nil {
+		a.log.Warnf("Cannot create \"%s/%s/%s\": %s",
+			pod.GetNamespace(), pod.GetName(), containersName, err)
+		return
+	}
+
+	defer dst.Close()
+
+	tw := tabwriter.NewWriter(dst, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tREADY\tRESTARTS\tSTATE\tREASON\tEXIT CODE\tLAST STATE\tLAST REASON\tLAST EXIT CODE")
+
+	for _, c := range containers {
+		ready, _, _ := unstructured.NestedBool(c.Status, "ready")
+		restarts, _, _ := unstructured.NestedInt64(c.Status, "restartCount")
+		state, reason, exitCode := containerState(c.Status, "state")
+		lastState, lastReason, lastExitCode := containerState(c.Status, "lastState")
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			c.Name, c.Type, ready, restarts, state, reason, exitCode, lastState, lastReason, lastExitCode)
+	}
+
+	if err := tw.Flush(); err != nil {
+		a.log.Warnf("Cannot write \"%s/%s/%s\": %s",
+			pod.GetNamespace(), pod.GetName(), containersName, err)
+	}
+}
+
+// writeContainersYAML writes the containers summary to containers.yaml in the
+// pod directory, so readers can reconstruct the containers startup order
+// without reading the pod.
+func (a *LogsAddon) writeContainersYAML(pod *unstructured.Unstructured, summary []ContainerSummary) {
+	if len(summary) == 0 {
+		return
+	}
+
+	data, err := yaml.Marshal(summary)
+	if err != nil {
+		a.log.Warnf("Cannot encode %q: %s", containersYAMLName, err)
+		return
+	}
+
+	dst, err := a.Output().CreatePodFile(pod.GetNamespace(), pod.GetName(), containersYAMLName)
+	if err != nil {
+		a.log.Warnf("Cannot create \"%s/%s/%s\": %s",
+			pod.GetNamespace(), pod.GetName(), containersYAMLName, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if _, err := dst.Write(data); err != nil {
+		a.log.Warnf("Cannot write \"%s/%s/%s\": %s",
+			pod.GetNamespace(), pod.GetName(), containersYAMLName, err)
+	}
+}
+
+// writeTermination writes the termination details of a terminated container
+// to termination.txt in the container directory. The termination message is
+// often the only clue when the logs were rotated away.
+func (a *LogsAddon) writeTermination(container *containerInfo) {
+	report := terminationReport(container.Status)
+	if report == "" {
+		return
+	}
+
+	dst, err := a.Output().CreateContainerFile(container.Namespace, container.Pod, container.Name, terminationName)
+	if err != nil {
+		a.log.Warnf("Cannot create \"%s/%s\": %s", container, terminationName, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if _, err := io.WriteString(dst, report); err != nil {
+		a.log.Warnf("Cannot write \"%s/%s\": %s", container, terminationName, err)
+	}
+}
+
+// terminationReport returns the terminated state details in the container
+// status state and last state, or an empty string if the container did not
+// terminate:
+//
+//	Last State:   terminated
+//	  Reason:     Error
+//	  Exit Code:  1
+//	  Started:    2024-06-01T10:00:00Z
+//	  Finished:   2024-06-01T10:00:05Z
+//	  Message:
+//	    panic: cannot connect to database
+func terminationReport(status map[string]interface{}) string {
+	var b strings.Builder
+
+	for _, state := range []struct {
+		Field string
+		Title string
+	}{
+		{"state", "State"},
+		{"lastState", "Last State"},
+	} {
+		terminated, found, _ := unstructured.NestedMap(status, state.Field, "terminated")
+		if !found {
+			continue
+		}
+
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+
+		fmt.Fprintf(&b, "%-14s%s\n", state.Title+":", "terminated")
+
+		field := func(name string, value string) {
+			if value != "" {
+				fmt.Fprintf(&b, "  %-12s%s\n", name+":", value)
+			}
+		}
+
+		reason, _, _ := unstructured.NestedString(terminated, "reason")
+		field("Reason", reason)
+
+		if code, found, _ := unstructured.NestedInt64(terminated, "exitCode"); found {
+			field("Exit Code", strconv.FormatInt(code, 10))
+		}
+		if signal, _, _ := unstructured.NestedInt64(terminated, "signal"); signal != 0 {
+			field("Signal", strconv.FormatInt(signal, 10))
+		}
+
+		started, _, _ := unstructured.NestedString(terminated, "startedAt")
+		field("Started", started)
+		finished, _, _ := unstructured.NestedString(terminated, "finishedAt")
+		field("Finished", finished)
+
+		if message, _, _ := unstructured.NestedString(terminated, "message"); message != "" {
+			b.WriteString("  Message:\n")
+			for _, line := range strings.Split(strings.TrimRight(message, "\n"), "\n") {
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// containerState returns the state name, reason and exit code in container
+// status field (e.g. "state" or "lastState"). Missing values are returned as
+// "-".
+func containerState(status map[string]interface{}, field string) (string, string, string) {
+	states, _, _ := unstructured.NestedMap(status, field)
+	for _, name := range []string{"running", "waiting", "terminated"} {
+		state, ok := states[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		reason, _, _ := unstructured.NestedString(state, "reason")
+		if reason == "" {
+			reason = "-"
+		}
+
+		exitCode := "-"
+		if code, found, _ := unstructured.NestedInt64(state, "exitCode"); found {
+			exitCode = strconv.FormatInt(code, 10)
+		}
+
+		return name, reason, exitCode
+	}
+
+	return "-", "-", "-"
+}
+
+// logsAddonGathers returns true if the logs addon gathers the logs of pods in
+// namespace. Addons gathering pods outside of the gathered namespaces use it
+// to avoid gathering the same logs twice.
+func logsAddonGathers(opts *Options, namespace string) bool {
+	return addonEnabled(logsName, opts) &&
+		(len(opts.Namespaces) == 0 || slices.Contains(opts.Namespaces, namespace)) &&
+		len(opts.Resources) == 0
+}
+
+// gatherPodLogs gathers the current log of all pod containers.
+func gatherPodLogs(ctx context.Context, backend AddonBackend, client *kubernetes.Clientset, log *zap.SugaredLogger, pod *corev1.Pod) {
+	for _, container := range pod.Spec.Containers {
+		opts := corev1.PodLogOptions{Container: container.Name}
+		if since := backend.Options().Since; !since.IsZero() {
+			opts.SinceTime = &metav1.Time{Time: since}
+		}
+
+		name := pod.Namespace + "/" + pod.Name + "/" + container.Name
+
+		src, err := client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &opts).Stream(ctx)
+		if err != nil {
+			log.Warnf("Cannot get log for %q: %s", name, err)
+			continue
+		}
+
+		dst, err := backend.Output().CreateContainerLog(pod.Namespace, pod.Name, container.Name, "current")
+		if err != nil {
+			log.Warnf("Cannot create \"%s/current.log\": %s", name, err)
+			src.Close()
+			continue
+		}
+
+		if _, err := io.Copy(dst, newLimitedReader(src, backend.Options().logLimiter)); err != nil {
+			log.Warnf("Cannot copy \"%s/current.log\": %s", name, err)
+		}
+
+		dst.Close()
+		src.Close()
+	}
+}
+
+// nodeLimiter limits the number of concurrent log streams from every node.
+// Logs are streamed by the node kubelet, which throttles and slows down all
+// streams when too many streams hit the same node.
+type nodeLimiter struct {
+	limit int
+	mutex sync.Mutex
+	nodes map[string]chan struct{}
+}
+
+// newNodeLimiter returns a limiter allowing limit streams per node, or nil if
+// streams are not limited.
+func newNodeLimiter(limit int) *nodeLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &nodeLimiter{limit: limit, nodes: map[string]chan struct{}{}}
+}
+
+// Acquire blocks until a stream from node is allowed, and returns a function
+// releasing the stream. Streams from unknown nodes are not limited.
+func (l *nodeLimiter) Acquire(node string) func() {
+	if l == nil || node == "" {
+		return func() {}
+	}
+
+	l.mutex.Lock()
+	sem, ok := l.nodes[node]
+	if !ok {
+		sem = make(chan struct{}, l.limit)
+		l.nodes[node] = sem
+	}
+	l.mutex.Unlock()
+
+	// Blocks this worker until other streams from node are done, but other
+	// workers continue to run other work.
+	sem <- struct{}{}
+	return func() {
+		<-sem
+	}
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNodeLimiter(t *testing.T) {
+	if l := newNodeLimiter(0); l != nil {
+		t.Fatalf("expected unlimited limiter, got %+v", l)
+	}
+
+	l := newNodeLimiter(1)
+	release := l.Acquire("node1")
+
+	// Other nodes and unknown nodes are not limited.
+	l.Acquire("node2")()
+	l.Acquire("")()
+
+	acquired := make(chan struct{})
+	go func() {
+		defer l.Acquire("node1")()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired node1 stream while another stream is running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout acquiring node1 stream")
+	}
+}
+
+func TestTerminationReport(t *testing.T) {
+	status := map[string]any{
+		"name": "server",
+		"state": map[string]any{
+			"terminated": map[string]any{
+				"reason":     "OOMKilled",
+				"exitCode":   int64(137),
+				"startedAt":  "2024-06-01T10:00:10Z",
+				"finishedAt": "2024-06-01T10:01:00Z",
+			},
+		},
+		"lastState": map[string]any{
+			"terminated": map[string]any{
+				"reason":     "Error",
+				"exitCode":   int64(1),
+				"startedAt":  "2024-06-01T10:00:00Z",
+				"finishedAt": "2024-06-01T10:00:05Z",
+				"message":    "panic: cannot connect to database\ngoroutine 1 [running]:\n",
+			},
+		},
+	}
+
+	expected := `State:        terminated
+  Reason:     OOMKilled
+  Exit Code:  137
+  Started:    2024-06-01T10:00:10Z
+  Finished:   2024-06-01T10:01:00Z
+
+Last State:   terminated
+  Reason:     Error
+  Exit Code:  1
+  Started:    2024-06-01T10:00:00Z
+  Finished:   2024-06-01T10:00:05Z
+  Message:
+    panic: cannot connect to database
+    goroutine 1 [running]:
+`
+	if report := terminationReport(status); report != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, report)
+	}
+
+	running := map[string]any{
+		"name":  "server",
+		"state": map[string]any{"running": map[string]any{"startedAt": "2024-06-01T10:00:00Z"}},
+	}
+	if report := terminationReport(running); report != "" {
+		t.Errorf("expected empty report, got:\n%s", report)
+	}
+}
@@ -0,0 +1,343 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/printers"
+)
+
+// Resources created by the cluster, not exported as manifests.
+var generatedResources = []string{
+	"events",
+	"events.k8s.io/events",
+	"endpoints",
+	"discovery.k8s.io/endpointslices",
+	"coordination.k8s.io/leases",
+	"metrics.k8s.io/pods",
+}
+
+// Resources exported first, so objects are created after the objects they
+// depend on. Other resources are exported in resource order.
+var manifestsOrder = []string{
+	"namespaces",
+	"resourcequotas",
+	"limitranges",
+	"serviceaccounts",
+	"secrets",
+	"configmaps",
+	"persistentvolumeclaims",
+	"rbac.authorization.k8s.io/roles",
+	"rbac.authorization.k8s.io/rolebindings",
+	"services",
+}
+
+// Metadata fields assigned by the cluster.
+var clusterMetadataFields = []string{
+	"uid",
+	"resourceVersion",
+	"generation",
+	"creationTimestamp",
+	"deletionTimestamp",
+	"deletionGracePeriodSeconds",
+	"managedFields",
+	"selfLink",
+	"ownerReferences",
+}
+
+// Annotations added by controllers, invalid on another cluster.
+var clusterAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"deployment.kubernetes.io/revision",
+	"pv.kubernetes.io/bind-completed",
+	"pv.kubernetes.io/bound-by-controller",
+	"volume.beta.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/selected-node",
+	"openshift.io/sa.scc.mcs",
+	"openshift.io/sa.scc.supplemental-groups",
+	"openshift.io/sa.scc.uid-range",
+}
+
+// Labels added by the job controller, matching the job uid.
+var jobControllerLabels = []string{
+	"controller-uid",
+	"batch.kubernetes.io/controller-uid",
+}
+
+// ExportManifests writes the resources gathered in namespace as multi
+// document YAML, cleaned from status and cluster specific fields, so they can
+// be applied to another cluster with "kubectl apply". Resources created by
+// controllers (e.g. pods owned by a replica set) and by the cluster (e.g.
+// events) are not exported. If cluster is empty, the namespace must be
+// gathered in a single cluster. Returns the number of exported resources.
+func ExportManifests(directory string, cluster string, namespace string, w io.Writer) (int, error) {
+	clusterDir, err := findNamespaceCluster(directory, cluster, namespace)
+	if err != nil {
+		return 0, err
+	}
+
+	manifests, err := namespaceManifests(clusterDir, namespace)
+	if err != nil {
+		return 0, err
+	}
+
+	printer := printers.YAMLPrinter{}
+
+	for _, m := range manifests {
+		if err := printer.PrintObj(m.Object, w); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(manifests), nil
+}
+
+// manifest is a cleaned resource that can be applied to another cluster.
+type manifest struct {
+	Resource schema.GroupVersionResource
+	Object   *unstructured.Unstructured
+}
+
+// namespaceManifests returns the cleaned manifests of the namespace and the
+// resources in the namespace gathered in clusterDir, in apply order.
+func namespaceManifests(clusterDir string, namespace string) ([]manifest, error) {
+	entries, err := ReadIndex(clusterDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []manifest
+
+	for _, entry := range manifestEntries(entries, namespace) {
+		m, err := readManifest(clusterDir, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		if !exportedManifest(m.Object) {
+			continue
+		}
+
+		cleanManifest(m.Object)
+		manifests = append(manifests, m)
+	}
+
+	return manifests, nil
+}
+
+// readManifest reads the resource described by entry, using the resource
+// version in the object. Binary values stored in external files are restored.
+func readManifest(clusterDir string, entry IndexEntry) (manifest, error) {
+	item, err := ReadResource(clusterDir, entry)
+	if err != nil {
+		return manifest{}, err
+	}
+
+	if err := restoreBinaryFields(clusterDir, entry, item); err != nil {
+		return manifest{}, err
+	}
+
+	gv, err := schema.ParseGroupVersion(item.GetAPIVersion())
+	if err != nil {
+		return manifest{}, fmt.Errorf("invalid resource %q: %s", entry.Path, err)
+	}
+
+	_, resource, found := strings.Cut(entry.Resource, "/")
+	if !found {
+		resource = entry.Resource
+	}
+
+	return manifest{Resource: gv.WithResource(resource), Object: item}, nil
+}
+
+// findNamespaceCluster returns the cluster directory gathering namespace.
+func findNamespaceCluster(directory string, cluster string, namespace string) (string, error) {
+	clusterDirs, err := FindClusterDirs(directory)
+	if err != nil {
+		return "", err
+	}
+
+	var found []string
+
+	for _, dir := range clusterDirs {
+		name, err := filepath.Rel(directory, dir)
+		if err != nil {
+			return "", err
+		}
+
+		if cluster != "" && name != cluster {
+			continue
+		}
+
+		entries, err := ReadIndex(dir)
+		if err != nil {
+			return "", err
+		}
+
+		if slices.ContainsFunc(entries, func(e IndexEntry) bool { return e.Namespace == namespace }) {
+			found = append(found, name)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		if cluster != "" {
+			return "", fmt.Errorf("namespace %q not found in cluster %q", namespace, cluster)
+		}
+		return "", fmt.Errorf("namespace %q not found in %q", namespace, directory)
+	case 1:
+		return filepath.Join(directory, found[0]), nil
+	default:
+		return "", fmt.Errorf("namespace %q found in multiple clusters (%s), specify the cluster",
+			namespace, strings.Join(found, ", "))
+	}
+}
+
+// manifestEntries returns the index entries of the namespace and the
+// resources in the namespace, sorted in apply order. When gathering all
+// versions, only the first version of a resource is included.
+func manifestEntries(entries []IndexEntry, namespace string) []IndexEntry {
+	var result []IndexEntry
+	seen := map[string]struct{}{}
+
+	for _, entry := range entries {
+		switch {
+		case entry.Resource == "namespaces" && entry.Name == namespace:
+		case entry.Namespace == namespace && !slices.Contains(generatedResources, entry.Resource):
+		default:
+			continue
+		}
+
+		key := entry.Resource + "/" + entry.Name
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		result = append(result, entry)
+	}
+
+	slices.SortStableFunc(result, func(a, b IndexEntry) int {
+		if n := manifestOrder(a.Resource) - manifestOrder(b.Resource); n != 0 {
+			return n
+		}
+		if n := strings.Compare(a.Resource, b.Resource); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return result
+}
+
+func manifestOrder(resource string) int {
+	if i := slices.Index(manifestsOrder, resource); i != -1 {
+		return i
+	}
+	return len(manifestsOrder)
+}
+
+// exportedManifest returns true if item should be exported. Objects managed
+// by a controller are created by the controller on the other cluster, and
+// objects created automatically in every namespace already exist.
+func exportedManifest(item *unstructured.Unstructured) bool {
+	for _, ref := range item.GetOwnerReferences() {
+		if ref.Controller != nil && *ref.Controller {
+			return false
+		}
+	}
+
+	switch item.GetKind() {
+	case "Secret":
+		kind, _, _ := unstructured.NestedString(item.Object, "type")
+		return kind != "kubernetes.io/service-account-token"
+	case "ConfigMap":
+		return item.GetName() != "kube-root-ca.crt" && item.GetName() != "openshift-service-ca.crt"
+	}
+
+	return true
+}
+
+// cleanManifest removes the status, the fields assigned by the cluster,
+// which are invalid or conflict with existing objects on another cluster, and
+// the annotations added when gathering.
+func cleanManifest(item *unstructured.Unstructured) {
+	delete(item.Object, "status")
+
+	for _, field := range clusterMetadataFields {
+		unstructured.RemoveNestedField(item.Object, "metadata", field)
+	}
+
+	if annotations := item.GetAnnotations(); annotations != nil {
+		for _, name := range clusterAnnotations {
+			delete(annotations, name)
+		}
+		for name := range annotations {
+			if strings.HasPrefix(name, gatherAnnotationsPrefix) {
+				delete(annotations, name)
+			}
+		}
+		if len(annotations) == 0 {
+			annotations = nil
+		}
+		item.SetAnnotations(annotations)
+	}
+
+	switch item.GetKind() {
+	case "Service":
+		cleanService(item)
+	case "PersistentVolumeClaim":
+		// Bind to a new volume on the other cluster.
+		unstructured.RemoveNestedField(item.Object, "spec", "volumeName")
+	case "Pod":
+		unstructured.RemoveNestedField(item.Object, "spec", "nodeName")
+	case "Job":
+		cleanJob(item)
+	}
+}
+
+// cleanService removes the allocated cluster IPs and node ports. Headless
+// services are kept as is.
+func cleanService(item *unstructured.Unstructured) {
+	if ip, _, _ := unstructured.NestedString(item.Object, "spec", "clusterIP"); ip != "None" {
+		unstructured.RemoveNestedField(item.Object, "spec", "clusterIP")
+		unstructured.RemoveNestedField(item.Object, "spec", "clusterIPs")
+	}
+
+	unstructured.RemoveNestedField(item.Object, "spec", "healthCheckNodePort")
+
+	ports, found, _ := unstructured.NestedSlice(item.Object, "spec", "ports")
+	if !found {
+		return
+	}
+	for _, port := range ports {
+		if p, ok := port.(map[string]any); ok {
+			delete(p, "nodePort")
+		}
+	}
+	_ = unstructured.SetNestedSlice(item.Object, ports, "spec", "ports")
+}
+
+// cleanJob removes the selector and labels generated by the job controller,
+// matching the job uid on this cluster.
+func cleanJob(item *unstructured.Unstructured) {
+	if manual, _, _ := unstructured.NestedBool(item.Object, "spec", "manualSelector"); manual {
+		return
+	}
+
+	unstructured.RemoveNestedField(item.Object, "spec", "selector")
+
+	for _, name := range jobControllerLabels {
+		unstructured.RemoveNestedField(item.Object, "metadata", "labels", name)
+		unstructured.RemoveNestedField(item.Object, "spec", "template", "metadata", "labels", name)
+	}
+}
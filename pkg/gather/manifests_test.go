@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bytes"
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestExportManifests(t *testing.T) {
+	dir := t.TempDir()
+	output := NewOutputDirectory(filepath.Join(dir, "cluster1"))
+	idx := &index{}
+	var written atomic.Int64
+	w := &resourceWriter{output: output, index: idx, written: &written}
+
+	dump := func(r resourceInfo, obj map[string]any) {
+		if err := w.Dump(&r, &unstructured.Unstructured{Object: obj}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	coreResource := func(resource string, kind string) resourceInfo {
+		return resourceInfo{
+			GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: resource},
+			Kind:                 kind,
+			Namespaced:           resource != "namespaces",
+		}
+	}
+	metadata := func(name string) map[string]any {
+		return map[string]any{
+			"name":              name,
+			"namespace":         "myapp",
+			"uid":               "0b2a3c4d-0000-0000-0000-000000000000",
+			"resourceVersion":   "1234",
+			"creationTimestamp": "2024-06-01T10:20:30Z",
+		}
+	}
+
+	dump(coreResource("namespaces", "Namespace"), map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   map[string]any{"name": "myapp", "uid": "0b2a3c4d-0000-0000-0000-000000000001"},
+		"status":     map[string]any{"phase": "Active"},
+	})
+	dump(coreResource("services", "Service"), map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   metadata("web"),
+		"spec": map[string]any{
+			"type":       "NodePort",
+			"clusterIP":  "10.96.0.10",
+			"clusterIPs": []any{"10.96.0.10"},
+			"ports":      []any{map[string]any{"port": int64(80), "nodePort": int64(30080)}},
+		},
+	})
+	dump(coreResource("configmaps", "ConfigMap"), map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   metadata("config"),
+		"data":       map[string]any{"key": "value"},
+	})
+	dump(coreResource("configmaps", "ConfigMap"), map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   metadata("kube-root-ca.crt"),
+	})
+	owned := metadata("web-1")
+	owned["ownerReferences"] = []any{
+		map[string]any{"apiVersion": "apps/v1", "kind": "ReplicaSet", "name": "web", "uid": "1", "controller": true},
+	}
+	dump(coreResource("pods", "Pod"), map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   owned,
+	})
+	dump(coreResource("events", "Event"), map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Event",
+		"metadata":   metadata("web.17d8a3b1c2e4f5a6"),
+	})
+	if err := idx.Write(output); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	count, err := ExportManifests(dir, "", "myapp", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 resources, got %d", count)
+	}
+
+	expected := `apiVersion: v1
+kind: Namespace
+metadata:
+  name: myapp
+---
+apiVersion: v1
+data:
+  key: value
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: myapp
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: myapp
+spec:
+  ports:
+  - port: 80
+  type: NodePort
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	if _, err := ExportManifests(dir, "", "other", &buf); err == nil {
+		t.Error("exporting missing namespace did not fail")
+	}
+}
+
+func TestExportManifestsBinaryFields(t *testing.T) {
+	configMaps := resourceInfo{
+		GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		Kind:                 "ConfigMap",
+		Namespaced:           true,
+	}
+	namespaces := resourceInfo{
+		GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: "namespaces"},
+		Kind:                 "Namespace",
+	}
+
+	large := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xff}, 2048))
+
+	for _, mode := range []string{BinaryFieldsOmit, BinaryFieldsExternal} {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			output := NewOutputDirectory(filepath.Join(dir, "cluster1"))
+			idx := &index{}
+			var written atomic.Int64
+			w := &resourceWriter{
+				output:                output,
+				index:                 idx,
+				written:               &written,
+				binaryFields:          mode,
+				binaryFieldsThreshold: 1024,
+			}
+
+			if err := w.Dump(&namespaces, &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "Namespace",
+				"metadata":   map[string]any{"name": "myapp"},
+			}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Dump(&configMaps, &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]any{"name": "firmware", "namespace": "myapp"},
+				"binaryData": map[string]any{"large.bin": large},
+			}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := idx.Write(output); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			_, err := ExportManifests(dir, "", "myapp", &buf)
+
+			if mode == BinaryFieldsOmit {
+				if err == nil {
+					t.Fatal("exporting omitted binary values did not fail")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), "large.bin: "+large) {
+				t.Errorf("binary value not restored:\n%s", buf.String())
+			}
+			if strings.Contains(buf.String(), "kubectl-gather/") {
+				t.Errorf("gather annotations not removed:\n%s", buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import "sync"
+
+// byteLimiter limits the approximate memory used by objects held by workers.
+// When the limit is exceeded, workers block until other workers release
+// memory. A nil limiter does not limit anything.
+type byteLimiter struct {
+	max   int64
+	used  int64
+	mutex sync.Mutex
+	cond  *sync.Cond
+}
+
+func newByteLimiter(max int64) *byteLimiter {
+	if max <= 0 {
+		return nil
+	}
+	l := &byteLimiter{max: max}
+	l.cond = sync.NewCond(&l.mutex)
+	return l
+}
+
+// Acquire blocks until n bytes are available. An object larger than the limit
+// is allowed when no other object is held, so we never block forever.
+func (l *byteLimiter) Acquire(n int64) {
+	if l == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for l.used > 0 && l.used+n > l.max {
+		l.cond.Wait()
+	}
+
+	l.used += n
+}
+
+func (l *byteLimiter) Release(n int64) {
+	if l == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.used -= n
+	l.cond.Broadcast()
+}
@@ -0,0 +1,189 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	metadataName = "metadata.json"
+)
+
+// Reasons for skipping resources by design.
+const (
+	// The resource does not support the list verb.
+	SkipNotListable = "NotListable"
+
+	// Cluster scoped resource skipped when gathering specific namespaces.
+	SkipClusterScoped = "ClusterScoped"
+
+	// packages.operators.coreos.com/packagemanifests returns the same items
+	// for every namespace.
+	SkipPackageManifests = "PackageManifestsPerNamespace"
+
+	// Core "events" are gathered as "events.k8s.io/events".
+	SkipDuplicateEvents = "DuplicateEvents"
+
+	// The resource is deprecated.
+	SkipDeprecated = "Deprecated"
+
+	// The resource was not selected by the resource command.
+	SkipNotSelected = "NotSelected"
+
+	// Cluster scoped resource excluded by the cluster resources option.
+	SkipClusterResourceExcluded = "ClusterResourceExcluded"
+)
+
+// SkippedResource describes a resource that was not gathered by design. Failed
+// resources are reported in errors.yaml.
+type SkippedResource struct {
+	Resource string `json:"resource"`
+	Version  string `json:"version"`
+	Reason   string `json:"reason"`
+}
+
+// Metadata describes a cluster gather. It is written to metadata.json in the
+// cluster directory, so consumers can tell how the data was gathered and if
+// the data is complete.
+type Metadata struct {
+	// Time when gathering started. Empty in a deterministic gather.
+	StartTime *time.Time `json:"startTime,omitempty"`
+
+	// Time when gathering ended. Empty if gathering was interrupted before
+	// in-flight work was completed, or in a deterministic gather.
+	EndTime *time.Time `json:"endTime,omitempty"`
+
+	// Deterministic is true if the gather does not record times and
+	// durations, so gathering an idle cluster twice produces identical
+	// files.
+	Deterministic bool `json:"deterministic,omitempty"`
+
+	// Number of gathered resources, including resources gathered by previous
+	// gathers when appending.
+	Count int `json:"count"`
+
+	// Addons used by this gather and previous gathers when appending.
+	Addons []string `json:"addons,omitempty"`
+
+	// Interrupted is true if gathering was interrupted by a signal. The data
+	// is partial.
+	Interrupted bool `json:"interrupted"`
+
+	// Partial is true if some data could not be gathered. Failures are
+	// recorded in errors.yaml.
+	Partial bool `json:"partial,omitempty"`
+
+	// Resources that could not be gathered in all namespaces, or cluster
+	// scoped resources.
+	FailedResources []string `json:"failedResources,omitempty"`
+
+	// Namespaces with data that could not be gathered.
+	PartialNamespaces []PartialNamespace `json:"partialNamespaces,omitempty"`
+
+	// Resources not gathered by design.
+	SkippedResources []SkippedResource `json:"skippedResources,omitempty"`
+
+	// Resources with more items in a namespace than the max per resource
+	// limit. Only the newest items were gathered.
+	TruncatedResources []TruncatedResource `json:"truncatedResources,omitempty"`
+}
+
+func (g *Gatherer) writeMetadata(done bool) {
+	// Called from the signal handler when interrupted, concurrently with
+	// the end of the gather.
+	g.metadataMutex.Lock()
+	defer g.metadataMutex.Unlock()
+
+	g.mutex.Lock()
+	metadata := Metadata{
+		Count:         len(g.resources) + len(g.previous),
+		Addons:        g.usedAddons(),
+		Interrupted:   g.interrupted,
+		Deterministic: g.opts.Deterministic,
+	}
+	if !g.opts.Deterministic {
+		startTime := g.startTime
+		metadata.StartTime = &startTime
+	}
+	metadata.SkippedResources = slices.Clone(g.skippedResources)
+	metadata.TruncatedResources = slices.Clone(g.truncatedResources)
+	g.mutex.Unlock()
+
+	failed := failedResources(g.allErrors())
+	metadata.Partial = len(failed) > 0
+	metadata.FailedResources = failed[""]
+	metadata.PartialNamespaces = partialNamespaces(failed)
+
+	if done && !g.opts.Deterministic {
+		now := time.Now()
+		metadata.EndTime = &now
+	}
+
+	data, err := json.MarshalIndent(&metadata, "", "  ")
+	if err != nil {
+		g.log.Warnf("Cannot encode %q: %s", metadataName, err)
+		return
+	}
+
+	dst, err := g.output.CreateFile(metadataName)
+	if err != nil {
+		g.log.Warnf("Cannot create %q: %s", metadataName, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if _, err := dst.Write(append(data, '\n')); err != nil {
+		g.log.Warnf("Cannot write %q: %s", metadataName, err)
+	}
+}
+
+// usedAddons returns the names of the addons used by this gather and
+// previous gathers.
+func (g *Gatherer) usedAddons() []string {
+	names := slices.Clone(g.previousAddons)
+	for _, addons := range g.addons {
+		for _, addon := range addons {
+			if !slices.Contains(names, addon.Name) {
+				names = append(names, addon.Name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (g *Gatherer) addSkippedResource(gv schema.GroupVersion, res *metav1.APIResource, reason string) {
+	r := resourceInfo{GroupVersionResource: gv.WithResource(res.Name)}
+	skipped := SkippedResource{
+		Resource: r.Name(),
+		Version:  gv.Version,
+		Reason:   reason,
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// When appending, the resource may be skipped by a previous gather.
+	i, found := slices.BinarySearchFunc(g.skippedResources, skipped, compareSkippedResources)
+	if found {
+		g.skippedResources[i] = skipped
+		return
+	}
+	g.skippedResources = slices.Insert(g.skippedResources, i, skipped)
+}
+
+func compareSkippedResources(a, b SkippedResource) int {
+	if c := strings.Compare(a.Resource, b.Resource); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Version, b.Version)
+}
@@ -0,0 +1,460 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	metallbName             = "metallb"
+	loadBalancersReportName = "loadbalancers.txt"
+	bgpSessionsReportName   = "bgp-sessions.txt"
+
+	// Speaker container running FRR in FRR and FRR-K8s modes.
+	frrContainerName = "frr"
+
+	// Timeout for vtysh commands.
+	metallbCommandTimeout = 60 * time.Second
+)
+
+var (
+	serviceL2StatusesResource = schema.GroupVersionResource{Group: "metallb.io", Version: "v1beta1", Resource: "servicel2statuses"}
+	bgpSessionStatesResource  = schema.GroupVersionResource{Group: "metallb.io", Version: "v1beta1", Resource: "bgpsessionstates"}
+
+	// Annotations selecting the address pool and the IPs of a service. MetalLB
+	// supports both the legacy and the current prefix.
+	metallbPoolAnnotations      = []string{"metallb.io/address-pool", "metallb.universe.tf/address-pool"}
+	metallbAllocatedAnnotations = []string{"metallb.io/ip-allocated-from-pool", "metallb.universe.tf/ip-allocated-from-pool"}
+	metallbIPsAnnotations       = []string{"metallb.io/loadBalancerIPs", "metallb.universe.tf/loadBalancerIPs"}
+
+	// FRR commands run in speaker pods using BGP.
+	frrCommands = [][]string{
+		{"vtysh", "-c", "show running-config"},
+		{"vtysh", "-c", "show bgp summary"},
+		{"vtysh", "-c", "show bgp neighbor"},
+		{"vtysh", "-c", "show bfd peers"},
+	}
+)
+
+// loadBalancerService describes the address assignment of a service of type
+// LoadBalancer.
+type loadBalancerService struct {
+	Namespace string
+	Name      string
+
+	// Pool requested by the user, or the pool allocating the IPs.
+	Pool string
+
+	// IPs requested by the user.
+	Requested []string
+
+	// IPs or hostnames assigned to the service.
+	Assigned []string
+
+	// Nodes announcing the service in layer 2 mode.
+	AnnouncedBy []string
+}
+
+// bgpSession describes a BGP session of a speaker with a peer.
+type bgpSession struct {
+	Node   string
+	Peer   string
+	VRF    string
+	BGP    string
+	BFD    string
+	Object string
+}
+
+// MetalLBAddon records the MetalLB speaker and controller pods, the BGP state
+// of the speakers, and the addresses assigned to services of type
+// LoadBalancer, for debugging services unreachable on bare metal clusters.
+type MetalLBAddon struct {
+	AddonBackend
+	client  *kubernetes.Clientset
+	dynamic dynamic.Interface
+	log     *zap.SugaredLogger
+
+	mutex      sync.Mutex
+	namespaces map[string]struct{}
+}
+
+func init() {
+	registerAddon(metallbName, addonInfo{
+		Resources: []string{"metallb.io/ipaddresspools"},
+		AddonFunc: NewMetalLBAddon,
+		Priority:  PriorityAddons,
+	})
+}
+
+func NewMetalLBAddon(backend AddonBackend) (Addon, error) {
+	client, err := kubernetes.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	return &MetalLBAddon{
+		AddonBackend: backend,
+		client:       client,
+		dynamic:      dynamicClient,
+		log:          backend.Options().Log.Named(metallbName),
+		namespaces:   map[string]struct{}{},
+	}, nil
+}
+
+func (a *MetalLBAddon) Inspect(pool *unstructured.Unstructured) error {
+	namespace := pool.GetNamespace()
+	a.log.Debugf("Inspecting ipaddresspool \"%s/%s\"", namespace, pool.GetName())
+
+	// All pools are in the MetalLB namespace.
+	if !a.addNamespace(namespace) {
+		return nil
+	}
+
+	a.QueueNamespace(namespace, func(ctx context.Context) error {
+		a.gatherPods(ctx, namespace)
+		return nil
+	})
+
+	a.QueueNamespace(namespace, func(context.Context) error {
+		a.gatherReports(namespace)
+		return nil
+	})
+
+	return nil
+}
+
+// addNamespace returns true if namespace was not inspected yet.
+func (a *MetalLBAddon) addNamespace(namespace string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, ok := a.namespaces[namespace]; ok {
+		return false
+	}
+
+	a.namespaces[namespace] = struct{}{}
+	return true
+}
+
+// gatherPods gathers the speaker and controller pods with their logs, and
+// the FRR state of speakers using BGP.
+func (a *MetalLBAddon) gatherPods(ctx context.Context, namespace string) {
+	pods, err := a.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		a.log.Warnf("Cannot list pods in namespace %q: %s", namespace, err)
+		return
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+
+		component := metallbComponent(pod)
+		if component == "" {
+			continue
+		}
+
+		a.log.Debugf("Gathering %s pod %q", component, pod.Name)
+		a.GatherResource(podsResource, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name})
+
+		if !logsAddonGathers(a.Options(), pod.Namespace) {
+			gatherPodLogs(ctx, a, a.client, a.log, pod)
+		}
+
+		if component == "speaker" && hasContainer(pod, frrContainerName) {
+			a.gatherFRRCommands(ctx, pod)
+		}
+	}
+}
+
+// gatherFRRCommands runs the FRR commands in the speaker pod. This is the only
+// place the addon runs commands in pods, so the addon is not an agents addon
+// and gathers everything else in read only mode.
+func (a *MetalLBAddon) gatherFRRCommands(ctx context.Context, pod *corev1.Pod) {
+	if !a.Options().AgentsAllowed() {
+		a.log.Debugf("Skipping pod %q FRR commands in read only mode", pod.Name)
+		return
+	}
+
+	dir, err := a.Output().CreateNamespaceAddonDir(pod.Namespace, metallbName, pod.Name)
+	if err != nil {
+		a.log.Warnf("Cannot create metallb directory: %s", err)
+		return
+	}
+
+	rc := NewRemoteCommand(pod, a.Options(), a.log, dir).
+		InContainer(frrContainerName).
+		WithContext(ctx)
+	for _, command := range frrCommands {
+		if err := rc.GatherTimeout(metallbCommandTimeout, command...); err != nil {
+			a.log.Warnf("Error running %q in pod %q: %s", strings.Join(command, " "), pod.Name, err)
+		}
+	}
+}
+
+// gatherReports writes the load balancer services and the BGP sessions
+// reports in the MetalLB namespace addon directory.
+func (a *MetalLBAddon) gatherReports(namespace string) {
+	services, err := a.listLoadBalancers(namespace)
+	if err != nil {
+		a.log.Warnf("Cannot list load balancer services: %s", err)
+	}
+
+	sessions, err := a.listBGPSessions(namespace)
+	if err != nil {
+		a.log.Warnf("Cannot list bgp sessions: %s", err)
+	}
+
+	if len(services) == 0 && len(sessions) == 0 {
+		return
+	}
+
+	dir, err := a.Output().CreateNamespaceAddonDir(namespace, metallbName)
+	if err != nil {
+		a.log.Warnf("Cannot create metallb directory: %s", err)
+		return
+	}
+
+	if len(services) > 0 {
+		a.writeReport(dir, loadBalancersReportName, func(w io.Writer) error {
+			return writeLoadBalancersReport(w, services)
+		})
+	}
+
+	if len(sessions) > 0 {
+		a.writeReport(dir, bgpSessionsReportName, func(w io.Writer) error {
+			return writeBGPSessionsReport(w, sessions)
+		})
+	}
+}
+
+func (a *MetalLBAddon) writeReport(dir string, name string, write func(io.Writer) error) {
+	dst, err := createFile(dir, name)
+	if err != nil {
+		a.log.Warnf("Cannot create %q: %s", name, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if err := write(dst); err != nil {
+		a.log.Warnf("Cannot write %q: %s", name, err)
+	}
+}
+
+// listLoadBalancers returns the services of type LoadBalancer in the gathered
+// namespaces, with the nodes announcing them in layer 2 mode.
+func (a *MetalLBAddon) listLoadBalancers(metallbNamespace string) ([]loadBalancerService, error) {
+	ctx := context.TODO()
+
+	namespaces := a.Options().Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	var services []loadBalancerService
+
+	for _, namespace := range namespaces {
+		list, err := a.client.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			if list.Items[i].Spec.Type == corev1.ServiceTypeLoadBalancer {
+				services = append(services, newLoadBalancerService(&list.Items[i]))
+			}
+		}
+	}
+
+	statuses, err := a.dynamic.Resource(serviceL2StatusesResource).Namespace(metallbNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		// Not available in older MetalLB versions.
+		if !apierrors.IsNotFound(err) {
+			a.log.Warnf("Cannot list service l2 statuses: %s", err)
+		}
+		return services, nil
+	}
+
+	for i := range statuses.Items {
+		status := &statuses.Items[i]
+		node, _, _ := unstructured.NestedString(status.Object, "status", "node")
+		namespace, _, _ := unstructured.NestedString(status.Object, "status", "serviceNamespace")
+		name, _, _ := unstructured.NestedString(status.Object, "status", "serviceName")
+		for j := range services {
+			s := &services[j]
+			if s.Namespace == namespace && s.Name == name && node != "" {
+				s.AnnouncedBy = append(s.AnnouncedBy, node)
+			}
+		}
+	}
+
+	return services, nil
+}
+
+// listBGPSessions returns the speakers BGP sessions. Available since MetalLB
+// 0.15 in FRR-K8s mode.
+func (a *MetalLBAddon) listBGPSessions(namespace string) ([]bgpSession, error) {
+	states, err := a.dynamic.Resource(bgpSessionStatesResource).Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var sessions []bgpSession
+	for i := range states.Items {
+		sessions = append(sessions, newBGPSession(&states.Items[i]))
+	}
+
+	return sessions, nil
+}
+
+// metallbComponent returns the MetalLB component ("speaker" or "controller")
+// of pod, or an empty string if the pod is not a MetalLB pod. MetalLB
+// manifests use the "component" label, and the helm chart uses the
+// "app.kubernetes.io/component" label.
+func metallbComponent(pod *corev1.Pod) string {
+	for _, label := range []string{"component", "app.kubernetes.io/component"} {
+		switch value := pod.Labels[label]; value {
+		case "speaker", "controller":
+			return value
+		}
+	}
+	return ""
+}
+
+func newLoadBalancerService(service *corev1.Service) loadBalancerService {
+	s := loadBalancerService{Namespace: service.Namespace, Name: service.Name}
+
+	s.Pool = firstAnnotation(service, metallbPoolAnnotations)
+	if s.Pool == "" {
+		s.Pool = firstAnnotation(service, metallbAllocatedAnnotations)
+	}
+
+	if ips := firstAnnotation(service, metallbIPsAnnotations); ips != "" {
+		s.Requested = strings.Split(ips, ",")
+	} else if service.Spec.LoadBalancerIP != "" {
+		s.Requested = []string{service.Spec.LoadBalancerIP}
+	}
+
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			s.Assigned = append(s.Assigned, ingress.IP)
+		} else if ingress.Hostname != "" {
+			s.Assigned = append(s.Assigned, ingress.Hostname)
+		}
+	}
+
+	return s
+}
+
+func firstAnnotation(service *corev1.Service, keys []string) string {
+	for _, key := range keys {
+		if value := service.Annotations[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func newBGPSession(state *unstructured.Unstructured) bgpSession {
+	session := bgpSession{Object: state.GetName()}
+	session.Node, _, _ = unstructured.NestedString(state.Object, "status", "node")
+	session.Peer, _, _ = unstructured.NestedString(state.Object, "status", "peer")
+	session.VRF, _, _ = unstructured.NestedString(state.Object, "status", "vrf")
+	session.BGP, _, _ = unstructured.NestedString(state.Object, "status", "bgpStatus")
+	session.BFD, _, _ = unstructured.NestedString(state.Object, "status", "bfdStatus")
+	return session
+}
+
+// Status returns "Pending" if no address was assigned, "Mismatch" if the
+// assigned addresses are not the requested addresses, or "Assigned".
+func (s *loadBalancerService) Status() string {
+	if len(s.Assigned) == 0 {
+		return "Pending"
+	}
+	for _, ip := range s.Requested {
+		if !slices.Contains(s.Assigned, ip) {
+			return "Mismatch"
+		}
+	}
+	return "Assigned"
+}
+
+// writeLoadBalancersReport writes the services sorted by namespace and name.
+//
+//	NAMESPACE   NAME    POOL       REQUESTED   ASSIGNED     ANNOUNCED-BY   STATUS
+//	myapp       web     frontend   -           10.0.0.100   worker-1       Assigned
+func writeLoadBalancersReport(w io.Writer, services []loadBalancerService) error {
+	slices.SortFunc(services, func(a, b loadBalancerService) int {
+		if c := strings.Compare(a.Namespace, b.Namespace); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tNAME\tPOOL\tREQUESTED\tASSIGNED\tANNOUNCED-BY\tSTATUS")
+
+	for i := range services {
+		s := &services[i]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.Namespace, s.Name, orDash(s.Pool),
+			orDash(strings.Join(s.Requested, ",")),
+			orDash(strings.Join(s.Assigned, ",")),
+			orDash(strings.Join(s.AnnouncedBy, ",")),
+			s.Status())
+	}
+
+	return tw.Flush()
+}
+
+// writeBGPSessionsReport writes the sessions sorted by node and peer.
+//
+//	NODE       PEER         VRF   BGP           BFD   NAME
+//	worker-1   10.0.0.1     -     Established   Up    worker-1-abcde
+func writeBGPSessionsReport(w io.Writer, sessions []bgpSession) error {
+	slices.SortFunc(sessions, func(a, b bgpSession) int {
+		if c := strings.Compare(a.Node, b.Node); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Peer, b.Peer); c != 0 {
+			return c
+		}
+		return strings.Compare(a.VRF, b.VRF)
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tPEER\tVRF\tBGP\tBFD\tNAME")
+
+	for _, s := range sessions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			orDash(s.Node), orDash(s.Peer), orDash(s.VRF), orDash(s.BGP), orDash(s.BFD), s.Object)
+	}
+
+	return tw.Flush()
+}
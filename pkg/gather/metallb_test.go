@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLoadBalancerService(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "myapp",
+			Annotations: map[string]string{
+				"metallb.universe.tf/ip-allocated-from-pool": "frontend",
+				"metallb.io/loadBalancerIPs":                 "10.0.0.100,10.0.0.101",
+			},
+		},
+		Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{IP: "10.0.0.100"}},
+			},
+		},
+	}
+
+	s := newLoadBalancerService(service)
+	expected := loadBalancerService{
+		Namespace: "myapp",
+		Name:      "web",
+		Pool:      "frontend",
+		Requested: []string{"10.0.0.100", "10.0.0.101"},
+		Assigned:  []string{"10.0.0.100"},
+	}
+	if !reflect.DeepEqual(s, expected) {
+		t.Errorf("expected %+v, got %+v", expected, s)
+	}
+	if s.Status() != "Mismatch" {
+		t.Errorf("expected Mismatch status, got %q", s.Status())
+	}
+
+	service.Status.LoadBalancer.Ingress = nil
+	s = newLoadBalancerService(service)
+	if s.Status() != "Pending" {
+		t.Errorf("expected Pending status, got %q", s.Status())
+	}
+}
+
+func TestMetallbComponent(t *testing.T) {
+	cases := []struct {
+		labels   map[string]string
+		expected string
+	}{
+		{map[string]string{"app": "metallb", "component": "speaker"}, "speaker"},
+		{map[string]string{"app.kubernetes.io/name": "metallb", "app.kubernetes.io/component": "controller"}, "controller"},
+		{map[string]string{"app": "metallb-operator"}, ""},
+	}
+	for _, c := range cases {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: c.labels}}
+		if got := metallbComponent(pod); got != c.expected {
+			t.Errorf("labels %v: expected %q, got %q", c.labels, c.expected, got)
+		}
+	}
+}
+
+func TestWriteLoadBalancersReport(t *testing.T) {
+	services := []loadBalancerService{
+		{Namespace: "b", Name: "pending"},
+		{Namespace: "a", Name: "web", Pool: "frontend", Assigned: []string{"10.0.0.100"}, AnnouncedBy: []string{"worker-1"}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeLoadBalancersReport(&buf, services); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got:\n%s", buf.String())
+	}
+
+	// Sorted by namespace.
+	if !strings.HasPrefix(lines[1], "a ") || !strings.HasSuffix(lines[1], "Assigned") {
+		t.Errorf("unexpected line %q", lines[1])
+	}
+	if !strings.Contains(lines[1], "worker-1") {
+		t.Errorf("expected announcing node in line %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "b ") || !strings.HasSuffix(lines[2], "Pending") {
+		t.Errorf("unexpected line %q", lines[2])
+	}
+}
+
+func TestGatherFRRCommandsReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	g, _ := newTestGathererIn(t, dir, Options{ReadOnly: true}, &fakeLister{})
+	a := &MetalLBAddon{
+		AddonBackend: newGatherBackend(g, metallbName, addonRegistry[metallbName]),
+		log:          zap.NewNop().Sugar(),
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "metallb-system", Name: "speaker-1"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: frrContainerName}}},
+	}
+	a.gatherFRRCommands(context.Background(), pod)
+
+	addonDir := filepath.Join(dir, namespacesDir, pod.Namespace, addonsDir, metallbName)
+	if _, err := os.Stat(addonDir); !os.IsNotExist(err) {
+		t.Errorf("commands gathered in read only mode: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"strings"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	mirroringName = "mirroring"
+
+	rbdDriverSuffix = "rbd.csi.ceph.com"
+)
+
+var volumeReplicationClassesResource = schema.GroupVersionResource{
+	Group:    "replication.storage.openshift.io",
+	Version:  "v1alpha1",
+	Resource: "volumereplicationclasses",
+}
+
+// mirroringAddon gathers mirroring status for replicated volumes, used for
+// debugging regional DR.
+type mirroringAddon struct {
+	AddonBackend
+	client *kubernetes.Clientset
+	log    *zap.SugaredLogger
+}
+
+func init() {
+	registerAddon(mirroringName, addonInfo{
+		Resources: []string{"replication.storage.openshift.io/volumereplications"},
+		AddonFunc: NewMirroringAddon,
+		Priority:  PriorityAddons,
+		Agents:    true,
+	})
+}
+
+func NewMirroringAddon(backend AddonBackend) (Addon, error) {
+	clientSet, err := kubernetes.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	return &mirroringAddon{
+		AddonBackend: backend,
+		client:       clientSet,
+		log:          backend.Options().Log.Named(mirroringName),
+	}, nil
+}
+
+func (a *mirroringAddon) Inspect(vr *unstructured.Unstructured) error {
+	namespace := vr.GetNamespace()
+	a.log.Debugf("Inspecting volumereplication \"%s/%s\"", namespace, vr.GetName())
+
+	// Needed only when gathering specific namespaces.
+	if len(a.Options().Namespaces) > 0 {
+		a.gatherVolumeReplicationClass(vr)
+	}
+
+	kind, _, _ := unstructured.NestedString(vr.Object, "spec", "dataSource", "kind")
+	name, _, _ := unstructured.NestedString(vr.Object, "spec", "dataSource", "name")
+	if kind != "PersistentVolumeClaim" || name == "" {
+		return nil
+	}
+
+	a.QueueNamespace(namespace, func(ctx context.Context) error {
+		a.gatherImageStatus(ctx, namespace, name)
+		return nil
+	})
+
+	return nil
+}
+
+func (a *mirroringAddon) gatherVolumeReplicationClass(vr *unstructured.Unstructured) {
+	name, _, err := unstructured.NestedString(vr.Object, "spec", "volumeReplicationClass")
+	if err != nil {
+		a.log.Warnf("Cannot get volumereplication \"%s/%s\" volumeReplicationClass: %s",
+			vr.GetNamespace(), vr.GetName(), err)
+		return
+	}
+
+	if name != "" {
+		a.GatherResource(volumeReplicationClassesResource, types.NamespacedName{Name: name})
+	}
+}
+
+// gatherImageStatus gathers the rbd mirror image status for pvc. The command
+// is run in the rook-ceph-tools pod in the ceph cluster namespace.
+func (a *mirroringAddon) gatherImageStatus(ctx context.Context, namespace string, name string) {
+	pvc, err := a.client.CoreV1().PersistentVolumeClaims(namespace).
+		Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		a.log.Warnf("Cannot get pvc \"%s/%s\": %s", namespace, name, err)
+		return
+	}
+
+	if pvc.Spec.VolumeName == "" {
+		return
+	}
+
+	pv, err := a.client.CoreV1().PersistentVolumes().
+		Get(ctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+	if err != nil {
+		a.log.Warnf("Cannot get pv %q: %s", pvc.Spec.VolumeName, err)
+		return
+	}
+
+	csi := pv.Spec.CSI
+	if csi == nil || !strings.HasSuffix(csi.Driver, rbdDriverSuffix) {
+		return
+	}
+
+	// For rook the clusterID is the ceph cluster namespace.
+	clusterNamespace := csi.VolumeAttributes["clusterID"]
+	pool := csi.VolumeAttributes["pool"]
+	image := csi.VolumeAttributes["imageName"]
+	if clusterNamespace == "" || pool == "" || image == "" {
+		a.log.Debugf("Missing rbd volume attributes in pv %q", pv.Name)
+		return
+	}
+
+	tools, err := findPod(a.client, clusterNamespace, "app=rook-ceph-tools")
+	if err != nil {
+		a.log.Warnf("Cannot find tools pod: %s", err)
+		return
+	}
+
+	dir, err := a.Output().CreateAddonDir(mirroringName, namespacesDir, namespace, name)
+	if err != nil {
+		a.log.Warnf("Cannot create pvc directory: %s", err)
+		return
+	}
+
+	rc := NewRemoteCommand(tools, a.Options(), a.log, dir).WithContext(ctx)
+	command := []string{"rbd", "mirror", "image", "status", "--pool", pool, image}
+	if err := rc.GatherTimeout(rookCommandTimeout, command...); err != nil {
+		a.log.Warnf("Error running %q: %s", strings.Join(command, " "), err)
+	}
+}
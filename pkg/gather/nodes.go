@@ -0,0 +1,276 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	nodesName = "nodes"
+
+	// The node root file system is mounted read only in the agent pod.
+	nodeHostRoot = "/host"
+
+	// Default kubelet static pods directory.
+	staticPodsDir = "/etc/kubernetes/manifests"
+
+	// Annotation set by kubelet on mirror pods.
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+	// Image name of the Ceph CSI plugins (rbd, cephfs, nfs).
+	cephCSIImage = "cephcsi"
+)
+
+// Node storage configuration files, relative to the node root. Many Ceph and
+// DR issues are caused by node level configuration drift.
+var nodeStorageFiles = []string{
+	"etc/multipath.conf",
+	"etc/multipath",
+	"etc/modprobe.d",
+	"etc/modules-load.d",
+}
+
+// Udev rules directories, relative to the node root. Only rbd and nbd rules
+// are gathered.
+var nodeUdevRulesDirs = []string{
+	"etc/udev/rules.d",
+	"usr/lib/udev/rules.d",
+	"lib/udev/rules.d",
+}
+
+// nodeCommand is a command run in the node namespaces, stored in name.
+type nodeCommand struct {
+	name    string
+	command []string
+}
+
+var nodeStorageCommands = []nodeCommand{
+	{"lsblk", []string{"lsblk", "--all", "--paths", "--output", "NAME,TYPE,SIZE,FSTYPE,MOUNTPOINT,WWN,MODEL,SERIAL"}},
+	{"lsmod", []string{"lsmod"}},
+	{"sysctl-net", []string{"sysctl", "net"}},
+}
+
+// nodePods describes the pods running on a node that require gathering node
+// data.
+type nodePods struct {
+	mirrorPods []string
+	cephCSI    bool
+}
+
+type NodesAddon struct {
+	AddonBackend
+	client *kubernetes.Clientset
+	log    *zap.SugaredLogger
+}
+
+func init() {
+	registerAddon(nodesName, addonInfo{
+		Resources: []string{"nodes"},
+		AddonFunc: NewNodesAddon,
+		Priority:  PriorityAddons,
+		Agents:    true,
+		// Avoid overwhelming the cluster with agent pods.
+		MaxConcurrency: 2,
+	})
+}
+
+func NewNodesAddon(backend AddonBackend) (Addon, error) {
+	client, err := kubernetes.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	return &NodesAddon{
+		AddonBackend: backend,
+		client:       client,
+		log:          backend.Options().Log.Named(nodesName),
+	}, nil
+}
+
+func (a *NodesAddon) Inspect(node *unstructured.Unstructured) error {
+	nodeName := node.GetName()
+	a.log.Debugf("Inspecting node %q", nodeName)
+
+	a.Queue(func(ctx context.Context) error {
+		a.gatherNode(ctx, nodeName)
+		return nil
+	})
+
+	return nil
+}
+
+func (a *NodesAddon) gatherNode(ctx context.Context, nodeName string) {
+	pods, err := a.findNodePods(nodeName)
+	if err != nil {
+		a.log.Warnf("Cannot find pods on node %q: %s", nodeName, err)
+		return
+	}
+
+	// Static pods are the true source of the mirror pods configuration, but
+	// only control plane nodes run static pods. Node storage configuration is
+	// relevant only on nodes running Ceph CSI plugins. Avoid creating agent
+	// pods on other nodes.
+	if len(pods.mirrorPods) == 0 && !pods.cephCSI {
+		return
+	}
+
+	a.log.Debugf("Found mirror pods %q, ceph csi %v on node %q",
+		pods.mirrorPods, pods.cephCSI, nodeName)
+
+	a.withAgentPod(nodeName, func(agent *AgentPod) {
+		if len(pods.mirrorPods) > 0 {
+			a.gatherStaticPods(ctx, nodeName, agent)
+		}
+		if pods.cephCSI {
+			a.gatherStorageConfig(ctx, nodeName, agent)
+		}
+	})
+}
+
+// findNodePods returns the mirror pods and Ceph CSI plugin pods running on
+// node.
+func (a *NodesAddon) findNodePods(nodeName string) (*nodePods, error) {
+	pods, err := a.client.CoreV1().
+		Pods(metav1.NamespaceAll).
+		List(context.TODO(), metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &nodePods{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+			result.mirrorPods = append(result.mirrorPods, pod.Namespace+"/"+pod.Name)
+		}
+		for j := range pod.Spec.Containers {
+			if strings.Contains(pod.Spec.Containers[j].Image, cephCSIImage) {
+				result.cephCSI = true
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// gatherStaticPods copies the static pods manifests from the node.
+func (a *NodesAddon) gatherStaticPods(ctx context.Context, nodeName string, agent *AgentPod) {
+	dst, err := a.Output().CreateAddonDir(nodesName, nodeName, "manifests")
+	if err != nil {
+		a.log.Warnf("Cannot create manifests directory: %s", err)
+		return
+	}
+
+	rd := NewRemoteDirectory(agent.Pod, a.Options(), a.log).WithContext(ctx)
+	src := path.Join(nodeHostRoot, staticPodsDir)
+
+	if err := rd.Gather(src, dst); err != nil {
+		a.log.Warnf("Cannot copy %q from agent pod %q: %s", src, agent, err)
+	}
+}
+
+// gatherStorageConfig gathers the node storage configuration: multipath
+// configuration, rbd and nbd udev rules, block devices, kernel modules and
+// sysctl networking values.
+func (a *NodesAddon) gatherStorageConfig(ctx context.Context, nodeName string, agent *AgentPod) {
+	dst, err := a.Output().CreateAddonDir(nodesName, nodeName, "storage")
+	if err != nil {
+		a.log.Warnf("Cannot create storage directory: %s", err)
+		return
+	}
+
+	rd := NewRemoteDirectory(agent.Pod, a.Options(), a.log).WithContext(ctx)
+
+	var findArgs []string
+	for _, name := range nodeStorageFiles {
+		findArgs = append(findArgs, path.Join(nodeHostRoot, name))
+	}
+	findArgs = append(findArgs, "-type", "f")
+
+	if err := rd.GatherFind(nodeHostRoot, dst, findArgs...); err != nil {
+		a.log.Warnf("Cannot copy storage configuration from agent pod %q: %s", agent, err)
+	}
+
+	findArgs = nil
+	for _, name := range nodeUdevRulesDirs {
+		findArgs = append(findArgs, path.Join(nodeHostRoot, name))
+	}
+	findArgs = append(findArgs, "-type", "f", "(", "-name", "*rbd*", "-o", "-name", "*nbd*", ")")
+
+	if err := rd.GatherFind(nodeHostRoot, dst, findArgs...); err != nil {
+		a.log.Warnf("Cannot copy udev rules from agent pod %q: %s", agent, err)
+	}
+
+	commands, err := a.Output().CreateAddonDir(nodesName, nodeName, "commands")
+	if err != nil {
+		a.log.Warnf("Cannot create commands directory: %s", err)
+		return
+	}
+
+	rc := NewRemoteCommand(agent.Pod, a.Options(), a.log, commands).WithContext(ctx)
+
+	// Run the commands in the node namespaces, using the node programs.
+	for _, c := range nodeStorageCommands {
+		command := append([]string{"nsenter", "--target", "1", "--mount", "--uts", "--ipc", "--net", "--"}, c.command...)
+		if err := rc.GatherAs(c.name, 0, command...); err != nil {
+			a.log.Warnf("Error running %q on node %q: %s", c.command, nodeName, err)
+		}
+	}
+}
+
+// withAgentPod runs fn with an agent pod running on node. The node root file
+// system is mounted read only in nodeHostRoot. The agent pod uses the host PID
+// namespace, so commands can run in the node namespaces using nsenter.
+func (a *NodesAddon) withAgentPod(nodeName string, fn func(*AgentPod)) {
+	start := time.Now()
+
+	agent := NewAgentPod(nodesName+"-"+nodeName, a.client, a.log)
+	agent.Pod.Spec.NodeName = nodeName
+	agent.Pod.Spec.HostPID = true
+	agent.Pod.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{
+		{
+			Name:      "host",
+			MountPath: nodeHostRoot,
+			ReadOnly:  true,
+		},
+	}
+	agent.Pod.Spec.Volumes = []corev1.Volume{
+		{
+			Name: "host",
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{Path: "/"},
+			},
+		},
+	}
+
+	if err := agent.Create(); err != nil {
+		a.log.Warnf("Cannot create agent pod: %s", err)
+		return
+	}
+	defer agent.Delete()
+
+	if err := agent.WaitUntilRunning(); err != nil {
+		a.log.Warnf("Error waiting for agent pod %q: %s", agent, err)
+		return
+	}
+
+	a.log.Debugf("Agent pod %q running in %.3f seconds", agent, time.Since(start).Seconds())
+
+	fn(agent)
+
+	a.log.Debugf("Gathered node %q in %.3f seconds", nodeName, time.Since(start).Seconds())
+}
@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// Suffix of the marker file stored instead of an object larger than the max
+// object size.
+const skippedObjectSuffix = ".skipped"
+
+// ObjectTooLargeError is returned when an object is larger than the max
+// object size.
+type ObjectTooLargeError struct {
+	Size  int64
+	Limit int64
+}
+
+func (e *ObjectTooLargeError) Error() string {
+	return fmt.Sprintf("object size %d bytes exceeds max object size %d bytes", e.Size, e.Limit)
+}
+
+func (e *ObjectTooLargeError) Is(target error) bool {
+	return target == ErrObjectTooLarge
+}
+
+// skipObject stores a marker file with the object metadata instead of an
+// object larger than the max object size, so the object existence and
+// labels are still visible in the gather.
+func (w *resourceWriter) skipObject(relpath string, item *unstructured.Unstructured, size int64) error {
+	tooLarge := &ObjectTooLargeError{Size: size, Limit: w.maxObjectSize}
+
+	marker := map[string]any{
+		"apiVersion": item.GetAPIVersion(),
+		"kind":       item.GetKind(),
+		"metadata":   item.Object["metadata"],
+	}
+
+	data, err := yaml.Marshal(marker)
+	if err != nil {
+		return err
+	}
+
+	dst, err := w.output.CreateResource(relpath + skippedObjectSuffix)
+	if err != nil {
+		return err
+	}
+
+	defer dst.Close()
+
+	header := fmt.Sprintf("# Skipped: %s\n", tooLarge)
+	writer := &countingWriter{w: dst, count: w.written}
+	if _, err := writer.Write(append([]byte(header), data...)); err != nil {
+		return err
+	}
+
+	return tooLarge
+}
+
+// dumpResource stores a gathered resource. Objects skipped because of their
+// size are recorded in the error report. Returns false if the resource was
+// not stored.
+func (g *Gatherer) dumpResource(r *resourceInfo, item *unstructured.Unstructured, key string) bool {
+	err := g.dumper.Dump(r, item)
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *ObjectTooLargeError
+	if errors.As(err, &tooLarge) {
+		g.log.Debugf("Skipping %q: %s", key, err)
+		g.addError(r, item.GetNamespace(), item.GetName(), ObjectTooLarge, err)
+	} else {
+		g.log.Warnf("Cannot dump %q: %s", key, err)
+		g.dumpAPIResponse(r, item.GetNamespace())
+	}
+
+	return false
+}
@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDumpMaxObjectSize(t *testing.T) {
+	dir := t.TempDir()
+	var written atomic.Int64
+	w := &resourceWriter{
+		output:        NewOutputDirectory(dir),
+		index:         &index{},
+		written:       &written,
+		maxObjectSize: 1024,
+	}
+
+	small := newItems(1)[0]
+	if err := w.Dump(&persistentVolumes, small); err != nil {
+		t.Fatal(err)
+	}
+
+	large := small.DeepCopy()
+	large.SetName("large")
+	large.Object["data"] = strings.Repeat("x", 2048)
+
+	err := w.Dump(&persistentVolumes, large)
+	var tooLarge *ObjectTooLargeError
+	if !stderrors.As(err, &tooLarge) {
+		t.Fatalf("expected ObjectTooLargeError, got %v", err)
+	}
+
+	relpath := ClusterResourcePath("persistentvolumes", "large")
+	if _, err := os.Stat(filepath.Join(dir, relpath)); !os.IsNotExist(err) {
+		t.Errorf("large object stored: %v", err)
+	}
+
+	marker, err := os.ReadFile(filepath.Join(dir, relpath+skippedObjectSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(marker), "name: large") || strings.Contains(string(marker), "xxx") {
+		t.Errorf("unexpected marker:\n%s", marker)
+	}
+
+	entries := w.index.Entries()
+	if len(entries) != 1 || entries[0].Name != small.GetName() {
+		t.Errorf("expected only the small object in the index, got %+v", entries)
+	}
+}
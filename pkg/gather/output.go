@@ -6,6 +6,7 @@ package gather
 import (
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 )
 
@@ -19,28 +20,90 @@ type OutputDirectory struct {
 	base string
 }
 
+// NewOutputDirectory returns an output directory writing to the cluster
+// directory base.
+func NewOutputDirectory(base string) *OutputDirectory {
+	return &OutputDirectory{base: base}
+}
+
 func (o *OutputDirectory) CreateContainerLog(namespace string, pod string, container string, name string) (io.WriteCloser, error) {
+	return o.CreateContainerFile(namespace, pod, container, name+".log")
+}
+
+// CreateContainerFile creates a file in the container directory.
+func (o *OutputDirectory) CreateContainerFile(namespace string, pod string, container string, name string) (io.WriteCloser, error) {
 	dir, err := createDirectory(o.base, namespacesDir, namespace, "pods", pod, container)
 	if err != nil {
 		return nil, err
 	}
-	return createFile(dir, name+".log")
+	return createFile(dir, name)
 }
 
-func (o *OutputDirectory) CreateNamespacedResource(namespace string, resource string, name string) (io.WriteCloser, error) {
-	dir, err := createDirectory(o.base, namespacesDir, namespace, resource)
+// CreatePodFile creates a file in the pod directory.
+func (o *OutputDirectory) CreatePodFile(namespace string, pod string, name string) (io.WriteCloser, error) {
+	dir, err := createDirectory(o.base, namespacesDir, namespace, "pods", pod)
 	if err != nil {
 		return nil, err
 	}
-	return createFile(dir, name+".yaml")
+	return createFile(dir, name)
 }
 
-func (o *OutputDirectory) CreateClusterResource(resource string, name string) (io.WriteCloser, error) {
-	dir, err := createDirectory(o.base, clusterDir, resource)
+// CreatePodDir creates a directory in the pod directory (e.g.
+// "namespaces/{namespace}/pods/{pod}/{container}").
+func (o *OutputDirectory) CreatePodDir(namespace string, pod string, more ...string) (string, error) {
+	args := append([]string{o.base, namespacesDir, namespace, "pods", pod}, more...)
+	return createDirectory(args...)
+}
+
+// NamespacedResourcePath returns the path of a namespaced resource relative to
+// the cluster directory. Long paths are replaced with hashed paths.
+func NamespacedResourcePath(namespace string, resource string, name string) string {
+	return shortenPath(path.Join(namespacesDir, namespace, resource, SafeName(name)+".yaml"))
+}
+
+// ClusterResourcePath returns the path of a cluster scoped resource relative
+// to the cluster directory. Long paths are replaced with hashed paths.
+func ClusterResourcePath(resource string, name string) string {
+	return shortenPath(path.Join(clusterDir, resource, SafeName(name)+".yaml"))
+}
+
+// CreateResource creates a resource file. The path is relative to the cluster
+// directory and uses "/" separator.
+func (o *OutputDirectory) CreateResource(relpath string) (io.WriteCloser, error) {
+	filename := filepath.Join(o.base, filepath.FromSlash(relpath))
+	dir, err := createDirectory(filepath.Dir(filename))
 	if err != nil {
 		return nil, err
 	}
-	return createFile(dir, name+".yaml")
+	return createFile(dir, filepath.Base(filename))
+}
+
+// CreateFile creates a file in the cluster directory.
+func (o *OutputDirectory) CreateFile(name string) (io.WriteCloser, error) {
+	dir, err := createDirectory(o.base)
+	if err != nil {
+		return nil, err
+	}
+	return createFile(dir, name)
+}
+
+// AppendFile opens a file in the cluster directory for appending, creating
+// it if needed.
+func (o *OutputDirectory) AppendFile(name string) (io.WriteCloser, error) {
+	dir, err := createDirectory(o.base)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+}
+
+// CreateClusterFile creates a file in the cluster resources directory.
+func (o *OutputDirectory) CreateClusterFile(name string) (io.WriteCloser, error) {
+	dir, err := createDirectory(o.base, clusterDir)
+	if err != nil {
+		return nil, err
+	}
+	return createFile(dir, name)
 }
 
 func (o *OutputDirectory) CreateAddonDir(name string, more ...string) (string, error) {
@@ -48,6 +111,14 @@ func (o *OutputDirectory) CreateAddonDir(name string, more ...string) (string, e
 	return createDirectory(args...)
 }
 
+// CreateNamespaceAddonDir creates an addon directory in the namespace
+// directory, keeping addon output next to the resources that triggered it
+// (e.g. "namespaces/{namespace}/addons/{name}").
+func (o *OutputDirectory) CreateNamespaceAddonDir(namespace string, name string, more ...string) (string, error) {
+	args := append([]string{o.base, namespacesDir, namespace, addonsDir, name}, more...)
+	return createDirectory(args...)
+}
+
 func createDirectory(args ...string) (string, error) {
 	dir := filepath.Join(args...)
 	if err := os.MkdirAll(dir, 0750); err != nil {
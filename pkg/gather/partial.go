@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+// PartialName is the marker written in a namespace directory when some data
+// in the namespace could not be gathered, if Options.PartialMarkers is set.
+// The marker lists the failed resources, one per line.
+const PartialName = "PARTIAL"
+
+// PartialNamespace describes a namespace with data that could not be
+// gathered. Objects missing in the gather may exist in the cluster.
+type PartialNamespace struct {
+	Namespace string `json:"namespace"`
+
+	// Resources, logs or addons that could not be gathered. Details are
+	// recorded in errors.yaml.
+	FailedResources []string `json:"failedResources"`
+}
+
+// failedResources returns the sorted names of the failed resources in every
+// namespace. Failures not specific to a namespace (e.g. listing a resource
+// in all namespaces) are returned in the empty namespace.
+func failedResources(errors []GatherError) map[string][]string {
+	failed := map[string][]string{}
+	for i := range errors {
+		e := &errors[i]
+		if !slices.Contains(failed[e.Namespace], e.Resource) {
+			failed[e.Namespace] = append(failed[e.Namespace], e.Resource)
+		}
+	}
+	for _, resources := range failed {
+		slices.Sort(resources)
+	}
+	return failed
+}
+
+// partialNamespaces returns the namespaces with failed resources, sorted by
+// namespace.
+func partialNamespaces(failed map[string][]string) []PartialNamespace {
+	var result []PartialNamespace
+	for _, namespace := range slices.Sorted(maps.Keys(failed)) {
+		if namespace == "" {
+			continue
+		}
+		result = append(result, PartialNamespace{
+			Namespace:       namespace,
+			FailedResources: failed[namespace],
+		})
+	}
+	return result
+}
+
+// writePartialMarkers writes a marker in every partially gathered namespace
+// directory, so readers can tell if a missing object does not exist or could
+// not be gathered.
+func (g *Gatherer) writePartialMarkers() {
+	for _, partial := range partialNamespaces(failedResources(g.errors.Errors())) {
+		relpath := path.Join(namespacesDir, partial.Namespace, PartialName)
+		dst, err := g.output.CreateResource(relpath)
+		if err != nil {
+			g.log.Warnf("Cannot create %q: %s", relpath, err)
+			continue
+		}
+
+		content := strings.Join(partial.FailedResources, "\n") + "\n"
+		if _, err := dst.Write([]byte(content)); err != nil {
+			g.log.Warnf("Cannot write %q: %s", relpath, err)
+		}
+
+		dst.Close()
+	}
+}
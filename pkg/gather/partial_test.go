@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPartialNamespaces(t *testing.T) {
+	lister := &fakeLister{err: errors.NewServiceUnavailable("try later")}
+	g, _ := newTestGatherer(t, Options{PartialMarkers: true}, lister)
+
+	g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+	g.errors.Add(GatherError{Resource: "pods/log", Namespace: "ns2", Name: "pod/c", Reason: LogFailed})
+	g.errors.Add(GatherError{Resource: "configmaps", Namespace: "ns1", Name: "big", Reason: ObjectTooLarge})
+	g.errors.Add(GatherError{Resource: "apps/deployments", Namespace: "ns1", Reason: ListFailed})
+	g.errors.Add(GatherError{Resource: "configmaps", Namespace: "ns1", Name: "bigger", Reason: ObjectTooLarge})
+
+	g.writePartialMarkers()
+	g.writeMetadata(true)
+
+	metadata, err := readMetadata(g.output.base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !metadata.Partial {
+		t.Errorf("expected partial gather")
+	}
+	if !slices.Equal(metadata.FailedResources, []string{"persistentvolumes"}) {
+		t.Errorf("unexpected failed resources %q", metadata.FailedResources)
+	}
+
+	expected := []PartialNamespace{
+		{Namespace: "ns1", FailedResources: []string{"apps/deployments", "configmaps"}},
+		{Namespace: "ns2", FailedResources: []string{"pods/log"}},
+	}
+	if !reflect.DeepEqual(metadata.PartialNamespaces, expected) {
+		t.Errorf("expected partial namespaces %+v, got %+v", expected, metadata.PartialNamespaces)
+	}
+
+	data, err := os.ReadFile(filepath.Join(g.output.base, namespacesDir, "ns1", PartialName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "apps/deployments\nconfigmaps\n" {
+		t.Errorf("unexpected marker %q", data)
+	}
+}
@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// Plan describes what a gather will do, resolved using the cluster, so other
+// tools can validate and record a gather before running it.
+type Plan struct {
+	// Requested namespaces existing on the cluster. If empty, all namespaces
+	// are gathered.
+	Namespaces []string `json:"namespaces"`
+
+	// Requested namespaces missing on the cluster.
+	MissingNamespaces []string `json:"missingNamespaces,omitempty"`
+
+	// Addons enabled for this cluster, sorted by name.
+	Addons []string `json:"addons"`
+
+	// Resources that will be gathered, sorted by name.
+	Resources []PlannedResource `json:"resources"`
+
+	// Resources filtered out by design.
+	SkippedResources []SkippedResource `json:"skippedResources,omitempty"`
+
+	// Group versions that failed discovery. Resources in these group versions
+	// will not be gathered.
+	FailedGroups []FailedGroup `json:"failedGroups,omitempty"`
+}
+
+// PlannedResource is a resource type that will be gathered.
+type PlannedResource struct {
+	Resource   string `json:"resource"`
+	Version    string `json:"version"`
+	Kind       string `json:"kind"`
+	Namespaced bool   `json:"namespaced"`
+
+	// InventoryOnly is set if only the names of the items are recorded.
+	InventoryOnly bool `json:"inventoryOnly,omitempty"`
+
+	// Estimated number of items that will be gathered, or -1 if the items
+	// cannot be counted.
+	Count int64 `json:"count"`
+}
+
+// Plan resolves the namespaces, resources and addons for this cluster and
+// estimates the number of items of every resource, without gathering
+// anything.
+func (g *Gatherer) Plan() (*Plan, error) {
+	plan := &Plan{Namespaces: []string{}, Addons: []string{}, Resources: []PlannedResource{}}
+
+	namespaces := []string{metav1.NamespaceAll}
+
+	if len(g.opts.Namespaces) > 0 {
+		items, err := g.getNamespaces()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ns := range items {
+			plan.Namespaces = append(plan.Namespaces, ns.GetName())
+		}
+
+		for _, namespace := range g.opts.Namespaces {
+			if !slices.Contains(plan.Namespaces, namespace) {
+				plan.MissingNamespaces = append(plan.MissingNamespaces, namespace)
+			}
+		}
+
+		if len(plan.Namespaces) == 0 {
+			// Nothing will be gathered.
+			return plan, nil
+		}
+
+		namespaces = plan.Namespaces
+	}
+
+	resources, err := g.listAPIResources()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list api resources: %w", err)
+	}
+
+	plan.SkippedResources = g.skippedResources
+	plan.FailedGroups = g.failedGroups
+
+	addons := map[string]struct{}{}
+	for _, enabled := range g.addons {
+		for _, addon := range enabled {
+			addons[addon.Name] = struct{}{}
+		}
+	}
+	plan.Addons = append(plan.Addons, slices.Sorted(maps.Keys(addons))...)
+
+	var mutex sync.Mutex
+
+	g.wq.Start()
+
+	for i := range resources {
+		r := &resources[i]
+		g.wq.Queue(func() error {
+			planned := PlannedResource{
+				Resource:      r.Name(),
+				Version:       r.Version,
+				Kind:          r.Kind,
+				Namespaced:    r.Namespaced,
+				InventoryOnly: g.inventoryOnly(r),
+				Count:         g.countItems(r, namespaces),
+			}
+
+			mutex.Lock()
+			plan.Resources = append(plan.Resources, planned)
+			mutex.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := g.wq.Wait(); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(plan.Resources, func(a, b PlannedResource) int {
+		if c := strings.Compare(a.Resource, b.Resource); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Version, b.Version)
+	})
+
+	return plan, nil
+}
+
+// countItems estimates the number of items of resource r in namespaces using
+// metadata only requests for single item. Returns -1 if counting failed.
+func (g *Gatherer) countItems(r *resourceInfo, namespaces []string) int64 {
+	opts := metav1.ListOptions{Limit: 1}
+	if g.opts.Name != "" {
+		opts.FieldSelector = fields.OneTermEqualSelector(metav1.ObjectNameField, g.opts.Name).String()
+	}
+
+	var total int64
+
+	for _, namespace := range namespaces {
+		var list *metav1.PartialObjectMetadataList
+		var err error
+
+		if r.Namespaced {
+			list, err = g.metadata.Resource(r.GroupVersionResource).
+				Namespace(namespace).
+				List(context.TODO(), opts)
+		} else {
+			list, err = g.metadata.Resource(r.GroupVersionResource).
+				List(context.TODO(), opts)
+		}
+
+		if err != nil {
+			g.log.Debugf("Cannot count %q: %s", r.Name(), err)
+			return -1
+		}
+
+		count := int64(len(list.Items))
+		if list.RemainingItemCount != nil {
+			count += *list.RemainingItemCount
+		}
+		if g.opts.MaxPerResource > 0 {
+			count = min(count, int64(g.opts.MaxPerResource))
+		}
+
+		total += count
+	}
+
+	return total
+}
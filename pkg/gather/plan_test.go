@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"slices"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakemetadata "k8s.io/client-go/metadata/fake"
+)
+
+func TestPlan(t *testing.T) {
+	namespace := &unstructured.Unstructured{}
+	namespace.SetAPIVersion("v1")
+	namespace.SetKind("Namespace")
+	namespace.SetName("my-app")
+
+	opts := Options{Namespaces: []string{"my-app", "missing"}, InventoryOnly: []string{"configmaps"}}
+	g, _ := newTestGatherer(t, opts, &fakeLister{}, namespace)
+	g.discovery.(*fakeDiscovery).preferred = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: []string{"list"}},
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"list"}},
+				{Name: "nodes", Kind: "Node", Verbs: []string{"list"}},
+			},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	metav1.AddMetaToScheme(scheme)
+	var pods []runtime.Object
+	for _, name := range []string{"pod-1", "pod-2"} {
+		pods = append(pods, &metav1.PartialObjectMetadata{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "my-app", Name: name},
+		})
+	}
+	g.metadata = fakemetadata.NewSimpleMetadataClient(scheme, pods...)
+
+	plan, err := g.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(plan.Namespaces, []string{"my-app"}) {
+		t.Errorf("expected namespaces [my-app], got %q", plan.Namespaces)
+	}
+	if !slices.Equal(plan.MissingNamespaces, []string{"missing"}) {
+		t.Errorf("expected missing namespaces [missing], got %q", plan.MissingNamespaces)
+	}
+
+	expected := []PlannedResource{
+		{Resource: "configmaps", Version: "v1", Kind: "ConfigMap", Namespaced: true, InventoryOnly: true, Count: 0},
+		{Resource: "pods", Version: "v1", Kind: "Pod", Namespaced: true, Count: 2},
+	}
+	if !slices.Equal(plan.Resources, expected) {
+		t.Errorf("expected resources %+v, got %+v", expected, plan.Resources)
+	}
+
+	skipped := []SkippedResource{{Resource: "nodes", Version: "v1", Reason: SkipClusterScoped}}
+	if !slices.Equal(plan.SkippedResources, skipped) {
+		t.Errorf("expected skipped resources %+v, got %+v", skipped, plan.SkippedResources)
+	}
+}
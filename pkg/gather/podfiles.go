@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	filesName = "files"
+
+	// Directory in the pod container directory for copied files.
+	podFilesDir = "files"
+)
+
+// FilesRule selects pods and the container paths copied from them by the
+// files addon.
+type FilesRule struct {
+	// Namespace of the pods. If empty, pods in all gathered namespaces are
+	// selected.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Selector is a label selector (e.g. "app=myapp") selecting the pods.
+	Selector string `json:"selector"`
+
+	// Container to copy the paths from. If empty, the first container is
+	// used. The container must have tar.
+	Container string `json:"container,omitempty"`
+
+	// Paths are absolute paths of files or directories in the container
+	// (e.g. "/etc/myapp").
+	Paths []string `json:"paths"`
+}
+
+// Validate returns an error if the rule is invalid.
+func (r *FilesRule) Validate() error {
+	if _, err := labels.Parse(r.Selector); err != nil {
+		return fmt.Errorf("invalid selector %q: %s", r.Selector, err)
+	}
+	if len(r.Paths) == 0 {
+		return fmt.Errorf("no path for selector %q", r.Selector)
+	}
+	for _, p := range r.Paths {
+		if !path.IsAbs(p) || path.Clean(p) == "/" {
+			return fmt.Errorf("invalid path %q: must be an absolute path below \"/\"", p)
+		}
+	}
+	return nil
+}
+
+// filesRule is a FilesRule with a parsed selector.
+type filesRule struct {
+	*FilesRule
+	selector labels.Selector
+}
+
+// Matches returns true if the rule selects pod.
+func (r *filesRule) Matches(pod *unstructured.Unstructured) bool {
+	if r.Namespace != "" && r.Namespace != pod.GetNamespace() {
+		return false
+	}
+	return r.selector.Matches(labels.Set(pod.GetLabels()))
+}
+
+// FilesAddon copies files from containers of the pods selected by the files
+// rules, generalizing what the rook addon does for ceph logs.
+type FilesAddon struct {
+	AddonBackend
+	rules []filesRule
+	log   *zap.SugaredLogger
+}
+
+func init() {
+	registerAddon(filesName, addonInfo{
+		Resources: []string{"pods"},
+		AddonFunc: NewFilesAddon,
+		Priority:  PriorityAddons,
+		Agents:    true,
+		// Avoid overwhelming the cluster with remote copies.
+		MaxConcurrency: 4,
+	})
+}
+
+func NewFilesAddon(backend AddonBackend) (Addon, error) {
+	opts := backend.Options()
+	if len(opts.Files) == 0 {
+		return nil, nil
+	}
+
+	var rules []filesRule
+	for i := range opts.Files {
+		rule := &opts.Files[i]
+		selector, err := labels.Parse(rule.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %s", rule.Selector, err)
+		}
+		rules = append(rules, filesRule{FilesRule: rule, selector: selector})
+	}
+
+	return &FilesAddon{
+		AddonBackend: backend,
+		rules:        rules,
+		log:          opts.Log.Named(filesName),
+	}, nil
+}
+
+func (a *FilesAddon) Inspect(item *unstructured.Unstructured) error {
+	var selected []*filesRule
+	for i := range a.rules {
+		if a.rules[i].Matches(item) {
+			selected = append(selected, &a.rules[i])
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil
+	}
+
+	a.log.Debugf("Inspecting pod \"%s/%s\"", item.GetNamespace(), item.GetName())
+
+	pod := &corev1.Pod{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, pod); err != nil {
+		return fmt.Errorf("cannot convert pod \"%s/%s\": %s", item.GetNamespace(), item.GetName(), err)
+	}
+
+	// Copying requires running tar in the container.
+	if pod.Status.Phase != corev1.PodRunning {
+		a.log.Debugf("Skipping pod \"%s/%s\" in phase %q", pod.Namespace, pod.Name, pod.Status.Phase)
+		return nil
+	}
+
+	for _, rule := range selected {
+		container := rule.Container
+		if container == "" {
+			container = pod.Spec.Containers[0].Name
+		} else if !hasContainer(pod, container) {
+			a.log.Warnf("Container %q not found in pod \"%s/%s\"", container, pod.Namespace, pod.Name)
+			continue
+		}
+
+		paths := rule.Paths
+		a.QueueNamespace(pod.Namespace, func(ctx context.Context) error {
+			a.gatherPaths(ctx, pod, container, paths)
+			return nil
+		})
+	}
+
+	return nil
+}
+
+// gatherPaths copies files and directories from the pod container to the
+// container directory, keeping their absolute path (e.g.
+// "pods/{pod}/{container}/files/etc/myapp"). Missing paths are ignored.
+func (a *FilesAddon) gatherPaths(ctx context.Context, pod *corev1.Pod, container string, paths []string) {
+	start := time.Now()
+
+	dst, err := a.Output().CreatePodDir(pod.Namespace, pod.Name, container, podFilesDir)
+	if err != nil {
+		a.log.Warnf("Cannot create files directory: %s", err)
+		return
+	}
+
+	rd := NewRemoteContainerDirectory(pod, container, a.Options(), a.log).WithContext(ctx)
+	findArgs := append(slices.Clone(paths), "-type", "f")
+	if err := rd.GatherFind("/", dst, findArgs...); err != nil {
+		a.log.Warnf("Cannot copy %q from pod \"%s/%s\" container %q: %s",
+			paths, pod.Namespace, pod.Name, container, err)
+		return
+	}
+
+	a.log.Debugf("Gathered %q from pod \"%s/%s\" container %q in %.3f seconds",
+		paths, pod.Namespace, pod.Name, container, time.Since(start).Seconds())
+}
+
+func hasContainer(pod *corev1.Pod, name string) bool {
+	return slices.ContainsFunc(pod.Spec.Containers, func(c corev1.Container) bool {
+		return c.Name == name
+	})
+}
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestFilesRuleMatches(t *testing.T) {
+	pod := &unstructured.Unstructured{}
+	pod.SetNamespace("myapp")
+	pod.SetName("server-1")
+	pod.SetLabels(map[string]string{"app": "myapp", "tier": "server"})
+
+	cases := []struct {
+		name    string
+		rule    FilesRule
+		matches bool
+	}{
+		{"selector", FilesRule{Selector: "app=myapp"}, true},
+		{"namespace", FilesRule{Namespace: "myapp", Selector: "app=myapp"}, true},
+		{"other namespace", FilesRule{Namespace: "other", Selector: "app=myapp"}, false},
+		{"other selector", FilesRule{Selector: "app=other"}, false},
+		{"set selector", FilesRule{Selector: "tier in (server,db)"}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g, _ := newTestGatherer(t, Options{
+				Addons:      []string{filesName},
+				AllowAgents: true,
+				Files:       []FilesRule{c.rule},
+			}, &fakeLister{})
+			addons := g.addons["pods"]
+			if len(addons) != 1 {
+				t.Fatalf("expected files addon, got %v", addons)
+			}
+			rule := &addons[0].Addon.(*FilesAddon).rules[0]
+			if rule.Matches(pod) != c.matches {
+				t.Errorf("expected matches %v", c.matches)
+			}
+		})
+	}
+}
+
+func TestFilesRuleValidate(t *testing.T) {
+	cases := []struct {
+		name  string
+		rule  FilesRule
+		valid bool
+	}{
+		{"valid", FilesRule{Selector: "app=myapp", Paths: []string{"/etc/myapp"}}, true},
+		{"no paths", FilesRule{Selector: "app=myapp"}, false},
+		{"relative path", FilesRule{Selector: "app=myapp", Paths: []string{"etc/myapp"}}, false},
+		{"root", FilesRule{Selector: "app=myapp", Paths: []string{"/"}}, false},
+		{"invalid selector", FilesRule{Selector: "app=(", Paths: []string{"/etc/myapp"}}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.rule.Validate()
+			if c.valid && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if !c.valid && err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	postgresName           = "postgres"
+	replicationReportName  = "replication-lag.txt"
+	replicationStatusName  = "pg_stat_replication"
+	postgresContainerName  = "postgres"
+	postgresDataDir        = "/var/lib/postgresql/data/pgdata"
+	cnpgClusterLabel       = "cnpg.io/cluster"
+	cnpgInstanceRoleLabel  = "cnpg.io/instanceRole"
+	cnpgPrimaryRole        = "primary"
+	postgresCommandTimeout = 60 * time.Second
+)
+
+var (
+	cnpgBackupsResource          = schema.GroupVersionResource{Group: "postgresql.cnpg.io", Version: "v1", Resource: "backups"}
+	cnpgScheduledBackupsResource = schema.GroupVersionResource{Group: "postgresql.cnpg.io", Version: "v1", Resource: "scheduledbackups"}
+
+	// Replication status of the standby instances, queried on the primary.
+	replicationQuery = "SELECT application_name, state, sync_state," +
+		" pg_wal_lsn_diff(pg_current_wal_lsn(), replay_lsn) AS lag_bytes, replay_lag" +
+		" FROM pg_stat_replication ORDER BY application_name"
+)
+
+// replicationStatus is the replication status of a standby instance.
+type replicationStatus struct {
+	Instance  string
+	State     string
+	SyncState string
+	LagBytes  string
+	ReplayLag string
+}
+
+// PostgresAddon gathers CloudNativePG clusters instance pods, backups, the
+// pg_controldata of every instance, and a replication lag summary, for
+// debugging stateful workloads during disaster recovery.
+type PostgresAddon struct {
+	AddonBackend
+	client  *kubernetes.Clientset
+	dynamic dynamic.Interface
+	log     *zap.SugaredLogger
+}
+
+func init() {
+	registerAddon(postgresName, addonInfo{
+		Resources: []string{"postgresql.cnpg.io/clusters"},
+		AddonFunc: NewPostgresAddon,
+		Priority:  PriorityAddons,
+	})
+}
+
+func NewPostgresAddon(backend AddonBackend) (Addon, error) {
+	client, err := kubernetes.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostgresAddon{
+		AddonBackend: backend,
+		client:       client,
+		dynamic:      dynamicClient,
+		log:          backend.Options().Log.Named(postgresName),
+	}, nil
+}
+
+func (a *PostgresAddon) Inspect(cluster *unstructured.Unstructured) error {
+	namespace := cluster.GetNamespace()
+	name := cluster.GetName()
+	a.log.Debugf("Inspecting cluster \"%s/%s\"", namespace, name)
+
+	a.QueueNamespace(namespace, func(ctx context.Context) error {
+		a.gatherBackups(ctx, namespace, name)
+		return nil
+	})
+
+	a.QueueNamespace(namespace, func(ctx context.Context) error {
+		a.gatherInstances(ctx, namespace, name)
+		return nil
+	})
+
+	return nil
+}
+
+// gatherBackups gathers the backups and scheduled backups of cluster.
+func (a *PostgresAddon) gatherBackups(ctx context.Context, namespace string, cluster string) {
+	backups, err := a.dynamic.Resource(cnpgBackupsResource).Namespace(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: cnpgClusterLabel + "=" + cluster,
+	})
+	if err != nil {
+		a.log.Warnf("Cannot list cluster \"%s/%s\" backups: %s", namespace, cluster, err)
+	} else {
+		for i := range backups.Items {
+			a.GatherResource(cnpgBackupsResource, types.NamespacedName{Namespace: namespace, Name: backups.Items[i].GetName()})
+		}
+	}
+
+	// Scheduled backups are not labeled.
+	scheduled, err := a.dynamic.Resource(cnpgScheduledBackupsResource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		a.log.Warnf("Cannot list cluster \"%s/%s\" scheduled backups: %s", namespace, cluster, err)
+	} else {
+		for i := range scheduled.Items {
+			item := &scheduled.Items[i]
+			if name, _, _ := unstructured.NestedString(item.Object, "spec", "cluster", "name"); name == cluster {
+				a.GatherResource(cnpgScheduledBackupsResource, types.NamespacedName{Namespace: namespace, Name: item.GetName()})
+			}
+		}
+	}
+}
+
+// gatherInstances gathers the instance pods with their logs, and the control
+// data and replication status of the instances.
+func (a *PostgresAddon) gatherInstances(ctx context.Context, namespace string, cluster string) {
+	pods, err := a.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: cnpgClusterLabel + "=" + cluster,
+	})
+	if err != nil {
+		a.log.Warnf("Cannot list cluster \"%s/%s\" pods: %s", namespace, cluster, err)
+		return
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		a.GatherResource(podsResource, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name})
+
+		if !logsAddonGathers(a.Options(), pod.Namespace) {
+			gatherPodLogs(ctx, a, a.client, a.log, pod)
+		}
+	}
+
+	a.gatherCommands(ctx, namespace, cluster, pods.Items)
+}
+
+// gatherCommands gathers the control data of the instances and the
+// replication status. This is the only place the addon runs commands in pods,
+// so the addon is not an agents addon and gathers everything else in read
+// only mode.
+func (a *PostgresAddon) gatherCommands(ctx context.Context, namespace string, cluster string, pods []corev1.Pod) {
+	if !a.Options().AgentsAllowed() {
+		a.log.Debugf("Skipping cluster \"%s/%s\" commands in read only mode", namespace, cluster)
+		return
+	}
+
+	dir, err := a.Output().CreateNamespaceAddonDir(namespace, postgresName, cluster)
+	if err != nil {
+		a.log.Warnf("Cannot create postgres directory: %s", err)
+		return
+	}
+
+	var primary *corev1.Pod
+
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase != corev1.PodRunning || !hasContainer(pod, postgresContainerName) {
+			continue
+		}
+
+		rc := NewRemoteCommand(pod, a.Options(), a.log, dir).
+			InContainer(postgresContainerName).
+			WithContext(ctx)
+		filename := pod.Name + ".pg_controldata"
+		if err := rc.GatherAs(filename, postgresCommandTimeout, "pg_controldata", postgresDataDir); err != nil {
+			a.log.Warnf("Cannot gather pod \"%s/%s\" pg_controldata: %s", namespace, pod.Name, err)
+		}
+
+		if pod.Labels[cnpgInstanceRoleLabel] == cnpgPrimaryRole {
+			primary = pod
+		}
+	}
+
+	if primary == nil {
+		a.log.Warnf("Cannot find running primary instance for cluster \"%s/%s\"", namespace, cluster)
+		return
+	}
+
+	a.gatherReplicationStatus(ctx, dir, primary, pods)
+}
+
+// gatherReplicationStatus queries the replication status on the primary and
+// writes the replication lag summary for all instances.
+func (a *PostgresAddon) gatherReplicationStatus(ctx context.Context, dir string, primary *corev1.Pod, pods []corev1.Pod) {
+	rc := NewRemoteCommand(primary, a.Options(), a.log, dir).
+		InContainer(postgresContainerName).
+		WithContext(ctx)
+	err := rc.GatherAs(replicationStatusName, postgresCommandTimeout,
+		"psql", "-X", "-A", "-F", "\t", "-P", "footer=off", "-c", replicationQuery)
+	if err != nil {
+		a.log.Warnf("Cannot query pod \"%s/%s\" replication status: %s", primary.Namespace, primary.Name, err)
+		return
+	}
+
+	src, err := os.Open(filepath.Join(dir, replicationStatusName))
+	if err != nil {
+		a.log.Warnf("Cannot open %q: %s", replicationStatusName, err)
+		return
+	}
+
+	defer src.Close()
+
+	statuses, err := parseReplicationStatus(src)
+	if err != nil {
+		a.log.Warnf("Cannot parse %q: %s", replicationStatusName, err)
+		return
+	}
+
+	// Job pods (e.g. initdb) have no instance role.
+	var replicas []string
+	for i := range pods {
+		if pods[i].Labels[cnpgInstanceRoleLabel] != "" && pods[i].Name != primary.Name {
+			replicas = append(replicas, pods[i].Name)
+		}
+	}
+
+	dst, err := createFile(dir, replicationReportName)
+	if err != nil {
+		a.log.Warnf("Cannot create %q: %s", replicationReportName, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if err := writeReplicationReport(dst, primary.Name, replicas, statuses); err != nil {
+		a.log.Warnf("Cannot write %q: %s", replicationReportName, err)
+	}
+}
+
+// parseReplicationStatus parses the tab separated replication query output,
+// starting with a header line.
+func parseReplicationStatus(r io.Reader) ([]replicationStatus, error) {
+	var statuses []replicationStatus
+
+	scanner := bufio.NewScanner(r)
+	header := true
+
+	for scanner.Scan() {
+		if header {
+			header = false
+			continue
+		}
+
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("invalid replication status line: %q", line)
+		}
+
+		statuses = append(statuses, replicationStatus{
+			Instance:  fields[0],
+			State:     fields[1],
+			SyncState: fields[2],
+			LagBytes:  fields[3],
+			ReplayLag: fields[4],
+		})
+	}
+
+	return statuses, scanner.Err()
+}
+
+// writeReplicationReport writes the replication status of every replica.
+// Replicas missing in the replication status are reported as not streaming.
+//
+//	INSTANCE   ROLE      STATE           SYNC    LAG-BYTES   REPLAY-LAG
+//	db-1       primary   -               -       -           -
+//	db-2       replica   streaming       async   0           00:00:00.0012
+//	db-3       replica   not streaming   -       -           -
+func writeReplicationReport(w io.Writer, primary string, replicas []string, statuses []replicationStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(tw, "INSTANCE\tROLE\tSTATE\tSYNC\tLAG-BYTES\tREPLAY-LAG")
+	fmt.Fprintf(tw, "%s\tprimary\t-\t-\t-\t-\n", primary)
+
+	slices.Sort(replicas)
+
+	for _, replica := range replicas {
+		i := slices.IndexFunc(statuses, func(s replicationStatus) bool {
+			return s.Instance == replica
+		})
+		if i == -1 {
+			fmt.Fprintf(tw, "%s\treplica\tnot streaming\t-\t-\t-\n", replica)
+			continue
+		}
+		s := &statuses[i]
+		fmt.Fprintf(tw, "%s\treplica\t%s\t%s\t%s\t%s\n",
+			replica, orDash(s.State), orDash(s.SyncState), orDash(s.LagBytes), orDash(s.ReplayLag))
+	}
+
+	return tw.Flush()
+}
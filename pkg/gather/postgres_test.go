@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReplicationReport(t *testing.T) {
+	output := "application_name\tstate\tsync_state\tlag_bytes\treplay_lag\n" +
+		"db-2\tstreaming\tasync\t0\t00:00:00.0012\n"
+
+	statuses, err := parseReplicationStatus(strings.NewReader(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []replicationStatus{
+		{Instance: "db-2", State: "streaming", SyncState: "async", LagBytes: "0", ReplayLag: "00:00:00.0012"},
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("expected %+v, got %+v", expected, statuses)
+	}
+
+	if _, err := parseReplicationStatus(strings.NewReader("header\ninvalid\n")); err == nil {
+		t.Error("invalid replication status parsed")
+	}
+
+	var buf bytes.Buffer
+	if err := writeReplicationReport(&buf, "db-1", []string{"db-3", "db-2"}, statuses); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got:\n%s", buf.String())
+	}
+	if !strings.HasPrefix(lines[1], "db-1") || !strings.Contains(lines[1], "primary") {
+		t.Errorf("unexpected primary line %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "db-2") || !strings.HasSuffix(lines[2], "00:00:00.0012") {
+		t.Errorf("unexpected streaming replica line %q", lines[2])
+	}
+	if !strings.HasPrefix(lines[3], "db-3") || !strings.Contains(lines[3], "not streaming") {
+		t.Errorf("unexpected missing replica line %q", lines[3])
+	}
+}
+
+func TestGatherPostgresCommandsReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	g, _ := newTestGathererIn(t, dir, Options{ReadOnly: true}, &fakeLister{})
+	a := &PostgresAddon{
+		AddonBackend: newGatherBackend(g, postgresName, addonRegistry[postgresName]),
+		log:          zap.NewNop().Sugar(),
+	}
+
+	pods := []corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "my-app",
+				Name:      "db-1",
+				Labels:    map[string]string{cnpgInstanceRoleLabel: cnpgPrimaryRole},
+			},
+			Spec:   corev1.PodSpec{Containers: []corev1.Container{{Name: postgresContainerName}}},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+	}
+	a.gatherCommands(context.Background(), "my-app", "db", pods)
+
+	addonDir := filepath.Join(dir, namespacesDir, "my-app", addonsDir, postgresName)
+	if _, err := os.Stat(addonDir); !os.IsNotExist(err) {
+		t.Errorf("commands gathered in read only mode: %v", err)
+	}
+}
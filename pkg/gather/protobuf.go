@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// newProtobufClient returns a rest client preferring protobuf responses.
+// Protobuf is supported only for built-in types; for other types the server
+// returns JSON.
+func newProtobufClient(config *rest.Config, httpClient *http.Client) (*rest.RESTClient, error) {
+	protobufConfig := rest.CopyConfig(config)
+	protobufConfig.GroupVersion = &schema.GroupVersion{}
+	protobufConfig.APIPath = "/"
+	protobufConfig.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+	protobufConfig.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
+	return rest.RESTClientForConfigAndClient(protobufConfig, httpClient)
+}
+
+// protobufListKind returns the list kind of resource r, and true if the list
+// kind is a built-in type that can be decoded from protobuf.
+func protobufListKind(r *resourceInfo) (schema.GroupVersionKind, bool) {
+	if r.Kind == "" {
+		return schema.GroupVersionKind{}, false
+	}
+	gvk := r.GroupVersion().WithKind(r.Kind + "List")
+	return gvk, scheme.Scheme.Recognizes(gvk)
+}
+
+// listProtobuf lists built-in resources using protobuf, calling fn
+// for every item converted to unstructured. Protobuf responses are smaller and
+// cheaper to encode on the server, but cannot be streamed, so the entire page
+// is decoded in memory.
+func (l *apiLister) listProtobuf(r *resourceInfo, namespace string, opts metav1.ListOptions, listKind schema.GroupVersionKind, fn func(*unstructured.Unstructured)) (*metav1.ListMeta, error) {
+	start := time.Now()
+
+	list, err := scheme.Scheme.New(listKind)
+	if err != nil {
+		return nil, err
+	}
+
+	result := l.protobuf.Get().
+		AbsPath(resourcePath(r, namespace)...).
+		SpecificallyVersionedParams(&opts, metav1.ParameterCodec, metav1.SchemeGroupVersion).
+		Do(context.TODO())
+
+	raw, err := result.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(len(raw))
+	l.limiter.Acquire(size)
+	defer l.limiter.Release(size)
+
+	if err := result.Into(list); err != nil {
+		return nil, err
+	}
+
+	listMeta, err := meta.ListAccessor(list)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, obj := range items {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		// Decoded items do not have apiVersion and kind.
+		item := &unstructured.Unstructured{Object: content}
+		item.SetAPIVersion(r.GroupVersion().String())
+		item.SetKind(r.Kind)
+
+		fn(item)
+	}
+
+	l.log.Debugf("Listed %d %q in %.3f seconds (protobuf)", len(items), r.Name(), time.Since(start).Seconds())
+
+	return &metav1.ListMeta{
+		ResourceVersion: listMeta.GetResourceVersion(),
+		Continue:        listMeta.GetContinue(),
+	}, nil
+}
@@ -4,43 +4,80 @@
 package gather
 
 import (
+	"context"
+	"sync"
+
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 )
 
 const (
 	pvcsName = "pvcs"
+
+	defaultClassAnnotation     = "storageclass.kubernetes.io/is-default-class"
+	betaDefaultClassAnnotation = "storageclass.beta.kubernetes.io/is-default-class"
 )
 
+var storageClassesResource = storagev1.SchemeGroupVersion.WithResource("storageclasses")
+
 type pvcsAddon struct {
 	AddonBackend
-	log *zap.SugaredLogger
+	client *dynamic.DynamicClient
+	log    *zap.SugaredLogger
+
+	// Namespaces with inspected snapshots.
+	mutex      sync.Mutex
+	namespaces map[string]struct{}
+
+	// The default storage class, looked up when needed.
+	defaultClassOnce sync.Once
+	defaultClass     string
 }
 
 func init() {
 	registerAddon(pvcsName, addonInfo{
-		Resource:  "persistentvolumeclaims",
+		Resources: []string{"persistentvolumeclaims"},
 		AddonFunc: NewPVCAddon,
+		Priority:  PriorityAddons,
 	})
 }
 
 func NewPVCAddon(backend AddonBackend) (Addon, error) {
+	client, err := dynamic.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
 	return &pvcsAddon{
 		AddonBackend: backend,
+		client:       client,
 		log:          backend.Options().Log.Named(pvcsName),
+		namespaces:   map[string]struct{}{},
 	}, nil
 }
 
 func (a *pvcsAddon) Inspect(pvc *unstructured.Unstructured) error {
+	namespace := pvc.GetNamespace()
+
+	// Snapshots are inspected once per namespace.
+	if a.addNamespace(namespace) {
+		a.QueueNamespace(namespace, func(context.Context) error {
+			a.gatherSnapshots(namespace)
+			return nil
+		})
+	}
+
 	// Needed only when gathering specific namespaces.
 	if len(a.Options().Namespaces) == 0 {
 		return nil
 	}
 
-	a.log.Debugf("Inspecting pvc \"%s/%s\"", pvc.GetNamespace(), pvc.GetName())
+	a.log.Debugf("Inspecting pvc \"%s/%s\"", namespace, pvc.GetName())
 
 	a.gatherPersistentVolume(pvc)
 	a.gatherStorageClass(pvc)
@@ -48,6 +85,18 @@ func (a *pvcsAddon) Inspect(pvc *unstructured.Unstructured) error {
 	return nil
 }
 
+func (a *pvcsAddon) addNamespace(namespace string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, ok := a.namespaces[namespace]; ok {
+		return false
+	}
+
+	a.namespaces[namespace] = struct{}{}
+	return true
+}
+
 func (a *pvcsAddon) gatherPersistentVolume(pvc *unstructured.Unstructured) {
 	name, found, err := unstructured.NestedString(pvc.Object, "spec", "volumeName")
 	if err != nil {
@@ -71,11 +120,38 @@ func (a *pvcsAddon) gatherStorageClass(pvc *unstructured.Unstructured) {
 			pvc.GetNamespace(), pvc.GetName(), err)
 		return
 	}
-	if name == "" || !found {
-		// TODO: Get the default storage class?
+	if !found {
+		// The default storage class is used when storageClassName is not
+		// set. An empty storageClassName means no storage class.
+		name = a.defaultStorageClass()
+	}
+
+	if name == "" {
 		return
 	}
 
-	gvr := storagev1.SchemeGroupVersion.WithResource("storageclasses")
-	a.GatherResource(gvr, types.NamespacedName{Name: name})
+	a.GatherResource(storageClassesResource, types.NamespacedName{Name: name})
+}
+
+// defaultStorageClass returns the name of the default storage class, or an
+// empty string if there is no default storage class.
+func (a *pvcsAddon) defaultStorageClass() string {
+	a.defaultClassOnce.Do(func() {
+		list, err := a.client.Resource(storageClassesResource).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			a.log.Warnf("Cannot list storage classes: %s", err)
+			return
+		}
+
+		for i := range list.Items {
+			annotations := list.Items[i].GetAnnotations()
+			if annotations[defaultClassAnnotation] == "true" || annotations[betaDefaultClassAnnotation] == "true" {
+				a.defaultClass = list.Items[i].GetName()
+				a.log.Debugf("Using default storage class %q", a.defaultClass)
+				return
+			}
+		}
+	})
+
+	return a.defaultClass
 }
@@ -0,0 +1,362 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	quotasName       = "quotas"
+	quotasReportName = "quotas-report.yaml"
+
+	// Quota usage percent flagged as near quota.
+	nearQuotaPercent = 90
+
+	// Annotation added by the LimitRanger admission plugin to pods with
+	// defaulted requests or limits.
+	limitRangerAnnotation = "kubernetes.io/limit-ranger"
+)
+
+// QuotasReport compares the resource quotas usage with the hard limits, and
+// the limit ranges with the actual pod requests in a namespace. Quota
+// exhaustion is a silent cause of stuck rollouts.
+type QuotasReport struct {
+	// AtQuota is true if any resource quota is exhausted.
+	AtQuota        bool               `json:"atQuota"`
+	ResourceQuotas []QuotaStatus      `json:"resourceQuotas,omitempty"`
+	LimitRanges    []LimitRangeStatus `json:"limitRanges,omitempty"`
+}
+
+// QuotaStatus describes the usage of a resource quota.
+type QuotaStatus struct {
+	Name      string          `json:"name"`
+	Resources []QuotaResource `json:"resources"`
+	Problems  []string        `json:"problems,omitempty"`
+}
+
+// QuotaResource describes the usage of a single resource in a quota.
+type QuotaResource struct {
+	Name    string `json:"name"`
+	Hard    string `json:"hard"`
+	Used    string `json:"used"`
+	Percent int64  `json:"percent"`
+}
+
+// LimitRangeStatus compares a limit range container limits with the
+// requests of the running containers.
+type LimitRangeStatus struct {
+	Name   string                `json:"name"`
+	Limits []LimitRangeResource  `json:"limits"`
+	Pods   *LimitRangePodsStatus `json:"pods,omitempty"`
+}
+
+// LimitRangeResource describes the container limits of a resource.
+type LimitRangeResource struct {
+	Resource       string `json:"resource"`
+	Default        string `json:"default,omitempty"`
+	DefaultRequest string `json:"defaultRequest,omitempty"`
+	Min            string `json:"min,omitempty"`
+	Max            string `json:"max,omitempty"`
+
+	// Smallest and largest request of the running containers.
+	MinRequest string `json:"minRequest,omitempty"`
+	MaxRequest string `json:"maxRequest,omitempty"`
+
+	Problems []string `json:"problems,omitempty"`
+}
+
+// LimitRangePodsStatus describes the running pods affected by the limit
+// ranges in the namespace.
+type LimitRangePodsStatus struct {
+	Containers int `json:"containers"`
+
+	// Number of pods with requests or limits set by the limit ranges.
+	Defaulted int `json:"defaulted"`
+}
+
+type quotasAddon struct {
+	AddonBackend
+	client *kubernetes.Clientset
+	log    *zap.SugaredLogger
+
+	// Namespaces with inspected quotas and limit ranges.
+	mutex      sync.Mutex
+	namespaces map[string]struct{}
+}
+
+func init() {
+	registerAddon(quotasName, addonInfo{
+		Resources: []string{"resourcequotas", "limitranges"},
+		AddonFunc: NewQuotasAddon,
+		Priority:  PriorityAddons,
+	})
+}
+
+func NewQuotasAddon(backend AddonBackend) (Addon, error) {
+	client, err := kubernetes.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	return &quotasAddon{
+		AddonBackend: backend,
+		client:       client,
+		log:          backend.Options().Log.Named(quotasName),
+		namespaces:   map[string]struct{}{},
+	}, nil
+}
+
+func (a *quotasAddon) Inspect(item *unstructured.Unstructured) error {
+	namespace := item.GetNamespace()
+
+	// Quotas and limit ranges are analyzed once per namespace.
+	if a.addNamespace(namespace) {
+		a.QueueNamespace(namespace, func(context.Context) error {
+			a.analyzeNamespace(namespace)
+			return nil
+		})
+	}
+
+	return nil
+}
+
+func (a *quotasAddon) addNamespace(namespace string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, ok := a.namespaces[namespace]; ok {
+		return false
+	}
+
+	a.namespaces[namespace] = struct{}{}
+	return true
+}
+
+func (a *quotasAddon) analyzeNamespace(namespace string) {
+	a.log.Debugf("Analyzing quotas and limit ranges in namespace %q", namespace)
+	ctx := context.TODO()
+	report := QuotasReport{}
+
+	quotas, err := a.client.CoreV1().ResourceQuotas(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		a.log.Warnf("Cannot list resourcequotas in namespace %q: %s", namespace, err)
+	} else {
+		for i := range quotas.Items {
+			status := inspectQuota(&quotas.Items[i])
+			if quotaExhausted(&quotas.Items[i]) {
+				report.AtQuota = true
+			}
+			report.ResourceQuotas = append(report.ResourceQuotas, status)
+		}
+	}
+
+	limitRanges, err := a.client.CoreV1().LimitRanges(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		a.log.Warnf("Cannot list limitranges in namespace %q: %s", namespace, err)
+	} else if len(limitRanges.Items) > 0 {
+		pods, err := a.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			a.log.Warnf("Cannot list pods in namespace %q: %s", namespace, err)
+		} else {
+			running := activePods(pods.Items)
+			for i := range limitRanges.Items {
+				report.LimitRanges = append(report.LimitRanges,
+					inspectLimitRange(&limitRanges.Items[i], running))
+			}
+		}
+	}
+
+	if len(report.ResourceQuotas) == 0 && len(report.LimitRanges) == 0 {
+		return
+	}
+
+	a.writeQuotasReport(namespace, &report)
+}
+
+func (a *quotasAddon) writeQuotasReport(namespace string, report *QuotasReport) {
+	data, err := yaml.Marshal(report)
+	if err != nil {
+		a.log.Warnf("Cannot encode %q: %s", quotasReportName, err)
+		return
+	}
+
+	dir, err := a.Output().CreateAddonDir(quotasName, namespacesDir, namespace)
+	if err != nil {
+		a.log.Warnf("Cannot create %q directory: %s", namespace, err)
+		return
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, quotasReportName), data, 0640); err != nil {
+		a.log.Warnf("Cannot write %q: %s", quotasReportName, err)
+	}
+}
+
+func inspectQuota(quota *corev1.ResourceQuota) QuotaStatus {
+	status := QuotaStatus{Name: quota.Name, Resources: []QuotaResource{}}
+
+	for _, name := range slices.Sorted(maps.Keys(quota.Status.Hard)) {
+		hard := quota.Status.Hard[name]
+		used := quota.Status.Used[name]
+
+		r := QuotaResource{
+			Name:    string(name),
+			Hard:    hard.String(),
+			Used:    used.String(),
+			Percent: quantityPercent(used, hard),
+		}
+		status.Resources = append(status.Resources, r)
+
+		switch {
+		case used.Cmp(hard) >= 0:
+			status.Problems = append(status.Problems, fmt.Sprintf("at quota for %s: used %s of %s", name, r.Used, r.Hard))
+		case r.Percent >= nearQuotaPercent:
+			status.Problems = append(status.Problems, fmt.Sprintf("near quota for %s: used %d%%", name, r.Percent))
+		}
+	}
+
+	return status
+}
+
+// quotaExhausted returns true if any resource in quota is used up. New pods
+// or objects consuming this resource will be rejected.
+func quotaExhausted(quota *corev1.ResourceQuota) bool {
+	for name, hard := range quota.Status.Hard {
+		used := quota.Status.Used[name]
+		if used.Cmp(hard) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// quantityPercent returns used as percent of hard.
+func quantityPercent(used resource.Quantity, hard resource.Quantity) int64 {
+	if hard.IsZero() {
+		if used.IsZero() {
+			return 0
+		}
+		return 100
+	}
+	return int64(used.AsApproximateFloat64() / hard.AsApproximateFloat64() * 100)
+}
+
+// activePods returns the pods counted by quotas: pods that did not
+// terminate.
+func activePods(pods []corev1.Pod) []corev1.Pod {
+	var active []corev1.Pod
+	for i := range pods {
+		switch pods[i].Status.Phase {
+		case corev1.PodSucceeded, corev1.PodFailed:
+		default:
+			active = append(active, pods[i])
+		}
+	}
+	return active
+}
+
+func inspectLimitRange(lr *corev1.LimitRange, pods []corev1.Pod) LimitRangeStatus {
+	status := LimitRangeStatus{Name: lr.Name, Limits: []LimitRangeResource{}}
+
+	var containers []corev1.Container
+	defaulted := 0
+	for i := range pods {
+		containers = append(containers, pods[i].Spec.Containers...)
+		if _, ok := pods[i].Annotations[limitRangerAnnotation]; ok {
+			defaulted++
+		}
+	}
+
+	for _, item := range lr.Spec.Limits {
+		if item.Type != corev1.LimitTypeContainer {
+			continue
+		}
+
+		names := map[corev1.ResourceName]struct{}{}
+		for _, list := range []corev1.ResourceList{item.Default, item.DefaultRequest, item.Min, item.Max} {
+			for name := range list {
+				names[name] = struct{}{}
+			}
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(names)) {
+			status.Limits = append(status.Limits, inspectLimitRangeResource(&item, name, containers))
+		}
+	}
+
+	if len(status.Limits) > 0 {
+		status.Pods = &LimitRangePodsStatus{Containers: len(containers), Defaulted: defaulted}
+	}
+
+	return status
+}
+
+func inspectLimitRangeResource(item *corev1.LimitRangeItem, name corev1.ResourceName, containers []corev1.Container) LimitRangeResource {
+	r := LimitRangeResource{
+		Resource:       string(name),
+		Default:        quantityString(item.Default, name),
+		DefaultRequest: quantityString(item.DefaultRequest, name),
+		Min:            quantityString(item.Min, name),
+		Max:            quantityString(item.Max, name),
+	}
+
+	var minRequest, maxRequest *resource.Quantity
+	belowMin, aboveMax := 0, 0
+
+	for i := range containers {
+		request, ok := containers[i].Resources.Requests[name]
+		if !ok {
+			continue
+		}
+		if minRequest == nil || request.Cmp(*minRequest) < 0 {
+			minRequest = &request
+		}
+		if maxRequest == nil || request.Cmp(*maxRequest) > 0 {
+			maxRequest = &request
+		}
+		if min, ok := item.Min[name]; ok && request.Cmp(min) < 0 {
+			belowMin++
+		}
+		if max, ok := item.Max[name]; ok && request.Cmp(max) > 0 {
+			aboveMax++
+		}
+	}
+
+	if minRequest != nil {
+		r.MinRequest = minRequest.String()
+		r.MaxRequest = maxRequest.String()
+	}
+
+	// Limit ranges are enforced only on new pods, so pods created before the
+	// limit range was changed will be rejected when recreated.
+	if belowMin > 0 {
+		r.Problems = append(r.Problems, fmt.Sprintf("%d containers request less than min %s", belowMin, r.Min))
+	}
+	if aboveMax > 0 {
+		r.Problems = append(r.Problems, fmt.Sprintf("%d containers request more than max %s", aboveMax, r.Max))
+	}
+
+	return r
+}
+
+func quantityString(list corev1.ResourceList, name corev1.ResourceName) string {
+	if q, ok := list[name]; ok {
+		return q.String()
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInspectQuota(t *testing.T) {
+	quota := &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "compute"},
+		Status: corev1.ResourceQuotaStatus{
+			Hard: corev1.ResourceList{
+				corev1.ResourcePods:           resource.MustParse("4"),
+				corev1.ResourceRequestsCPU:    resource.MustParse("2"),
+				corev1.ResourceRequestsMemory: resource.MustParse("4Gi"),
+			},
+			Used: corev1.ResourceList{
+				corev1.ResourcePods:           resource.MustParse("4"),
+				corev1.ResourceRequestsCPU:    resource.MustParse("1900m"),
+				corev1.ResourceRequestsMemory: resource.MustParse("1Gi"),
+			},
+		},
+	}
+	expected := QuotaStatus{
+		Name: "compute",
+		Resources: []QuotaResource{
+			{Name: "pods", Hard: "4", Used: "4", Percent: 100},
+			{Name: "requests.cpu", Hard: "2", Used: "1900m", Percent: 95},
+			{Name: "requests.memory", Hard: "4Gi", Used: "1Gi", Percent: 25},
+		},
+		Problems: []string{
+			"at quota for pods: used 4 of 4",
+			"near quota for requests.cpu: used 95%",
+		},
+	}
+	status := inspectQuota(quota)
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("expected %+v, got %+v", expected, status)
+	}
+	if !quotaExhausted(quota) {
+		t.Error("expected quota exhausted")
+	}
+}
+
+func TestInspectLimitRange(t *testing.T) {
+	lr := &corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{Name: "defaults"},
+		Spec: corev1.LimitRangeSpec{
+			Limits: []corev1.LimitRangeItem{
+				{
+					Type: corev1.LimitTypePod,
+					Max:  corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")},
+				},
+				{
+					Type:           corev1.LimitTypeContainer,
+					DefaultRequest: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+					Max:            corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+				},
+			},
+		},
+	}
+	container := func(cpu string) corev1.Container {
+		return corev1.Container{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+			},
+		}
+	}
+	pods := []corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "defaulted",
+				Annotations: map[string]string{limitRangerAnnotation: "LimitRanger plugin set: cpu request for container app"},
+			},
+			Spec:   corev1.PodSpec{Containers: []corev1.Container{container("100m")}},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "large"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{container("2"), container("500m")}},
+			Status:     corev1.PodStatus{Phase: corev1.PodPending},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "completed"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{container("8")}},
+			Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+		},
+	}
+	expected := LimitRangeStatus{
+		Name: "defaults",
+		Limits: []LimitRangeResource{
+			{
+				Resource:       "cpu",
+				DefaultRequest: "100m",
+				Max:            "1",
+				MinRequest:     "100m",
+				MaxRequest:     "2",
+				Problems:       []string{"1 containers request more than max 1"},
+			},
+		},
+		Pods: &LimitRangePodsStatus{Containers: 3, Defaulted: 1},
+	}
+	status := inspectLimitRange(lr, activePods(pods))
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("expected %+v, got %+v", expected, status)
+	}
+}
@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	rawDir = "raw"
+
+	// Placeholders expanded in raw endpoints.
+	nodePlaceholder      = "{node}"
+	namespacePlaceholder = "{namespace}"
+)
+
+// RawEndpointFailed is recorded in the error report when getting a raw
+// endpoint failed.
+const RawEndpointFailed = "RawEndpointFailed"
+
+// gatherRawEndpoints queues gathering of the raw endpoints in the gathered
+// namespaces.
+func (g *Gatherer) gatherRawEndpoints(namespaces []string) {
+	for _, endpoint := range g.opts.RawEndpoints {
+		nodes := []string{""}
+		if strings.Contains(endpoint, nodePlaceholder) {
+			var err error
+			nodes, err = g.listNodes()
+			if err != nil {
+				g.log.Warnf("Cannot list nodes for %q: %s", endpoint, err)
+				continue
+			}
+		}
+
+		endpointNamespaces := []string{""}
+		if strings.Contains(endpoint, namespacePlaceholder) {
+			endpointNamespaces = namespaces
+			if len(namespaces) == 1 && namespaces[0] == metav1.NamespaceAll {
+				var err error
+				endpointNamespaces, err = g.listNamespaces()
+				if err != nil {
+					g.log.Warnf("Cannot list namespaces for %q: %s", endpoint, err)
+					continue
+				}
+			}
+		}
+
+		for _, node := range nodes {
+			for _, namespace := range endpointNamespaces {
+				uri := strings.ReplaceAll(endpoint, nodePlaceholder, url.PathEscape(node))
+				uri = strings.ReplaceAll(uri, namespacePlaceholder, url.PathEscape(namespace))
+				g.wq.Queue(func() error {
+					g.gatherRawEndpoint(uri, namespace)
+					return nil
+				})
+			}
+		}
+	}
+}
+
+// gatherRawEndpoint gets uri from the API server and stores the response in
+// the raw directory of namespace, or in the cluster raw directory if
+// namespace is empty.
+func (g *Gatherer) gatherRawEndpoint(uri string, namespace string) {
+	src, err := g.stream.Get().RequestURI(uri).Stream(context.TODO())
+	if err != nil {
+		g.log.Warnf("Cannot get %q: %s", uri, err)
+		g.errors.Add(GatherError{
+			Resource:  uri,
+			Namespace: namespace,
+			Reason:    RawEndpointFailed,
+			Kind:      ErrorKind(err),
+			Message:   err.Error(),
+		})
+		return
+	}
+
+	defer src.Close()
+
+	relpath := rawEndpointPath(uri, namespace)
+	dst, err := g.output.CreateResource(relpath)
+	if err != nil {
+		g.log.Warnf("Cannot create %q: %s", relpath, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		g.log.Warnf("Cannot write %q: %s", relpath, err)
+		return
+	}
+
+	g.log.Debugf("Gathered raw endpoint %q", uri)
+}
+
+// rawEndpointPath returns the path of a raw endpoint response relative to the
+// cluster directory. The path of the endpoint is kept, so
+// "/api/v1/nodes/node1/proxy/stats/summary" is stored in
+// "cluster/raw/api/v1/nodes/node1/proxy/stats/summary".
+func rawEndpointPath(uri string, namespace string) string {
+	p := uri
+	if u, err := url.Parse(uri); err == nil {
+		p = u.Path
+	}
+
+	var segments []string
+	if namespace != "" {
+		segments = append(segments, namespacesDir, namespace, rawDir)
+	} else {
+		segments = append(segments, clusterDir, rawDir)
+	}
+
+	for _, s := range strings.Split(p, "/") {
+		if s == "" || s == "." || s == ".." {
+			continue
+		}
+		segments = append(segments, SafeName(s))
+	}
+
+	return shortenPath(path.Join(segments...))
+}
+
+// listNodes returns the names of all nodes in the cluster.
+func (g *Gatherer) listNodes() ([]string, error) {
+	gvr := corev1.SchemeGroupVersion.WithResource("nodes")
+	list, err := g.metadata.Resource(gvr).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []string
+	for i := range list.Items {
+		nodes = append(nodes, list.Items[i].Name)
+	}
+
+	return nodes, nil
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// ErrReadOnly is returned for requests modifying the cluster in read only
+// mode.
+var ErrReadOnly = errors.New("read only gather")
+
+// Paths used by agents for creating and deleting agent pods, and running
+// commands in pods.
+var (
+	podsPath = regexp.MustCompile(`^/api/v1/namespaces/[^/]+/pods$`)
+	podPath  = regexp.MustCompile(`^/api/v1/namespaces/[^/]+/pods/[^/]+$`)
+	execPath = regexp.MustCompile(`^/api/v1/namespaces/[^/]+/pods/[^/]+/exec$`)
+)
+
+// AgentsAllowed returns true if addons may create agent pods and run commands
+// in pods.
+func (o *Options) AgentsAllowed() bool {
+	return !o.ReadOnly || o.AllowAgents
+}
+
+// readOnlyGuard rejects API requests modifying the cluster. If allowAgents is
+// true, requests needed for agents are allowed.
+type readOnlyGuard struct {
+	rt          http.RoundTripper
+	allowAgents bool
+}
+
+func newReadOnlyGuard(allowAgents bool) func(http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &readOnlyGuard{rt: rt, allowAgents: allowAgents}
+	}
+}
+
+func (g *readOnlyGuard) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !g.allowed(req) {
+		return nil, fmt.Errorf("%w: rejected %s %s", ErrReadOnly, req.Method, req.URL.Path)
+	}
+	return g.rt.RoundTrip(req)
+}
+
+func (g *readOnlyGuard) allowed(req *http.Request) bool {
+	// Running commands may use GET or POST for upgrading the connection.
+	if execPath.MatchString(req.URL.Path) {
+		return g.allowAgents
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		return g.allowAgents && podsPath.MatchString(req.URL.Path)
+	case http.MethodDelete:
+		return g.allowAgents && podPath.MatchString(req.URL.Path)
+	default:
+		return false
+	}
+}
+
+// checkAgentsAllowed returns an error if running commands in pods is not
+// allowed. Commands run with kubectl do not use the gather transport, so
+// they must be checked explicitly.
+func checkAgentsAllowed(opts *Options) error {
+	if !opts.AgentsAllowed() {
+		return fmt.Errorf("%w: running commands in pods is not allowed (use --allow-agents)", ErrReadOnly)
+	}
+	return nil
+}
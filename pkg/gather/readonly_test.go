@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadOnlyGuard(t *testing.T) {
+	cases := []struct {
+		method      string
+		path        string
+		allowAgents bool
+		allowed     bool
+	}{
+		{"GET", "/api/v1/pods", false, true},
+		{"GET", "/apis/apps/v1/namespaces/ns/deployments/name", false, true},
+		{"POST", "/api/v1/namespaces/default/pods", false, false},
+		{"POST", "/api/v1/namespaces/default/pods", true, true},
+		{"DELETE", "/api/v1/namespaces/default/pods/agent", false, false},
+		{"DELETE", "/api/v1/namespaces/default/pods/agent", true, true},
+		{"GET", "/api/v1/namespaces/rook-ceph/pods/tools/exec", false, false},
+		{"POST", "/api/v1/namespaces/rook-ceph/pods/tools/exec", false, false},
+		{"POST", "/api/v1/namespaces/rook-ceph/pods/tools/exec", true, true},
+		{"DELETE", "/api/v1/namespaces/default", true, false},
+		{"PUT", "/api/v1/namespaces/default/pods/agent", true, false},
+		{"PATCH", "/apis/apps/v1/namespaces/ns/deployments/name", true, false},
+		{"POST", "/apis/batch/v1/namespaces/ns/jobs", true, false},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "https://cluster"+c.path, nil)
+		guard := &readOnlyGuard{allowAgents: c.allowAgents}
+		if allowed := guard.allowed(req); allowed != c.allowed {
+			t.Errorf("%s %s (allow agents %v): expected allowed %v, got %v",
+				c.method, c.path, c.allowAgents, c.allowed, allowed)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// Maximum number of events in a cluster timeline. Older events are dropped.
+const maxReportEvents = 1000
+
+//go:embed report.html
+var reportTemplate string
+
+// Finding severities.
+const (
+	SeverityError   = "Error"
+	SeverityWarning = "Warning"
+)
+
+// Report summarizes a gather directory.
+type Report struct {
+	Directory string
+	Generated time.Time
+	Clusters  []ClusterReport
+}
+
+type ClusterReport struct {
+	Name       string
+	Metadata   *Metadata
+	Resources  int
+	Findings   []Finding
+	Namespaces []NamespaceReport
+	Events     []EventRow
+
+	// Number of events dropped from the timeline.
+	DroppedEvents int
+}
+
+// Finding is a problem found in the gathered data.
+type Finding struct {
+	Severity string
+	Source   string
+	Message  string
+}
+
+type NamespaceReport struct {
+	Name      string
+	Workloads []WorkloadRow
+}
+
+// WorkloadRow describes the state of a deployment, stateful set, daemon set
+// or pod.
+type WorkloadRow struct {
+	Kind     string
+	Name     string
+	Ready    string
+	Status   string
+	Restarts int64
+	Healthy  bool
+}
+
+type EventRow struct {
+	Time      string
+	Type      string
+	Namespace string
+	Object    string
+	Reason    string
+	Message   string
+}
+
+// NewReport creates a report for the gather directory.
+func NewReport(directory string) (*Report, error) {
+	clusterDirs, err := FindClusterDirs(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(clusterDirs) == 0 {
+		return nil, fmt.Errorf("no cluster directory found in %q", directory)
+	}
+
+	report := &Report{
+		Directory: directory,
+		Generated: time.Now(),
+	}
+
+	for _, dir := range clusterDirs {
+		cluster, err := newClusterReport(directory, dir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create report for %q: %s", dir, err)
+		}
+		report.Clusters = append(report.Clusters, *cluster)
+	}
+
+	return report, nil
+}
+
+// WriteHTML writes the report as a static HTML page.
+func (r *Report) WriteHTML(w io.Writer) error {
+	tmpl, err := template.New("report").Parse(reportTemplate)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, r)
+}
+
+func newClusterReport(directory string, dir string) (*ClusterReport, error) {
+	name, err := filepath.Rel(directory, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ReadIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := &ClusterReport{Name: name, Resources: len(entries)}
+
+	metadata, err := readReportFile[Metadata](dir, metadataName)
+	if err != nil {
+		return nil, err
+	}
+	cluster.Metadata = metadata
+
+	if err := cluster.addFindings(dir); err != nil {
+		return nil, err
+	}
+
+	namespaces := map[string]*NamespaceReport{}
+
+	for _, entry := range entries {
+		var kind string
+		switch entry.Resource {
+		case "apps/deployments", "apps/statefulsets", "apps/daemonsets", "pods":
+			kind = entry.Resource
+		case "events.k8s.io/events":
+			item, err := ReadResource(dir, entry)
+			if err != nil {
+				return nil, err
+			}
+			cluster.Events = append(cluster.Events, eventRow(item))
+			continue
+		default:
+			continue
+		}
+
+		item, err := ReadResource(dir, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		ns, ok := namespaces[entry.Namespace]
+		if !ok {
+			ns = &NamespaceReport{Name: entry.Namespace}
+			namespaces[entry.Namespace] = ns
+		}
+
+		row := workloadRow(kind, item)
+		ns.Workloads = append(ns.Workloads, row)
+
+		if kind == "pods" && !row.Healthy {
+			cluster.Findings = append(cluster.Findings, Finding{
+				Severity: SeverityWarning,
+				Source:   "pods",
+				Message:  fmt.Sprintf("Pod %s/%s is %s", entry.Namespace, entry.Name, row.Status),
+			})
+		}
+	}
+
+	for _, ns := range namespaces {
+		cluster.Namespaces = append(cluster.Namespaces, *ns)
+	}
+	slices.SortFunc(cluster.Namespaces, func(a, b NamespaceReport) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	slices.SortFunc(cluster.Events, func(a, b EventRow) int {
+		return strings.Compare(a.Time, b.Time)
+	})
+	if len(cluster.Events) > maxReportEvents {
+		cluster.DroppedEvents = len(cluster.Events) - maxReportEvents
+		cluster.Events = cluster.Events[cluster.DroppedEvents:]
+	}
+
+	return cluster, nil
+}
+
+// addFindings adds findings from the reports written during the gather.
+func (c *ClusterReport) addFindings(dir string) error {
+	if c.Metadata != nil && c.Metadata.Interrupted {
+		c.Findings = append(c.Findings, Finding{
+			Severity: SeverityError,
+			Source:   metadataName,
+			Message:  "Gather was interrupted, the data is partial",
+		})
+	}
+
+	if c.Metadata != nil {
+		for _, partial := range c.Metadata.PartialNamespaces {
+			c.Findings = append(c.Findings, Finding{
+				Severity: SeverityWarning,
+				Source:   metadataName,
+				Message: fmt.Sprintf("Namespace %q is partially gathered, failed: %s",
+					partial.Namespace, strings.Join(partial.FailedResources, ", ")),
+			})
+		}
+	}
+
+	gatherErrors, err := readReportFile[[]GatherError](dir, errorsName)
+	if err != nil {
+		return err
+	}
+	if gatherErrors != nil {
+		for _, e := range *gatherErrors {
+			c.Findings = append(c.Findings, Finding{
+				Severity: SeverityError,
+				Source:   errorsName,
+				Message:  fmt.Sprintf("%s: %s %s/%s: %s", e.Reason, e.Resource, e.Namespace, e.Name, e.Message),
+			})
+		}
+	}
+
+	apiServices, err := readReportFile[APIServicesReport](dir, filepath.Join(clusterDir, apiServicesReportName))
+	if err != nil {
+		return err
+	}
+	if apiServices != nil {
+		for _, g := range apiServices.FailedGroups {
+			c.Findings = append(c.Findings, Finding{
+				Severity: SeverityError,
+				Source:   apiServicesReportName,
+				Message:  fmt.Sprintf("Discovery of %s failed: %s", g.GroupVersion, g.Error),
+			})
+		}
+		for _, s := range apiServices.APIServices {
+			if s.Available == "True" {
+				continue
+			}
+			c.Findings = append(c.Findings, Finding{
+				Severity: SeverityError,
+				Source:   apiServicesReportName,
+				Message:  fmt.Sprintf("API service %s is not available: %s", s.Name, s.Message),
+			})
+		}
+	}
+
+	snapshotsReports, err := filepath.Glob(filepath.Join(dir, addonsDir, "pvcs", namespacesDir, "*", snapshotsReportName))
+	if err != nil {
+		return err
+	}
+	for _, path := range snapshotsReports {
+		rel, _ := filepath.Rel(dir, path)
+		snapshots, err := readReportFile[[]SnapshotStatus](dir, rel)
+		if err != nil {
+			return err
+		}
+		namespace := filepath.Base(filepath.Dir(path))
+		for _, s := range *snapshots {
+			for _, problem := range s.Problems {
+				c.Findings = append(c.Findings, Finding{
+					Severity: SeverityWarning,
+					Source:   snapshotsReportName,
+					Message:  fmt.Sprintf("Snapshot %s/%s: %s", namespace, s.Name, problem),
+				})
+			}
+		}
+	}
+
+	availabilityReports, err := filepath.Glob(filepath.Join(dir, addonsDir, availabilityName, namespacesDir, "*", availabilityReportName))
+	if err != nil {
+		return err
+	}
+	for _, path := range availabilityReports {
+		rel, _ := filepath.Rel(dir, path)
+		availability, err := readReportFile[AvailabilityReport](dir, rel)
+		if err != nil {
+			return err
+		}
+		namespace := filepath.Base(filepath.Dir(path))
+		for _, h := range availability.HorizontalPodAutoscalers {
+			for _, problem := range h.Problems {
+				c.Findings = append(c.Findings, Finding{
+					Severity: SeverityWarning,
+					Source:   availabilityReportName,
+					Message:  fmt.Sprintf("HorizontalPodAutoscaler %s/%s: %s", namespace, h.Name, problem),
+				})
+			}
+		}
+		for _, p := range availability.PodDisruptionBudgets {
+			for _, problem := range p.Problems {
+				c.Findings = append(c.Findings, Finding{
+					Severity: SeverityWarning,
+					Source:   availabilityReportName,
+					Message:  fmt.Sprintf("PodDisruptionBudget %s/%s: %s", namespace, p.Name, problem),
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+// readReportFile reads a JSON or YAML file from the cluster directory.
+// Returns nil if the file does not exist.
+func readReportFile[T any](dir string, name string) (*T, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var value T
+	if strings.HasSuffix(name, ".json") {
+		err = json.Unmarshal(data, &value)
+	} else {
+		err = yaml.Unmarshal(data, &value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %q: %s", name, err)
+	}
+
+	return &value, nil
+}
+
+func workloadRow(resource string, item *unstructured.Unstructured) WorkloadRow {
+	row := WorkloadRow{Kind: item.GetKind(), Name: item.GetName()}
+
+	if resource == "pods" {
+		phase, _, _ := unstructured.NestedString(item.Object, "status", "phase")
+		if phase == "" {
+			phase = "Unknown"
+		}
+		row.Status = phase
+		row.Healthy = phase == "Running" || phase == "Succeeded"
+
+		statuses, _, _ := unstructured.NestedSlice(item.Object, "status", "containerStatuses")
+		ready := 0
+		for _, s := range statuses {
+			status, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if isReady, _ := status["ready"].(bool); isReady {
+				ready++
+			}
+			restarts, _, _ := unstructured.NestedInt64(status, "restartCount")
+			row.Restarts += restarts
+			if reason, _, _ := unstructured.NestedString(status, "state", "waiting", "reason"); reason != "" {
+				row.Status = reason
+				row.Healthy = false
+			}
+		}
+		row.Ready = fmt.Sprintf("%d/%d", ready, len(statuses))
+		return row
+	}
+
+	var desired int64
+	var ready int64
+	if resource == "apps/daemonsets" {
+		desired, _, _ = unstructured.NestedInt64(item.Object, "status", "desiredNumberScheduled")
+		ready, _, _ = unstructured.NestedInt64(item.Object, "status", "numberReady")
+	} else {
+		var found bool
+		desired, found, _ = unstructured.NestedInt64(item.Object, "spec", "replicas")
+		if !found {
+			desired = 1
+		}
+		ready, _, _ = unstructured.NestedInt64(item.Object, "status", "readyReplicas")
+	}
+
+	row.Ready = fmt.Sprintf("%d/%d", ready, desired)
+	row.Healthy = ready >= desired
+	if row.Healthy {
+		row.Status = "Ready"
+	} else {
+		row.Status = "NotReady"
+	}
+
+	return row
+}
+
+func eventRow(item *unstructured.Unstructured) EventRow {
+	row := EventRow{Namespace: item.GetNamespace()}
+
+	for _, field := range [][]string{
+		{"eventTime"},
+		{"series", "lastObservedTime"},
+		{"deprecatedLastTimestamp"},
+		{"metadata", "creationTimestamp"},
+	} {
+		if value, _, _ := unstructured.NestedString(item.Object, field...); value != "" {
+			row.Time = value
+			break
+		}
+	}
+
+	row.Type, _, _ = unstructured.NestedString(item.Object, "type")
+	row.Reason, _, _ = unstructured.NestedString(item.Object, "reason")
+	row.Message, _, _ = unstructured.NestedString(item.Object, "note")
+
+	kind, _, _ := unstructured.NestedString(item.Object, "regarding", "kind")
+	name, _, _ := unstructured.NestedString(item.Object, "regarding", "name")
+	if kind != "" {
+		row.Object = kind + "/" + name
+	}
+
+	return row
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const requestLogName = "requests.log"
+
+// requestLog records every API request made by the gatherer in requests.log
+// in the cluster directory, for debugging the gather performance, and to show
+// exactly what was accessed. Lines are written when the response headers are
+// received, so the latency does not include reading streamed responses.
+type requestLog struct {
+	mutex sync.Mutex
+	file  io.WriteCloser
+}
+
+// newRequestLog creates the request log. When appending, requests are
+// appended to the log of the previous gathers.
+func newRequestLog(output *OutputDirectory, appending bool) (*requestLog, error) {
+	create := output.CreateFile
+	if appending {
+		create = output.AppendFile
+	}
+
+	file, err := create(requestLogName)
+	if err != nil {
+		return nil, err
+	}
+	return &requestLog{file: file}, nil
+}
+
+// Wrap returns a round tripper logging requests to l, used as
+// rest.Config.WrapTransport.
+func (l *requestLog) Wrap(rt http.RoundTripper) http.RoundTripper {
+	return &requestLogger{rt: rt, log: l}
+}
+
+// Close closes the log. Requests made after closing are not logged.
+func (l *requestLog) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (l *requestLog) write(start time.Time, req *http.Request, status string) {
+	line := fmt.Sprintf("%s %s %s %s %.3f\n",
+		start.UTC().Format(time.RFC3339Nano),
+		req.Method,
+		req.URL.RequestURI(),
+		status,
+		time.Since(start).Seconds(),
+	)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return
+	}
+
+	// Logging must not fail the request.
+	_, _ = io.WriteString(l.file, line)
+}
+
+type requestLogger struct {
+	rt  http.RoundTripper
+	log *requestLog
+}
+
+func (r *requestLogger) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	res, err := r.rt.RoundTrip(req)
+	if err != nil {
+		r.log.write(start, req, fmt.Sprintf("%q", err.Error()))
+		return res, err
+	}
+
+	r.log.write(start, req, fmt.Sprint(res.StatusCode))
+	return res, nil
+}
@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRequestLog(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	dir := t.TempDir()
+	requests, err := newRequestLog(NewOutputDirectory(dir), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: requests.Wrap(http.DefaultTransport)}
+	res, err := client.Get(server.URL + "/api/v1/pods?limit=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if err := requests.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, requestLogName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) != 5 || fields[1] != "GET" || fields[2] != "/api/v1/pods?limit=100" || fields[3] != "404" {
+		t.Errorf("unexpected request log %q", data)
+	}
+}
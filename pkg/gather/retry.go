@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Timeout for retried addon work if the addon timeout is not set. Retried
+// work gets twice the addon timeout.
+const defaultRetryTimeout = 10 * time.Minute
+
+// failedOperation is a list, get or log operation that failed and recorded
+// errors for resource in namespace with name (empty for lists).
+type failedOperation struct {
+	Resource  string
+	Namespace string
+	Name      string
+	Work      WorkFunc
+}
+
+// retryList collects failed operations from all workers.
+type retryList struct {
+	mutex      sync.Mutex
+	operations []failedOperation
+	retrying   bool
+}
+
+// Add records a failed operation. Operations failing when retrying are not
+// recorded, since every operation is retried once.
+func (l *retryList) Add(op failedOperation) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !l.retrying {
+		l.operations = append(l.operations, op)
+	}
+}
+
+// Retrying returns the failed operations and stops recording operations.
+func (l *retryList) Retrying() []failedOperation {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.retrying = true
+	return l.operations
+}
+
+// canRetry returns true if an operation failing with err may succeed on a
+// second attempt. Operations that are not allowed will fail again.
+func canRetry(err error) bool {
+	err = wrapAPIError(err)
+	return !errors.Is(err, ErrListForbidden) && !errors.Is(err, ErrReadOnly)
+}
+
+// retryTimeout returns the timeout for retried addon work.
+func retryTimeout(addonTimeout time.Duration) time.Duration {
+	if addonTimeout == 0 {
+		return defaultRetryTimeout
+	}
+	return 2 * addonTimeout
+}
+
+// retryLater records an operation failing with err for retrying when the
+// gather completes. The operation must record its errors in the error report
+// for resource in namespace with name.
+func (g *Gatherer) retryLater(resource string, namespace string, name string, err error, work WorkFunc) {
+	if !g.opts.RetryFailed || !canRetry(err) {
+		return
+	}
+	g.retries.Add(failedOperation{Resource: resource, Namespace: namespace, Name: name, Work: work})
+}
+
+// retryFailed retries the failed operations once, serially, since most
+// transient failures succeed on a quieter second pass. The errors recorded by
+// the failed operations are replaced by the errors recorded when retrying.
+func (g *Gatherer) retryFailed() error {
+	operations := g.retries.Retrying()
+	if len(operations) == 0 || g.Interrupted() {
+		return nil
+	}
+
+	start := time.Now()
+	g.log.Infof("Retrying %d failed operations", len(operations))
+
+	for _, op := range operations {
+		g.errors.Remove(op.Resource, op.Namespace, op.Name)
+	}
+	g.errors.Retrying()
+
+	g.wq.Restart(1)
+	for _, op := range operations {
+		g.wq.Queue(op.Work)
+	}
+	err := g.wq.Wait()
+
+	failed := 0
+	for _, op := range operations {
+		if g.errors.Has(op.Resource, op.Namespace, op.Name) {
+			failed++
+		}
+	}
+
+	g.timing.Retry = time.Since(start).Seconds()
+	g.log.Infof("Retried %d failed operations in %.3f seconds: %d succeeded, %d still failing",
+		len(operations), g.timing.Retry, len(operations)-failed, failed)
+
+	return err
+}
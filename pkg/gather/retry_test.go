@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRetryFailed(t *testing.T) {
+	t.Run("succeeded", func(t *testing.T) {
+		lister := &fakeLister{items: newItems(3), err: errors.NewServiceUnavailable("try later")}
+		g, dumper := newTestGatherer(t, Options{RetryFailed: true}, lister)
+
+		g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+		if g.errors.Len() != 1 {
+			t.Fatalf("expected 1 error, got %+v", g.errors.Errors())
+		}
+
+		lister.err = nil
+		if err := g.retryFailed(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(dumper.items) != 3 {
+			t.Errorf("expected 3 items, got %d", len(dumper.items))
+		}
+		if errs := g.errors.Errors(); len(errs) != 0 {
+			t.Errorf("expected no errors, got %+v", errs)
+		}
+	})
+
+	t.Run("still failing", func(t *testing.T) {
+		lister := &fakeLister{err: errors.NewServiceUnavailable("try later")}
+		g, _ := newTestGatherer(t, Options{RetryFailed: true}, lister)
+
+		g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+		if err := g.retryFailed(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(lister.calls) != 2 {
+			t.Errorf("expected 2 list calls, got %d", len(lister.calls))
+		}
+		errs := g.errors.Errors()
+		if len(errs) != 1 || !errs[0].Retried {
+			t.Errorf("expected retried error, got %+v", errs)
+		}
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		lister := &fakeLister{err: errors.NewForbidden(schema.GroupResource{Resource: "persistentvolumes"}, "", nil)}
+		g, _ := newTestGatherer(t, Options{RetryFailed: true}, lister)
+
+		g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+		if err := g.retryFailed(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(lister.calls) != 1 {
+			t.Errorf("expected 1 list call, got %d", len(lister.calls))
+		}
+		errs := g.errors.Errors()
+		if len(errs) != 1 || errs[0].Retried {
+			t.Errorf("expected error not retried, got %+v", errs)
+		}
+	})
+}
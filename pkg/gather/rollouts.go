@@ -0,0 +1,331 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	rolloutsName = "rollouts"
+
+	deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+	changeCauseAnnotation        = "kubernetes.io/change-cause"
+)
+
+var (
+	replicaSetsResource         = appsv1.SchemeGroupVersion.WithResource("replicasets")
+	controllerRevisionsResource = appsv1.SchemeGroupVersion.WithResource("controllerrevisions")
+)
+
+// rolloutRevision is a revision of a workload pod template, stored in a
+// ReplicaSet for deployments, or in a ControllerRevision for stateful sets
+// and daemon sets.
+type rolloutRevision struct {
+	Revision    int64
+	Name        string
+	Created     time.Time
+	Containers  []corev1.Container
+	ChangeCause string
+}
+
+// RolloutsAddon records the rollout history of deployments, stateful sets and
+// daemon sets, answering the question "what changed before it broke".
+type RolloutsAddon struct {
+	AddonBackend
+	client *kubernetes.Clientset
+	log    *zap.SugaredLogger
+}
+
+func init() {
+	registerAddon(rolloutsName, addonInfo{
+		Resources: []string{"apps/deployments", "apps/statefulsets", "apps/daemonsets"},
+		AddonFunc: NewRolloutsAddon,
+		Priority:  PriorityAddons,
+	})
+}
+
+func NewRolloutsAddon(backend AddonBackend) (Addon, error) {
+	client, err := kubernetes.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	return &RolloutsAddon{
+		AddonBackend: backend,
+		client:       client,
+		log:          backend.Options().Log.Named(rolloutsName),
+	}, nil
+}
+
+func (a *RolloutsAddon) Inspect(workload *unstructured.Unstructured) error {
+	namespace := workload.GetNamespace()
+	a.log.Debugf("Inspecting %s \"%s/%s\"", strings.ToLower(workload.GetKind()), namespace, workload.GetName())
+
+	a.QueueNamespace(namespace, func(context.Context) error {
+		a.gatherHistory(workload)
+		return nil
+	})
+
+	return nil
+}
+
+func (a *RolloutsAddon) gatherHistory(workload *unstructured.Unstructured) {
+	var revisions []rolloutRevision
+	var err error
+
+	kind := workload.GetKind()
+	if kind == "Deployment" {
+		revisions, err = a.replicaSetRevisions(workload)
+	} else {
+		revisions, err = a.controllerRevisions(workload)
+	}
+	if err != nil {
+		a.log.Warnf("Cannot get %s \"%s/%s\" revisions: %s",
+			strings.ToLower(kind), workload.GetNamespace(), workload.GetName(), err)
+		return
+	}
+
+	if len(revisions) == 0 {
+		return
+	}
+
+	dir, err := a.Output().CreateNamespaceAddonDir(workload.GetNamespace(), rolloutsName, strings.ToLower(kind)+"s")
+	if err != nil {
+		a.log.Warnf("Cannot create rollouts directory: %s", err)
+		return
+	}
+
+	name := SafeName(workload.GetName()) + ".txt"
+	dst, err := createFile(dir, name)
+	if err != nil {
+		a.log.Warnf("Cannot create %q: %s", name, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if err := writeRolloutHistory(dst, revisions); err != nil {
+		a.log.Warnf("Cannot write %q: %s", name, err)
+	}
+}
+
+// replicaSetRevisions returns the revisions of a deployment, gathering the
+// replica sets controlled by the deployment.
+func (a *RolloutsAddon) replicaSetRevisions(workload *unstructured.Unstructured) ([]rolloutRevision, error) {
+	namespace := workload.GetNamespace()
+	opts, err := selectorListOptions(workload)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := a.client.AppsV1().ReplicaSets(namespace).List(context.TODO(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []rolloutRevision
+
+	for i := range list.Items {
+		rs := &list.Items[i]
+		if !isControlledBy(rs.OwnerReferences, workload.GetUID()) {
+			continue
+		}
+
+		a.GatherResource(replicaSetsResource, types.NamespacedName{Namespace: namespace, Name: rs.Name})
+
+		revision, err := strconv.ParseInt(rs.Annotations[deploymentRevisionAnnotation], 10, 64)
+		if err != nil {
+			a.log.Debugf("Invalid replicaset \"%s/%s\" revision: %s", namespace, rs.Name, err)
+			continue
+		}
+
+		revisions = append(revisions, rolloutRevision{
+			Revision:    revision,
+			Name:        rs.Name,
+			Created:     rs.CreationTimestamp.Time,
+			Containers:  rs.Spec.Template.Spec.Containers,
+			ChangeCause: rs.Annotations[changeCauseAnnotation],
+		})
+	}
+
+	sortRevisions(revisions)
+	return revisions, nil
+}
+
+// controllerRevisions returns the revisions of a stateful set or daemon set,
+// gathering the controller revisions controlled by the workload.
+func (a *RolloutsAddon) controllerRevisions(workload *unstructured.Unstructured) ([]rolloutRevision, error) {
+	namespace := workload.GetNamespace()
+	opts, err := selectorListOptions(workload)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := a.client.AppsV1().ControllerRevisions(namespace).List(context.TODO(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []rolloutRevision
+
+	for i := range list.Items {
+		cr := &list.Items[i]
+		if !isControlledBy(cr.OwnerReferences, workload.GetUID()) {
+			continue
+		}
+
+		a.GatherResource(controllerRevisionsResource, types.NamespacedName{Namespace: namespace, Name: cr.Name})
+
+		// The revision data is a patch with the workload pod template.
+		var patch struct {
+			Spec struct {
+				Template corev1.PodTemplateSpec `json:"template"`
+			} `json:"spec"`
+		}
+		if err := json.Unmarshal(cr.Data.Raw, &patch); err != nil {
+			a.log.Debugf("Invalid controllerrevision \"%s/%s\" data: %s", namespace, cr.Name, err)
+		}
+
+		revisions = append(revisions, rolloutRevision{
+			Revision:    cr.Revision,
+			Name:        cr.Name,
+			Created:     cr.CreationTimestamp.Time,
+			Containers:  patch.Spec.Template.Spec.Containers,
+			ChangeCause: cr.Annotations[changeCauseAnnotation],
+		})
+	}
+
+	sortRevisions(revisions)
+	return revisions, nil
+}
+
+// selectorListOptions returns list options selecting the objects matching the
+// workload selector, since replica sets and controller revisions have the
+// workload pod labels.
+func selectorListOptions(workload *unstructured.Unstructured) (metav1.ListOptions, error) {
+	obj, found, err := unstructured.NestedMap(workload.Object, "spec", "selector")
+	if err != nil {
+		return metav1.ListOptions{}, err
+	}
+	if !found {
+		return metav1.ListOptions{}, fmt.Errorf("cannot find .spec.selector")
+	}
+
+	var labelSelector metav1.LabelSelector
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &labelSelector); err != nil {
+		return metav1.ListOptions{}, err
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&labelSelector)
+	if err != nil {
+		return metav1.ListOptions{}, err
+	}
+
+	return metav1.ListOptions{LabelSelector: selector.String()}, nil
+}
+
+func isControlledBy(refs []metav1.OwnerReference, uid types.UID) bool {
+	for i := range refs {
+		if refs[i].Controller != nil && *refs[i].Controller && refs[i].UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func sortRevisions(revisions []rolloutRevision) {
+	slices.SortFunc(revisions, func(a, b rolloutRevision) int {
+		if c := cmp.Compare(a.Revision, b.Revision); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+}
+
+// writeRolloutHistory writes the revisions like "kubectl rollout history",
+// with the images changed in every revision.
+//
+//	REVISION   CREATED                NAME              CHANGES                     CHANGE-CAUSE
+//	1          2024-06-01T10:00:00Z   myapp-5d4f8b7c9   server=myapp:1.0
+//	2          2024-06-02T12:30:00Z   myapp-7b9c6d5f8   server: myapp:1.0 -> myapp:1.1
+func writeRolloutHistory(w io.Writer, revisions []rolloutRevision) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(tw, "REVISION\tCREATED\tNAME\tCHANGES\tCHANGE-CAUSE")
+
+	var previous []corev1.Container
+
+	for i, r := range revisions {
+		var changes string
+		if i == 0 {
+			changes = formatImages(r.Containers)
+		} else {
+			changes = imageChanges(previous, r.Containers)
+		}
+		previous = r.Containers
+
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n",
+			r.Revision, r.Created.UTC().Format(time.RFC3339), r.Name, changes, r.ChangeCause)
+	}
+
+	return tw.Flush()
+}
+
+// formatImages formats container images (e.g. "server=myapp:1.0,sidecar=proxy:2.3").
+func formatImages(containers []corev1.Container) string {
+	var images []string
+	for i := range containers {
+		images = append(images, containers[i].Name+"="+containers[i].Image)
+	}
+	return strings.Join(images, ",")
+}
+
+// imageChanges describes the images changed between two revisions (e.g.
+// "server: myapp:1.0 -> myapp:1.1"). If no image changed, the change was in
+// other parts of the pod template.
+func imageChanges(previous []corev1.Container, current []corev1.Container) string {
+	var changes []string
+
+	for i := range current {
+		c := &current[i]
+		j := slices.IndexFunc(previous, func(p corev1.Container) bool { return p.Name == c.Name })
+		switch {
+		case j == -1:
+			changes = append(changes, "+"+c.Name+"="+c.Image)
+		case previous[j].Image != c.Image:
+			changes = append(changes, c.Name+": "+previous[j].Image+" -> "+c.Image)
+		}
+	}
+
+	for i := range previous {
+		p := &previous[i]
+		if !slices.ContainsFunc(current, func(c corev1.Container) bool { return c.Name == p.Name }) {
+			changes = append(changes, "-"+p.Name)
+		}
+	}
+
+	if len(changes) == 0 {
+		return "(template changed)"
+	}
+
+	return strings.Join(changes, ",")
+}
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestWriteRolloutHistory(t *testing.T) {
+	created := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	revisions := []rolloutRevision{
+		{
+			Revision: 1,
+			Name:     "myapp-1",
+			Created:  created,
+			Containers: []corev1.Container{
+				{Name: "server", Image: "myapp:1.0"},
+			},
+		},
+		{
+			Revision: 2,
+			Name:     "myapp-2",
+			Created:  created.Add(time.Hour),
+			Containers: []corev1.Container{
+				{Name: "server", Image: "myapp:1.1"},
+				{Name: "proxy", Image: "proxy:2.0"},
+			},
+			ChangeCause: "upgrade",
+		},
+		{
+			Revision: 3,
+			Name:     "myapp-3",
+			Created:  created.Add(2 * time.Hour),
+			Containers: []corev1.Container{
+				{Name: "server", Image: "myapp:1.1"},
+			},
+		},
+		{
+			Revision: 4,
+			Name:     "myapp-4",
+			Created:  created.Add(3 * time.Hour),
+			Containers: []corev1.Container{
+				{Name: "server", Image: "myapp:1.1"},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeRolloutHistory(&buf, revisions); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 lines, got:\n%s", buf.String())
+	}
+
+	expected := []string{
+		"server=myapp:1.0",
+		"server: myapp:1.0 -> myapp:1.1,+proxy=proxy:2.0",
+		"-proxy",
+		"(template changed)",
+	}
+	for i, changes := range expected {
+		if !strings.Contains(lines[i+1], changes) {
+			t.Errorf("expected %q in line %q", changes, lines[i+1])
+		}
+	}
+
+	if !strings.HasSuffix(lines[2], "upgrade") {
+		t.Errorf("expected change cause in line %q", lines[2])
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -20,8 +19,17 @@ import (
 
 const (
 	rookName = "rook"
+
+	// Timeout for ceph commands. Commands may block when ceph is unhealthy.
+	rookCommandTimeout = 60 * time.Second
+
+	// Timeout for slow ceph commands producing a lot of output.
+	rookReportTimeout = 5 * time.Minute
 )
 
+// OSD and MON logs gathered when gathering recent logs.
+var rookRecentLogs = []string{"ceph-osd.*", "ceph-mon.*"}
+
 type RookAddon struct {
 	AddonBackend
 	client *kubernetes.Clientset
@@ -30,8 +38,12 @@ type RookAddon struct {
 
 func init() {
 	registerAddon(rookName, addonInfo{
-		Resource:  "ceph.rook.io/cephclusters",
+		Resources: []string{"ceph.rook.io/cephclusters"},
 		AddonFunc: NewRookAddon,
+		Priority:  PriorityAddons,
+		Agents:    true,
+		// Avoid overwhelming the cluster with agent pods and ceph commands.
+		MaxConcurrency: 4,
 	})
 }
 
@@ -52,7 +64,7 @@ func (a *RookAddon) Inspect(cephcluster *unstructured.Unstructured) error {
 	namespace := cephcluster.GetNamespace()
 	a.log.Debugf("Inspecting cephcluster \"%s/%s\"", namespace, cephcluster.GetName())
 
-	a.Queue(func() error {
+	a.QueueNamespace(namespace, func(context.Context) error {
 		a.gatherCommands(namespace)
 		return nil
 	})
@@ -64,7 +76,7 @@ func (a *RookAddon) Inspect(cephcluster *unstructured.Unstructured) error {
 			return nil
 		}
 
-		a.Queue(func() error {
+		a.QueueNamespace(namespace, func(context.Context) error {
 			a.gatherLogs(namespace, dataDir)
 			return nil
 		})
@@ -74,7 +86,7 @@ func (a *RookAddon) Inspect(cephcluster *unstructured.Unstructured) error {
 }
 
 func (a *RookAddon) gatherCommands(namespace string) {
-	tools, err := a.findPod(namespace, "app=rook-ceph-tools")
+	tools, err := findPod(a.client, namespace, "app=rook-ceph-tools")
 	if err != nil {
 		a.log.Warnf("Cannot find tools pod: %s", err)
 		return
@@ -82,7 +94,7 @@ func (a *RookAddon) gatherCommands(namespace string) {
 
 	a.log.Debugf("Using pod %q", tools.Name)
 
-	commands, err := a.Output().CreateAddonDir(rookName, "commands")
+	commands, err := a.Output().CreateNamespaceAddonDir(namespace, rookName, "commands")
 	if err != nil {
 		a.log.Warnf("Cannot create commnads directory: %s", err)
 		return
@@ -92,20 +104,14 @@ func (a *RookAddon) gatherCommands(namespace string) {
 
 	rc := NewRemoteCommand(tools, a.Options(), a.log, commands)
 
-	// Running remote ceph commands in parallel is much faster.
-
-	a.Queue(func() error {
-		a.gatherCommand(rc, "ceph", "osd", "blocklist", "ls")
-		return nil
-	})
-
-	a.gatherCommand(rc, "ceph", "status")
-}
-
-func (a *RookAddon) gatherCommand(rc *RemoteCommand, command ...string) {
-	if err := rc.Gather(command...); err != nil {
-		a.log.Warnf("Error running %q: %s", strings.Join(command, "-"), err)
+	runner, err := a.newCommandRunner(namespace, rc)
+	if err != nil {
+		a.log.Warnf("Cannot create commands runner: %s", err)
+		return
 	}
+
+	// Running remote ceph commands in parallel is much faster.
+	runner.Run(rookCommands)
 }
 
 func (a *RookAddon) logCollectorEnabled(cephcluster *unstructured.Unstructured) bool {
@@ -136,8 +142,8 @@ func (a *RookAddon) gatherLogs(namespace string, dataDir string) {
 
 	for i := range nodes {
 		nodeName := nodes[i]
-		a.Queue(func() error {
-			a.gatherNodeLogs(namespace, nodeName, dataDir)
+		a.QueueNamespace(namespace, func(ctx context.Context) error {
+			a.gatherNodeLogs(ctx, namespace, nodeName, dataDir)
 			return nil
 		})
 	}
@@ -163,7 +169,7 @@ func (a *RookAddon) findNodesToGather(namespace string) ([]string, error) {
 	return names.UnsortedList(), nil
 }
 
-func (a *RookAddon) gatherNodeLogs(namespace string, nodeName string, dataDir string) {
+func (a *RookAddon) gatherNodeLogs(ctx context.Context, namespace string, nodeName string, dataDir string) {
 	a.log.Debugf("Gathering ceph logs from node %q dataDir %q", nodeName, dataDir)
 	start := time.Now()
 
@@ -181,17 +187,23 @@ func (a *RookAddon) gatherNodeLogs(namespace string, nodeName string, dataDir st
 
 	a.log.Debugf("Agent pod %q running in %.3f seconds", agent, time.Since(start).Seconds())
 
-	logs, err := a.Output().CreateAddonDir(rookName, "logs", nodeName)
+	logs, err := a.Output().CreateNamespaceAddonDir(namespace, rookName, "logs", nodeName)
 	if err != nil {
 		a.log.Warnf("Cannot create logs directory: %s", err)
 		return
 	}
 
-	rd := NewRemoteDirectory(agent.Pod, a.Options(), a.log)
+	rd := NewRemoteDirectory(agent.Pod, a.Options(), a.log).WithContext(ctx)
 	src := filepath.Join(dataDir, namespace, "log")
 
-	if err := rd.Gather(src, logs); err != nil {
-		a.log.Warnf("Cannot copy %q from agent pod %q: %s", src, agent.Pod.Name, err)
+	if since := a.Options().RookLogsSince; since > 0 {
+		if err := rd.GatherRecent(src, logs, rookRecentLogs, since); err != nil {
+			a.log.Warnf("Cannot copy recent logs in %q from agent pod %q: %s", src, agent.Pod.Name, err)
+		}
+	} else {
+		if err := rd.Gather(src, logs); err != nil {
+			a.log.Warnf("Cannot copy %q from agent pod %q: %s", src, agent.Pod.Name, err)
+		}
 	}
 
 	a.log.Debugf("Gathered node %q logs in %.3f seconds", nodeName, time.Since(start).Seconds())
@@ -223,8 +235,8 @@ func (a *RookAddon) createAgentPod(nodeName string, dataDir string) (*AgentPod,
 	return agent, nil
 }
 
-func (a *RookAddon) findPod(namespace string, labelSelector string) (*corev1.Pod, error) {
-	pods, err := a.client.CoreV1().
+func findPod(client *kubernetes.Clientset, namespace string, labelSelector string) (*corev1.Pod, error) {
+	pods, err := client.CoreV1().
 		Pods(namespace).
 		List(context.TODO(), metav1.ListOptions{
 			LabelSelector: labelSelector,
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rookCommandsManifest = "commands.json"
+)
+
+// rookCommand is a command run in the rook-ceph-tools pod.
+type rookCommand struct {
+	Command []string
+
+	// Timeout for running the command. If zero, rookCommandTimeout is used.
+	Timeout time.Duration
+
+	// Then is called with the command output path if the command succeeded,
+	// returning more commands to run.
+	Then func(path string) ([]rookCommand, error)
+}
+
+// rookCommands are the ceph commands gathered from the rook-ceph-tools pod,
+// based on the commands gathered by rook's must-gather.
+var rookCommands = []rookCommand{
+	{Command: []string{"ceph", "status"}},
+	{Command: []string{"ceph", "health", "detail"}},
+	{Command: []string{"ceph", "versions"}},
+	{Command: []string{"ceph", "df", "detail"}},
+	{Command: []string{"ceph", "osd", "tree"}},
+	{Command: []string{"ceph", "osd", "df", "tree"}},
+	{Command: []string{"ceph", "osd", "dump"}},
+	{Command: []string{"ceph", "osd", "pool", "ls", "detail"}},
+	{Command: []string{"ceph", "osd", "blocklist", "ls"}},
+	{Command: []string{"ceph", "osd", "crush", "dump"}},
+	{Command: []string{"ceph", "pg", "dump", "summary"}},
+	{Command: []string{"ceph", "pg", "dump_stuck"}},
+	{Command: []string{"ceph", "mon", "dump"}},
+	{Command: []string{"ceph", "mgr", "dump"}},
+	{Command: []string{"ceph", "fs", "ls"}},
+	{Command: []string{"ceph", "fs", "status"}},
+	{Command: []string{"ceph", "fs", "snapshot", "mirror", "daemon", "status"}},
+	{Command: []string{"ceph", "balancer", "status"}},
+	{Command: []string{"ceph", "progress"}},
+	{Command: []string{"ceph", "config", "dump"}},
+	{Command: []string{"ceph", "crash", "ls"}},
+	{Command: []string{"ceph", "report"}, Timeout: rookReportTimeout},
+	{
+		Command: []string{"ceph", "crash", "ls", "--format", "json"},
+		Then:    rookCrashInfoCommands,
+	},
+	{
+		Command: []string{"ceph", "osd", "pool", "ls", "detail", "--format", "json"},
+		Then:    rookRBDMirrorCommands,
+	},
+}
+
+// RookCommandResult describes a command gathered by the rook addon. The
+// results are recorded in namespaces/{namespace}/addons/rook/commands.json.
+type RookCommandResult struct {
+	Command  string  `json:"command"`
+	Output   string  `json:"output"`
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// rookCommandRunner runs commands in parallel using the work queue, and
+// writes the results manifest when the last command completes.
+type rookCommandRunner struct {
+	addon     *RookAddon
+	namespace string
+	rc        *RemoteCommand
+	manifest  string
+	mutex     sync.Mutex
+	pending   int
+	results   []RookCommandResult
+}
+
+// Run queues commands. Must not be called after all queued commands
+// completed.
+func (r *rookCommandRunner) Run(commands []rookCommand) {
+	r.mutex.Lock()
+	r.pending += len(commands)
+	r.mutex.Unlock()
+
+	for i := range commands {
+		command := &commands[i]
+		r.addon.QueueNamespace(r.namespace, func(ctx context.Context) error {
+			r.runCommand(ctx, command)
+			return nil
+		})
+	}
+}
+
+func (r *rookCommandRunner) runCommand(ctx context.Context, command *rookCommand) {
+	start := time.Now()
+	rc := r.rc.WithContext(ctx)
+
+	timeout := command.Timeout
+	if timeout == 0 {
+		timeout = rookCommandTimeout
+	}
+
+	result := RookCommandResult{
+		Command: strings.Join(command.Command, " "),
+		Output:  r.rc.Filename(command.Command...),
+	}
+
+	err := rc.GatherTimeout(timeout, command.Command...)
+	if err != nil {
+		r.addon.log.Warnf("Error running %q: %s", result.Command, err)
+		result.Error = err.Error()
+	} else if command.Then != nil {
+		// Queue more commands before completing this command, so the
+		// manifest is written after all commands complete.
+		more, err := command.Then(r.rc.Path(command.Command...))
+		if err != nil {
+			r.addon.log.Warnf("Cannot process %q output: %s", result.Command, err)
+		}
+		if len(more) > 0 {
+			r.Run(more)
+		}
+	}
+
+	result.Duration = time.Since(start).Seconds()
+	r.done(result)
+}
+
+func (r *rookCommandRunner) done(result RookCommandResult) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.results = append(r.results, result)
+	r.pending--
+
+	if r.pending == 0 {
+		r.writeManifest()
+	}
+}
+
+func (r *rookCommandRunner) writeManifest() {
+	slices.SortFunc(r.results, func(a, b RookCommandResult) int {
+		return strings.Compare(a.Command, b.Command)
+	})
+
+	data, err := json.MarshalIndent(r.results, "", "  ")
+	if err != nil {
+		r.addon.log.Warnf("Cannot encode %q: %s", rookCommandsManifest, err)
+		return
+	}
+
+	if err := os.WriteFile(r.manifest, append(data, '\n'), 0640); err != nil {
+		r.addon.log.Warnf("Cannot write %q: %s", rookCommandsManifest, err)
+	}
+}
+
+// rookCrashInfoCommands returns a "ceph crash info" command for every crash
+// in "ceph crash ls" json output.
+func rookCrashInfoCommands(path string) ([]rookCommand, error) {
+	var crashes []struct {
+		CrashID string `json:"crash_id"`
+	}
+	if err := readJSON(path, &crashes); err != nil {
+		return nil, err
+	}
+
+	var commands []rookCommand
+	for _, crash := range crashes {
+		commands = append(commands, rookCommand{
+			Command: []string{"ceph", "crash", "info", crash.CrashID},
+		})
+	}
+
+	return commands, nil
+}
+
+// rookRBDMirrorCommands returns rbd mirroring commands for every rbd pool in
+// "ceph osd pool ls detail" json output.
+func rookRBDMirrorCommands(path string) ([]rookCommand, error) {
+	var pools []struct {
+		PoolName            string                     `json:"pool_name"`
+		ApplicationMetadata map[string]json.RawMessage `json:"application_metadata"`
+	}
+	if err := readJSON(path, &pools); err != nil {
+		return nil, err
+	}
+
+	var commands []rookCommand
+	for _, pool := range pools {
+		if _, ok := pool.ApplicationMetadata["rbd"]; !ok {
+			continue
+		}
+		commands = append(commands,
+			rookCommand{Command: []string{"rbd", "mirror", "pool", "info", pool.PoolName}},
+			rookCommand{Command: []string{"rbd", "mirror", "pool", "status", pool.PoolName}},
+		)
+	}
+
+	return commands, nil
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (a *RookAddon) newCommandRunner(namespace string, rc *RemoteCommand) (*rookCommandRunner, error) {
+	dir, err := a.Output().CreateNamespaceAddonDir(namespace, rookName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rookCommandRunner{
+		addon:     a,
+		namespace: namespace,
+		rc:        rc,
+		manifest:  filepath.Join(dir, rookCommandsManifest),
+	}, nil
+}
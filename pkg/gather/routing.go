@@ -0,0 +1,489 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	routingName       = "routing"
+	routesReportName  = "routes.txt"
+	haproxyConfigName = "haproxy.config"
+
+	// OpenShift router pods namespace and label.
+	routerNamespace       = "openshift-ingress"
+	routerLabel           = "ingresscontroller.operator.openshift.io/deployment-ingresscontroller"
+	ingressOperatorNS     = "openshift-ingress-operator"
+	dnsNamespace          = "openshift-dns"
+	dnsConfigMap          = "dns-default"
+	haproxyConfigPath     = "/var/lib/haproxy/conf/haproxy.config"
+	routingCommandTimeout = 60 * time.Second
+)
+
+var (
+	routesResource             = schema.GroupVersionResource{Group: "route.openshift.io", Version: "v1", Resource: "routes"}
+	ingressControllersResource = schema.GroupVersionResource{Group: "operator.openshift.io", Version: "v1", Resource: "ingresscontrollers"}
+
+	// Cluster scoped DNS and ingress configuration, gathered with the router
+	// diagnostics.
+	routingConfigResources = []struct {
+		GVR  schema.GroupVersionResource
+		Name types.NamespacedName
+	}{
+		{schema.GroupVersionResource{Group: "operator.openshift.io", Version: "v1", Resource: "dnses"}, types.NamespacedName{Name: "default"}},
+		{schema.GroupVersionResource{Group: "config.openshift.io", Version: "v1", Resource: "dnses"}, types.NamespacedName{Name: "cluster"}},
+		{schema.GroupVersionResource{Group: "config.openshift.io", Version: "v1", Resource: "ingresses"}, types.NamespacedName{Name: "cluster"}},
+		{corev1.SchemeGroupVersion.WithResource("configmaps"), types.NamespacedName{Namespace: dnsNamespace, Name: dnsConfigMap}},
+	}
+)
+
+// routeEntry describes a route or ingress path, mapping a hostname to the
+// service handling it.
+type routeEntry struct {
+	Kind    string
+	Name    string
+	Host    string
+	Path    string
+	Service string
+	Port    string
+	TLS     string
+
+	// Admission status for routes, load balancer addresses for ingresses.
+	Status string
+
+	// Number of ready endpoints of the service, or -1 if the service was not
+	// found.
+	ReadyEndpoints int
+}
+
+// RoutingAddon records routes and ingresses with a hostname to service table
+// per namespace, and the OpenShift router and DNS diagnostics, for debugging
+// routes that do not work.
+type RoutingAddon struct {
+	AddonBackend
+	client  *kubernetes.Clientset
+	dynamic dynamic.Interface
+	log     *zap.SugaredLogger
+
+	routerOnce sync.Once
+
+	mutex      sync.Mutex
+	namespaces map[string]struct{}
+}
+
+func init() {
+	registerAddon(routingName, addonInfo{
+		Resources: []string{"route.openshift.io/routes", "networking.k8s.io/ingresses"},
+		AddonFunc: NewRoutingAddon,
+		Priority:  PriorityAddons,
+	})
+}
+
+func NewRoutingAddon(backend AddonBackend) (Addon, error) {
+	client, err := kubernetes.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	return &RoutingAddon{
+		AddonBackend: backend,
+		client:       client,
+		dynamic:      dynamicClient,
+		log:          backend.Options().Log.Named(routingName),
+		namespaces:   map[string]struct{}{},
+	}, nil
+}
+
+func (a *RoutingAddon) Inspect(item *unstructured.Unstructured) error {
+	namespace := item.GetNamespace()
+	a.log.Debugf("Inspecting %s \"%s/%s\"", strings.ToLower(item.GetKind()), namespace, item.GetName())
+
+	// Routes are served by the OpenShift router.
+	if item.GetKind() == "Route" {
+		a.routerOnce.Do(func() {
+			a.Queue(func(ctx context.Context) error {
+				a.gatherRouterDiagnostics(ctx)
+				return nil
+			})
+		})
+	}
+
+	if a.addNamespace(namespace) {
+		a.QueueNamespace(namespace, func(ctx context.Context) error {
+			a.gatherRoutesReport(ctx, namespace)
+			return nil
+		})
+	}
+
+	return nil
+}
+
+// addNamespace returns true if the routes report for namespace was not
+// queued yet.
+func (a *RoutingAddon) addNamespace(namespace string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, ok := a.namespaces[namespace]; ok {
+		return false
+	}
+
+	a.namespaces[namespace] = struct{}{}
+	return true
+}
+
+// gatherRoutesReport writes the routes and ingresses in namespace with the
+// health of their services.
+func (a *RoutingAddon) gatherRoutesReport(ctx context.Context, namespace string) {
+	var entries []routeEntry
+
+	routes, err := a.dynamic.Resource(routesResource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			a.log.Warnf("Cannot list routes in namespace %q: %s", namespace, err)
+		}
+	} else {
+		for i := range routes.Items {
+			entries = append(entries, routeEntries(&routes.Items[i])...)
+		}
+	}
+
+	ingresses, err := a.client.NetworkingV1().Ingresses(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			a.log.Warnf("Cannot list ingresses in namespace %q: %s", namespace, err)
+		}
+	} else {
+		for i := range ingresses.Items {
+			entries = append(entries, ingressEntries(&ingresses.Items[i])...)
+		}
+	}
+
+	if len(entries) == 0 {
+		return
+	}
+
+	ready := map[string]int{}
+	for i := range entries {
+		e := &entries[i]
+		count, ok := ready[e.Service]
+		if !ok {
+			count = a.serviceReadyEndpoints(namespace, e.Service)
+			ready[e.Service] = count
+		}
+		e.ReadyEndpoints = count
+	}
+
+	dir, err := a.Output().CreateNamespaceAddonDir(namespace, routingName)
+	if err != nil {
+		a.log.Warnf("Cannot create routing directory: %s", err)
+		return
+	}
+
+	dst, err := createFile(dir, routesReportName)
+	if err != nil {
+		a.log.Warnf("Cannot create %q: %s", routesReportName, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if err := writeRoutesReport(dst, entries); err != nil {
+		a.log.Warnf("Cannot write %q: %s", routesReportName, err)
+	}
+}
+
+// serviceReadyEndpoints returns the number of ready endpoints of service, or
+// -1 if the service was not found.
+func (a *RoutingAddon) serviceReadyEndpoints(namespace string, service string) int {
+	ctx := context.TODO()
+
+	if service == "" {
+		return -1
+	}
+
+	if _, err := a.client.CoreV1().Services(namespace).Get(ctx, service, metav1.GetOptions{}); err != nil {
+		if !apierrors.IsNotFound(err) {
+			a.log.Warnf("Cannot get service \"%s/%s\": %s", namespace, service, err)
+		}
+		return -1
+	}
+
+	endpointSlices, err := a.client.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + service,
+	})
+	if err != nil {
+		a.log.Warnf("Cannot list service \"%s/%s\" endpoints: %s", namespace, service, err)
+		return -1
+	}
+
+	ready := 0
+	for i := range endpointSlices.Items {
+		ready += readyEndpoints(&endpointSlices.Items[i])
+	}
+
+	return ready
+}
+
+// gatherRouterDiagnostics gathers the ingress controllers, the DNS and ingress
+// configuration, and the router pods with their logs and haproxy config.
+func (a *RoutingAddon) gatherRouterDiagnostics(ctx context.Context) {
+	controllers, err := a.dynamic.Resource(ingressControllersResource).Namespace(ingressOperatorNS).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		a.log.Debugf("Cannot list ingress controllers: %s", err)
+		return
+	}
+
+	for i := range controllers.Items {
+		name := types.NamespacedName{Namespace: ingressOperatorNS, Name: controllers.Items[i].GetName()}
+		a.GatherResource(ingressControllersResource, name)
+	}
+
+	for _, r := range routingConfigResources {
+		a.GatherResource(r.GVR, r.Name)
+	}
+
+	pods, err := a.client.CoreV1().Pods(routerNamespace).List(ctx, metav1.ListOptions{LabelSelector: routerLabel})
+	if err != nil {
+		a.log.Warnf("Cannot list router pods: %s", err)
+		return
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		a.GatherResource(podsResource, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name})
+
+		if !logsAddonGathers(a.Options(), pod.Namespace) {
+			gatherPodLogs(ctx, a, a.client, a.log, pod)
+		}
+
+		if a.Options().AgentsAllowed() {
+			a.gatherHAProxyConfig(ctx, pod)
+		} else {
+			a.log.Debugf("Skipping pod %q haproxy config in read only mode", pod.Name)
+		}
+	}
+}
+
+func (a *RoutingAddon) gatherHAProxyConfig(ctx context.Context, pod *corev1.Pod) {
+	dir, err := a.Output().CreateNamespaceAddonDir(pod.Namespace, routingName, pod.Name)
+	if err != nil {
+		a.log.Warnf("Cannot create routing directory: %s", err)
+		return
+	}
+
+	rc := NewRemoteCommand(pod, a.Options(), a.log, dir).WithContext(ctx)
+	if err := rc.GatherAs(haproxyConfigName, routingCommandTimeout, "cat", haproxyConfigPath); err != nil {
+		a.log.Warnf("Cannot gather pod %q haproxy config: %s", pod.Name, err)
+	}
+}
+
+// routeEntries returns the entries for an OpenShift route.
+func routeEntries(route *unstructured.Unstructured) []routeEntry {
+	host, _, _ := unstructured.NestedString(route.Object, "spec", "host")
+	path, _, _ := unstructured.NestedString(route.Object, "spec", "path")
+	service, _, _ := unstructured.NestedString(route.Object, "spec", "to", "name")
+	tls, _, _ := unstructured.NestedString(route.Object, "spec", "tls", "termination")
+
+	var port string
+	if value, found, _ := unstructured.NestedFieldNoCopy(route.Object, "spec", "port", "targetPort"); found {
+		port = fmt.Sprint(value)
+	}
+
+	entries := []routeEntry{{
+		Kind:    "route",
+		Name:    route.GetName(),
+		Host:    host,
+		Path:    path,
+		Service: service,
+		Port:    port,
+		TLS:     tls,
+		Status:  routeStatus(route),
+	}}
+
+	// Traffic split between services (e.g. A/B deployments).
+	backends, _, _ := unstructured.NestedSlice(route.Object, "spec", "alternateBackends")
+	for _, b := range backends {
+		backend, ok := b.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		entry := entries[0]
+		entry.Service, _ = backend["name"].(string)
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// routeStatus returns "Admitted" if a router admitted the route, the reason
+// a router did not admit the route (e.g. "HostAlreadyClaimed"), or "Pending"
+// if no router reported status.
+func routeStatus(route *unstructured.Unstructured) string {
+	ingresses, _, _ := unstructured.NestedSlice(route.Object, "status", "ingress")
+
+	var reason string
+
+	for _, i := range ingresses {
+		ingress, ok := i.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		conditions, _, _ := unstructured.NestedSlice(ingress, "conditions")
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if !ok || condition["type"] != "Admitted" {
+				continue
+			}
+			if condition["status"] == string(corev1.ConditionTrue) {
+				return "Admitted"
+			}
+			if reason == "" {
+				reason, _ = condition["reason"].(string)
+			}
+		}
+	}
+
+	if reason != "" {
+		return reason
+	}
+
+	return "Pending"
+}
+
+// ingressEntries returns the entries for every path of an ingress.
+func ingressEntries(ingress *networkingv1.Ingress) []routeEntry {
+	var addresses []string
+	for _, lb := range ingress.Status.LoadBalancer.Ingress {
+		if lb.Hostname != "" {
+			addresses = append(addresses, lb.Hostname)
+		} else if lb.IP != "" {
+			addresses = append(addresses, lb.IP)
+		}
+	}
+
+	status := "Pending"
+	if len(addresses) > 0 {
+		status = strings.Join(addresses, ",")
+	}
+
+	var tlsHosts []string
+	for _, tls := range ingress.Spec.TLS {
+		tlsHosts = append(tlsHosts, tls.Hosts...)
+	}
+
+	newEntry := func(host string, path string, backend *networkingv1.IngressBackend) routeEntry {
+		entry := routeEntry{
+			Kind:   "ingress",
+			Name:   ingress.Name,
+			Host:   host,
+			Path:   path,
+			Status: status,
+		}
+		if slices.Contains(tlsHosts, host) {
+			entry.TLS = "edge"
+		}
+		if backend.Service != nil {
+			entry.Service = backend.Service.Name
+			if backend.Service.Port.Name != "" {
+				entry.Port = backend.Service.Port.Name
+			} else {
+				entry.Port = strconv.Itoa(int(backend.Service.Port.Number))
+			}
+		}
+		return entry
+	}
+
+	var entries []routeEntry
+
+	if ingress.Spec.DefaultBackend != nil {
+		entries = append(entries, newEntry("*", "", ingress.Spec.DefaultBackend))
+	}
+
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		host := rule.Host
+		if host == "" {
+			host = "*"
+		}
+		for i := range rule.HTTP.Paths {
+			path := &rule.HTTP.Paths[i]
+			entries = append(entries, newEntry(host, path.Path, &path.Backend))
+		}
+	}
+
+	return entries
+}
+
+// writeRoutesReport writes the entries sorted by host and path.
+//
+//	HOST                   PATH   KIND    NAME   SERVICE   PORT   TLS    STATUS     ENDPOINTS
+//	myapp.apps.example.com /      route   myapp  myapp     8080   edge   Admitted   2
+func writeRoutesReport(w io.Writer, entries []routeEntry) error {
+	slices.SortFunc(entries, func(a, b routeEntry) int {
+		if c := strings.Compare(a.Host, b.Host); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Kind, b.Kind); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Service, b.Service)
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tPATH\tKIND\tNAME\tSERVICE\tPORT\tTLS\tSTATUS\tENDPOINTS")
+
+	for _, e := range entries {
+		endpoints := "<no service>"
+		if e.ReadyEndpoints >= 0 {
+			endpoints = strconv.Itoa(e.ReadyEndpoints)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			orDash(e.Host), orDash(e.Path), e.Kind, e.Name, orDash(e.Service),
+			orDash(e.Port), orDash(e.TLS), e.Status, endpoints)
+	}
+
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRouteEntries(t *testing.T) {
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "route.openshift.io/v1",
+		"kind":       "Route",
+		"metadata":   map[string]interface{}{"name": "myapp", "namespace": "ns"},
+		"spec": map[string]interface{}{
+			"host": "myapp.apps.example.com",
+			"path": "/",
+			"to":   map[string]interface{}{"kind": "Service", "name": "myapp"},
+			"port": map[string]interface{}{"targetPort": int64(8080)},
+			"tls":  map[string]interface{}{"termination": "edge"},
+			"alternateBackends": []interface{}{
+				map[string]interface{}{"kind": "Service", "name": "myapp-canary"},
+			},
+		},
+		"status": map[string]interface{}{
+			"ingress": []interface{}{
+				map[string]interface{}{
+					"routerName": "default",
+					"conditions": []interface{}{
+						map[string]interface{}{"type": "Admitted", "status": "False", "reason": "HostAlreadyClaimed"},
+					},
+				},
+			},
+		},
+	}}
+
+	entries := routeEntries(route)
+	expected := []routeEntry{
+		{Kind: "route", Name: "myapp", Host: "myapp.apps.example.com", Path: "/", Service: "myapp", Port: "8080", TLS: "edge", Status: "HostAlreadyClaimed"},
+		{Kind: "route", Name: "myapp", Host: "myapp.apps.example.com", Path: "/", Service: "myapp-canary", Port: "8080", TLS: "edge", Status: "HostAlreadyClaimed"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestIngressEntries(t *testing.T) {
+	pathType := networkingv1.PathTypePrefix
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "ns"},
+		Spec: networkingv1.IngressSpec{
+			TLS: []networkingv1.IngressTLS{{Hosts: []string{"www.example.com"}}},
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: "www.example.com",
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     "/api",
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: "api",
+											Port: networkingv1.ServiceBackendPort{Name: "http"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+				{
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     "/",
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: "web",
+											Port: networkingv1.ServiceBackendPort{Number: 80},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Status: networkingv1.IngressStatus{
+			LoadBalancer: networkingv1.IngressLoadBalancerStatus{
+				Ingress: []networkingv1.IngressLoadBalancerIngress{{IP: "10.0.0.12"}},
+			},
+		},
+	}
+
+	entries := ingressEntries(ingress)
+	expected := []routeEntry{
+		{Kind: "ingress", Name: "web", Host: "www.example.com", Path: "/api", Service: "api", Port: "http", TLS: "edge", Status: "10.0.0.12"},
+		{Kind: "ingress", Name: "web", Host: "*", Path: "/", Service: "web", Port: "80", Status: "10.0.0.12"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestWriteRoutesReport(t *testing.T) {
+	entries := []routeEntry{
+		{Kind: "ingress", Name: "web", Host: "www.example.com", Path: "/api", Service: "api", Port: "http", Status: "10.0.0.12", ReadyEndpoints: 0},
+		{Kind: "route", Name: "other", Host: "other.apps.example.com", Service: "other", Status: "Pending", ReadyEndpoints: -1},
+		{Kind: "route", Name: "myapp", Host: "myapp.apps.example.com", Path: "/", Service: "myapp", Port: "8080", TLS: "edge", Status: "Admitted", ReadyEndpoints: 2},
+	}
+
+	var buf bytes.Buffer
+	if err := writeRoutesReport(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got:\n%s", buf.String())
+	}
+
+	// Sorted by host.
+	expected := []string{"myapp.apps.example.com", "other.apps.example.com", "www.example.com"}
+	for i, host := range expected {
+		if !strings.HasPrefix(lines[i+1], host) {
+			t.Errorf("expected %q in line %q", host, lines[i+1])
+		}
+	}
+
+	if !strings.HasSuffix(lines[1], "2") {
+		t.Errorf("expected 2 ready endpoints in line %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], "<no service>") {
+		t.Errorf("expected missing service in line %q", lines[2])
+	}
+}
@@ -0,0 +1,354 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	s3Name                = "s3"
+	s3EndpointsReportName = "endpoints.yaml"
+
+	// Ramen config maps on the hub and the managed clusters, and the config
+	// map key holding the ramen configuration.
+	ramenHubConfigMap     = "ramen-hub-operator-config"
+	ramenClusterConfigMap = "ramen-dr-cluster-operator-config"
+	ramenConfigKey        = "ramen_manager_config.yaml"
+
+	// Timeout for connecting to an endpoint from the agent pod.
+	s3ConnectTimeoutSeconds = 10
+
+	// Timeout for the check command, including the connect timeout.
+	s3CheckTimeout = 30 * time.Second
+)
+
+var (
+	backupStorageLocationsResource = schema.GroupVersionResource{Group: "velero.io", Version: "v1", Resource: "backupstoragelocations"}
+
+	// Matches the HTTP status line in wget server response.
+	httpStatusRegexp = regexp.MustCompile(`HTTP/[0-9.]+ ([0-9]{3})`)
+)
+
+// S3Endpoint describes an object store bucket used by Ramen or Velero, and
+// its reachability from the cluster.
+type S3Endpoint struct {
+	// Source of the endpoint ("ramen" or "velero").
+	Source string `json:"source"`
+
+	// Ramen s3 profile name or Velero backup storage location
+	// "namespace/name".
+	Name string `json:"name"`
+
+	// Endpoint URL, without credentials.
+	Endpoint string `json:"endpoint"`
+	Bucket   string `json:"bucket"`
+	Region   string `json:"region,omitempty"`
+
+	// Reachable is true if the endpoint returned an HTTP response, including
+	// authorization errors, since the request is not authenticated.
+	Reachable bool `json:"reachable"`
+
+	// HTTP status code returned by the endpoint.
+	Status int `json:"status,omitempty"`
+
+	// Error connecting to the endpoint.
+	Error string `json:"error,omitempty"`
+}
+
+// ramenConfig is the part of the ramen configuration describing the s3
+// profiles.
+type ramenConfig struct {
+	S3StoreProfiles []struct {
+		S3ProfileName        string `json:"s3ProfileName"`
+		S3Bucket             string `json:"s3Bucket"`
+		S3CompatibleEndpoint string `json:"s3CompatibleEndpoint"`
+		S3Region             string `json:"s3Region"`
+	} `json:"s3StoreProfiles"`
+}
+
+// S3Addon verifies the reachability of the object store endpoints used by
+// Ramen s3 profiles and Velero backup storage locations, since unreachable
+// s3 is a top cause of DR failures. Endpoints are checked from an agent pod
+// using unauthenticated requests; credentials are never read.
+type S3Addon struct {
+	AddonBackend
+	client  *kubernetes.Clientset
+	dynamic dynamic.Interface
+	log     *zap.SugaredLogger
+	once    sync.Once
+}
+
+func init() {
+	registerAddon(s3Name, addonInfo{
+		Resources: []string{
+			"ramendr.openshift.io/drclusters",
+			"ramendr.openshift.io/volumereplicationgroups",
+			"velero.io/backupstoragelocations",
+		},
+		AddonFunc: NewS3Addon,
+		Priority:  PriorityAddons,
+		Agents:    true,
+	})
+}
+
+func NewS3Addon(backend AddonBackend) (Addon, error) {
+	client, err := kubernetes.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Addon{
+		AddonBackend: backend,
+		client:       client,
+		dynamic:      dynamicClient,
+		log:          backend.Options().Log.Named(s3Name),
+	}, nil
+}
+
+func (a *S3Addon) Inspect(item *unstructured.Unstructured) error {
+	a.log.Debugf("Inspecting %s \"%s/%s\"", strings.ToLower(item.GetKind()), item.GetNamespace(), item.GetName())
+
+	// All endpoints are checked together from a single agent pod.
+	a.once.Do(func() {
+		a.Queue(func(ctx context.Context) error {
+			a.checkEndpoints(ctx)
+			return nil
+		})
+	})
+
+	return nil
+}
+
+func (a *S3Addon) checkEndpoints(ctx context.Context) {
+	endpoints := append(a.ramenEndpoints(), a.veleroEndpoints()...)
+	if len(endpoints) == 0 {
+		a.log.Debug("No s3 endpoints found")
+		return
+	}
+
+	agent := NewAgentPod(s3Name, a.client, a.log)
+	if err := agent.Create(); err != nil {
+		a.log.Warnf("Cannot create agent pod: %s", err)
+		return
+	}
+	defer agent.Delete()
+
+	if err := agent.WaitUntilRunning(); err != nil {
+		a.log.Warnf("Error waiting for agent pod: %s", err)
+		return
+	}
+
+	dir, err := a.Output().CreateAddonDir(s3Name)
+	if err != nil {
+		a.log.Warnf("Cannot create s3 directory: %s", err)
+		return
+	}
+
+	for i := range endpoints {
+		a.checkEndpoint(ctx, agent, dir, &endpoints[i])
+	}
+
+	a.writeEndpointsReport(dir, endpoints)
+}
+
+// checkEndpoint sends an unauthenticated HEAD bucket request from the agent
+// pod. Any HTTP response proves that the endpoint is reachable.
+func (a *S3Addon) checkEndpoint(ctx context.Context, agent *AgentPod, dir string, endpoint *S3Endpoint) {
+	bucketURL, err := url.JoinPath(endpoint.Endpoint, endpoint.Bucket)
+	if err != nil {
+		endpoint.Error = err.Error()
+		return
+	}
+
+	a.log.Debugf("Checking %s endpoint %q bucket %q", endpoint.Source, endpoint.Endpoint, endpoint.Bucket)
+
+	// wget reports errors and the server response on stderr.
+	script := fmt.Sprintf("wget --spider -S -T %d \"$0\" 2>&1", s3ConnectTimeoutSeconds)
+	filename := endpoint.Source + "-" + sanitizeFilename(endpoint.Name) + ".check"
+
+	rc := NewRemoteCommand(agent.Pod, a.Options(), a.log, dir).WithContext(ctx)
+	err = rc.GatherAs(filename, s3CheckTimeout, "sh", "-c", script, bucketURL)
+
+	output, readErr := os.ReadFile(filepath.Join(dir, filename))
+	if readErr != nil {
+		a.log.Warnf("Cannot read %q: %s", filename, readErr)
+	}
+
+	parseCheckOutput(endpoint, output, err)
+}
+
+// ramenEndpoints returns the s3 profiles in the ramen hub and dr cluster
+// config maps.
+func (a *S3Addon) ramenEndpoints() []S3Endpoint {
+	var endpoints []S3Endpoint
+
+	for _, name := range []string{ramenHubConfigMap, ramenClusterConfigMap} {
+		configMaps, err := a.client.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector(metav1.ObjectNameField, name).String(),
+		})
+		if err != nil {
+			a.log.Warnf("Cannot list config map %q: %s", name, err)
+			continue
+		}
+
+		for i := range configMaps.Items {
+			cm := &configMaps.Items[i]
+			found, err := ramenS3Endpoints([]byte(cm.Data[ramenConfigKey]))
+			if err != nil {
+				a.log.Warnf("Cannot parse config map \"%s/%s\": %s", cm.Namespace, cm.Name, err)
+				continue
+			}
+			endpoints = append(endpoints, found...)
+		}
+	}
+
+	return endpoints
+}
+
+// veleroEndpoints returns the s3 backup storage locations.
+func (a *S3Addon) veleroEndpoints() []S3Endpoint {
+	locations, err := a.dynamic.Resource(backupStorageLocationsResource).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		a.log.Debugf("Cannot list backup storage locations: %s", err)
+		return nil
+	}
+
+	var endpoints []S3Endpoint
+	for i := range locations.Items {
+		if endpoint, ok := veleroS3Endpoint(&locations.Items[i]); ok {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	return endpoints
+}
+
+func (a *S3Addon) writeEndpointsReport(dir string, endpoints []S3Endpoint) {
+	data, err := yaml.Marshal(endpoints)
+	if err != nil {
+		a.log.Warnf("Cannot encode %q: %s", s3EndpointsReportName, err)
+		return
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, s3EndpointsReportName), data, 0640); err != nil {
+		a.log.Warnf("Cannot write %q: %s", s3EndpointsReportName, err)
+	}
+}
+
+// ramenS3Endpoints returns the s3 profiles in the ramen configuration.
+func ramenS3Endpoints(data []byte) ([]S3Endpoint, error) {
+	var config ramenConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	var endpoints []S3Endpoint
+	for _, profile := range config.S3StoreProfiles {
+		endpoints = append(endpoints, S3Endpoint{
+			Source:   "ramen",
+			Name:     profile.S3ProfileName,
+			Endpoint: redactEndpoint(profile.S3CompatibleEndpoint),
+			Bucket:   profile.S3Bucket,
+			Region:   profile.S3Region,
+		})
+	}
+
+	return endpoints, nil
+}
+
+// veleroS3Endpoint returns the endpoint of a backup storage location using
+// the aws (s3) provider.
+func veleroS3Endpoint(location *unstructured.Unstructured) (S3Endpoint, bool) {
+	provider, _, _ := unstructured.NestedString(location.Object, "spec", "provider")
+	if provider != "aws" && provider != "velero.io/aws" {
+		return S3Endpoint{}, false
+	}
+
+	bucket, _, _ := unstructured.NestedString(location.Object, "spec", "objectStorage", "bucket")
+	config, _, _ := unstructured.NestedStringMap(location.Object, "spec", "config")
+
+	endpoint := config["s3Url"]
+	if endpoint == "" {
+		// AWS regional endpoint.
+		region := config["region"]
+		if region == "" {
+			region = "us-east-1"
+		}
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+
+	return S3Endpoint{
+		Source:   "velero",
+		Name:     location.GetNamespace() + "/" + location.GetName(),
+		Endpoint: redactEndpoint(endpoint),
+		Bucket:   bucket,
+		Region:   config["region"],
+	}, true
+}
+
+// redactEndpoint removes credentials from endpoint URL. S3 requests do not
+// use URL credentials, so they are not needed for checking the endpoint.
+func redactEndpoint(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.User == nil {
+		return endpoint
+	}
+	u.User = nil
+	return u.String()
+}
+
+// parseCheckOutput updates endpoint using the wget output and the command
+// error.
+func parseCheckOutput(endpoint *S3Endpoint, output []byte, err error) {
+	if matches := httpStatusRegexp.FindAllSubmatch(output, -1); len(matches) > 0 {
+		endpoint.Status, _ = strconv.Atoi(string(matches[len(matches)-1][1]))
+		endpoint.Reachable = true
+		return
+	}
+
+	// The last wget message describes the connection error.
+	lines := bytes.Split(bytes.TrimSpace(output), []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		if bytes.HasPrefix(lines[i], []byte("wget:")) {
+			endpoint.Error = string(lines[i])
+			return
+		}
+	}
+
+	if err != nil {
+		endpoint.Error = err.Error()
+	} else {
+		endpoint.Error = "no response"
+	}
+}
+
+// sanitizeFilename replaces characters that are not valid in file names.
+func sanitizeFilename(name string) string {
+	return strings.ReplaceAll(name, "/", "-")
+}
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Maximum length of a file name in bytes, leaving room for the file extension.
+// Most file systems limit file names to 255 bytes, but eCryptfs (used for
+// encrypted home directories) limits file names to 143 bytes.
+const maxNameLength = 135
+
+// Maximum length of a path relative to the cluster directory. Windows limits
+// paths to 260 characters, so we need to leave room for the gather directory.
+const maxPathLength = 160
+
+// Directory for resources with paths longer than maxPathLength.
+const hashedDir = "hashed"
+
+// Names reserved on Windows, regardless of case and extension.
+var reservedNames = map[string]struct{}{
+	"con": {}, "prn": {}, "aux": {}, "nul": {},
+	"com1": {}, "com2": {}, "com3": {}, "com4": {}, "com5": {},
+	"com6": {}, "com7": {}, "com8": {}, "com9": {},
+	"lpt1": {}, "lpt2": {}, "lpt3": {}, "lpt4": {}, "lpt5": {},
+	"lpt6": {}, "lpt7": {}, "lpt8": {}, "lpt9": {},
+}
+
+// SafeName returns a file name for a resource name that is valid on Linux,
+// macOS and Windows. Characters invalid on some file systems (e.g. ":" in
+// "system:node") are escaped as "%XX". Names that are too long are truncated
+// and suffixed with a hash of the full name. The mapping from resource names
+// to paths is recorded in the index, so the original name can always be
+// found.
+func SafeName(name string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if needsEscape(c) || (i == len(name)-1 && (c == '.' || c == ' ')) {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+
+	safe := sb.String()
+
+	base, _, _ := strings.Cut(strings.ToLower(safe), ".")
+	if _, ok := reservedNames[base]; ok {
+		safe = fmt.Sprintf("%%%02X", safe[0]) + safe[1:]
+	}
+
+	if len(safe) > maxNameLength {
+		// Keep valid UTF-8, required on macOS.
+		end := maxNameLength - 17
+		for end > 0 && !utf8.RuneStart(safe[end]) {
+			end--
+		}
+		sum := sha256.Sum256([]byte(name))
+		safe = safe[:end] + "~" + hex.EncodeToString(sum[:8])
+	}
+
+	return safe
+}
+
+func needsEscape(c byte) bool {
+	if c < 0x20 || c == 0x7f {
+		return true
+	}
+	return strings.IndexByte(`<>:"/\|?*%`, c) != -1
+}
+
+// shortenPath returns relpath if it is short enough, or a shorter path using a
+// hashed file name. If the directory is too long, the resource is stored in the
+// hashed directory. The mapping from resource names to paths is recorded in
+// the index, so the resource can be found by name.
+func shortenPath(relpath string) string {
+	if len(relpath) <= maxPathLength {
+		return relpath
+	}
+
+	sum := sha256.Sum256([]byte(relpath))
+	name := hex.EncodeToString(sum[:16]) + path.Ext(relpath)
+
+	shorter := path.Join(path.Dir(relpath), name)
+	if len(shorter) <= maxPathLength {
+		return shorter
+	}
+
+	return path.Join(hashedDir, name)
+}
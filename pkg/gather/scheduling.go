@@ -0,0 +1,344 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	schedulingReportName = "scheduling-report.yaml"
+
+	failedSchedulingReason = "FailedScheduling"
+)
+
+var (
+	priorityClassesResource = schedulingv1.SchemeGroupVersion.WithResource("priorityclasses")
+	podsResource            = corev1.SchemeGroupVersion.WithResource("pods")
+	nodesResource           = corev1.SchemeGroupVersion.WithResource("nodes")
+	eventsResource          = corev1.SchemeGroupVersion.WithResource("events")
+)
+
+// SchedulingReport describes the scheduling pressure at the time of the
+// gather, enabling offline diagnosis of pending pods.
+type SchedulingReport struct {
+	PriorityClasses []PriorityClassInfo `json:"priorityClasses,omitempty"`
+
+	// Pods waiting to be scheduled in the gathered namespaces.
+	PendingPods []PendingPod `json:"pendingPods,omitempty"`
+
+	// Nodes allocatable and requested resources. Recorded only when gathering
+	// all namespaces.
+	Nodes []NodeResources `json:"nodes,omitempty"`
+}
+
+type PriorityClassInfo struct {
+	Name             string `json:"name"`
+	Value            int32  `json:"value"`
+	GlobalDefault    bool   `json:"globalDefault,omitempty"`
+	PreemptionPolicy string `json:"preemptionPolicy,omitempty"`
+}
+
+type PendingPod struct {
+	Namespace         string              `json:"namespace"`
+	Name              string              `json:"name"`
+	PriorityClass     string              `json:"priorityClass,omitempty"`
+	Priority          int32               `json:"priority"`
+	NominatedNodeName string              `json:"nominatedNodeName,omitempty"`
+	Requests          corev1.ResourceList `json:"requests,omitempty"`
+	Events            []SchedulingEvent   `json:"events,omitempty"`
+}
+
+type SchedulingEvent struct {
+	LastTimestamp metav1.Time `json:"lastTimestamp"`
+	Count         int32       `json:"count"`
+	Message       string      `json:"message"`
+}
+
+type NodeResources struct {
+	Name          string              `json:"name"`
+	Unschedulable bool                `json:"unschedulable,omitempty"`
+	Pods          int                 `json:"pods"`
+	Allocatable   corev1.ResourceList `json:"allocatable"`
+	Requested     corev1.ResourceList `json:"requested"`
+}
+
+// gatherSchedulingReport writes the scheduling report to the cluster
+// directory. When gathering specific namespaces, the priority classes are
+// gathered, since cluster scoped resources are not gathered.
+func (g *Gatherer) gatherSchedulingReport(namespaces []string) {
+	report := SchedulingReport{}
+	report.PriorityClasses = g.priorityClasses()
+
+	for _, namespace := range namespaces {
+		report.PendingPods = append(report.PendingPods, g.pendingPods(namespace)...)
+	}
+
+	if slices.Contains(namespaces, metav1.NamespaceAll) {
+		report.Nodes = g.nodesResources()
+	}
+
+	data, err := yaml.Marshal(&report)
+	if err != nil {
+		g.log.Warnf("Cannot encode %q: %s", schedulingReportName, err)
+		return
+	}
+
+	dst, err := g.output.CreateClusterFile(schedulingReportName)
+	if err != nil {
+		g.log.Warnf("Cannot create %q: %s", schedulingReportName, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if _, err := dst.Write(data); err != nil {
+		g.log.Warnf("Cannot write %q: %s", schedulingReportName, err)
+	}
+}
+
+func (g *Gatherer) priorityClasses() []PriorityClassInfo {
+	list, err := g.client.Resource(priorityClassesResource).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		g.log.Warnf("Cannot list priorityclasses: %s", err)
+		return nil
+	}
+
+	var classes []PriorityClassInfo
+
+	for i := range list.Items {
+		var pc schedulingv1.PriorityClass
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(list.Items[i].Object, &pc); err != nil {
+			continue
+		}
+
+		// Needed only when gathering specific namespaces.
+		if len(g.opts.Namespaces) > 0 {
+			g.wq.Queue(func() error {
+				g.gatherResource(priorityClassesResource, types.NamespacedName{Name: pc.Name})
+				return nil
+			})
+		}
+
+		info := PriorityClassInfo{Name: pc.Name, Value: pc.Value, GlobalDefault: pc.GlobalDefault}
+		if pc.PreemptionPolicy != nil {
+			info.PreemptionPolicy = string(*pc.PreemptionPolicy)
+		}
+		classes = append(classes, info)
+	}
+
+	slices.SortFunc(classes, func(a, b PriorityClassInfo) int {
+		if c := cmp.Compare(b.Value, a.Value); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return classes
+}
+
+// pendingPods returns the pods in namespace waiting to be scheduled, with
+// their scheduling failure events.
+func (g *Gatherer) pendingPods(namespace string) []PendingPod {
+	ctx := context.TODO()
+
+	list, err := g.client.Resource(podsResource).
+		Namespace(namespace).
+		List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("status.phase", string(corev1.PodPending)).String(),
+		})
+	if err != nil {
+		g.log.Warnf("Cannot list pending pods: %s", err)
+		return nil
+	}
+
+	var pending []PendingPod
+
+	for i := range list.Items {
+		var pod corev1.Pod
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(list.Items[i].Object, &pod); err != nil {
+			continue
+		}
+		if pod.Spec.NodeName != "" {
+			continue
+		}
+		p := PendingPod{
+			Namespace:         pod.Namespace,
+			Name:              pod.Name,
+			PriorityClass:     pod.Spec.PriorityClassName,
+			NominatedNodeName: pod.Status.NominatedNodeName,
+			Requests:          podRequests(&pod),
+		}
+		if pod.Spec.Priority != nil {
+			p.Priority = *pod.Spec.Priority
+		}
+		pending = append(pending, p)
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	events, err := g.client.Resource(eventsResource).
+		Namespace(namespace).
+		List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("reason", failedSchedulingReason).String(),
+		})
+	if err != nil {
+		g.log.Warnf("Cannot list %q events: %s", failedSchedulingReason, err)
+	} else {
+		addSchedulingEvents(pending, events.Items)
+	}
+
+	slices.SortFunc(pending, func(a, b PendingPod) int {
+		if c := strings.Compare(a.Namespace, b.Namespace); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return pending
+}
+
+// addSchedulingEvents adds scheduling failure events to the pending pods,
+// oldest first.
+func addSchedulingEvents(pending []PendingPod, events []unstructured.Unstructured) {
+	for i := range events {
+		var event corev1.Event
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(events[i].Object, &event); err != nil {
+			continue
+		}
+
+		obj := event.InvolvedObject
+		j := slices.IndexFunc(pending, func(p PendingPod) bool {
+			return obj.Kind == "Pod" && p.Namespace == obj.Namespace && p.Name == obj.Name
+		})
+		if j == -1 {
+			continue
+		}
+
+		// Events reported by new event API have only the event time.
+		timestamp := event.LastTimestamp
+		if timestamp.IsZero() {
+			timestamp = metav1.Time{Time: event.EventTime.Time}
+		}
+
+		pending[j].Events = append(pending[j].Events, SchedulingEvent{
+			LastTimestamp: timestamp,
+			Count:         max(event.Count, 1),
+			Message:       event.Message,
+		})
+	}
+
+	for i := range pending {
+		slices.SortFunc(pending[i].Events, func(a, b SchedulingEvent) int {
+			return a.LastTimestamp.Compare(b.LastTimestamp.Time)
+		})
+	}
+}
+
+// nodesResources returns the allocatable and requested resources of all
+// nodes. Requested resources are the sum of the requests of pods running or
+// waiting to run on the node.
+func (g *Gatherer) nodesResources() []NodeResources {
+	ctx := context.TODO()
+
+	nodes, err := g.client.Resource(nodesResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		g.log.Warnf("Cannot list nodes: %s", err)
+		return nil
+	}
+
+	result := make([]NodeResources, 0, len(nodes.Items))
+	byName := map[string]int{}
+
+	for i := range nodes.Items {
+		var node corev1.Node
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(nodes.Items[i].Object, &node); err != nil {
+			continue
+		}
+		byName[node.Name] = len(result)
+		result = append(result, NodeResources{
+			Name:          node.Name,
+			Unschedulable: node.Spec.Unschedulable,
+			Allocatable:   node.Status.Allocatable,
+			Requested:     corev1.ResourceList{},
+		})
+	}
+
+	selector := fields.AndSelectors(
+		fields.OneTermNotEqualSelector("status.phase", string(corev1.PodSucceeded)),
+		fields.OneTermNotEqualSelector("status.phase", string(corev1.PodFailed)),
+	)
+	pods, err := g.client.Resource(podsResource).List(ctx, metav1.ListOptions{FieldSelector: selector.String()})
+	if err != nil {
+		g.log.Warnf("Cannot list pods: %s", err)
+		return result
+	}
+
+	for i := range pods.Items {
+		var pod corev1.Pod
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(pods.Items[i].Object, &pod); err != nil {
+			continue
+		}
+		j, ok := byName[pod.Spec.NodeName]
+		if !ok {
+			continue
+		}
+		result[j].Pods++
+		addResourceList(result[j].Requested, podRequests(&pod))
+	}
+
+	slices.SortFunc(result, func(a, b NodeResources) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return result
+}
+
+// podRequests returns the resources requested by pod, like the scheduler: the
+// sum of the containers requests or the largest init container request, plus
+// the pod overhead.
+func podRequests(pod *corev1.Pod) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+
+	for i := range pod.Spec.Containers {
+		addResourceList(requests, pod.Spec.Containers[i].Resources.Requests)
+	}
+
+	for i := range pod.Spec.InitContainers {
+		for name, quantity := range pod.Spec.InitContainers[i].Resources.Requests {
+			if current, ok := requests[name]; !ok || quantity.Cmp(current) > 0 {
+				requests[name] = quantity.DeepCopy()
+			}
+		}
+	}
+
+	addResourceList(requests, pod.Spec.Overhead)
+
+	return requests
+}
+
+func addResourceList(list corev1.ResourceList, more corev1.ResourceList) {
+	for name, quantity := range more {
+		if current, ok := list[name]; ok {
+			current.Add(quantity)
+			list[name] = current
+		} else {
+			list[name] = quantity.DeepCopy()
+		}
+	}
+}
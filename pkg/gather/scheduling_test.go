@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestPodRequests(t *testing.T) {
+	requests := func(cpu, memory string) corev1.ResourceRequirements {
+		return corev1.ResourceRequirements{Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		}}
+	}
+
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{
+				{Name: "setup", Resources: requests("2", "64Mi")},
+			},
+			Containers: []corev1.Container{
+				{Name: "server", Resources: requests("500m", "128Mi")},
+				{Name: "proxy", Resources: requests("100m", "64Mi")},
+			},
+			Overhead: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m")},
+		},
+	}
+
+	result := podRequests(pod)
+
+	// The init container cpu request is larger than the containers requests.
+	if cpu := result[corev1.ResourceCPU]; cpu.String() != "2050m" {
+		t.Errorf("expected cpu 2050m, got %s", cpu.String())
+	}
+	if memory := result[corev1.ResourceMemory]; memory.String() != "192Mi" {
+		t.Errorf("expected memory 192Mi, got %s", memory.String())
+	}
+}
@@ -0,0 +1,229 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+)
+
+const (
+	schemasName = "schemas"
+	schemasDir  = "schemas"
+)
+
+// SchemasResult describes the result of validating the custom resources in a
+// gather directory against their schemas.
+type SchemasResult struct {
+	// Number of validated objects.
+	Objects int
+
+	// Objects that do not match their schema, and would fail re-creation on
+	// another cluster. Empty if all objects are valid.
+	Problems []string
+}
+
+type schemasAddon struct {
+	AddonBackend
+	log *zap.SugaredLogger
+}
+
+func init() {
+	registerAddon(schemasName, addonInfo{
+		Resources: []string{"apiextensions.k8s.io/customresourcedefinitions"},
+		AddonFunc: NewSchemasAddon,
+		Priority:  PriorityAddons,
+	})
+}
+
+func NewSchemasAddon(backend AddonBackend) (Addon, error) {
+	return &schemasAddon{
+		AddonBackend: backend,
+		log:          backend.Options().Log.Named(schemasName),
+	}, nil
+}
+
+// Inspect extracts the openAPIV3Schema of every version of a custom resource
+// definition to "schemas/{group}/{resource}/{version}.json", so gathered
+// custom resources can be validated offline.
+func (a *schemasAddon) Inspect(crd *unstructured.Unstructured) error {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	resource, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+	if group == "" || resource == "" {
+		a.log.Warnf("Invalid customresourcedefinition %q: missing group or plural name", crd.GetName())
+		return nil
+	}
+
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, item := range versions {
+		version, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		name, _, _ := unstructured.NestedString(version, "name")
+		schema, found, _ := unstructured.NestedMap(version, "schema", "openAPIV3Schema")
+		if name == "" || !found {
+			continue
+		}
+
+		a.writeSchema(schemaPath(group, resource, name), schema)
+	}
+
+	return nil
+}
+
+func (a *schemasAddon) writeSchema(relpath string, schema map[string]any) {
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		a.log.Warnf("Cannot encode %q: %s", relpath, err)
+		return
+	}
+
+	dst, err := a.Output().CreateResource(relpath)
+	if err != nil {
+		a.log.Warnf("Cannot create %q: %s", relpath, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if _, err := dst.Write(data); err != nil {
+		a.log.Warnf("Cannot write %q: %s", relpath, err)
+	}
+}
+
+// schemaPath returns the path of a custom resource schema relative to the
+// cluster directory.
+func schemaPath(group string, resource string, version string) string {
+	return path.Join(schemasDir, group, resource, version+".json")
+}
+
+// ValidateSchemas validates the custom resources gathered in all clusters in
+// directory against the schemas extracted from their custom resource
+// definitions. Resources without a schema are not validated.
+func ValidateSchemas(directory string) (*SchemasResult, error) {
+	clusterDirs, err := FindClusterDirs(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(clusterDirs) == 0 {
+		return nil, fmt.Errorf("no clusters found in %q", directory)
+	}
+
+	result := &SchemasResult{}
+
+	for _, clusterDir := range clusterDirs {
+		if err := validateClusterSchemas(clusterDir, result); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func validateClusterSchemas(clusterDir string, result *SchemasResult) error {
+	entries, err := ReadIndex(clusterDir)
+	if err != nil {
+		return fmt.Errorf("cannot read index in %q: %s", clusterDir, err)
+	}
+
+	// Loaded validators by schema path. Nil if the resource has no schema.
+	validators := map[string]*validate.SchemaValidator{}
+
+	for _, entry := range entries {
+		// Core resources (e.g. "pods") have no custom resource definition.
+		if !strings.Contains(entry.Resource, "/") {
+			continue
+		}
+
+		item, err := ReadResource(clusterDir, entry)
+		if err != nil {
+			result.Problems = append(result.Problems, err.Error())
+			continue
+		}
+
+		gv, err := schema.ParseGroupVersion(item.GetAPIVersion())
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("%q: %s", entry.Path, err))
+			continue
+		}
+
+		_, resource, _ := strings.Cut(entry.Resource, "/")
+		relpath := schemaPath(gv.Group, resource, gv.Version)
+
+		validator, ok := validators[relpath]
+		if !ok {
+			validator, err = loadSchemaValidator(filepath.Join(clusterDir, filepath.FromSlash(relpath)))
+			if err != nil {
+				return err
+			}
+			validators[relpath] = validator
+		}
+
+		if validator == nil {
+			continue
+		}
+
+		result.Objects++
+
+		for _, problem := range validateObject(validator, item) {
+			result.Problems = append(result.Problems, fmt.Sprintf("%q: %s", entry.Path, problem))
+		}
+	}
+
+	return nil
+}
+
+// loadSchemaValidator returns a validator for the schema in filename, or nil
+// if the schema does not exist.
+func loadSchemaValidator(filename string) (*validate.SchemaValidator, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	s := &spec.Schema{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("cannot decode schema %q: %s", filename, err)
+	}
+
+	return validate.NewSchemaValidator(s, nil, "", strfmt.Default), nil
+}
+
+// validateObject returns the schema violations in item. The metadata is
+// validated by the API server and the status is not restored when the object
+// is re-created, so both are ignored.
+func validateObject(validator *validate.SchemaValidator, item *unstructured.Unstructured) []string {
+	obj := item.DeepCopy().Object
+	delete(obj, "metadata")
+	delete(obj, "status")
+
+	res := validator.Validate(obj)
+	if res.IsValid() {
+		return nil
+	}
+
+	var problems []string
+	for _, err := range res.Errors {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
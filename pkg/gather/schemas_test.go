@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestValidateSchemas(t *testing.T) {
+	dir := t.TempDir()
+	clusterDir := filepath.Join(dir, "cluster1")
+
+	crdSchema := `{
+  "type": "object",
+  "properties": {
+    "spec": {
+      "type": "object",
+      "required": ["size"],
+      "properties": {
+        "size": {"type": "integer", "minimum": 1}
+      }
+    }
+  }
+}`
+	relpath := schemaPath("example.com", "widgets", "v1")
+	if err := os.MkdirAll(filepath.Join(clusterDir, filepath.Dir(relpath)), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(clusterDir, relpath), []byte(crdSchema), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	widgets := resourceInfo{
+		GroupVersionResource: schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"},
+		Kind:                 "Widget",
+		Namespaced:           true,
+	}
+	gadgets := resourceInfo{
+		GroupVersionResource: schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "gadgets"},
+		Kind:                 "Gadget",
+		Namespaced:           true,
+	}
+
+	newItem := func(kind string, name string, spec map[string]any) *unstructured.Unstructured {
+		item := &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "example.com/v1",
+			"kind":       kind,
+			"spec":       spec,
+			// Status is not validated.
+			"status": map[string]any{"size": "invalid"},
+		}}
+		item.SetNamespace("test")
+		item.SetName(name)
+		return item
+	}
+
+	output := NewOutputDirectory(clusterDir)
+	idx := &index{}
+	var written atomic.Int64
+	w := &resourceWriter{output: output, index: idx, written: &written}
+
+	for _, item := range []*unstructured.Unstructured{
+		newItem("Widget", "valid", map[string]any{"size": int64(3)}),
+		newItem("Widget", "wrong-type", map[string]any{"size": "3"}),
+		newItem("Widget", "missing", map[string]any{}),
+	} {
+		if err := w.Dump(&widgets, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// No schema for gadgets.
+	if err := w.Dump(&gadgets, newItem("Gadget", "anything", map[string]any{"size": "3"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Write(output); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ValidateSchemas(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Objects != 3 {
+		t.Errorf("expected 3 objects, got %d", result.Objects)
+	}
+	if len(result.Problems) != 2 {
+		t.Fatalf("expected 2 problems, got %q", result.Problems)
+	}
+	for i, name := range []string{"missing", "wrong-type"} {
+		relpath := NamespacedResourcePath("test", "example.com/widgets", name)
+		if !strings.HasPrefix(result.Problems[i], strconv.Quote(relpath)) {
+			t.Errorf("expected problem for %q, got %q", relpath, result.Problems[i])
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	snapshotsReportName = "snapshots-report.yaml"
+)
+
+var (
+	volumeSnapshotsResource        = snapshotResource("volumesnapshots")
+	volumeSnapshotContentsResource = snapshotResource("volumesnapshotcontents")
+	volumeSnapshotClassesResource  = snapshotResource("volumesnapshotclasses")
+)
+
+func snapshotResource(resource string) schema.GroupVersionResource {
+	return schema.GroupVersionResource{
+		Group:    "snapshot.storage.k8s.io",
+		Version:  "v1",
+		Resource: resource,
+	}
+}
+
+// SnapshotStatus describes the consistency of a volume snapshot and its bound
+// volume snapshot content.
+type SnapshotStatus struct {
+	Name       string   `json:"name"`
+	PVC        string   `json:"pvc,omitempty"`
+	Content    string   `json:"content,omitempty"`
+	Class      string   `json:"class,omitempty"`
+	ReadyToUse bool     `json:"readyToUse"`
+	Problems   []string `json:"problems,omitempty"`
+}
+
+// gatherSnapshots gathers the volume snapshot contents and classes of volume
+// snapshots in namespace, and writes a consistency report flagging snapshots
+// without bound content or with stale content.
+func (a *pvcsAddon) gatherSnapshots(namespace string) {
+	ctx := context.TODO()
+
+	snapshots, err := a.client.Resource(volumeSnapshotsResource).
+		Namespace(namespace).
+		List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// Snapshot CRDs not installed.
+			return
+		}
+		a.log.Warnf("Cannot list volumesnapshots in namespace %q: %s", namespace, err)
+		return
+	}
+
+	if len(snapshots.Items) == 0 {
+		return
+	}
+
+	var report []SnapshotStatus
+
+	for i := range snapshots.Items {
+		report = append(report, a.inspectSnapshot(&snapshots.Items[i]))
+	}
+
+	a.writeSnapshotsReport(namespace, report)
+}
+
+func (a *pvcsAddon) inspectSnapshot(snapshot *unstructured.Unstructured) SnapshotStatus {
+	status := SnapshotStatus{Name: snapshot.GetName()}
+
+	status.PVC, _, _ = unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName")
+	status.Class, _, _ = unstructured.NestedString(snapshot.Object, "spec", "volumeSnapshotClassName")
+	status.Content, _, _ = unstructured.NestedString(snapshot.Object, "status", "boundVolumeSnapshotContentName")
+	status.ReadyToUse, _, _ = unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+
+	// Needed only when gathering specific namespaces.
+	if len(a.Options().Namespaces) > 0 {
+		if status.Class != "" {
+			a.GatherResource(volumeSnapshotClassesResource, types.NamespacedName{Name: status.Class})
+		}
+		if status.Content != "" {
+			a.GatherResource(volumeSnapshotContentsResource, types.NamespacedName{Name: status.Content})
+		}
+	}
+
+	if status.Content == "" {
+		status.Problems = append(status.Problems, "no bound content")
+		return status
+	}
+
+	content, err := a.client.Resource(volumeSnapshotContentsResource).
+		Get(context.TODO(), status.Content, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			status.Problems = append(status.Problems, "bound content does not exist")
+		} else {
+			status.Problems = append(status.Problems, fmt.Sprintf("cannot get bound content: %s", err))
+		}
+		return status
+	}
+
+	refName, _, _ := unstructured.NestedString(content.Object, "spec", "volumeSnapshotRef", "name")
+	refNamespace, _, _ := unstructured.NestedString(content.Object, "spec", "volumeSnapshotRef", "namespace")
+	refUID, _, _ := unstructured.NestedString(content.Object, "spec", "volumeSnapshotRef", "uid")
+
+	if refName != snapshot.GetName() || refNamespace != snapshot.GetNamespace() {
+		status.Problems = append(status.Problems,
+			fmt.Sprintf("content bound to another snapshot \"%s/%s\"", refNamespace, refName))
+	} else if refUID != "" && refUID != string(snapshot.GetUID()) {
+		status.Problems = append(status.Problems, "content bound to a deleted snapshot with the same name")
+	}
+
+	handle, _, _ := unstructured.NestedString(content.Object, "status", "snapshotHandle")
+	if handle == "" {
+		handle, _, _ = unstructured.NestedString(content.Object, "spec", "source", "snapshotHandle")
+	}
+	if handle == "" {
+		status.Problems = append(status.Problems, "content has no snapshot handle")
+	}
+
+	message, _, _ := unstructured.NestedString(content.Object, "status", "error", "message")
+	if message != "" {
+		status.Problems = append(status.Problems, fmt.Sprintf("content error: %s", message))
+	}
+
+	return status
+}
+
+func (a *pvcsAddon) writeSnapshotsReport(namespace string, report []SnapshotStatus) {
+	data, err := yaml.Marshal(report)
+	if err != nil {
+		a.log.Warnf("Cannot encode %q: %s", snapshotsReportName, err)
+		return
+	}
+
+	dir, err := a.Output().CreateAddonDir(pvcsName, namespacesDir, namespace)
+	if err != nil {
+		a.log.Warnf("Cannot create %q directory: %s", namespace, err)
+		return
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, snapshotsReportName), data, 0640); err != nil {
+		a.log.Warnf("Cannot write %q: %s", snapshotsReportName, err)
+	}
+}
@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"maps"
+	"time"
+)
+
+// Stats describes a gather. Stats can be used while gathering to report
+// progress, or after Gather returns to report the results.
+type Stats struct {
+	// Number of resources gathered.
+	Resources int `json:"resources"`
+
+	// Bytes written to resource files.
+	Bytes int64 `json:"bytes"`
+
+	// Number of unique API warnings. Warnings are recorded only when
+	// Options.ShowAPIWarnings is set.
+	Warnings int `json:"warnings"`
+
+	// Number of errors recorded in errors.yaml.
+	Errors int `json:"errors"`
+
+	// Number of errors recorded in errors.yaml by kind (e.g.
+	// "ListForbidden"). Errors of unknown kind are not included.
+	ErrorKinds map[string]int `json:"errorKinds,omitempty"`
+
+	// Time spent listing and dumping each resource in all namespaces, in
+	// seconds. Time spent in addons is not included.
+	ResourceTiming Durations `json:"resourceTiming"`
+
+	// Work queue activity.
+	Queue QueueStats `json:"queue"`
+}
+
+// Stats returns the gather statistics.
+func (g *Gatherer) Stats() Stats {
+	g.mutex.Lock()
+	stats := Stats{
+		Resources:      len(g.resources),
+		ResourceTiming: maps.Clone(g.resourceTiming),
+	}
+	g.mutex.Unlock()
+
+	stats.Bytes = g.written.Load()
+	stats.Errors = g.errors.Len()
+	stats.ErrorKinds = g.errors.Kinds()
+	if g.warnings != nil {
+		stats.Warnings = len(g.warnings.Warnings())
+	}
+	stats.Queue = g.wq.Stats()
+
+	return stats
+}
+
+func (g *Gatherer) addResourceTime(r *resourceInfo, elapsed time.Duration) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.resourceTiming[r.Name()] += elapsed.Seconds()
+}
@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStats(t *testing.T) {
+	lister := &fakeLister{items: newItems(10)}
+	g, _ := newTestGatherer(t, Options{}, lister)
+	g.dumper = &resourceWriter{output: &g.output, index: &g.index, written: &g.written}
+
+	g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+
+	stats := g.Stats()
+	if stats.Resources != 10 {
+		t.Errorf("expected 10 resources, got %d", stats.Resources)
+	}
+	if stats.Bytes == 0 {
+		t.Errorf("expected bytes written")
+	}
+	if _, ok := stats.ResourceTiming["persistentvolumes"]; !ok {
+		t.Errorf("expected persistentvolumes timing, got %v", stats.ResourceTiming)
+	}
+	if stats.Errors != 0 {
+		t.Errorf("expected no errors, got %d", stats.Errors)
+	}
+}
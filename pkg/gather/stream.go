@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// newStreamClient returns a rest client for streaming list responses. The
+// client is configured like the dynamic client, but we use it to read the raw
+// response body instead of decoding the entire response in memory.
+func newStreamClient(config *rest.Config, httpClient *http.Client) (*rest.RESTClient, error) {
+	streamConfig := dynamic.ConfigFor(config)
+	streamConfig.GroupVersion = &schema.GroupVersion{}
+	streamConfig.APIPath = "/"
+	return rest.RESTClientForConfigAndClient(streamConfig, httpClient)
+}
+
+// resourcePath returns the path segments for listing resource r in namespace.
+func resourcePath(r *resourceInfo, namespace string) []string {
+	var path []string
+	if r.Group == "" {
+		path = append(path, "api")
+	} else {
+		path = append(path, "apis", r.Group)
+	}
+	path = append(path, r.Version)
+	if r.Namespaced && namespace != "" {
+		path = append(path, "namespaces", namespace)
+	}
+	return append(path, r.Resource)
+}
+
+// listDecoder decodes a list response one item at a time, so we keep only
+// one item in memory regardless of the size of the list.
+type listDecoder struct {
+	decoder    *json.Decoder
+	limiter    *byteLimiter
+	apiVersion string
+	kind       string
+}
+
+func newListDecoder(r io.Reader, limiter *byteLimiter) *listDecoder {
+	return &listDecoder{decoder: json.NewDecoder(r), limiter: limiter}
+}
+
+// Decode calls fn for every item in the list and returns the list metadata.
+func (d *listDecoder) Decode(fn func(*unstructured.Unstructured)) (*metav1.ListMeta, error) {
+	if err := d.expectDelim('{'); err != nil {
+		return nil, err
+	}
+
+	var meta metav1.ListMeta
+
+	for d.decoder.More() {
+		token, err := d.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok := token.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected token %v", token)
+		}
+
+		switch key {
+		case "apiVersion":
+			err = d.decoder.Decode(&d.apiVersion)
+		case "kind":
+			err = d.decoder.Decode(&d.kind)
+		case "metadata":
+			err = d.decoder.Decode(&meta)
+		case "items":
+			err = d.decodeItems(fn)
+		default:
+			var ignored json.RawMessage
+			err = d.decoder.Decode(&ignored)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode %q: %s", key, err)
+		}
+	}
+
+	if err := d.expectDelim('}'); err != nil {
+		return nil, err
+	}
+
+	return &meta, nil
+}
+
+func (d *listDecoder) decodeItems(fn func(*unstructured.Unstructured)) error {
+	token, err := d.decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	// "items": null
+	if token == nil {
+		return nil
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected '[', got %v", token)
+	}
+
+	for d.decoder.More() {
+		var raw json.RawMessage
+		if err := d.decoder.Decode(&raw); err != nil {
+			return err
+		}
+
+		if err := d.decodeItem(raw, fn); err != nil {
+			return err
+		}
+	}
+
+	return d.expectDelim(']')
+}
+
+func (d *listDecoder) decodeItem(raw json.RawMessage, fn func(*unstructured.Unstructured)) error {
+	// The size of the encoded item is a good enough approximation of the
+	// memory used by the decoded item.
+	size := int64(len(raw))
+	d.limiter.Acquire(size)
+	defer d.limiter.Release(size)
+
+	// Convert numbers to int64 or float64 like the dynamic client.
+	item := &unstructured.Unstructured{}
+	if err := utiljson.Unmarshal(raw, &item.Object); err != nil {
+		return err
+	}
+
+	// Items in a list do not have apiVersion and kind.
+	if item.GetAPIVersion() == "" {
+		item.SetAPIVersion(d.apiVersion)
+	}
+	if item.GetKind() == "" {
+		item.SetKind(strings.TrimSuffix(d.kind, "List"))
+	}
+
+	fn(item)
+	return nil
+}
+
+func (d *listDecoder) expectDelim(expected json.Delim) error {
+	token, err := d.decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("expected %q, got %v", expected, token)
+	}
+	return nil
+}
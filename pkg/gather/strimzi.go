@@ -0,0 +1,220 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	strimziName = "strimzi"
+
+	// Label of all resources belonging to a kafka cluster.
+	strimziClusterLabel = "strimzi.io/cluster"
+
+	// Label of the component (e.g. "{cluster}-kafka") of a pod.
+	strimziNameLabel = "strimzi.io/name"
+
+	// Kafka tools in the entity operator pod, connecting to the cluster
+	// bootstrap service plain listener.
+	kafkaBinDir        = "/opt/kafka/bin"
+	kafkaBootstrapPort = 9092
+
+	// Timeout for kafka commands. Commands may block when brokers are
+	// unavailable.
+	strimziCommandTimeout = 60 * time.Second
+)
+
+var (
+	kafkaTopicsResource = schema.GroupVersionResource{Group: "kafka.strimzi.io", Version: "v1beta2", Resource: "kafkatopics"}
+	kafkaUsersResource  = schema.GroupVersionResource{Group: "kafka.strimzi.io", Version: "v1beta2", Resource: "kafkausers"}
+
+	// Kafka cluster components with logs to gather.
+	strimziComponents = []string{"kafka", "zookeeper", "entity-operator"}
+)
+
+// StrimziAddon gathers the pods, topics and users of Strimzi kafka clusters,
+// and runs kafka commands describing the topics and consumer groups.
+type StrimziAddon struct {
+	AddonBackend
+	client  *kubernetes.Clientset
+	dynamic dynamic.Interface
+	log     *zap.SugaredLogger
+}
+
+func init() {
+	registerAddon(strimziName, addonInfo{
+		Resources: []string{"kafka.strimzi.io/kafkas"},
+		AddonFunc: NewStrimziAddon,
+		Priority:  PriorityAddons,
+	})
+}
+
+func NewStrimziAddon(backend AddonBackend) (Addon, error) {
+	client, err := kubernetes.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfigAndClient(backend.Config(), backend.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	return &StrimziAddon{
+		AddonBackend: backend,
+		client:       client,
+		dynamic:      dynamicClient,
+		log:          backend.Options().Log.Named(strimziName),
+	}, nil
+}
+
+func (a *StrimziAddon) Inspect(kafka *unstructured.Unstructured) error {
+	namespace := kafka.GetNamespace()
+	cluster := kafka.GetName()
+	a.log.Debugf("Inspecting kafka \"%s/%s\"", namespace, cluster)
+
+	a.QueueNamespace(namespace, func(ctx context.Context) error {
+		a.gatherPods(ctx, namespace, cluster)
+		return nil
+	})
+
+	a.QueueNamespace(namespace, func(context.Context) error {
+		a.gatherClusterResources(namespace, cluster, kafkaTopicsResource)
+		a.gatherClusterResources(namespace, cluster, kafkaUsersResource)
+		return nil
+	})
+
+	if a.Options().AgentsAllowed() {
+		a.QueueNamespace(namespace, func(ctx context.Context) error {
+			a.gatherCommands(ctx, namespace, cluster)
+			return nil
+		})
+	} else {
+		a.log.Debugf("Skipping kafka \"%s/%s\" commands in read only mode", namespace, cluster)
+	}
+
+	return nil
+}
+
+// gatherPods gathers the kafka, zookeeper and entity operator pods of
+// cluster with their logs.
+func (a *StrimziAddon) gatherPods(ctx context.Context, namespace string, cluster string) {
+	for _, component := range strimziComponents {
+		pods, err := a.listComponentPods(namespace, cluster, component)
+		if err != nil {
+			a.log.Warnf("Cannot list kafka \"%s/%s\" %s pods: %s", namespace, cluster, component, err)
+			continue
+		}
+
+		for i := range pods {
+			pod := &pods[i]
+			a.GatherResource(podsResource, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name})
+
+			if !logsAddonGathers(a.Options(), pod.Namespace) {
+				gatherPodLogs(ctx, a, a.client, a.log, pod)
+			}
+		}
+	}
+}
+
+// gatherClusterResources gathers the resources belonging to cluster.
+func (a *StrimziAddon) gatherClusterResources(namespace string, cluster string, gvr schema.GroupVersionResource) {
+	list, err := a.dynamic.Resource(gvr).Namespace(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: strimziClusterLabel + "=" + cluster,
+	})
+	if err != nil {
+		a.log.Warnf("Cannot list kafka \"%s/%s\" %s: %s", namespace, cluster, gvr.Resource, err)
+		return
+	}
+
+	for i := range list.Items {
+		a.GatherResource(gvr, types.NamespacedName{Namespace: namespace, Name: list.Items[i].GetName()})
+	}
+}
+
+// gatherCommands describes the topics and consumer groups using the kafka
+// tools in the entity operator pod.
+func (a *StrimziAddon) gatherCommands(ctx context.Context, namespace string, cluster string) {
+	pods, err := a.listComponentPods(namespace, cluster, "entity-operator")
+	if err != nil {
+		a.log.Warnf("Cannot list kafka \"%s/%s\" entity operator pods: %s", namespace, cluster, err)
+		return
+	}
+
+	pod := firstRunningPod(pods)
+	if pod == nil {
+		a.log.Warnf("Cannot find running entity operator pod for kafka \"%s/%s\"", namespace, cluster)
+		return
+	}
+
+	a.log.Debugf("Using pod %q", pod.Name)
+
+	dir, err := a.Output().CreateNamespaceAddonDir(namespace, strimziName, cluster)
+	if err != nil {
+		a.log.Warnf("Cannot create strimzi directory: %s", err)
+		return
+	}
+
+	rc := NewRemoteCommand(pod, a.Options(), a.log, dir).WithContext(ctx)
+
+	for _, c := range kafkaCommands(cluster) {
+		if err := rc.GatherAs(c.Filename, strimziCommandTimeout, c.Command...); err != nil {
+			a.log.Warnf("Error running %q in pod \"%s/%s\": %s", c.Filename, namespace, pod.Name, err)
+		}
+	}
+}
+
+func (a *StrimziAddon) listComponentPods(namespace string, cluster string, component string) ([]corev1.Pod, error) {
+	pods, err := a.client.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: strimziNameLabel + "=" + cluster + "-" + component,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// kafkaCommand is a kafka tool command with the file name for its output.
+type kafkaCommand struct {
+	Filename string
+	Command  []string
+}
+
+// kafkaCommands returns the commands describing the topics and consumer
+// groups of cluster.
+func kafkaCommands(cluster string) []kafkaCommand {
+	bootstrap := fmt.Sprintf("%s-kafka-bootstrap:%d", cluster, kafkaBootstrapPort)
+	return []kafkaCommand{
+		{
+			Filename: "kafka-topics-describe",
+			Command:  []string{kafkaBinDir + "/kafka-topics.sh", "--bootstrap-server", bootstrap, "--describe"},
+		},
+		{
+			Filename: "kafka-consumer-groups-describe",
+			Command:  []string{kafkaBinDir + "/kafka-consumer-groups.sh", "--bootstrap-server", bootstrap, "--describe", "--all-groups"},
+		},
+	}
+}
+
+// firstRunningPod returns the first running pod, or nil if no pod is running.
+func firstRunningPod(pods []corev1.Pod) *corev1.Pod {
+	for i := range pods {
+		if pods[i].Status.Phase == corev1.PodRunning {
+			return &pods[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestKafkaCommands(t *testing.T) {
+	commands := kafkaCommands("my-cluster")
+	for _, c := range commands {
+		if !slices.Contains(c.Command, "my-cluster-kafka-bootstrap:9092") {
+			t.Errorf("command %q does not use the cluster bootstrap service", c.Command)
+		}
+	}
+
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "pending"}, Status: corev1.PodStatus{Phase: corev1.PodPending}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "running"}, Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+	}
+	if pod := firstRunningPod(pods); pod == nil || pod.Name != "running" {
+		t.Errorf("expected running pod, got %v", pod)
+	}
+	if pod := firstRunningPod(pods[:1]); pod != nil {
+		t.Errorf("expected no pod, got %q", pod.Name)
+	}
+}
@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Event fields used to find the last time an event was observed, in order of
+// preference. Covers both "events" and "events.k8s.io/events".
+var eventTimeFields = [][]string{
+	{"series", "lastObservedTime"},
+	{"lastTimestamp"},
+	{"deprecatedLastTimestamp"},
+	{"eventTime"},
+	{"metadata", "creationTimestamp"},
+}
+
+// hasTimeWindow returns true if gathering is limited to a time window.
+func (o *Options) hasTimeWindow() bool {
+	return !o.Since.IsZero() || !o.Until.IsZero()
+}
+
+// inTimeWindow returns false if item is an event observed outside of the
+// gather time window. Other resources are always in the time window.
+func (g *Gatherer) inTimeWindow(r *resourceInfo, item *unstructured.Unstructured) bool {
+	if !g.opts.hasTimeWindow() || !isEventResource(r) {
+		return true
+	}
+
+	t, ok := eventTime(item)
+	if !ok {
+		return true
+	}
+
+	if !g.opts.Since.IsZero() && t.Before(g.opts.Since) {
+		return false
+	}
+
+	if !g.opts.Until.IsZero() && t.After(g.opts.Until) {
+		return false
+	}
+
+	return true
+}
+
+func isEventResource(r *resourceInfo) bool {
+	return r.Resource == "events" && (r.Group == "" || r.Group == "events.k8s.io")
+}
+
+// eventTime returns the last time event item was observed.
+func eventTime(item *unstructured.Unstructured) (time.Time, bool) {
+	for _, field := range eventTimeFields {
+		value, _, _ := unstructured.NestedString(item.Object, field...)
+		if value == "" {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// copyLogUntil copies log lines from src to dst, stopping at the first line
+// logged after until. The log must include timestamps (e.g. "2024-06-01T10:20:30.123456789Z
+// message"). The timestamps are removed, so the log looks like a log gathered
+// without timestamps. Lines without a valid timestamp are copied as is.
+func copyLogUntil(dst io.Writer, src io.Reader, until time.Time) (int64, error) {
+	reader := bufio.NewReader(src)
+	var n int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if i := bytes.IndexByte(line, ' '); i > 0 {
+				if t, terr := time.Parse(time.RFC3339Nano, string(line[:i])); terr == nil {
+					if t.After(until) {
+						return n, nil
+					}
+					line = line[i+1:]
+				}
+			}
+
+			written, werr := dst.Write(line)
+			n += int64(written)
+			if werr != nil {
+				return n, werr
+			}
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return n, nil
+			}
+			return n, err
+		}
+	}
+}
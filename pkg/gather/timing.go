@@ -0,0 +1,210 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	timingName = "timing.json"
+
+	// Time spent listing and dumping resources.
+	resourcesCategory = "resources"
+)
+
+// Durations maps a category (e.g. "resources", "logs") to the time spent in
+// this category in seconds. Since work is done in parallel by multiple
+// workers, the sum of all durations is typically larger than the total time.
+type Durations map[string]float64
+
+// Run is a single gather. Appending to a previous gather adds a run.
+type Run struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type Timing struct {
+	// Total gather time in seconds. When appending to previous gathers, the
+	// time from the start of the first gather to the end of the last one.
+	Total float64 `json:"total"`
+
+	// Time spent preparing the gather (discovery, getting namespaces).
+	Prepare float64 `json:"prepare"`
+
+	// Time spent retrying failed operations at the end of the gather.
+	Retry float64 `json:"retry,omitempty"`
+
+	// Time spent on cluster scoped resources and work not related to a
+	// specific namespace. When gathering all namespaces, listing namespaced
+	// resources in all namespaces is also accounted here.
+	Cluster Durations `json:"cluster"`
+
+	// Time spent per namespace.
+	Namespaces map[string]Durations `json:"namespaces"`
+
+	// Gather runs, ordered by start time.
+	Runs []Run `json:"runs,omitempty"`
+
+	mutex sync.Mutex
+}
+
+func newTiming() *Timing {
+	return &Timing{
+		Cluster:    Durations{},
+		Namespaces: map[string]Durations{},
+	}
+}
+
+// Add accounts elapsed time to category in namespace. An empty namespace
+// accounts the time to the cluster.
+func (t *Timing) Add(namespace string, category string, elapsed time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	durations := t.Cluster
+	if namespace != "" {
+		durations = t.Namespaces[namespace]
+		if durations == nil {
+			durations = Durations{}
+			t.Namespaces[namespace] = durations
+		}
+	}
+
+	durations[category] += elapsed.Seconds()
+}
+
+// AddRun records a gather run from start to end.
+func (t *Timing) AddRun(start time.Time, end time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.Runs = append(t.Runs, Run{Start: start, End: end})
+	t.updateTotal()
+}
+
+// Merge adds the runs and the time spent in other to t. Since runs do not
+// overlap, the total time is computed from the runs instead of adding the
+// totals. Timing written before runs were recorded has no runs, and does not
+// contribute to the total.
+func (t *Timing) Merge(other *Timing) {
+	other.mutex.Lock()
+	defer other.mutex.Unlock()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.Runs = append(t.Runs, other.Runs...)
+	t.updateTotal()
+	t.Prepare += other.Prepare
+	t.Retry += other.Retry
+
+	for category, seconds := range other.Cluster {
+		t.Cluster[category] += seconds
+	}
+
+	for namespace, durations := range other.Namespaces {
+		if t.Namespaces[namespace] == nil {
+			t.Namespaces[namespace] = Durations{}
+		}
+		for category, seconds := range durations {
+			t.Namespaces[namespace][category] += seconds
+		}
+	}
+}
+
+// updateTotal sets the total time to the time from the start of the first run
+// to the end of the last run. Must be called with the mutex held.
+func (t *Timing) updateTotal() {
+	if len(t.Runs) == 0 {
+		return
+	}
+
+	slices.SortFunc(t.Runs, func(a, b Run) int {
+		return a.Start.Compare(b.Start)
+	})
+
+	end := t.Runs[0].End
+	for _, run := range t.Runs[1:] {
+		if run.End.After(end) {
+			end = run.End
+		}
+	}
+
+	t.Total = end.Sub(t.Runs[0].Start).Seconds()
+}
+
+func (t *Timing) WriteJSON(w io.Writer) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(t)
+}
+
+// Summary returns a table summarizing the time spent in each namespace and
+// category.
+func (t *Timing) Summary() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	categories := map[string]struct{}{}
+	for c := range t.Cluster {
+		categories[c] = struct{}{}
+	}
+	for _, durations := range t.Namespaces {
+		for c := range durations {
+			categories[c] = struct{}{}
+		}
+	}
+
+	columns := slices.Sorted(maps.Keys(categories))
+
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "NAMESPACE\t%s\t\n", strings.ToUpper(strings.Join(columns, "\t")))
+
+	row := func(name string, durations Durations) {
+		fmt.Fprintf(w, "%s\t", name)
+		for _, c := range columns {
+			fmt.Fprintf(w, "%.3f\t", durations[c])
+		}
+		fmt.Fprintln(w)
+	}
+
+	row("(cluster)", t.Cluster)
+	for _, namespace := range slices.Sorted(maps.Keys(t.Namespaces)) {
+		row(namespace, t.Namespaces[namespace])
+	}
+
+	w.Flush()
+	return sb.String()
+}
+
+// readTiming reads the timing of the cluster directory.
+func readTiming(clusterDir string) (*Timing, error) {
+	data, err := os.ReadFile(filepath.Join(clusterDir, timingName))
+	if err != nil {
+		return nil, err
+	}
+
+	t := newTiming()
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", timingName, err)
+	}
+
+	return t, nil
+}
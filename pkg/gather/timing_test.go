@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimingAddRun(t *testing.T) {
+	start := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	timing := newTiming()
+	timing.AddRun(start, start.Add(90*time.Second))
+
+	if timing.Total != 90 {
+		t.Errorf("expected total 90, got %v", timing.Total)
+	}
+}
+
+func TestTimingMerge(t *testing.T) {
+	start := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		previous []Run
+		current  []Run
+		total    float64
+	}{
+		{
+			name:     "sequential runs",
+			previous: []Run{{start, start.Add(10 * time.Second)}},
+			current:  []Run{{start.Add(time.Hour), start.Add(time.Hour + 20*time.Second)}},
+			total:    3620,
+		},
+		{
+			name: "previous appended gathers",
+			previous: []Run{
+				{start, start.Add(10 * time.Second)},
+				{start.Add(time.Minute), start.Add(70 * time.Second)},
+			},
+			current: []Run{{start.Add(2 * time.Minute), start.Add(130 * time.Second)}},
+			total:   130,
+		},
+		{
+			name:     "unordered runs",
+			previous: []Run{{start.Add(time.Minute), start.Add(70 * time.Second)}},
+			current:  []Run{{start, start.Add(10 * time.Second)}},
+			total:    70,
+		},
+		{
+			name:    "previous without runs",
+			current: []Run{{start, start.Add(10 * time.Second)}},
+			total:   10,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			previous := newTiming()
+			for _, run := range c.previous {
+				previous.AddRun(run.Start, run.End)
+			}
+			current := newTiming()
+			for _, run := range c.current {
+				current.AddRun(run.Start, run.End)
+			}
+
+			previous.Merge(current)
+
+			if previous.Total != c.total {
+				t.Errorf("expected total %v, got %v", c.total, previous.Total)
+			}
+			if n := len(c.previous) + len(c.current); len(previous.Runs) != n {
+				t.Errorf("expected %d runs, got %+v", n, previous.Runs)
+			}
+			for i := 1; i < len(previous.Runs); i++ {
+				if previous.Runs[i].Start.Before(previous.Runs[i-1].Start) {
+					t.Errorf("runs not sorted: %+v", previous.Runs)
+				}
+			}
+		})
+	}
+}
+
+func TestTimingMergeDurations(t *testing.T) {
+	previous := newTiming()
+	previous.Prepare = 1
+	previous.Add("", resourcesCategory, time.Second)
+	previous.Add("my-app", "logs", 2*time.Second)
+
+	current := newTiming()
+	current.Prepare = 2
+	current.Add("", resourcesCategory, 3*time.Second)
+	current.Add("my-app", "logs", time.Second)
+	current.Add("my-db", "logs", time.Second)
+
+	previous.Merge(current)
+
+	if previous.Prepare != 3 {
+		t.Errorf("expected prepare 3, got %v", previous.Prepare)
+	}
+	if previous.Cluster[resourcesCategory] != 4 {
+		t.Errorf("expected cluster resources 4, got %v", previous.Cluster)
+	}
+	if previous.Namespaces["my-app"]["logs"] != 3 || previous.Namespaces["my-db"]["logs"] != 1 {
+		t.Errorf("unexpected namespaces %v", previous.Namespaces)
+	}
+}
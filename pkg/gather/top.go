@@ -0,0 +1,241 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	topNodesName = "top-nodes.txt"
+	topPodsName  = "top-pods.txt"
+)
+
+var (
+	nodeMetricsResource = schema.GroupVersionResource{
+		Group:    "metrics.k8s.io",
+		Version:  "v1beta1",
+		Resource: "nodes",
+	}
+	podMetricsResource = schema.GroupVersionResource{
+		Group:    "metrics.k8s.io",
+		Version:  "v1beta1",
+		Resource: "pods",
+	}
+)
+
+// topUsage is the resource usage of a node or pod at the time of the gather.
+type topUsage struct {
+	Namespace string
+	Name      string
+	CPU       resource.Quantity
+	Memory    resource.Quantity
+}
+
+// queueTop queues gathering of nodes and pods resource usage. Nodes usage is
+// gathered only when gathering all namespaces.
+func (g *Gatherer) queueTop(namespaces []string) {
+	for i := range namespaces {
+		namespace := namespaces[i]
+		if namespace == metav1.NamespaceAll {
+			g.wq.Queue(func() error {
+				g.gatherTopNodes()
+				return nil
+			})
+		}
+		g.wq.Queue(func() error {
+			g.gatherTopPods(namespace)
+			return nil
+		})
+	}
+}
+
+// gatherTopNodes writes the node resource usage like "kubectl top nodes" to
+// top-nodes.txt in the cluster directory.
+func (g *Gatherer) gatherTopNodes() {
+	list, err := g.client.Resource(nodeMetricsResource).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		// Expected when the metrics server is not deployed.
+		g.log.Debugf("Cannot list node metrics: %s", err)
+		return
+	}
+
+	usage := make([]topUsage, 0, len(list.Items))
+	for i := range list.Items {
+		usage = append(usage, nodeMetricsUsage(&list.Items[i]))
+	}
+
+	allocatable := g.nodesAllocatable()
+
+	relpath := path.Join(clusterDir, topNodesName)
+	dst, err := g.output.CreateResource(relpath)
+	if err != nil {
+		g.log.Warnf("Cannot create %q: %s", relpath, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if err := writeTopNodes(dst, usage, allocatable); err != nil {
+		g.log.Warnf("Cannot write %q: %s", relpath, err)
+	}
+}
+
+// gatherTopPods writes the pods resource usage like "kubectl top pods" to
+// top-pods.txt in the namespace directory. If namespace is empty, pods metrics
+// in all namespaces are listed once and written to each namespace directory.
+func (g *Gatherer) gatherTopPods(namespace string) {
+	list, err := g.client.Resource(podMetricsResource).
+		Namespace(namespace).
+		List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		// Expected when the metrics server is not deployed.
+		g.log.Debugf("Cannot list pod metrics: %s", err)
+		return
+	}
+
+	byNamespace := map[string][]topUsage{}
+	for i := range list.Items {
+		item := &list.Items[i]
+		byNamespace[item.GetNamespace()] = append(byNamespace[item.GetNamespace()],
+			podMetricsUsage(item))
+	}
+
+	for ns, usage := range byNamespace {
+		relpath := path.Join(namespacesDir, ns, topPodsName)
+		dst, err := g.output.CreateResource(relpath)
+		if err != nil {
+			g.log.Warnf("Cannot create %q: %s", relpath, err)
+			continue
+		}
+
+		if err := writeTopPods(dst, usage); err != nil {
+			g.log.Warnf("Cannot write %q: %s", relpath, err)
+		}
+
+		dst.Close()
+	}
+}
+
+// nodesAllocatable returns the allocatable resources of all nodes, used to
+// compute usage percentage. Returns an empty map if nodes cannot be listed.
+func (g *Gatherer) nodesAllocatable() map[string]corev1.ResourceList {
+	allocatable := map[string]corev1.ResourceList{}
+
+	gvr := corev1.SchemeGroupVersion.WithResource("nodes")
+	list, err := g.client.Resource(gvr).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		g.log.Warnf("Cannot list nodes: %s", err)
+		return allocatable
+	}
+
+	for i := range list.Items {
+		var node corev1.Node
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(list.Items[i].Object, &node)
+		if err != nil {
+			continue
+		}
+		allocatable[node.Name] = node.Status.Allocatable
+	}
+
+	return allocatable
+}
+
+func writeTopNodes(w io.Writer, usage []topUsage, allocatable map[string]corev1.ResourceList) error {
+	sortUsage(usage)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCPU(cores)\tCPU%\tMEMORY(bytes)\tMEMORY%")
+
+	for _, u := range usage {
+		cpuPercent, memoryPercent := "<unknown>", "<unknown>"
+		if resources, ok := allocatable[u.Name]; ok {
+			if cpu := resources.Cpu(); cpu.MilliValue() > 0 {
+				cpuPercent = fmt.Sprintf("%d%%", u.CPU.MilliValue()*100/cpu.MilliValue())
+			}
+			if memory := resources.Memory(); memory.Value() > 0 {
+				memoryPercent = fmt.Sprintf("%d%%", u.Memory.Value()*100/memory.Value())
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", u.Name, formatCPU(u.CPU), cpuPercent,
+			formatMemory(u.Memory), memoryPercent)
+	}
+
+	return tw.Flush()
+}
+
+func writeTopPods(w io.Writer, usage []topUsage) error {
+	sortUsage(usage)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCPU(cores)\tMEMORY(bytes)")
+
+	for _, u := range usage {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", u.Name, formatCPU(u.CPU), formatMemory(u.Memory))
+	}
+
+	return tw.Flush()
+}
+
+// nodeMetricsUsage returns the usage of a node metrics item.
+func nodeMetricsUsage(item *unstructured.Unstructured) topUsage {
+	usage := topUsage{Name: item.GetName()}
+	addUsage(&usage, item.Object, "usage")
+	return usage
+}
+
+// podMetricsUsage returns the total usage of all containers in a pod metrics
+// item.
+func podMetricsUsage(item *unstructured.Unstructured) topUsage {
+	usage := topUsage{Namespace: item.GetNamespace(), Name: item.GetName()}
+
+	containers, _, _ := unstructured.NestedSlice(item.Object, "containers")
+	for _, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		addUsage(&usage, container, "usage")
+	}
+
+	return usage
+}
+
+func addUsage(usage *topUsage, obj map[string]interface{}, fields ...string) {
+	values, _, _ := unstructured.NestedStringMap(obj, fields...)
+
+	if q, err := resource.ParseQuantity(values["cpu"]); err == nil {
+		usage.CPU.Add(q)
+	}
+	if q, err := resource.ParseQuantity(values["memory"]); err == nil {
+		usage.Memory.Add(q)
+	}
+}
+
+func sortUsage(usage []topUsage) {
+	slices.SortFunc(usage, func(a, b topUsage) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+}
+
+func formatCPU(q resource.Quantity) string {
+	return fmt.Sprintf("%dm", q.MilliValue())
+}
+
+func formatMemory(q resource.Quantity) string {
+	return fmt.Sprintf("%dMi", q.Value()/(1024*1024))
+}
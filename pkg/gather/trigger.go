@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// EventTrigger matches events using field selectors like "reason=Failed".
+// The selector is used for watching events, and matching is done again on
+// the client, so the trigger does not depend on the server filtering.
+type EventTrigger struct {
+	selector fields.Selector
+}
+
+// NewEventTrigger returns a trigger matching events matching all selectors.
+func NewEventTrigger(selectors []string) (*EventTrigger, error) {
+	selector, err := fields.ParseSelector(strings.Join(selectors, ","))
+	if err != nil {
+		return nil, fmt.Errorf("invalid event selector: %s", err)
+	}
+	return &EventTrigger{selector: selector}, nil
+}
+
+// Selector returns the field selector for watching events.
+func (t *EventTrigger) Selector() string {
+	return t.selector.String()
+}
+
+// Match returns true if a watch event reports an event matching the trigger.
+func (t *EventTrigger) Match(eventType watch.EventType, e *corev1.Event) bool {
+	if eventType != watch.Added && eventType != watch.Modified {
+		return false
+	}
+	return t.selector.Matches(eventFields(e))
+}
+
+// eventFields returns the event fields supported by the API server field
+// selectors.
+func eventFields(e *corev1.Event) fields.Set {
+	return fields.Set{
+		"metadata.name":                  e.Name,
+		"metadata.namespace":             e.Namespace,
+		"involvedObject.kind":            e.InvolvedObject.Kind,
+		"involvedObject.namespace":       e.InvolvedObject.Namespace,
+		"involvedObject.name":            e.InvolvedObject.Name,
+		"involvedObject.uid":             string(e.InvolvedObject.UID),
+		"involvedObject.apiVersion":      e.InvolvedObject.APIVersion,
+		"involvedObject.resourceVersion": e.InvolvedObject.ResourceVersion,
+		"involvedObject.fieldPath":       e.InvolvedObject.FieldPath,
+		"reason":                         e.Reason,
+		"reportingComponent":             e.ReportingController,
+		"source":                         e.Source.Component,
+		"type":                           e.Type,
+	}
+}
+
+// PodPhaseTrigger matches pods transitioning to one of the trigger phases. A
+// pod matches when its phase changes to a trigger phase, not on every update
+// while in this phase.
+type PodPhaseTrigger struct {
+	phases []string
+
+	// Last seen phase of every pod.
+	seen map[types.UID]corev1.PodPhase
+}
+
+// NewPodPhaseTrigger returns a trigger matching transitions to phases. Pods
+// are the existing pods; a pod already in a trigger phase matches only after
+// leaving the phase and entering it again.
+func NewPodPhaseTrigger(phases []string, pods []corev1.Pod) *PodPhaseTrigger {
+	t := &PodPhaseTrigger{phases: phases, seen: map[types.UID]corev1.PodPhase{}}
+	for i := range pods {
+		t.seen[pods[i].UID] = pods[i].Status.Phase
+	}
+	return t
+}
+
+// Match returns true if a watch event reports a pod transitioning to one of
+// the trigger phases. Deleted pods are forgotten.
+func (t *PodPhaseTrigger) Match(eventType watch.EventType, pod *corev1.Pod) bool {
+	switch eventType {
+	case watch.Deleted:
+		delete(t.seen, pod.UID)
+		return false
+	case watch.Added, watch.Modified:
+		previous, seen := t.seen[pod.UID]
+		t.seen[pod.UID] = pod.Status.Phase
+		if seen && previous == pod.Status.Phase {
+			return false
+		}
+		for _, phase := range t.phases {
+			if strings.EqualFold(string(pod.Status.Phase), phase) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestEventTrigger(t *testing.T) {
+	event := &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: "my-app", Name: "web-1.17a"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "my-app", Name: "web-1"},
+		Reason:         "FailedMount",
+		Type:           corev1.EventTypeWarning,
+	}
+
+	cases := []struct {
+		name      string
+		selectors []string
+		eventType watch.EventType
+		match     bool
+	}{
+		{"reason", []string{"reason=FailedMount"}, watch.Added, true},
+		{"modified", []string{"reason=FailedMount"}, watch.Modified, true},
+		{"deleted", []string{"reason=FailedMount"}, watch.Deleted, false},
+		{"other reason", []string{"reason=Failed"}, watch.Added, false},
+		{"not equal", []string{"reason!=Failed"}, watch.Added, true},
+		{"all selectors", []string{"reason=FailedMount", "involvedObject.kind=Pod", "type=Warning"}, watch.Added, true},
+		{"one selector differs", []string{"reason=FailedMount", "involvedObject.kind=Node"}, watch.Added, false},
+		{"comma separated", []string{"reason=FailedMount,involvedObject.name=web-1"}, watch.Added, true},
+		{"namespace", []string{"metadata.namespace=other"}, watch.Added, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			trigger, err := NewEventTrigger(c.selectors)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if match := trigger.Match(c.eventType, event); match != c.match {
+				t.Errorf("expected match %v, got %v", c.match, match)
+			}
+		})
+	}
+}
+
+func TestEventTriggerInvalid(t *testing.T) {
+	if _, err := NewEventTrigger([]string{"reason"}); err == nil {
+		t.Error("invalid selector accepted")
+	}
+}
+
+func TestPodPhaseTrigger(t *testing.T) {
+	type update struct {
+		eventType watch.EventType
+		uid       types.UID
+		phase     corev1.PodPhase
+		match     bool
+	}
+
+	cases := []struct {
+		name     string
+		existing []corev1.Pod
+		updates  []update
+	}{
+		{
+			name: "transition",
+			updates: []update{
+				{watch.Added, "a", corev1.PodPending, false},
+				{watch.Modified, "a", corev1.PodRunning, false},
+				{watch.Modified, "a", corev1.PodFailed, true},
+			},
+		},
+		{
+			name: "added in phase",
+			updates: []update{
+				{watch.Added, "a", corev1.PodFailed, true},
+			},
+		},
+		{
+			name: "update in same phase",
+			updates: []update{
+				{watch.Modified, "a", corev1.PodFailed, true},
+				{watch.Modified, "a", corev1.PodFailed, false},
+			},
+		},
+		{
+			name:     "existing in phase",
+			existing: []corev1.Pod{newPhasePod("a", corev1.PodFailed)},
+			updates: []update{
+				{watch.Modified, "a", corev1.PodFailed, false},
+				{watch.Modified, "a", corev1.PodRunning, false},
+				{watch.Modified, "a", corev1.PodFailed, true},
+			},
+		},
+		{
+			name:     "existing pod transition",
+			existing: []corev1.Pod{newPhasePod("a", corev1.PodRunning)},
+			updates: []update{
+				{watch.Modified, "a", corev1.PodFailed, true},
+			},
+		},
+		{
+			name:     "deleted",
+			existing: []corev1.Pod{newPhasePod("a", corev1.PodRunning)},
+			updates: []update{
+				{watch.Deleted, "a", corev1.PodFailed, false},
+			},
+		},
+		{
+			name: "case insensitive",
+			updates: []update{
+				{watch.Added, "a", corev1.PodSucceeded, true},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			trigger := NewPodPhaseTrigger([]string{"failed", "Succeeded"}, c.existing)
+			for i, u := range c.updates {
+				pod := newPhasePod(u.uid, u.phase)
+				if match := trigger.Match(u.eventType, &pod); match != u.match {
+					t.Errorf("update %d: expected match %v, got %v", i, u.match, match)
+				}
+			}
+		})
+	}
+}
+
+func TestPodPhaseTriggerForgetsDeletedPods(t *testing.T) {
+	trigger := NewPodPhaseTrigger([]string{"Failed"}, []corev1.Pod{newPhasePod("a", corev1.PodRunning)})
+
+	pod := newPhasePod("a", corev1.PodRunning)
+	trigger.Match(watch.Deleted, &pod)
+
+	if len(trigger.seen) != 0 {
+		t.Errorf("deleted pod not forgotten: %v", trigger.seen)
+	}
+}
+
+func newPhasePod(uid types.UID, phase corev1.PodPhase) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "my-app", Name: "pod-" + string(uid), UID: uid},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+}
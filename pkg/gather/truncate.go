@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"container/heap"
+	"maps"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TruncatedResource describes a resource with more items in a namespace than
+// the max per resource limit. Only the newest items were gathered.
+type TruncatedResource struct {
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Gathered  int    `json:"gathered"`
+	Total     int    `json:"total"`
+}
+
+// newestItems keeps the newest items of a resource in every namespace, by
+// creation timestamp. Items with the same creation timestamp are ordered by
+// name to keep the selection stable.
+//
+// Kept items are not accounted by the byte limiter, but the number of kept
+// items is bounded by the limit.
+type newestItems struct {
+	limit      int
+	namespaces map[string]*itemsHeap
+	totals     map[string]int
+}
+
+func newNewestItems(limit int) *newestItems {
+	return &newestItems{
+		limit:      limit,
+		namespaces: map[string]*itemsHeap{},
+		totals:     map[string]int{},
+	}
+}
+
+// Add adds an item, dropping the oldest item in the item namespace if the
+// limit was reached.
+func (n *newestItems) Add(item *unstructured.Unstructured) {
+	namespace := item.GetNamespace()
+	n.totals[namespace]++
+
+	h, ok := n.namespaces[namespace]
+	if !ok {
+		h = &itemsHeap{}
+		n.namespaces[namespace] = h
+	}
+
+	if h.Len() < n.limit {
+		heap.Push(h, item)
+		return
+	}
+
+	if compareItemsAge(item, (*h)[0]) > 0 {
+		(*h)[0] = item
+		heap.Fix(h, 0)
+	}
+}
+
+// Items returns the kept items sorted by namespace, newest first.
+func (n *newestItems) Items() []*unstructured.Unstructured {
+	var items []*unstructured.Unstructured
+	for _, namespace := range slices.Sorted(maps.Keys(n.namespaces)) {
+		kept := slices.Clone(*n.namespaces[namespace])
+		slices.SortFunc(kept, func(a, b *unstructured.Unstructured) int {
+			return compareItemsAge(b, a)
+		})
+		items = append(items, kept...)
+	}
+	return items
+}
+
+// Truncated returns the namespaces with more items than the limit, sorted by
+// namespace.
+func (n *newestItems) Truncated(resource string) []TruncatedResource {
+	var truncated []TruncatedResource
+	for _, namespace := range slices.Sorted(maps.Keys(n.totals)) {
+		if total := n.totals[namespace]; total > n.limit {
+			truncated = append(truncated, TruncatedResource{
+				Resource:  resource,
+				Namespace: namespace,
+				Gathered:  n.limit,
+				Total:     total,
+			})
+		}
+	}
+	return truncated
+}
+
+// compareItemsAge returns a negative number if a is older than b, and a
+// positive number if a is newer than b.
+func compareItemsAge(a, b *unstructured.Unstructured) int {
+	ta := a.GetCreationTimestamp()
+	tb := b.GetCreationTimestamp()
+	if !ta.Equal(&tb) {
+		if ta.Before(&tb) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a.GetName(), b.GetName())
+}
+
+// itemsHeap is a min heap of items, keeping the oldest item on top.
+type itemsHeap []*unstructured.Unstructured
+
+func (h itemsHeap) Len() int           { return len(h) }
+func (h itemsHeap) Less(i, j int) bool { return compareItemsAge(h[i], h[j]) < 0 }
+func (h itemsHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *itemsHeap) Push(x any) {
+	*h = append(*h, x.(*unstructured.Unstructured))
+}
+
+func (h *itemsHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+func (g *Gatherer) addTruncatedResources(truncated []TruncatedResource) {
+	if len(truncated) == 0 {
+		return
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for _, t := range truncated {
+		g.log.Debugf("Gathered %d of %d %q in namespace %q", t.Gathered, t.Total, t.Resource, t.Namespace)
+		// When appending, the resource may be truncated by a previous gather.
+		i, found := slices.BinarySearchFunc(g.truncatedResources, t, compareTruncatedResources)
+		if found {
+			g.truncatedResources[i] = t
+			continue
+		}
+		g.truncatedResources = slices.Insert(g.truncatedResources, i, t)
+	}
+}
+
+func compareTruncatedResources(a, b TruncatedResource) int {
+	if c := strings.Compare(a.Resource, b.Resource); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Namespace, b.Namespace)
+}
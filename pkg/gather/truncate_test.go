@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestGatherResourcesMaxPerResource(t *testing.T) {
+	items := newItems(250)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, item := range items {
+		// Items are listed by name, oldest first, except the last one.
+		item.SetCreationTimestamp(metav1.NewTime(base.Add(time.Duration(i) * time.Minute)))
+	}
+	items[249].SetCreationTimestamp(metav1.NewTime(base.Add(-time.Hour)))
+
+	lister := &fakeLister{items: items}
+	g, dumper := newTestGatherer(t, Options{MaxPerResource: 3}, lister)
+
+	g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+
+	expected := []string{
+		"persistentvolumes/pv-248",
+		"persistentvolumes/pv-247",
+		"persistentvolumes/pv-246",
+	}
+	if !slices.Equal(dumper.items, expected) {
+		t.Errorf("expected items %v, got %v", expected, dumper.items)
+	}
+
+	truncated := []TruncatedResource{{Resource: "persistentvolumes", Gathered: 3, Total: 250}}
+	if !slices.Equal(g.truncatedResources, truncated) {
+		t.Errorf("expected truncated %+v, got %+v", truncated, g.truncatedResources)
+	}
+}
+
+func TestGatherResourcesMaxPerResourceNamespaces(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var items []*unstructured.Unstructured
+	for _, namespace := range []string{"ns1", "ns2"} {
+		for i := 0; i < 5; i++ {
+			item := &unstructured.Unstructured{}
+			item.SetAPIVersion("v1")
+			item.SetKind("ConfigMap")
+			item.SetNamespace(namespace)
+			item.SetName(fmt.Sprintf("cm-%d", i))
+			item.SetCreationTimestamp(metav1.NewTime(base.Add(time.Duration(i) * time.Minute)))
+			items = append(items, item)
+		}
+	}
+
+	configMaps := resourceInfo{
+		GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		Namespaced:           true,
+	}
+
+	// All items fit in one page of the list in all namespaces.
+	lister := &fakeLister{items: items}
+	g, dumper := newTestGatherer(t, Options{MaxPerResource: 2}, lister)
+
+	g.gatherResources(&configMaps, metav1.NamespaceAll)
+
+	expected := []string{
+		"configmaps/cm-4",
+		"configmaps/cm-3",
+		"configmaps/cm-4",
+		"configmaps/cm-3",
+	}
+	if !slices.Equal(dumper.items, expected) {
+		t.Errorf("expected items %v, got %v", expected, dumper.items)
+	}
+
+	truncated := []TruncatedResource{
+		{Resource: "configmaps", Namespace: "ns1", Gathered: 2, Total: 5},
+		{Resource: "configmaps", Namespace: "ns2", Gathered: 2, Total: 5},
+	}
+	if !slices.Equal(g.truncatedResources, truncated) {
+		t.Errorf("expected truncated %+v, got %+v", truncated, g.truncatedResources)
+	}
+}
+
+func TestGatherResourcesMaxPerResourceExpired(t *testing.T) {
+	items := newItems(150)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, item := range items {
+		// The newest items are in the first page.
+		item.SetCreationTimestamp(metav1.NewTime(base.Add(-time.Duration(i) * time.Minute)))
+	}
+
+	// Getting the second page fails, falling back to a full list.
+	lister := &fakeLister{items: items, expireContinue: true}
+	g, dumper := newTestGatherer(t, Options{MaxPerResource: 3}, lister)
+
+	g.gatherResources(&persistentVolumes, metav1.NamespaceAll)
+
+	expected := []string{
+		"persistentvolumes/pv-000",
+		"persistentvolumes/pv-001",
+		"persistentvolumes/pv-002",
+	}
+	if !slices.Equal(dumper.items, expected) {
+		t.Errorf("expected items %v, got %v", expected, dumper.items)
+	}
+
+	truncated := []TruncatedResource{{Resource: "persistentvolumes", Gathered: 3, Total: 150}}
+	if !slices.Equal(g.truncatedResources, truncated) {
+		t.Errorf("expected truncated %+v, got %+v", truncated, g.truncatedResources)
+	}
+}
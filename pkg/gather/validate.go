@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Validate returns an error describing all invalid options.
+func (o *Options) Validate() error {
+	var errs []error
+
+	available := AvailableAddons()
+	slices.Sort(available)
+	for _, name := range o.Addons {
+		if !slices.Contains(available, name) {
+			errs = append(errs, fmt.Errorf("unknown addon %q (available addons: %s)",
+				name, strings.Join(available, ", ")))
+		}
+	}
+
+	if !o.AgentsAllowed() {
+		for _, name := range o.Addons {
+			if slices.Contains(AgentAddons(), name) {
+				errs = append(errs, fmt.Errorf("addon %q creates agent pods or runs commands in pods, not allowed in read only mode (use --allow-agents)", name))
+			}
+		}
+	}
+
+	for i := range o.Files {
+		if err := o.Files[i].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("invalid files rule: %w", err))
+		}
+	}
+
+	if len(o.Files) > 0 && !o.AgentsAllowed() {
+		errs = append(errs, errors.New("files rules copy files from pods, not allowed in read only mode (use --allow-agents)"))
+	}
+
+	if len(o.Files) > 0 && !addonEnabled(filesName, o) {
+		errs = append(errs, fmt.Errorf("files rules require the %q addon", filesName))
+	}
+
+	for _, name := range o.ClusterResources {
+		if strings.TrimPrefix(name, "-") == "" {
+			errs = append(errs, fmt.Errorf("invalid cluster resource %q", name))
+		}
+	}
+
+	for _, namespace := range o.Namespaces {
+		if msgs := validation.IsDNS1123Label(namespace); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("invalid namespace %q: %s",
+				namespace, strings.Join(msgs, ", ")))
+		}
+	}
+
+	if o.MaxPerResource < 0 {
+		errs = append(errs, fmt.Errorf("invalid max per resource %d: must be positive", o.MaxPerResource))
+	}
+
+	if o.MaxObjectSize < 0 {
+		errs = append(errs, fmt.Errorf("invalid max object size %d: must be positive", o.MaxObjectSize))
+	}
+
+	switch o.BinaryFields {
+	case "", BinaryFieldsKeep, BinaryFieldsOmit, BinaryFieldsExternal:
+	default:
+		errs = append(errs, fmt.Errorf("invalid binary fields %q (expected %q, %q, or %q)",
+			o.BinaryFields, BinaryFieldsKeep, BinaryFieldsOmit, BinaryFieldsExternal))
+	}
+
+	if o.BinaryFieldsThreshold < 0 {
+		errs = append(errs, fmt.Errorf("invalid binary fields threshold %d: must be positive", o.BinaryFieldsThreshold))
+	}
+
+	if o.MaxInFlightBytes < 0 {
+		errs = append(errs, fmt.Errorf("invalid max in-flight bytes %d: must be positive", o.MaxInFlightBytes))
+	}
+
+	if o.DiscoveryCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("invalid discovery cache TTL %s: must be positive", o.DiscoveryCacheTTL))
+	}
+
+	if o.CopyBandwidth < 0 {
+		errs = append(errs, fmt.Errorf("invalid copy bandwidth %d: must be positive", o.CopyBandwidth))
+	}
+
+	if o.LogsPerNode < 0 {
+		errs = append(errs, fmt.Errorf("invalid logs per node %d: must be positive", o.LogsPerNode))
+	}
+
+	if o.LogBandwidth < 0 {
+		errs = append(errs, fmt.Errorf("invalid log bandwidth %d: must be positive", o.LogBandwidth))
+	}
+
+	if o.AddonTimeout < 0 {
+		errs = append(errs, fmt.Errorf("invalid addon timeout %s: must be positive", o.AddonTimeout))
+	}
+
+	if o.RookLogsSince < 0 {
+		errs = append(errs, fmt.Errorf("invalid rook logs since %s: must be positive", o.RookLogsSince))
+	}
+
+	if o.Name != "" && len(o.Resources) == 0 {
+		errs = append(errs, fmt.Errorf("resource name %q requires a resource", o.Name))
+	}
+
+	for _, name := range o.Resources {
+		if slices.Contains(o.InventoryOnly, name) {
+			errs = append(errs, fmt.Errorf("resource %q cannot be gathered and inventoried", name))
+		}
+	}
+
+	if !o.Since.IsZero() && !o.Until.IsZero() && o.Until.Before(o.Since) {
+		errs = append(errs, fmt.Errorf("invalid time window: until %s is before since %s",
+			o.Until.Format(time.RFC3339), o.Since.Format(time.RFC3339)))
+	}
+
+	for _, endpoint := range o.RawEndpoints {
+		if !strings.HasPrefix(endpoint, "/") {
+			errs = append(errs, fmt.Errorf("invalid raw endpoint %q: must start with \"/\"", endpoint))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,208 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"path"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+	"sigs.k8s.io/yaml"
+)
+
+const versionInfoName = "version-info.yaml"
+
+// Platforms detected by the gather.
+const (
+	PlatformOpenShift  = "OpenShift"
+	PlatformEKS        = "EKS"
+	PlatformGKE        = "GKE"
+	PlatformAKS        = "AKS"
+	PlatformKind       = "kind"
+	PlatformKubernetes = "Kubernetes"
+)
+
+var clusterVersionsResource = schema.GroupVersionResource{
+	Group:    "config.openshift.io",
+	Version:  "v1",
+	Resource: "clusterversions",
+}
+
+// VersionInfo describes the cluster versions and platform. It is written to
+// cluster/version-info.yaml, answering the first question when reading a
+// gather.
+type VersionInfo struct {
+	// Platform detected from the server version, nodes provider IDs, and
+	// OpenShift APIs (e.g. "OpenShift", "EKS", "kind").
+	Platform string `json:"platform"`
+
+	// OpenShift version, if the platform is OpenShift.
+	OpenShiftVersion string `json:"openshiftVersion,omitempty"`
+
+	// Server is the API server /version response.
+	Server *version.Info `json:"server,omitempty"`
+
+	// Nodes versions sorted by node name. Empty if nodes cannot be listed.
+	Nodes []NodeVersionInfo `json:"nodes,omitempty"`
+}
+
+// NodeVersionInfo describes the versions of a node.
+type NodeVersionInfo struct {
+	Name                    string `json:"name"`
+	ProviderID              string `json:"providerID,omitempty"`
+	OSImage                 string `json:"osImage"`
+	KernelVersion           string `json:"kernelVersion"`
+	KubeletVersion          string `json:"kubeletVersion"`
+	ContainerRuntimeVersion string `json:"containerRuntimeVersion"`
+	Architecture            string `json:"architecture"`
+}
+
+// gatherVersionInfo writes the cluster version and platform information to
+// cluster/version-info.yaml.
+func (g *Gatherer) gatherVersionInfo() {
+	info := &VersionInfo{}
+
+	server, err := g.discovery.ServerVersion()
+	if err != nil {
+		g.log.Warnf("Cannot get server version: %s", err)
+	} else {
+		info.Server = server
+	}
+
+	nodes, err := g.nodesVersionInfo()
+	if err != nil {
+		// Expected when gathering namespaces without cluster permissions.
+		g.log.Debugf("Cannot list nodes: %s", err)
+	} else {
+		info.Nodes = nodes
+	}
+
+	info.OpenShiftVersion = g.openShiftVersion()
+	info.Platform = detectPlatform(info)
+
+	data, err := yaml.Marshal(info)
+	if err != nil {
+		g.log.Warnf("Cannot encode %q: %s", versionInfoName, err)
+		return
+	}
+
+	relpath := path.Join(clusterDir, versionInfoName)
+	dst, err := g.output.CreateResource(relpath)
+	if err != nil {
+		g.log.Warnf("Cannot create %q: %s", relpath, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if _, err := dst.Write(data); err != nil {
+		g.log.Warnf("Cannot write %q: %s", relpath, err)
+	}
+}
+
+func (g *Gatherer) nodesVersionInfo() ([]NodeVersionInfo, error) {
+	gvr := corev1.SchemeGroupVersion.WithResource("nodes")
+	list, err := g.client.Resource(gvr).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]NodeVersionInfo, 0, len(list.Items))
+	for i := range list.Items {
+		var node corev1.Node
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(list.Items[i].Object, &node); err != nil {
+			g.log.Warnf("Cannot convert node %q: %s", list.Items[i].GetName(), err)
+			continue
+		}
+		nodes = append(nodes, NodeVersionInfo{
+			Name:                    node.Name,
+			ProviderID:              node.Spec.ProviderID,
+			OSImage:                 node.Status.NodeInfo.OSImage,
+			KernelVersion:           node.Status.NodeInfo.KernelVersion,
+			KubeletVersion:          node.Status.NodeInfo.KubeletVersion,
+			ContainerRuntimeVersion: node.Status.NodeInfo.ContainerRuntimeVersion,
+			Architecture:            node.Status.NodeInfo.Architecture,
+		})
+	}
+
+	slices.SortFunc(nodes, func(a, b NodeVersionInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return nodes, nil
+}
+
+// openShiftVersion returns the OpenShift cluster version, or an empty string
+// if this is not an OpenShift cluster.
+func (g *Gatherer) openShiftVersion() string {
+	cv, err := g.client.Resource(clusterVersionsResource).Get(context.TODO(), "version", metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			g.log.Debugf("Cannot get openshift cluster version: %s", err)
+		}
+		return ""
+	}
+
+	// The current version is the first completed version in the history.
+	history, _, _ := unstructured.NestedSlice(cv.Object, "status", "history")
+	for _, item := range history {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		if entry["state"] == "Completed" {
+			if v, ok := entry["version"].(string); ok {
+				return v
+			}
+		}
+	}
+
+	v, _, _ := unstructured.NestedString(cv.Object, "status", "desired", "version")
+	return v
+}
+
+// detectPlatform returns the platform using the OpenShift version, the server
+// git version (e.g. "v1.29.4-eks-036c24b"), or the nodes provider IDs (e.g.
+// "kind://docker/kind/kind-control-plane").
+func detectPlatform(info *VersionInfo) string {
+	if info.OpenShiftVersion != "" {
+		return PlatformOpenShift
+	}
+
+	if info.Server != nil {
+		switch {
+		case strings.Contains(info.Server.GitVersion, "-eks-"):
+			return PlatformEKS
+		case strings.Contains(info.Server.GitVersion, "-gke."):
+			return PlatformGKE
+		}
+	}
+
+	for _, node := range info.Nodes {
+		scheme, _, found := strings.Cut(node.ProviderID, "://")
+		if !found {
+			continue
+		}
+		switch scheme {
+		case "aws":
+			return PlatformEKS
+		case "gce":
+			return PlatformGKE
+		case "azure":
+			return PlatformAKS
+		case "kind":
+			return PlatformKind
+		}
+	}
+
+	return PlatformKubernetes
+}
@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/version"
+)
+
+func TestDetectPlatform(t *testing.T) {
+	cases := []struct {
+		name     string
+		info     VersionInfo
+		platform string
+	}{
+		{
+			name:     "openshift",
+			info:     VersionInfo{OpenShiftVersion: "4.16.3"},
+			platform: PlatformOpenShift,
+		},
+		{
+			name:     "eks server version",
+			info:     VersionInfo{Server: &version.Info{GitVersion: "v1.29.4-eks-036c24b"}},
+			platform: PlatformEKS,
+		},
+		{
+			name:     "gke server version",
+			info:     VersionInfo{Server: &version.Info{GitVersion: "v1.30.2-gke.1587003"}},
+			platform: PlatformGKE,
+		},
+		{
+			name: "kind provider id",
+			info: VersionInfo{
+				Server: &version.Info{GitVersion: "v1.30.0"},
+				Nodes:  []NodeVersionInfo{{Name: "kind-control-plane", ProviderID: "kind://docker/kind/kind-control-plane"}},
+			},
+			platform: PlatformKind,
+		},
+		{
+			name:     "aks provider id",
+			info:     VersionInfo{Nodes: []NodeVersionInfo{{Name: "node1", ProviderID: "azure:///subscriptions/123/vm/0"}}},
+			platform: PlatformAKS,
+		},
+		{
+			name:     "unknown",
+			info:     VersionInfo{Server: &version.Info{GitVersion: "v1.30.0"}, Nodes: []NodeVersionInfo{{Name: "node1"}}},
+			platform: PlatformKubernetes,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if platform := detectPlatform(&c.info); platform != c.platform {
+				t.Errorf("expected platform %q, got %q", c.platform, platform)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bufio"
+	"slices"
+	"sync"
+)
+
+const (
+	deprecationsName = "deprecations.txt"
+)
+
+// warningRecorder records unique API warnings (e.g. "v1 ComponentStatus is
+// deprecated in v1.19+"). The warnings are useful for upgrade planning.
+type warningRecorder struct {
+	mutex    sync.Mutex
+	warnings map[string]struct{}
+}
+
+func newWarningRecorder() *warningRecorder {
+	return &warningRecorder{warnings: map[string]struct{}{}}
+}
+
+// HandleWarningHeader implements rest.WarningHandler.
+func (w *warningRecorder) HandleWarningHeader(code int, agent string, text string) {
+	// Only code 299 is used for warnings.
+	if code != 299 || text == "" {
+		return
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.warnings[text] = struct{}{}
+}
+
+// Warnings returns the recorded warnings sorted.
+func (w *warningRecorder) Warnings() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	warnings := make([]string, 0, len(w.warnings))
+	for text := range w.warnings {
+		warnings = append(warnings, text)
+	}
+	slices.Sort(warnings)
+
+	return warnings
+}
+
+func (g *Gatherer) writeWarnings() {
+	if g.warnings == nil {
+		return
+	}
+
+	warnings := g.warnings.Warnings()
+	if len(warnings) == 0 {
+		return
+	}
+
+	dst, err := g.output.CreateFile(deprecationsName)
+	if err != nil {
+		g.log.Warnf("Cannot create %q: %s", deprecationsName, err)
+		return
+	}
+
+	defer dst.Close()
+
+	writer := bufio.NewWriter(dst)
+	for _, text := range warnings {
+		writer.WriteString(text + "\n")
+	}
+
+	if err := writer.Flush(); err != nil {
+		g.log.Warnf("Cannot write %q: %s", deprecationsName, err)
+	}
+}
@@ -0,0 +1,242 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const webhooksReportName = "webhooks-report.txt"
+
+var (
+	validatingWebhooksResource = admissionregistrationv1.SchemeGroupVersion.WithResource("validatingwebhookconfigurations")
+	mutatingWebhooksResource   = admissionregistrationv1.SchemeGroupVersion.WithResource("mutatingwebhookconfigurations")
+	servicesResource           = corev1.SchemeGroupVersion.WithResource("services")
+	namespacesResource         = corev1.SchemeGroupVersion.WithResource("namespaces")
+	endpointSlicesResource     = discoveryv1.SchemeGroupVersion.WithResource("endpointslices")
+)
+
+// webhookStatus describes an admission webhook and the health of the service
+// handling it.
+type webhookStatus struct {
+	Configuration string
+	Name          string
+	Type          string
+	FailurePolicy string
+	Service       string
+
+	// Number of ready endpoints, or -1 if unknown.
+	ReadyEndpoints int
+
+	// Problem with the webhook service. Webhooks failing closed with a broken
+	// service reject all matching requests, a classic cause of cluster wide
+	// breakage.
+	Problem string
+}
+
+// gatherWebhooksReport writes the admission webhooks and the health of their
+// services to the cluster directory, flagging webhooks with failurePolicy Fail
+// and an unhealthy service.
+func (g *Gatherer) gatherWebhooksReport() {
+	var webhooks []webhookStatus
+
+	for _, gvr := range []schema.GroupVersionResource{validatingWebhooksResource, mutatingWebhooksResource} {
+		list, err := g.client.Resource(gvr).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			g.log.Warnf("Cannot list %q: %s", gvr.GroupResource().String(), err)
+			continue
+		}
+
+		for i := range list.Items {
+			item := list.Items[i].Object
+			if gvr == validatingWebhooksResource {
+				var config admissionregistrationv1.ValidatingWebhookConfiguration
+				if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item, &config); err != nil {
+					continue
+				}
+				for j := range config.Webhooks {
+					w := &config.Webhooks[j]
+					webhooks = append(webhooks, g.webhookStatus(config.Name, w.Name, "validating", w.FailurePolicy, &w.ClientConfig))
+				}
+			} else {
+				var config admissionregistrationv1.MutatingWebhookConfiguration
+				if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item, &config); err != nil {
+					continue
+				}
+				for j := range config.Webhooks {
+					w := &config.Webhooks[j]
+					webhooks = append(webhooks, g.webhookStatus(config.Name, w.Name, "mutating", w.FailurePolicy, &w.ClientConfig))
+				}
+			}
+		}
+	}
+
+	if len(webhooks) == 0 {
+		return
+	}
+
+	dst, err := g.output.CreateClusterFile(webhooksReportName)
+	if err != nil {
+		g.log.Warnf("Cannot create %q: %s", webhooksReportName, err)
+		return
+	}
+
+	defer dst.Close()
+
+	if err := writeWebhooksReport(dst, webhooks); err != nil {
+		g.log.Warnf("Cannot write %q: %s", webhooksReportName, err)
+	}
+}
+
+func (g *Gatherer) webhookStatus(configuration string, name string, webhookType string,
+	policy *admissionregistrationv1.FailurePolicyType, clientConfig *admissionregistrationv1.WebhookClientConfig) webhookStatus {
+	status := webhookStatus{
+		Configuration:  configuration,
+		Name:           name,
+		Type:           webhookType,
+		FailurePolicy:  string(admissionregistrationv1.Fail),
+		ReadyEndpoints: -1,
+	}
+	if policy != nil {
+		status.FailurePolicy = string(*policy)
+	}
+
+	ref := clientConfig.Service
+	if ref == nil {
+		if clientConfig.URL != nil {
+			status.Service = *clientConfig.URL
+		}
+		return status
+	}
+
+	status.Service = ref.Namespace + "/" + ref.Name
+
+	problem, ready := g.serviceHealth(ref.Namespace, ref.Name)
+	status.ReadyEndpoints = ready
+
+	// Webhooks ignoring failures cannot break the cluster.
+	if status.FailurePolicy == string(admissionregistrationv1.Fail) {
+		status.Problem = problem
+	}
+
+	return status
+}
+
+// serviceHealth returns a problem with the service, and the number of ready
+// endpoints, or -1 if unknown.
+func (g *Gatherer) serviceHealth(namespace string, name string) (string, int) {
+	ctx := context.TODO()
+
+	ns, err := g.client.Resource(namespacesResource).Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Sprintf("namespace %q not found", namespace), -1
+		}
+		return fmt.Sprintf("cannot get namespace %q: %s", namespace, err), -1
+	}
+	if ns.GetDeletionTimestamp() != nil {
+		return fmt.Sprintf("namespace %q is terminating", namespace), -1
+	}
+
+	service, err := g.client.Resource(servicesResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return "service not found", -1
+		}
+		return fmt.Sprintf("cannot get service: %s", err), -1
+	}
+
+	var svc corev1.Service
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(service.Object, &svc); err != nil {
+		return fmt.Sprintf("invalid service: %s", err), -1
+	}
+	if svc.Spec.Type == corev1.ServiceTypeExternalName {
+		return "", -1
+	}
+
+	endpointSlices, err := g.client.Resource(endpointSlicesResource).Namespace(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + name,
+	})
+	if err != nil {
+		return fmt.Sprintf("cannot list endpoints: %s", err), -1
+	}
+
+	ready := 0
+	for i := range endpointSlices.Items {
+		var slice discoveryv1.EndpointSlice
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(endpointSlices.Items[i].Object, &slice); err != nil {
+			continue
+		}
+		ready += readyEndpoints(&slice)
+	}
+
+	if ready == 0 {
+		return "no ready endpoints", 0
+	}
+
+	return "", ready
+}
+
+// readyEndpoints returns the number of ready endpoints in slice.
+func readyEndpoints(slice *discoveryv1.EndpointSlice) int {
+	ready := 0
+	for _, endpoint := range slice.Endpoints {
+		// A nil ready condition means ready.
+		if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+			ready++
+		}
+	}
+	return ready
+}
+
+// writeWebhooksReport writes the webhooks sorted by configuration and name,
+// with the flagged webhooks first.
+//
+//	CONFIGURATION   WEBHOOK             TYPE         FAILURE POLICY   SERVICE           READY   PROBLEM
+//	myapp-webhook   validate.myapp.io   validating   Fail             myapp/myapp-svc   0       no ready endpoints
+func writeWebhooksReport(w io.Writer, webhooks []webhookStatus) error {
+	slices.SortFunc(webhooks, func(a, b webhookStatus) int {
+		if (a.Problem == "") != (b.Problem == "") {
+			if a.Problem != "" {
+				return -1
+			}
+			return 1
+		}
+		if c := strings.Compare(a.Configuration, b.Configuration); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(tw, "CONFIGURATION\tWEBHOOK\tTYPE\tFAILURE POLICY\tSERVICE\tREADY\tPROBLEM")
+
+	for _, s := range webhooks {
+		ready := "<unknown>"
+		if s.ReadyEndpoints >= 0 {
+			ready = fmt.Sprintf("%d", s.ReadyEndpoints)
+		}
+		problem := s.Problem
+		if problem == "" {
+			problem = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Configuration, s.Name, s.Type,
+			s.FailurePolicy, s.Service, ready, problem)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteWebhooksReport(t *testing.T) {
+	webhooks := []webhookStatus{
+		{
+			Configuration:  "b-config",
+			Name:           "ok.example.com",
+			Type:           "validating",
+			FailurePolicy:  "Fail",
+			Service:        "b/webhook",
+			ReadyEndpoints: 2,
+		},
+		{
+			Configuration:  "c-config",
+			Name:           "broken.example.com",
+			Type:           "mutating",
+			FailurePolicy:  "Fail",
+			Service:        "c/webhook",
+			ReadyEndpoints: 0,
+			Problem:        "no ready endpoints",
+		},
+		{
+			Configuration:  "a-config",
+			Name:           "ignored.example.com",
+			Type:           "validating",
+			FailurePolicy:  "Ignore",
+			Service:        "a/webhook",
+			ReadyEndpoints: -1,
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeWebhooksReport(&buf, webhooks); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got:\n%s", buf.String())
+	}
+
+	// Flagged webhooks first, then sorted by configuration.
+	expected := []string{"broken.example.com", "ignored.example.com", "ok.example.com"}
+	for i, name := range expected {
+		if !strings.Contains(lines[i+1], name) {
+			t.Errorf("expected %q in line %q", name, lines[i+1])
+		}
+	}
+
+	if !strings.HasSuffix(lines[1], "no ready endpoints") {
+		t.Errorf("expected problem in line %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "<unknown>") {
+		t.Errorf("expected unknown endpoints in line %q", lines[2])
+	}
+}
@@ -3,63 +3,249 @@
 
 package gather
 
-import "sync"
+import (
+	"slices"
+	"sync"
+)
 
 type WorkFunc func() error
 
+// Priority of queued work. Queued work with higher priority runs first, so
+// resources are gathered before bulk log copying starts, and interrupted
+// gathers are more useful.
+type Priority int
+
+const (
+	PriorityResources Priority = iota
+	PriorityLogs
+	PriorityAddons
+
+	numPriorities
+)
+
 type Queuer interface {
 	Queue(WorkFunc)
 }
 
+// Limiter limits the number of running work functions queued with the
+// limiter. Work waiting for a free slot stays in the queue, so it does not
+// block workers from running other work.
+type Limiter struct {
+	limit   int
+	running int
+}
+
+func NewLimiter(limit int) *Limiter {
+	return &Limiter{limit: limit}
+}
+
+func (l *Limiter) full() bool {
+	return l != nil && l.running >= l.limit
+}
+
+// queuedWork is work waiting for a worker. If limiter is set, the work starts
+// only when the limiter has a free slot.
+type queuedWork struct {
+	work    WorkFunc
+	limiter *Limiter
+}
+
+// WorkQueue runs queued work using a fixed number of workers. Queuing work
+// never blocks, so work functions can queue more work without risking a
+// deadlock when all workers are queuing.
 type WorkQueue struct {
-	queue   chan WorkFunc
+	queues  [numPriorities][]queuedWork
 	workers int
 	wg      sync.WaitGroup
 	mutex   sync.Mutex
+	cond    *sync.Cond
+	closed  bool
+	stopped bool
 	err     error
+	stats   QueueStats
+}
+
+// QueueStats describes the work queue activity.
+type QueueStats struct {
+	// Number of workers running queued work.
+	Workers int `json:"workers"`
+
+	// Work queued since the queue was created.
+	Queued int `json:"queued"`
+
+	// Work completed.
+	Completed int `json:"completed"`
+
+	// Work dropped when the queue was stopped.
+	Dropped int `json:"dropped"`
+
+	// Work waiting for a worker.
+	Pending int `json:"pending"`
+
+	// Work running now.
+	Running int `json:"running"`
+
+	// Maximum number of work waiting for a worker.
+	MaxPending int `json:"maxPending"`
 }
 
 func NewWorkQueue(workers int, size int) *WorkQueue {
-	return &WorkQueue{
-		queue:   make(chan WorkFunc, size),
-		workers: workers,
+	q := &WorkQueue{workers: workers, stats: QueueStats{Workers: workers}}
+	for i := range q.queues {
+		q.queues[i] = make([]queuedWork, 0, size)
 	}
+	q.cond = sync.NewCond(&q.mutex)
+	return q
 }
 
+// Queue queues work with resources priority.
 func (q *WorkQueue) Queue(work WorkFunc) {
+	q.QueuePriority(PriorityResources, work)
+}
+
+// QueuePriority queues work with priority. Work runs after all queued work
+// with higher priority started.
+func (q *WorkQueue) QueuePriority(priority Priority, work WorkFunc) {
+	q.QueueLimited(priority, nil, work)
+}
+
+// QueueLimited queues work with priority, limited by limiter. The work takes
+// a limiter slot when it starts, and must release it by calling Release,
+// possibly after the work returned. If limiter is nil, the work is not
+// limited.
+func (q *WorkQueue) QueueLimited(priority Priority, limiter *Limiter, work WorkFunc) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	// Work queued after stopping is dropped.
+	if q.stopped {
+		return
+	}
+
 	q.wg.Add(1)
-	q.queue <- work
+	q.queues[priority] = append(q.queues[priority], queuedWork{work: work, limiter: limiter})
+	q.stats.Queued++
+	q.stats.Pending++
+	q.stats.MaxPending = max(q.stats.MaxPending, q.stats.Pending)
+	q.cond.Signal()
+}
+
+// Stop drops queued work and rejects new work. Work already running is not
+// affected; use Wait to wait until it is done.
+func (q *WorkQueue) Stop() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.stopped = true
+
+	for p := range q.queues {
+		for i := range q.queues[p] {
+			q.queues[p][i] = queuedWork{}
+			q.wg.Done()
+		}
+		q.stats.Dropped += len(q.queues[p])
+		q.stats.Pending -= len(q.queues[p])
+		q.queues[p] = q.queues[p][:0]
+	}
 }
 
 func (q *WorkQueue) Start() {
 	for i := 0; i < q.workers; i++ {
 		go func() {
-			for work := range q.queue {
-				err := work()
-				if err != nil {
-					q.setFirstError(err)
+			for {
+				work, ok := q.next()
+				if !ok {
+					return
 				}
+				err := work()
+				q.done(err)
 				q.wg.Done()
 			}
 		}()
 	}
 }
 
+// Restart starts the queue again after Wait returned, running queued work
+// using workers, so more work can run after the queue was drained.
+func (q *WorkQueue) Restart(workers int) {
+	q.mutex.Lock()
+	q.closed = false
+	q.workers = workers
+	q.stats.Workers = workers
+	q.mutex.Unlock()
+
+	q.Start()
+}
+
+// Wait waits until all queued work is done and stops the workers.
 func (q *WorkQueue) Wait() error {
 	q.wg.Wait()
+
+	q.mutex.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+
 	return q.firstError()
 }
 
-func (q *WorkQueue) firstError() error {
+func (q *WorkQueue) next() (WorkFunc, bool) {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
-	return q.err
+
+	for {
+		for p := range q.queues {
+			for i, w := range q.queues[p] {
+				// Try the next work, waiting until a slot is released.
+				if w.limiter.full() {
+					continue
+				}
+				if w.limiter != nil {
+					w.limiter.running++
+				}
+				q.queues[p] = slices.Delete(q.queues[p], i, i+1)
+				q.stats.Pending--
+				q.stats.Running++
+				return w.work, true
+			}
+		}
+
+		if q.closed {
+			return nil, false
+		}
+
+		q.cond.Wait()
+	}
+}
+
+// Release releases a limiter slot taken by work queued with QueueLimited,
+// allowing waiting work to start.
+func (q *WorkQueue) Release(limiter *Limiter) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	limiter.running--
+	q.cond.Broadcast()
+}
+
+// Stats returns the current queue statistics.
+func (q *WorkQueue) Stats() QueueStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.stats
 }
 
-func (q *WorkQueue) setFirstError(err error) {
+func (q *WorkQueue) done(err error) {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
-	if q.err == nil {
+	q.stats.Running--
+	q.stats.Completed++
+	if err != nil && q.err == nil {
 		q.err = err
 	}
 }
+
+func (q *WorkQueue) firstError() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.err
+}
@@ -0,0 +1,491 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/nirs/kubectl-gather/pkg/gather"
+)
+
+const (
+	managedByLabel = "app.kubernetes.io/managed-by"
+	gatherLabel    = Group + "/gather"
+	managerName    = "kubectl-gather"
+
+	// Mount point of the destination volume in the gather job.
+	dataDir = "/gather"
+)
+
+type Options struct {
+	// Image used to run the gather jobs.
+	Image string
+
+	// ServiceAccount used by the gather jobs. It must be allowed to get, list
+	// and watch all resources, and to create pods if addons need agent pods.
+	ServiceAccount string
+
+	// Namespace to watch. If empty, watch all namespaces.
+	Namespace string
+
+	Log *zap.SugaredLogger
+}
+
+// Operator reconciles Gather resources by running a gather job for every
+// Gather, and reporting the job progress in the Gather status.
+type Operator struct {
+	dynamic dynamic.Interface
+	client  kubernetes.Interface
+	opts    *Options
+	log     *zap.SugaredLogger
+	queue   workqueue.TypedRateLimitingInterface[cache.ObjectName]
+	gathers cache.GenericLister
+}
+
+func New(config *rest.Config, opts Options) (*Operator, error) {
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Operator{
+		dynamic: dynamicClient,
+		client:  client,
+		opts:    &opts,
+		log:     opts.Log,
+		queue: workqueue.NewTypedRateLimitingQueue(
+			workqueue.DefaultTypedControllerRateLimiter[cache.ObjectName]()),
+	}, nil
+}
+
+// Run watches Gather resources and gather jobs until the context is done.
+func (o *Operator) Run(ctx context.Context) error {
+	defer o.queue.ShutDown()
+
+	gatherFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(
+		o.dynamic, 0, o.opts.Namespace, nil)
+	gatherInformer := gatherFactory.ForResource(GatherResource)
+	o.gathers = gatherInformer.Lister()
+
+	_, err := gatherInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    o.enqueueGather,
+		UpdateFunc: func(_, obj interface{}) { o.enqueueGather(obj) },
+	})
+	if err != nil {
+		return err
+	}
+
+	jobFactory := informers.NewSharedInformerFactoryWithOptions(
+		o.client, 0,
+		informers.WithNamespace(o.opts.Namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = managedByLabel + "=" + managerName
+		}),
+	)
+	jobInformer := jobFactory.Batch().V1().Jobs()
+
+	_, err = jobInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    o.enqueueJobOwner,
+		UpdateFunc: func(_, obj interface{}) { o.enqueueJobOwner(obj) },
+	})
+	if err != nil {
+		return err
+	}
+
+	gatherFactory.Start(ctx.Done())
+	jobFactory.Start(ctx.Done())
+
+	o.log.Info("Waiting for caches to sync")
+	gatherFactory.WaitForCacheSync(ctx.Done())
+	jobFactory.WaitForCacheSync(ctx.Done())
+
+	o.log.Info("Starting reconcile loop")
+	go func() {
+		for o.processNextItem(ctx) {
+		}
+	}()
+
+	<-ctx.Done()
+	o.log.Info("Operator stopped")
+	return nil
+}
+
+func (o *Operator) enqueueGather(obj interface{}) {
+	name, err := cache.ObjectToName(obj)
+	if err != nil {
+		o.log.Warnf("Cannot get gather name: %s", err)
+		return
+	}
+	o.queue.Add(name)
+}
+
+func (o *Operator) enqueueJobOwner(obj interface{}) {
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		return
+	}
+	if name, ok := job.Labels[gatherLabel]; ok {
+		o.queue.Add(cache.NewObjectName(job.Namespace, name))
+	}
+}
+
+func (o *Operator) processNextItem(ctx context.Context) bool {
+	name, quit := o.queue.Get()
+	if quit {
+		return false
+	}
+
+	defer o.queue.Done(name)
+
+	if err := o.reconcile(ctx, name); err != nil {
+		o.log.Warnf("Cannot reconcile gather %q: %s", name, err)
+		o.queue.AddRateLimited(name)
+		return true
+	}
+
+	o.queue.Forget(name)
+	return true
+}
+
+func (o *Operator) reconcile(ctx context.Context, name cache.ObjectName) error {
+	obj, err := o.gathers.ByNamespace(name.Namespace).Get(name.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Deleted, the job is deleted by the garbage collector.
+			return nil
+		}
+		return err
+	}
+
+	u := obj.(*unstructured.Unstructured).DeepCopy()
+
+	var g Gather
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &g); err != nil {
+		return err
+	}
+
+	if g.Status.Finished() {
+		return nil
+	}
+
+	status := g.Status.DeepCopy()
+
+	if err := validateSpec(&g.Spec); err != nil {
+		status.Phase = PhaseFailed
+		status.Message = err.Error()
+		return o.updateStatus(ctx, u, status)
+	}
+
+	job, err := o.client.BatchV1().Jobs(g.Namespace).
+		Get(ctx, jobName(&g), metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+
+		o.log.Infof("Starting gather %q", name)
+		job, err = o.client.BatchV1().Jobs(g.Namespace).
+			Create(ctx, o.newJob(&g), metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	updateStatusFromJob(status, &g, job)
+
+	if status.Finished() {
+		o.log.Infof("Gather %q %s", name, strings.ToLower(string(status.Phase)))
+	}
+
+	return o.updateStatus(ctx, u, status)
+}
+
+func (o *Operator) updateStatus(ctx context.Context, u *unstructured.Unstructured, status *GatherStatus) error {
+	value, err := runtime.DefaultUnstructuredConverter.ToUnstructured(status)
+	if err != nil {
+		return err
+	}
+
+	if err := unstructured.SetNestedMap(u.Object, value, "status"); err != nil {
+		return err
+	}
+
+	_, err = o.dynamic.Resource(GatherResource).
+		Namespace(u.GetNamespace()).
+		UpdateStatus(ctx, u, metav1.UpdateOptions{})
+	return err
+}
+
+func (o *Operator) newJob(g *Gather) *batchv1.Job {
+	backoffLimit := int32(0)
+	controller := true
+
+	labels := map[string]string{
+		managedByLabel: managerName,
+		gatherLabel:    g.Name,
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName(g),
+			Namespace: g.Namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: GatherResource.GroupVersion().String(),
+					Kind:       "Gather",
+					Name:       g.Name,
+					UID:        g.UID,
+					Controller: &controller,
+				},
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       o.newPodSpec(g),
+			},
+		},
+	}
+}
+
+// newPodSpec returns the spec of the gather job pod. With a PVC destination
+// the gather container writes directly to the volume. With an S3 destination
+// the gather runs in an init container writing an archive to a temporary
+// volume, and the upload container uploads the archive to the bucket.
+func (o *Operator) newPodSpec(g *Gather) corev1.PodSpec {
+	mounts := []corev1.VolumeMount{
+		{Name: "data", MountPath: dataDir},
+	}
+
+	spec := corev1.PodSpec{
+		ServiceAccountName: o.opts.ServiceAccount,
+		RestartPolicy:      corev1.RestartPolicyNever,
+	}
+
+	if s3 := g.Spec.Destination.S3; s3 != nil {
+		archive := path.Join(dataDir, g.Name+".tar.gz")
+		args := append(gatherArgs(g, path.Join(dataDir, g.Name)), "--output="+archive)
+
+		spec.InitContainers = []corev1.Container{
+			{
+				Name:    "gather",
+				Image:   o.opts.Image,
+				Command: []string{"kubectl-gather"},
+				Args:    args,
+				// Keep the temporary gather directory in the volume.
+				Env:          []corev1.EnvVar{{Name: "TMPDIR", Value: dataDir}},
+				VolumeMounts: mounts,
+			},
+		}
+		spec.Containers = []corev1.Container{
+			{
+				Name:    "upload",
+				Image:   o.opts.Image,
+				Command: []string{"kubectl-gather", "operator", "upload-s3"},
+				Args: []string{
+					"--endpoint=" + s3.Endpoint,
+					"--region=" + s3.Region,
+					"--bucket=" + s3.Bucket,
+					"--key=" + s3Key(g),
+					"--file=" + archive,
+				},
+				Env: []corev1.EnvVar{
+					secretEnv(S3AccessKeyIDKey, s3.SecretName),
+					secretEnv(S3SecretAccessKeyKey, s3.SecretName),
+				},
+				VolumeMounts: mounts,
+			},
+		}
+		spec.Volumes = []corev1.Volume{
+			{
+				Name:         "data",
+				VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+			},
+		}
+		return spec
+	}
+
+	spec.Containers = []corev1.Container{
+		{
+			Name:         "gather",
+			Image:        o.opts.Image,
+			Command:      []string{"kubectl-gather"},
+			Args:         gatherArgs(g, path.Join(dataDir, destinationPath(g))),
+			VolumeMounts: mounts,
+		},
+	}
+	spec.Volumes = []corev1.Volume{
+		{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: g.Spec.Destination.PVC.ClaimName,
+				},
+			},
+		},
+	}
+	return spec
+}
+
+// gatherArgs returns the arguments of the gather command storing the data in
+// directory.
+func gatherArgs(g *Gather, directory string) []string {
+	args := []string{"--directory=" + directory}
+	if len(g.Spec.Namespaces) > 0 {
+		args = append(args, "--namespaces="+strings.Join(g.Spec.Namespaces, ","))
+	}
+	if g.Spec.Addons != nil {
+		args = append(args, "--addons="+strings.Join(g.Spec.Addons, ","))
+	}
+	if g.Spec.AllowAgents {
+		args = append(args, "--allow-agents")
+	}
+	return args
+}
+
+// secretEnv returns an environment variable set from key in secret.
+func secretEnv(key string, secret string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: key,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secret},
+				Key:                  key,
+			},
+		},
+	}
+}
+
+func updateStatusFromJob(status *GatherStatus, g *Gather, job *batchv1.Job) {
+	if status.Phase == "" {
+		status.Phase = PhasePending
+	}
+
+	if status.Location == "" {
+		status.Location = location(g)
+	}
+
+	if job.Status.StartTime != nil && status.StartTime == nil {
+		status.StartTime = job.Status.StartTime
+	}
+
+	if job.Status.Active > 0 {
+		status.Phase = PhaseRunning
+		status.Message = "Gathering data"
+	}
+
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+
+		switch c.Type {
+		case batchv1.JobComplete:
+			status.Phase = PhaseSucceeded
+			status.Message = "Gathering completed"
+		case batchv1.JobFailed:
+			status.Phase = PhaseFailed
+			status.Message = fmt.Sprintf("Gather job failed: %s", c.Message)
+		default:
+			continue
+		}
+
+		completionTime := metav1.NewTime(time.Now())
+		if job.Status.CompletionTime != nil {
+			completionTime = *job.Status.CompletionTime
+		}
+		status.CompletionTime = &completionTime
+		return
+	}
+}
+
+func validateSpec(spec *GatherSpec) error {
+	if err := validateDestination(&spec.Destination); err != nil {
+		return err
+	}
+
+	// Agent addons are disabled by default, but enabling them explicitly
+	// would fail the gather job.
+	if !spec.AllowAgents {
+		for _, name := range spec.Addons {
+			if slices.Contains(gather.AgentAddons(), name) {
+				return fmt.Errorf("addon %q creates agent pods or runs commands in pods, requires allowAgents", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateDestination(d *Destination) error {
+	switch {
+	case d.PVC != nil && d.S3 != nil:
+		return fmt.Errorf("destination must specify either pvc or s3")
+	case d.PVC != nil:
+		if d.PVC.ClaimName == "" {
+			return fmt.Errorf("destination pvc claimName is required")
+		}
+	case d.S3 != nil:
+		if d.S3.Endpoint == "" || d.S3.Bucket == "" || d.S3.SecretName == "" {
+			return fmt.Errorf("destination s3 endpoint, bucket, and secretName are required")
+		}
+	default:
+		return fmt.Errorf("destination pvc or s3 is required")
+	}
+
+	return nil
+}
+
+// location returns the location of the gathered data reported in the status.
+func location(g *Gather) string {
+	if s3 := g.Spec.Destination.S3; s3 != nil {
+		return fmt.Sprintf("s3://%s/%s", s3.Bucket, s3Key(g))
+	}
+	return fmt.Sprintf("pvc://%s/%s", g.Spec.Destination.PVC.ClaimName, destinationPath(g))
+}
+
+func destinationPath(g *Gather) string {
+	if g.Spec.Destination.PVC.Path != "" {
+		return g.Spec.Destination.PVC.Path
+	}
+	return g.Name
+}
+
+func s3Key(g *Gather) string {
+	if g.Spec.Destination.S3.Key != "" {
+		return g.Spec.Destination.S3.Key
+	}
+	return g.Name + ".tar.gz"
+}
+
+func jobName(g *Gather) string {
+	return "gather-" + g.Name
+}
@@ -0,0 +1,310 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package operator
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestGather(t *testing.T, spec GatherSpec, status GatherStatus) *unstructured.Unstructured {
+	g := &Gather{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: GatherResource.GroupVersion().String(),
+			Kind:       "Gather",
+		},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "my-app", Name: "my-gather", UID: "my-uid"},
+		Spec:       spec,
+		Status:     status,
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &unstructured.Unstructured{Object: obj}
+}
+
+func newTestOperator(t *testing.T, gather *unstructured.Unstructured, objects ...runtime.Object) *Operator {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(gather); err != nil {
+		t.Fatal(err)
+	}
+
+	dynamicClient := fakedynamic.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{GatherResource: "GatherList"}, gather)
+
+	return &Operator{
+		dynamic: dynamicClient,
+		client:  fake.NewSimpleClientset(objects...),
+		opts:    &Options{Image: "gather:test", ServiceAccount: "kubectl-gather"},
+		log:     zap.NewNop().Sugar(),
+		gathers: cache.NewGenericLister(indexer, GatherResource.GroupResource()),
+	}
+}
+
+func reconcileGather(t *testing.T, o *Operator) *Gather {
+	ctx := context.Background()
+	if err := o.reconcile(ctx, cache.NewObjectName("my-app", "my-gather")); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := o.dynamic.Resource(GatherResource).Namespace("my-app").Get(ctx, "my-gather", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var g Gather
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &g); err != nil {
+		t.Fatal(err)
+	}
+	return &g
+}
+
+var pvcSpec = GatherSpec{
+	Namespaces:  []string{"my-app"},
+	Destination: Destination{PVC: &PVCDestination{ClaimName: "gather-data"}},
+}
+
+func TestReconcileCreatesJob(t *testing.T) {
+	o := newTestOperator(t, newTestGather(t, pvcSpec, GatherStatus{}))
+
+	g := reconcileGather(t, o)
+	if g.Status.Phase != PhasePending || g.Status.Location != "pvc://gather-data/my-gather" {
+		t.Errorf("unexpected status %+v", g.Status)
+	}
+
+	job, err := o.client.BatchV1().Jobs("my-app").Get(context.Background(), "gather-my-gather", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Labels[gatherLabel] != "my-gather" {
+		t.Errorf("unexpected labels %v", job.Labels)
+	}
+	if owner := job.OwnerReferences[0]; owner.Name != "my-gather" || owner.UID != "my-uid" {
+		t.Errorf("unexpected owner %+v", owner)
+	}
+	args := job.Spec.Template.Spec.Containers[0].Args
+	expected := []string{"--directory=/gather/my-gather", "--namespaces=my-app"}
+	if !slices.Equal(args, expected) {
+		t.Errorf("expected args %q, got %q", expected, args)
+	}
+}
+
+func TestReconcileJobCompleted(t *testing.T) {
+	completed := metav1.NewTime(time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC))
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "my-app", Name: "gather-my-gather"},
+		Status: batchv1.JobStatus{
+			CompletionTime: &completed,
+			Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+			},
+		},
+	}
+	o := newTestOperator(t, newTestGather(t, pvcSpec, GatherStatus{Phase: PhaseRunning}), job)
+
+	g := reconcileGather(t, o)
+	if g.Status.Phase != PhaseSucceeded || !g.Status.CompletionTime.Equal(&completed) {
+		t.Errorf("unexpected status %+v", g.Status)
+	}
+}
+
+func TestReconcileInvalidSpec(t *testing.T) {
+	spec := GatherSpec{Destination: Destination{}}
+	o := newTestOperator(t, newTestGather(t, spec, GatherStatus{}))
+
+	g := reconcileGather(t, o)
+	if g.Status.Phase != PhaseFailed || g.Status.Message == "" {
+		t.Errorf("unexpected status %+v", g.Status)
+	}
+
+	_, err := o.client.BatchV1().Jobs("my-app").Get(context.Background(), "gather-my-gather", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("job created for invalid spec: %v", err)
+	}
+}
+
+func TestReconcileFinished(t *testing.T) {
+	o := newTestOperator(t, newTestGather(t, pvcSpec, GatherStatus{Phase: PhaseSucceeded}))
+
+	reconcileGather(t, o)
+
+	_, err := o.client.BatchV1().Jobs("my-app").Get(context.Background(), "gather-my-gather", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("job created for finished gather: %v", err)
+	}
+}
+
+func TestUpdateStatusFromJob(t *testing.T) {
+	started := metav1.NewTime(time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC))
+	completed := metav1.NewTime(started.Add(time.Minute))
+
+	cases := []struct {
+		name      string
+		job       batchv1.JobStatus
+		phase     GatherPhase
+		message   string
+		completed bool
+	}{
+		{
+			name:  "pending",
+			job:   batchv1.JobStatus{},
+			phase: PhasePending,
+		},
+		{
+			name:    "running",
+			job:     batchv1.JobStatus{Active: 1, StartTime: &started},
+			phase:   PhaseRunning,
+			message: "Gathering data",
+		},
+		{
+			name: "succeeded",
+			job: batchv1.JobStatus{
+				StartTime:      &started,
+				CompletionTime: &completed,
+				Conditions: []batchv1.JobCondition{
+					{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+				},
+			},
+			phase:     PhaseSucceeded,
+			message:   "Gathering completed",
+			completed: true,
+		},
+		{
+			name: "failed",
+			job: batchv1.JobStatus{
+				StartTime: &started,
+				Conditions: []batchv1.JobCondition{
+					{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"},
+				},
+			},
+			phase:     PhaseFailed,
+			message:   "Gather job failed: BackoffLimitExceeded",
+			completed: true,
+		},
+		{
+			name: "condition not true",
+			job: batchv1.JobStatus{
+				Active: 1,
+				Conditions: []batchv1.JobCondition{
+					{Type: batchv1.JobFailed, Status: corev1.ConditionFalse},
+				},
+			},
+			phase:   PhaseRunning,
+			message: "Gathering data",
+		},
+	}
+
+	g := &Gather{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-gather"},
+		Spec:       pvcSpec,
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status := &GatherStatus{}
+			updateStatusFromJob(status, g, &batchv1.Job{Status: c.job})
+			if status.Phase != c.phase || status.Message != c.message {
+				t.Errorf("unexpected status %+v", status)
+			}
+			if status.Location != "pvc://gather-data/my-gather" {
+				t.Errorf("unexpected location %q", status.Location)
+			}
+			if c.job.StartTime != nil && status.StartTime == nil {
+				t.Error("start time not set")
+			}
+			if c.completed != (status.CompletionTime != nil) {
+				t.Errorf("unexpected completion time %v", status.CompletionTime)
+			}
+		})
+	}
+}
+
+func TestNewJobS3(t *testing.T) {
+	spec := GatherSpec{
+		Destination: Destination{S3: &S3Destination{
+			Endpoint:   "https://s3.example.com",
+			Bucket:     "gathers",
+			SecretName: "s3-secret",
+		}},
+	}
+	u := newTestGather(t, spec, GatherStatus{})
+	o := newTestOperator(t, u)
+
+	var g Gather
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &g); err != nil {
+		t.Fatal(err)
+	}
+
+	if loc := location(&g); loc != "s3://gathers/my-gather.tar.gz" {
+		t.Errorf("unexpected location %q", loc)
+	}
+
+	pod := o.newJob(&g).Spec.Template.Spec
+
+	if len(pod.InitContainers) != 1 || len(pod.Containers) != 1 {
+		t.Fatalf("unexpected containers %+v", pod)
+	}
+	if pod.Volumes[0].EmptyDir == nil {
+		t.Errorf("unexpected volume %+v", pod.Volumes[0])
+	}
+
+	gatherArgs := pod.InitContainers[0].Args
+	if !slices.Contains(gatherArgs, "--output=/gather/my-gather.tar.gz") {
+		t.Errorf("gather does not write an archive: %q", gatherArgs)
+	}
+
+	upload := pod.Containers[0]
+	if !slices.Contains(upload.Args, "--key=my-gather.tar.gz") || !slices.Contains(upload.Args, "--file=/gather/my-gather.tar.gz") {
+		t.Errorf("unexpected upload args %q", upload.Args)
+	}
+	for _, env := range upload.Env {
+		ref := env.ValueFrom.SecretKeyRef
+		if ref.Name != "s3-secret" || ref.Key != env.Name {
+			t.Errorf("unexpected env %+v", env)
+		}
+	}
+}
+
+func TestValidateSpec(t *testing.T) {
+	pvc := &PVCDestination{ClaimName: "gather-data"}
+	s3 := &S3Destination{Endpoint: "https://s3.example.com", Bucket: "gathers", SecretName: "s3-secret"}
+
+	cases := []struct {
+		name  string
+		spec  GatherSpec
+		valid bool
+	}{
+		{"pvc", GatherSpec{Destination: Destination{PVC: pvc}}, true},
+		{"s3", GatherSpec{Destination: Destination{S3: s3}}, true},
+		{"no destination", GatherSpec{}, false},
+		{"both destinations", GatherSpec{Destination: Destination{PVC: pvc, S3: s3}}, false},
+		{"s3 without secret", GatherSpec{Destination: Destination{S3: &S3Destination{Endpoint: "https://s3.example.com", Bucket: "gathers"}}}, false},
+		{"agent addon", GatherSpec{Addons: []string{"rook"}, Destination: Destination{PVC: pvc}}, false},
+		{"agent addon allowed", GatherSpec{Addons: []string{"rook"}, AllowAgents: true, Destination: Destination{PVC: pvc}}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateSpec(&c.spec)
+			if c.valid != (err == nil) {
+				t.Errorf("unexpected result: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package operator
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Keys in the S3 credentials secret, the same keys used by Ramen and
+	// Velero.
+	S3AccessKeyIDKey     = "AWS_ACCESS_KEY_ID"
+	S3SecretAccessKeyKey = "AWS_SECRET_ACCESS_KEY"
+
+	// Region used when the destination does not specify a region. Most S3
+	// compatible object stores ignore the region.
+	defaultS3Region = "us-east-1"
+
+	s3Algorithm = "AWS4-HMAC-SHA256"
+	s3Service   = "s3"
+	amzDateISO  = "20060102T150405Z"
+	amzDate     = "20060102"
+)
+
+// S3Upload describes an object uploaded to an S3 bucket.
+type S3Upload struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	Key             string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// UploadS3 uploads file to the bucket, using a single PUT request signed
+// with AWS signature version 4. The bucket is addressed using path style
+// URLs (endpoint/bucket/key), supported by AWS and S3 compatible object
+// stores.
+func UploadS3(ctx context.Context, u *S3Upload, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	// The payload hash is part of the signature, so the file is read twice.
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	endpoint, err := url.Parse(u.Endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint %q: %s", u.Endpoint, err)
+	}
+
+	target := *endpoint
+	target.Path = "/" + u.Bucket + "/" + u.Key
+	target.RawPath = "/" + uriEncode(u.Bucket, false) + "/" + uriEncode(u.Key, false)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target.String(), f)
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/gzip")
+	signS3Request(req, u, hex.EncodeToString(h.Sum(nil)), time.Now())
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("cannot upload to s3://%s/%s: %s: %s",
+			u.Bucket, u.Key, res.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// signS3Request adds the AWS signature version 4 authorization header to req.
+// All headers set on the request are signed.
+func signS3Request(req *http.Request, u *S3Upload, payloadHash string, now time.Time) {
+	region := u.Region
+	if region == "" {
+		region = defaultS3Region
+	}
+
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(amzDateISO))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{now.Format(amzDate), region, s3Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format(amzDateISO),
+		scope,
+		hexSHA256(canonicalRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+u.SecretAccessKey), now.Format(amzDate))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, u.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// uriEncode encodes s as required by the signature. Unreserved characters
+// are kept, and "/" is kept unless encodeSlash is true.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
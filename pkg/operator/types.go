@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: The kubectl-gather authors
+// SPDX-License-Identifier: Apache-2.0
+
+package operator
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	Group   = "gather.nirs.github.io"
+	Version = "v1alpha1"
+)
+
+// GatherResource is the resource of the Gather custom resource, defined in
+// config/operator.yaml.
+var GatherResource = schema.GroupVersionResource{
+	Group:    Group,
+	Version:  Version,
+	Resource: "gathers",
+}
+
+type GatherPhase string
+
+const (
+	PhasePending   = GatherPhase("Pending")
+	PhaseRunning   = GatherPhase("Running")
+	PhaseSucceeded = GatherPhase("Succeeded")
+	PhaseFailed    = GatherPhase("Failed")
+)
+
+type Gather struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GatherSpec   `json:"spec"`
+	Status GatherStatus `json:"status,omitempty"`
+}
+
+type GatherSpec struct {
+	// Namespaces to gather. If empty, gather all namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Addons to enable. If not set, enable all addons. If set to an empty
+	// list, disable all addons.
+	Addons []string `json:"addons,omitempty"`
+
+	// AllowAgents allows addons creating agent pods or running commands in
+	// pods. If not set, such addons are disabled.
+	AllowAgents bool `json:"allowAgents,omitempty"`
+
+	// Destination for the gathered data.
+	Destination Destination `json:"destination"`
+}
+
+// Destination for the gathered data. Exactly one destination must be set.
+type Destination struct {
+	PVC *PVCDestination `json:"pvc,omitempty"`
+	S3  *S3Destination  `json:"s3,omitempty"`
+}
+
+type PVCDestination struct {
+	// ClaimName is the name of a persistent volume claim in the namespace of
+	// the Gather resource.
+	ClaimName string `json:"claimName"`
+
+	// Path is the directory in the volume for storing the gathered data. If
+	// not set the name of the Gather resource is used.
+	Path string `json:"path,omitempty"`
+}
+
+// S3Destination uploads the gathered data as a gzip compressed tar archive
+// to an S3 bucket.
+type S3Destination struct {
+	// Endpoint is the URL of the object store (e.g.
+	// https://s3.us-east-1.amazonaws.com).
+	Endpoint string `json:"endpoint"`
+
+	// Region of the bucket. If not set "us-east-1" is used.
+	Region string `json:"region,omitempty"`
+
+	Bucket string `json:"bucket"`
+
+	// Key is the object key of the archive. If not set "{name}.tar.gz" is
+	// used, where name is the name of the Gather resource.
+	Key string `json:"key,omitempty"`
+
+	// SecretName is the name of a secret in the namespace of the Gather
+	// resource, with the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY keys.
+	SecretName string `json:"secretName"`
+}
+
+type GatherStatus struct {
+	Phase          GatherPhase  `json:"phase,omitempty"`
+	Location       string       `json:"location,omitempty"`
+	Message        string       `json:"message,omitempty"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+func (s *GatherStatus) Finished() bool {
+	return s.Phase == PhaseSucceeded || s.Phase == PhaseFailed
+}
+
+func (s *GatherStatus) DeepCopy() *GatherStatus {
+	c := *s
+	if s.StartTime != nil {
+		c.StartTime = s.StartTime.DeepCopy()
+	}
+	if s.CompletionTime != nil {
+		c.CompletionTime = s.CompletionTime.DeepCopy()
+	}
+	return &c
+}